@@ -5,8 +5,12 @@ import (
 	"sync"
 )
 
+var SystemName = "Account System"
+var ServerAddress = "http://localhost:3000" // 對外訪問地址，用於生成第三方登入回調地址
+
 var SessionSecret = uuid.New().String()
 var CryptoSecret = uuid.New().String()
+var TokenHashSecret = "" // 令牌哈希密鑰，修改後已有的令牌全部失效
 
 var OptionMap map[string]string
 var OptionMapRWMutex sync.RWMutex
@@ -16,6 +20,79 @@ var PasswordRegisterEnabled = true
 var EmailVerificationEnabled = false
 var RegisterEnabled = true
 
+// SMTP 郵件配置
+var SMTPServer = ""
+var SMTPPort = 587
+var SMTPAccount = ""
+var SMTPToken = ""
+var SMTPFrom = "" // 發件人地址，為空時使用 SMTPAccount
+
+// 郵件驗證碼配置
+var VerificationCodeLifetime int64 = 10 * 60  // 驗證碼有效期（秒）
+var VerificationCodeMaxAttempts = 5           // 單個驗證碼允許的最大嘗試次數，超過後作廢
+var VerificationCodeResendCooldown int64 = 60 // 同一郵箱重新發送驗證碼的最短間隔（秒）
+
+// 密碼策略配置
+var PasswordMinLength = 8
+var PasswordMaxLength = 64 // bcrypt 只使用前 72 字節
+var PasswordRequireUppercase = false
+var PasswordRequireLowercase = false
+var PasswordRequireDigit = false
+var PasswordRequireSymbol = false
+var PasswordForbidUserInfo = true // 禁止密碼包含用戶名或郵箱
+var PasswordHistoryCount = 5      // 禁止重複使用最近 N 個密碼，0 表示不限制
+var BreachedPasswordFile = ""     // 洩露密碼庫文件，每行一個 SHA-1 哈希
+
+// 登入失敗鎖定配置，按帳號統計連續失敗次數
+var LoginLockoutEnabled = true
+var LoginFailureDelayThreshold = 3       // 連續失敗達到該次數後，每次嘗試前需要等待
+var LoginFailureBaseDelay int64 = 1      // 首次等待時間（秒），之後每失敗一次翻倍
+var LoginFailureMaxDelay int64 = 60      // 單次等待時間上限（秒）
+var LoginLockoutThreshold = 10           // 連續失敗達到該次數後臨時鎖定帳號
+var LoginLockoutDuration int64 = 15 * 60 // 臨時鎖定時長（秒），超過該時長沒有失敗記錄時計數清零
+
+// 兩步驗證配置
+var TwoFactorPendingTimeout int64 = 5 * 60 // 密碼驗證通過後，等待輸入驗證碼的最長時間（秒）
+var TwoFactorMaxAttempts = 5               // 單次登入允許輸入驗證碼的最大次數
+var TwoFactorRecoveryCodeCount = 10        // 每次生成的恢復碼數量
+
+// 通行密鑰（WebAuthn）配置
+var PasskeyLoginEnabled = true
+var WebAuthnRPID = ""          // 依賴方 ID，通常為站點域名，不含協議和端口
+var WebAuthnRPOrigins []string // 允許的來源，例如 https://account.example.com
+
+// OAuth2 / OpenID Connect 身份提供方配置，時間單位均為秒
+var OAuth2AuthorizationCodeLifetime int64 = 60                 // 授權碼有效期
+var OAuth2AccessTokenLifetime int64 = 60 * 60                  // access token 和 id_token 有效期
+var OAuth2RefreshTokenLifetime int64 = 30 * 24 * 60 * 60       // refresh token 有效期
+var OAuth2SigningKeyRotationInterval int64 = 30 * 24 * 60 * 60 // 簽名密鑰輪換間隔
+
+// 信任的反向代理，只有來自這些地址的請求才使用 X-Forwarded-For 等請求頭中的客戶端 IP；
+// 默認只信任本機，部署在其他反向代理之後時需要通過 TRUSTED_PROXIES 明確指定
+var TrustedProxies = []string{"127.0.0.1", "::1"}
+
+// 令牌使用記錄配置
+var TokenUsageRetentionDays = 30 // 使用記錄保留天數，0 表示永久保留
+
+// 後台任務配置
+var TokenSweepInterval = 300  // 將過期和額度用盡的令牌標記為對應狀態的間隔 (秒)
+var TokenExpiryNoticeDays = 7 // 令牌過期前多少天發送提醒郵件，0 表示不提醒
+
+// 令牌有效期配置，按令牌所有者的角色限制最長有效期 (天)，0 表示不限制
+var TokenMaxLifetimeUser = 0
+var TokenMaxLifetimeAdmin = 0
+var TokenMaxLifetimeRoot = 0
+var TokenLifetimePolicy = TokenLifetimePolicyReject // 超出最長有效期時拒絕或縮短
+
+const (
+	TokenLifetimePolicyReject = "reject"
+	TokenLifetimePolicyClamp  = "clamp"
+)
+
+// 令牌輪換配置，時間單位均為秒
+var TokenRotationGracePeriod int64 = 24 * 60 * 60         // 默認寬限期，期間舊密鑰仍然有效
+var TokenRotationMaxGracePeriod int64 = 30 * 24 * 60 * 60 // 允許指定的最長寬限期
+
 var EmailDomainRestrictionEnabled = false // 是否啟用郵箱域名限制
 var EmailAliasRestrictionEnabled = false  // 是否啟用郵箱別名限制
 var EmailDomainWhitelist = []string{
@@ -41,6 +118,52 @@ func IsValidateRole(role int) bool {
 	return role == RoleGuestUser || role == RoleCommonUser || role == RoleAdminUser || role == RoleRootUser
 }
 
+// 權限，由角色授予，路由通過 RequirePermission 聲明所需權限
+const (
+	PermissionAll        = "*" // 所有權限，只授予內置的超級管理員角色
+	PermissionUserRead   = "user.read"
+	PermissionUserCreate = "user.create"
+	PermissionUserUpdate = "user.update" // 修改資料、解除鎖定、重置兩步驗證
+	PermissionUserManage = "user.manage" // 啟用、禁用、升降級、分配角色、撤銷會話
+	PermissionUserDelete = "user.delete"
+	PermissionRoleRead   = "role.read"
+	PermissionRoleManage = "role.manage"
+
+	PermissionTokenManage      = "token.manage" // 查看和管理所有用戶的令牌
+	PermissionQuotaManage      = "quota.manage" // 扣減、退還和調整令牌與組織額度，設置令牌的初始額度和無限額度
+	PermissionRedemptionManage = "redemption.manage"
+	PermissionGroupManage      = "group.manage"
+	PermissionOAuth2Manage     = "oauth2.manage" // 管理 OAuth2 應用
+	PermissionUsageRead        = "usage.read"    // 查詢所有令牌的使用記錄
+)
+
+// Permissions 所有可以授予的權限
+var Permissions = []string{
+	PermissionUserRead,
+	PermissionUserCreate,
+	PermissionUserUpdate,
+	PermissionUserManage,
+	PermissionUserDelete,
+	PermissionRoleRead,
+	PermissionRoleManage,
+	PermissionTokenManage,
+	PermissionQuotaManage,
+	PermissionRedemptionManage,
+	PermissionGroupManage,
+	PermissionOAuth2Manage,
+	PermissionUsageRead,
+}
+
+// IsValidPermission 檢查權限名稱是否有效
+func IsValidPermission(permission string) bool {
+	for _, p := range Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
 // All duration's unit is seconds
 // Shouldn't larger then RateLimitKeyExpirationDuration
 var (
@@ -61,6 +184,11 @@ const (
 	UserStatusDisabled = 2 // also don't use 0
 )
 
+const (
+	OAuth2ClientStatusEnabled  = 1 // don't use 0, 0 is the default value!
+	OAuth2ClientStatusDisabled = 2 // also don't use 0
+)
+
 const (
 	TokenStatusEnabled   = 1 // don't use 0, 0 is the default value!
 	TokenStatusDisabled  = 2 // also don't use 0
@@ -68,6 +196,51 @@ const (
 	TokenStatusExhausted = 4
 )
 
+const (
+	RedemptionCodeStatusEnabled  = 1 // don't use 0, 0 is the default value!
+	RedemptionCodeStatusDisabled = 2 // also don't use 0
+)
+
+// 內置的令牌權限範圍，也可以使用自定義的「服務:操作」格式範圍
+const (
+	TokenScopeUserRead     = "user:read"
+	TokenScopeTokenRead    = "token:read"
+	TokenScopeTokenWrite   = "token:write"
+	TokenScopeQuotaConsume = "quota:consume"
+)
+
+// 額度流水類型
+const (
+	QuotaLedgerTypeConsume = "consume"
+	QuotaLedgerTypeRefund  = "refund"
+	QuotaLedgerTypeAdjust  = "adjust"
+	QuotaLedgerTypeRedeem  = "redeem"
+	QuotaLedgerTypeGrant   = "grant"
+)
+
+// 組織成員角色
+const (
+	OrganizationRoleOwner  = "owner"
+	OrganizationRoleAdmin  = "admin"
+	OrganizationRoleMember = "member"
+)
+
+// OrganizationRoleRank 返回組織角色的權限等級，無效的角色返回 0
+func OrganizationRoleRank(role string) int {
+	switch role {
+	case OrganizationRoleOwner:
+		return 3
+	case OrganizationRoleAdmin:
+		return 2
+	case OrganizationRoleMember:
+		return 1
+	}
+	return 0
+}
+
+// DefaultUserGroup 內置的默認用戶分組，新用戶未指定分組時加入該分組
+const DefaultUserGroup = "default"
+
 // 郵件驗證用途
 const (
 	EmailVerificationPurpose = "email_verification"
@@ -0,0 +1,156 @@
+package common
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CheckEmailAddress 檢查郵箱格式，並按配置限制郵箱域名和別名
+func CheckEmailAddress(email string) error {
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return errors.New("郵箱地址格式錯誤")
+	}
+	at := strings.LastIndex(email, "@")
+	local, domain := email[:at], strings.ToLower(email[at+1:])
+	if EmailDomainRestrictionEnabled {
+		allowed := false
+		for _, d := range EmailDomainWhitelist {
+			if domain == d {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return errors.New("管理員限制了可用的郵箱域名")
+		}
+	}
+	if EmailAliasRestrictionEnabled && (strings.Contains(local, "+") || (domain == "gmail.com" && strings.Contains(local, "."))) {
+		return errors.New("管理員禁止使用郵箱別名")
+	}
+	return nil
+}
+
+// MailSender 郵件發送接口，默認通過 SMTP 發送，測試時可替換為 MemoryMailSender
+type MailSender interface {
+	Send(subject string, receiver string, content string) error
+}
+
+var mailSender MailSender = SMTPMailSender{}
+
+// SetMailSender 替換郵件發送實現
+func SetMailSender(sender MailSender) {
+	mailSender = sender
+}
+
+// SendEmail 發送 HTML 郵件
+func SendEmail(subject string, receiver string, content string) error {
+	return mailSender.Send(subject, receiver, content)
+}
+
+// Mail 已發送的郵件
+type Mail struct {
+	Subject  string
+	Receiver string
+	Content  string
+	SentTime time.Time
+}
+
+// MemoryMailSender 內存發件箱，只記錄郵件不實際發送
+type MemoryMailSender struct {
+	mutex sync.Mutex
+	mails []Mail
+}
+
+func (s *MemoryMailSender) Send(subject string, receiver string, content string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.mails = append(s.mails, Mail{Subject: subject, Receiver: receiver, Content: content, SentTime: time.Now()})
+	return nil
+}
+
+// Mails 返回發件箱中的所有郵件
+func (s *MemoryMailSender) Mails() []Mail {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]Mail(nil), s.mails...)
+}
+
+// LastMail 返回發給指定收件人的最後一封郵件
+func (s *MemoryMailSender) LastMail(receiver string) (Mail, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i := len(s.mails) - 1; i >= 0; i-- {
+		if s.mails[i].Receiver == receiver {
+			return s.mails[i], true
+		}
+	}
+	return Mail{}, false
+}
+
+// SMTPMailSender 通過 SMTP 服務器發送郵件
+type SMTPMailSender struct{}
+
+func (SMTPMailSender) Send(subject string, receiver string, content string) error {
+	if SMTPServer == "" || SMTPAccount == "" {
+		return errors.New("未配置 SMTP 服務器")
+	}
+	from := SMTPFrom
+	if from == "" {
+		from = SMTPAccount
+	}
+	encodedSubject := fmt.Sprintf("=?UTF-8?B?%s?=", base64.StdEncoding.EncodeToString([]byte(subject)))
+	message := []byte(fmt.Sprintf("To: %s\r\n"+
+		"From: %s <%s>\r\n"+
+		"Subject: %s\r\n"+
+		"Date: %s\r\n"+
+		"MIME-Version: 1.0\r\n"+
+		"Content-Type: text/html; charset=UTF-8\r\n\r\n%s\r\n",
+		receiver, SystemName, from, encodedSubject, time.Now().Format(time.RFC1123Z), content))
+	addr := net.JoinHostPort(SMTPServer, fmt.Sprint(SMTPPort))
+	auth := smtp.PlainAuth("", SMTPAccount, SMTPToken, SMTPServer)
+	if SMTPPort != 465 {
+		// 其他端口由 smtp.SendMail 自動協商 STARTTLS
+		return smtp.SendMail(addr, auth, from, strings.Split(receiver, ";"), message)
+	}
+	// 465 端口使用隱式 TLS
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: SMTPServer})
+	if err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(conn, SMTPServer)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if err = client.Auth(auth); err != nil {
+		return err
+	}
+	if err = client.Mail(from); err != nil {
+		return err
+	}
+	for _, to := range strings.Split(receiver, ";") {
+		if err = client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(message); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,58 @@
+package common
+
+import (
+	"os"
+	"strings"
+)
+
+// OIDCProvider 第三方 OpenID Connect 登入提供方配置
+type OIDCProvider struct {
+	Name         string   `json:"name"`         // 提供方標識，用於路由和身份綁定，例如 google
+	DisplayName  string   `json:"display_name"` // 顯示名稱
+	Issuer       string   `json:"-"`            // 簽發者地址，將從 {issuer}/.well-known/openid-configuration 讀取配置
+	ClientId     string   `json:"-"`
+	ClientSecret string   `json:"-"`
+	Scopes       []string `json:"-"`
+}
+
+// OIDCProviders 已啟用的 OIDC 提供方
+var OIDCProviders []OIDCProvider
+
+// GetOIDCProvider 通過名稱獲取 OIDC 提供方配置
+func GetOIDCProvider(name string) (*OIDCProvider, bool) {
+	for i := range OIDCProviders {
+		if OIDCProviders[i].Name == name {
+			return &OIDCProviders[i], true
+		}
+	}
+	return nil, false
+}
+
+// loadOIDCProviders 從環境變數加載 OIDC 提供方，
+// OIDC_PROVIDERS 列出提供方名稱，每個提供方使用 OIDC_<NAME>_* 配置
+func loadOIDCProviders() {
+	OIDCProviders = nil
+	for _, name := range GetStringSliceEnv("OIDC_PROVIDERS") {
+		name = strings.ToLower(name)
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		provider := OIDCProvider{
+			Name:         name,
+			DisplayName:  os.Getenv(prefix + "DISPLAY_NAME"),
+			Issuer:       strings.TrimSuffix(os.Getenv(prefix+"ISSUER"), "/"),
+			ClientId:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			Scopes:       GetStringSliceEnv(prefix + "SCOPES"),
+		}
+		if provider.Issuer == "" || provider.ClientId == "" {
+			SysError("OIDC provider " + name + " is missing issuer or client id, skipped")
+			continue
+		}
+		if provider.DisplayName == "" {
+			provider.DisplayName = name
+		}
+		if len(provider.Scopes) == 0 {
+			provider.Scopes = []string{"openid", "profile", "email"}
+		}
+		OIDCProviders = append(OIDCProviders, provider)
+	}
+}
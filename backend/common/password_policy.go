@@ -0,0 +1,164 @@
+package common
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 密碼策略規則名稱，用於結構化的違規信息
+const (
+	PasswordRuleMinLength = "min_length"
+	PasswordRuleMaxLength = "max_length"
+	PasswordRuleUppercase = "uppercase"
+	PasswordRuleLowercase = "lowercase"
+	PasswordRuleDigit     = "digit"
+	PasswordRuleSymbol    = "symbol"
+	PasswordRuleUserInfo  = "user_info"
+	PasswordRuleHistory   = "history"
+	PasswordRuleBreached  = "breached"
+)
+
+// PasswordViolation 違反的一條密碼規則
+type PasswordViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicyError 密碼不符合策略時返回的錯誤，包含所有違規項
+type PasswordPolicyError struct {
+	Violations []PasswordViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+	return "密碼不符合要求：" + strings.Join(messages, "；")
+}
+
+// Add 添加一條違規項
+func (e *PasswordPolicyError) Add(rule string, message string) {
+	e.Violations = append(e.Violations, PasswordViolation{Rule: rule, Message: message})
+}
+
+// OrNil 沒有違規項時返回 nil
+func (e *PasswordPolicyError) OrNil() error {
+	if len(e.Violations) == 0 {
+		return nil
+	}
+	return e
+}
+
+// CheckPasswordPolicy 按配置檢查密碼的長度、字符類別、是否包含用戶名或郵箱以及是否已洩露，
+// 歷史密碼檢查需要查詢數據庫，由 model 層完成
+func CheckPasswordPolicy(password string, username string, email string) *PasswordPolicyError {
+	result := &PasswordPolicyError{}
+	length := utf8.RuneCountInString(password)
+	if length < PasswordMinLength {
+		result.Add(PasswordRuleMinLength, fmt.Sprintf("長度不得小於 %d 位", PasswordMinLength))
+	}
+	if PasswordMaxLength > 0 && length > PasswordMaxLength {
+		result.Add(PasswordRuleMaxLength, fmt.Sprintf("長度不得大於 %d 位", PasswordMaxLength))
+	}
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		default:
+			hasSymbol = true
+		}
+	}
+	if PasswordRequireUppercase && !hasUpper {
+		result.Add(PasswordRuleUppercase, "需要包含大寫字母")
+	}
+	if PasswordRequireLowercase && !hasLower {
+		result.Add(PasswordRuleLowercase, "需要包含小寫字母")
+	}
+	if PasswordRequireDigit && !hasDigit {
+		result.Add(PasswordRuleDigit, "需要包含數字")
+	}
+	if PasswordRequireSymbol && !hasSymbol {
+		result.Add(PasswordRuleSymbol, "需要包含特殊字符")
+	}
+	if PasswordForbidUserInfo && containsUserInfo(password, username, email) {
+		result.Add(PasswordRuleUserInfo, "不能包含用戶名或郵箱")
+	}
+	if IsBreachedPassword(password) {
+		result.Add(PasswordRuleBreached, "該密碼已出現在洩露密碼庫中，請更換")
+	}
+	return result
+}
+
+// containsUserInfo 檢查密碼是否包含用戶名或郵箱前綴，忽略大小寫；過短的片段不參與比較
+func containsUserInfo(password string, username string, email string) bool {
+	lower := strings.ToLower(password)
+	candidates := []string{strings.ToLower(strings.TrimSpace(username))}
+	if email = strings.ToLower(strings.TrimSpace(email)); email != "" {
+		candidates = append(candidates, email, strings.Split(email, "@")[0])
+	}
+	for _, candidate := range candidates {
+		if len(candidate) >= 3 && strings.Contains(lower, candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	breachedPasswordOnce   sync.Once
+	breachedPasswordHashes map[[sha1.Size]byte]struct{}
+)
+
+// loadBreachedPasswords 加載洩露密碼庫，每行一個 SHA-1 十六進制哈希，兼容 HASH:COUNT 格式
+func loadBreachedPasswords() {
+	if BreachedPasswordFile == "" {
+		return
+	}
+	file, err := os.Open(BreachedPasswordFile)
+	if err != nil {
+		SysError("failed to open breached password file: " + err.Error())
+		return
+	}
+	defer file.Close()
+	hashes := make(map[[sha1.Size]byte]struct{})
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			line = line[:i]
+		}
+		var key [sha1.Size]byte
+		if n, err := hex.Decode(key[:], []byte(line)); err != nil || n != sha1.Size {
+			continue
+		}
+		hashes[key] = struct{}{}
+	}
+	if err = scanner.Err(); err != nil {
+		SysError("failed to read breached password file: " + err.Error())
+	}
+	breachedPasswordHashes = hashes
+	SysLog(fmt.Sprintf("loaded %d breached password hashes", len(hashes)))
+}
+
+// IsBreachedPassword 檢查密碼是否在本地洩露密碼庫中
+func IsBreachedPassword(password string) bool {
+	breachedPasswordOnce.Do(loadBreachedPasswords)
+	if len(breachedPasswordHashes) == 0 {
+		return false
+	}
+	_, ok := breachedPasswordHashes[sha1.Sum([]byte(password))]
+	return ok
+}
@@ -0,0 +1,77 @@
+package common
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+type clientIPKey struct{}
+
+// WithClientIP 將客戶端 IP 保存到請求上下文中，供會話存儲等無法訪問 gin.Context 的代碼使用
+func WithClientIP(r *http.Request, ip string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), clientIPKey{}, ip))
+}
+
+// GetRequestIP 獲取請求的客戶端 IP；使用 ClientIP 中間件按信任的反向代理解析出的地址，
+// 未經過該中間件時使用連接的遠端地址，不直接信任 X-Forwarded-For 等請求頭
+func GetRequestIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok && ip != "" {
+		return ip
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ParseDevice 從 User-Agent 中粗略解析出瀏覽器和操作系統，用於會話列表展示
+func ParseDevice(userAgent string) string {
+	if userAgent == "" {
+		return "未知設備"
+	}
+	browsers := []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	}
+	systems := []struct{ token, name string }{
+		{"Windows", "Windows"},
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Android", "Android"},
+		{"Mac OS X", "macOS"},
+		{"Linux", "Linux"},
+	}
+	browser := ""
+	for _, b := range browsers {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	system := ""
+	for _, s := range systems {
+		if strings.Contains(userAgent, s.token) {
+			system = s.name
+			break
+		}
+	}
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	}
+	if len(userAgent) > 64 {
+		return userAgent[:64]
+	}
+	return userAgent
+}
@@ -0,0 +1,78 @@
+package common
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash/crc32"
+	"strings"
+)
+
+// TokenKeyPrefixLength 令牌明文中保留用於識別的可見前綴長度，不含格式前綴
+const TokenKeyPrefixLength = 8
+
+// 令牌格式：產品前綴 + 類型標記 + 隨機部分 + 校驗碼，例如 acs_tk_<30 位隨機字符><6 位校驗碼>，
+// 便於密鑰掃描工具識別洩露的令牌，並在查詢數據庫前拒絕輸錯或偽造的令牌
+const (
+	TokenKeyProductPrefix = "acs_"
+	TokenKeyTypeAPI       = "tk" // API 令牌
+	TokenKeyTypeAccess    = "at" // 用戶的系統管理訪問令牌
+	TokenKeyTypeRedeem    = "rc" // 兌換碼
+
+	tokenKeyRandomLength   = 30
+	tokenKeyChecksumLength = 6
+	tokenKeyCharset        = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+)
+
+// GenerateTokenKey 生成指定類型的令牌明文
+func GenerateTokenKey(keyType string) string {
+	random := GetRandomString(tokenKeyRandomLength)
+	return TokenKeyProductPrefix + keyType + "_" + random + tokenKeyChecksum(random)
+}
+
+// tokenKeyChecksum 以 base62 編碼的 CRC32 作為校驗碼，固定 6 位
+func tokenKeyChecksum(random string) string {
+	sum := crc32.ChecksumIEEE([]byte(random))
+	result := make([]byte, tokenKeyChecksumLength)
+	for i := tokenKeyChecksumLength - 1; i >= 0; i-- {
+		result[i] = tokenKeyCharset[sum%62]
+		sum /= 62
+	}
+	return string(result)
+}
+
+// IsTokenKeyWellFormed 檢查令牌的格式和校驗碼，不訪問數據庫；
+// 沒有產品前綴的舊格式令牌不做檢查，以兼容升級前簽發的令牌
+func IsTokenKeyWellFormed(key string, keyType string) bool {
+	if !strings.HasPrefix(key, TokenKeyProductPrefix) {
+		return true
+	}
+	prefix := TokenKeyProductPrefix + keyType + "_"
+	if !strings.HasPrefix(key, prefix) || len(key) != len(prefix)+tokenKeyRandomLength+tokenKeyChecksumLength {
+		return false
+	}
+	body := key[len(prefix):]
+	random, checksum := body[:tokenKeyRandomLength], body[tokenKeyRandomLength:]
+	return tokenKeyChecksum(random) == checksum
+}
+
+// HashTokenKey 使用 TokenHashSecret 計算令牌的 HMAC-SHA256，數據庫中只保存該哈希
+func HashTokenKey(key string) string {
+	mac := hmac.New(sha256.New, []byte(TokenHashSecret))
+	mac.Write([]byte(key))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// TokenKeyPrefix 返回令牌的可見前綴，用於在列表中識別令牌；新格式令牌的前綴包含格式前綴和類型標記
+func TokenKeyPrefix(key string) string {
+	length := TokenKeyPrefixLength
+	if strings.HasPrefix(key, TokenKeyProductPrefix) {
+		if i := strings.IndexByte(key[len(TokenKeyProductPrefix):], '_'); i >= 0 {
+			length += len(TokenKeyProductPrefix) + i + 1
+		}
+	}
+	if len(key) <= length {
+		return key
+	}
+	return key[:length]
+}
@@ -72,6 +72,22 @@ func GetBoolEnv(key string, defaultValue bool) bool {
 	return value
 }
 
+// GetStringSliceEnv 獲取以逗號分隔的字符串列表環境變數
+func GetStringSliceEnv(key string) []string {
+	valueStr := os.Getenv(key)
+	if valueStr == "" {
+		return nil
+	}
+	var values []string
+	for _, value := range strings.Split(valueStr, ",") {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 // SysLog 系統日誌
 func SysLog(message string) {
 	log.Printf("[INFO] %s\n", message)
@@ -109,9 +125,99 @@ func LoadEnv() {
 	CriticalRateLimitNum = GetIntEnv("CRITICAL_RATE_LIMIT_NUM", 20)
 	CriticalRateLimitDuration = int64(GetIntEnv("CRITICAL_RATE_LIMIT_DURATION", 1200))
 
+	// 加載郵件配置
+	SMTPServer = os.Getenv("SMTP_SERVER")
+	SMTPPort = GetIntEnv("SMTP_PORT", 587)
+	SMTPAccount = os.Getenv("SMTP_ACCOUNT")
+	SMTPToken = os.Getenv("SMTP_TOKEN")
+	SMTPFrom = os.Getenv("SMTP_FROM")
+	VerificationCodeLifetime = int64(GetIntEnv("VERIFICATION_CODE_LIFETIME", 600))
+	VerificationCodeMaxAttempts = GetIntEnv("VERIFICATION_CODE_MAX_ATTEMPTS", 5)
+	VerificationCodeResendCooldown = int64(GetIntEnv("VERIFICATION_CODE_RESEND_COOLDOWN", 60))
+
+	// 加載密碼策略配置
+	PasswordMinLength = GetIntEnv("PASSWORD_MIN_LENGTH", 8)
+	PasswordMaxLength = GetIntEnv("PASSWORD_MAX_LENGTH", 64)
+	PasswordRequireUppercase = GetBoolEnv("PASSWORD_REQUIRE_UPPERCASE", false)
+	PasswordRequireLowercase = GetBoolEnv("PASSWORD_REQUIRE_LOWERCASE", false)
+	PasswordRequireDigit = GetBoolEnv("PASSWORD_REQUIRE_DIGIT", false)
+	PasswordRequireSymbol = GetBoolEnv("PASSWORD_REQUIRE_SYMBOL", false)
+	PasswordForbidUserInfo = GetBoolEnv("PASSWORD_FORBID_USER_INFO", true)
+	PasswordHistoryCount = GetIntEnv("PASSWORD_HISTORY_COUNT", 5)
+	BreachedPasswordFile = os.Getenv("BREACHED_PASSWORD_FILE")
+
+	// 加載登入失敗鎖定配置
+	LoginLockoutEnabled = GetBoolEnv("LOGIN_LOCKOUT_ENABLED", true)
+	LoginFailureDelayThreshold = GetIntEnv("LOGIN_FAILURE_DELAY_THRESHOLD", 3)
+	LoginFailureBaseDelay = int64(GetIntEnv("LOGIN_FAILURE_BASE_DELAY", 1))
+	LoginFailureMaxDelay = int64(GetIntEnv("LOGIN_FAILURE_MAX_DELAY", 60))
+	LoginLockoutThreshold = GetIntEnv("LOGIN_LOCKOUT_THRESHOLD", 10)
+	LoginLockoutDuration = int64(GetIntEnv("LOGIN_LOCKOUT_DURATION", 900))
+
+	// 加載兩步驗證配置
+	TwoFactorPendingTimeout = int64(GetIntEnv("TWO_FACTOR_PENDING_TIMEOUT", 300))
+	TwoFactorMaxAttempts = GetIntEnv("TWO_FACTOR_MAX_ATTEMPTS", 5)
+	TwoFactorRecoveryCodeCount = GetIntEnv("TWO_FACTOR_RECOVERY_CODE_COUNT", 10)
+	if TwoFactorRecoveryCodeCount < 1 {
+		SysError("TWO_FACTOR_RECOVERY_CODE_COUNT must be at least 1, using 1")
+		TwoFactorRecoveryCodeCount = 1
+	}
+
+	// 加載通行密鑰配置
+	PasskeyLoginEnabled = GetBoolEnv("PASSKEY_LOGIN_ENABLED", true)
+	WebAuthnRPID = os.Getenv("WEBAUTHN_RP_ID")
+	WebAuthnRPOrigins = GetStringSliceEnv("WEBAUTHN_RP_ORIGINS")
+
+	// 加載身份提供方配置
+	OAuth2AuthorizationCodeLifetime = int64(GetIntEnv("OAUTH2_AUTHORIZATION_CODE_LIFETIME", 60))
+	OAuth2AccessTokenLifetime = int64(GetIntEnv("OAUTH2_ACCESS_TOKEN_LIFETIME", 3600))
+	OAuth2RefreshTokenLifetime = int64(GetIntEnv("OAUTH2_REFRESH_TOKEN_LIFETIME", 2592000))
+	OAuth2SigningKeyRotationInterval = int64(GetIntEnv("OAUTH2_SIGNING_KEY_ROTATION_INTERVAL", 2592000))
+
+	if trustedProxies := GetStringSliceEnv("TRUSTED_PROXIES"); trustedProxies != nil {
+		TrustedProxies = trustedProxies
+	}
+
+	// 加載令牌使用記錄配置
+	TokenUsageRetentionDays = GetIntEnv("TOKEN_USAGE_RETENTION_DAYS", 30)
+
+	// 加載後台任務配置
+	TokenSweepInterval = GetIntEnv("TOKEN_SWEEP_INTERVAL", 300)
+	TokenExpiryNoticeDays = GetIntEnv("TOKEN_EXPIRY_NOTICE_DAYS", 7)
+
+	// 加載令牌有效期配置
+	TokenMaxLifetimeUser = GetIntEnv("TOKEN_MAX_LIFETIME_USER", 0)
+	TokenMaxLifetimeAdmin = GetIntEnv("TOKEN_MAX_LIFETIME_ADMIN", 0)
+	TokenMaxLifetimeRoot = GetIntEnv("TOKEN_MAX_LIFETIME_ROOT", 0)
+	if policy := os.Getenv("TOKEN_LIFETIME_POLICY"); policy == TokenLifetimePolicyClamp || policy == TokenLifetimePolicyReject {
+		TokenLifetimePolicy = policy
+	} else if policy != "" {
+		SysError("invalid TOKEN_LIFETIME_POLICY, using " + TokenLifetimePolicy)
+	}
+
+	// 加載令牌輪換配置
+	TokenRotationGracePeriod = int64(GetIntEnv("TOKEN_ROTATION_GRACE_PERIOD", 86400))
+	TokenRotationMaxGracePeriod = int64(GetIntEnv("TOKEN_ROTATION_MAX_GRACE_PERIOD", 2592000))
+
+	// 加載第三方登入配置
+	loadOIDCProviders()
+
+	if serverAddress := os.Getenv("SERVER_ADDRESS"); serverAddress != "" {
+		ServerAddress = strings.TrimSuffix(serverAddress, "/")
+	}
+	if systemName := os.Getenv("SYSTEM_NAME"); systemName != "" {
+		SystemName = systemName
+	}
+
 	// 如果環境變數中有 SESSION_SECRET，則使用它
 	envSessionSecret := os.Getenv("SESSION_SECRET")
 	if envSessionSecret != "" {
 		SessionSecret = envSessionSecret
 	}
+
+	// 令牌哈希密鑰必須固定且獨立於會話密鑰，未配置時拒絕啟動
+	TokenHashSecret = os.Getenv("TOKEN_HASH_SECRET")
+	if TokenHashSecret == "" {
+		FatalLog("TOKEN_HASH_SECRET is not set, please set it to a random string")
+	}
 }
@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"account-system/common"
+	"account-system/model"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+)
+
+// SendEmailVerification 發送註冊用的郵箱驗證碼
+func SendEmailVerification(c *gin.Context) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的參數",
+		})
+		return
+	}
+	email := strings.TrimSpace(req.Email)
+	if err := common.CheckEmailAddress(email); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	exist, err := model.CheckUserExistOrDeleted("", email)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "數據庫錯誤，請稍後重試",
+		})
+		common.SysError(fmt.Sprintf("CheckUserExistOrDeleted error: %v", err))
+		return
+	}
+	if exist {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "郵箱地址已被佔用",
+		})
+		return
+	}
+	code, err := model.CreateVerificationCode(common.EmailVerificationPurpose, email)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	subject := fmt.Sprintf("%s 郵箱驗證", common.SystemName)
+	content := fmt.Sprintf("<p>您正在註冊 %s。</p><p>驗證碼為：<strong>%s</strong></p><p>驗證碼 %d 分鐘內有效，如非本人操作，請忽略此郵件。</p>",
+		common.SystemName, code, common.VerificationCodeLifetime/60)
+	if err = common.SendEmail(subject, email, content); err != nil {
+		common.SysError("failed to send verification email: " + err.Error())
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "郵件發送失敗，請稍後重試",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "驗證碼已發送，請查收郵件",
+	})
+}
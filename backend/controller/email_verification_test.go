@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"account-system/common"
+	"account-system/model"
+	"github.com/gin-gonic/gin"
+	"regexp"
+	"testing"
+)
+
+var verificationCodePattern = regexp.MustCompile(`<strong>(\d{6})</strong>`)
+
+// setupMailbox 使用內存發件箱代替 SMTP 並開啟註冊郵箱驗證
+func setupMailbox(t *testing.T) *common.MemoryMailSender {
+	t.Helper()
+	mailbox := &common.MemoryMailSender{}
+	common.SetMailSender(mailbox)
+	enabled := common.EmailVerificationEnabled
+	common.EmailVerificationEnabled = true
+	t.Cleanup(func() {
+		common.SetMailSender(common.SMTPMailSender{})
+		common.EmailVerificationEnabled = enabled
+	})
+	return mailbox
+}
+
+// receivedCode 從發件箱中取出發給指定郵箱的最後一個驗證碼
+func receivedCode(t *testing.T, mailbox *common.MemoryMailSender, email string) string {
+	t.Helper()
+	mail, ok := mailbox.LastMail(email)
+	if !ok {
+		t.Fatalf("no mail sent to %s", email)
+	}
+	match := verificationCodePattern.FindStringSubmatch(mail.Content)
+	if match == nil {
+		t.Fatalf("mail to %s does not contain a verification code: %s", email, mail.Content)
+	}
+	return match[1]
+}
+
+func newRegisterClient(t *testing.T) *testClient {
+	return newTestClient(t, func(engine *gin.Engine) {
+		engine.POST("/verification", SendEmailVerification)
+		engine.POST("/register", Register)
+	})
+}
+
+func TestRegisterWithEmailVerification(t *testing.T) {
+	mailbox := setupMailbox(t)
+	client := newRegisterClient(t)
+	const email = "register@example.com"
+	mustSucceed(t, client.do(t, "POST", "/verification", map[string]string{"email": email}))
+	mustSucceed(t, client.do(t, "POST", "/verification", map[string]string{"email": "other@example.com"}))
+	code := receivedCode(t, mailbox, email)
+	otherCode := receivedCode(t, mailbox, "other@example.com")
+
+	tests := []struct {
+		name     string
+		username string
+		email    string
+		code     string
+		wantOK   bool
+	}{
+		{"missing email", "reg_no_email", "", code, false},
+		{"missing code", "reg_no_code", email, "", false},
+		{"wrong code", "reg_wrong", email, "000000x", false},
+		{"code of other email", "reg_other", email, otherCode, false},
+		{"valid code", "reg_valid", email, code, true},
+		{"code reused", "reg_reused", email, code, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := client.do(t, "POST", "/register", map[string]string{
+				"username":          tt.username,
+				"password":          "Correct-Horse-9",
+				"email":             tt.email,
+				"verification_code": tt.code,
+			})
+			if ok := result["success"] == true; ok != tt.wantOK {
+				t.Fatalf("success = %v, want %v: %v", ok, tt.wantOK, result["message"])
+			}
+			user, err := model.GetUserByUsername(tt.username)
+			if (err == nil) != tt.wantOK {
+				t.Fatalf("user created = %v, want %v", err == nil, tt.wantOK)
+			}
+			if tt.wantOK && !user.EmailVerified {
+				t.Fatal("registered email is not marked as verified")
+			}
+		})
+	}
+
+	t.Run("registered email", func(t *testing.T) {
+		before := len(mailbox.Mails())
+		if result := client.do(t, "POST", "/verification", map[string]string{"email": email}); result["success"] == true {
+			t.Fatal("verification code sent to registered email")
+		}
+		if len(mailbox.Mails()) != before {
+			t.Fatal("mail sent to registered email")
+		}
+	})
+}
@@ -0,0 +1,185 @@
+package controller
+
+import (
+	"account-system/common"
+	"account-system/model"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+// GetAllGroups 獲取所有分組及其成員數（管理員）
+func GetAllGroups(c *gin.Context) {
+	groups, err := model.GetAllGroups()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "獲取成功",
+		"data":    groups,
+	})
+}
+
+// CreateGroup 創建分組（管理員）
+func CreateGroup(c *gin.Context) {
+	var group model.Group
+	if err := json.NewDecoder(c.Request.Body).Decode(&group); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的參數",
+		})
+		return
+	}
+	if err := group.Insert(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "創建成功",
+		"data":    group,
+	})
+}
+
+// UpdateGroup 更新分組的描述、默認額度和速率限制（管理員）
+func UpdateGroup(c *gin.Context) {
+	var group model.Group
+	if err := json.NewDecoder(c.Request.Body).Decode(&group); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的參數",
+		})
+		return
+	}
+	if err := group.Update(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "更新成功",
+		"data":    group,
+	})
+}
+
+// DeleteGroup 刪除沒有成員的分組（管理員）
+func DeleteGroup(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的分組 ID",
+		})
+		return
+	}
+	group, err := model.GetGroupById(id)
+	if err == nil {
+		err = group.Delete()
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "刪除成功",
+	})
+}
+
+// GetGroupMembers 分頁獲取分組中的用戶（管理員）
+func GetGroupMembers(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的分組 ID",
+		})
+		return
+	}
+	group, err := model.GetGroupById(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "分組不存在",
+		})
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+	users, total, err := model.GetGroupMembers(group.Name, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "獲取成功",
+		"data":    users,
+		"total":   total,
+	})
+}
+
+// MoveGroupMembers 將用戶移到分組（管理員），grant_quota 為 true 時向新成員發放分組的默認額度
+func MoveGroupMembers(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的分組 ID",
+		})
+		return
+	}
+	var req struct {
+		UserIds    []int `json:"user_ids"`
+		GrantQuota bool  `json:"grant_quota"`
+	}
+	if err = json.NewDecoder(c.Request.Body).Decode(&req); err != nil || len(req.UserIds) == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的參數",
+		})
+		return
+	}
+	if len(req.UserIds) > 100 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "每次最多移動 100 個用戶",
+		})
+		return
+	}
+	moved, err := model.MoveUsersToGroup(req.UserIds, id, req.GrantQuota, c.GetInt("role"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	common.SysLog(fmt.Sprintf("user %d moved %d users to group %d", c.GetInt("id"), moved, id))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": fmt.Sprintf("已移動 %d 個用戶", moved),
+		"data": gin.H{
+			"moved": moved,
+		},
+	})
+}
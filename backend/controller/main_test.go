@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"account-system/common"
+	"account-system/model"
+	"bytes"
+	"encoding/json"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestMain 在臨時目錄中使用 SQLite 數據庫運行控制器測試
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "account-system-controller")
+	if err != nil {
+		panic(err)
+	}
+	if err = os.Chdir(dir); err != nil {
+		panic(err)
+	}
+	// 並發測試需要等待寫鎖而不是直接返回 database is locked
+	os.Setenv("SQLITE_PATH", filepath.Join(dir, "test.db")+"?_busy_timeout=5000&_journal_mode=WAL")
+	os.Setenv("SESSION_SECRET", "test-session-secret")
+	os.Setenv("TOKEN_HASH_SECRET", "test-token-hash-secret")
+	common.LoadEnv()
+	gin.SetMode(gin.TestMode)
+	if err = model.InitDB(); err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	_ = model.CloseDB()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// createTestUser 創建一個啟用的普通用戶
+func createTestUser(t *testing.T, username string) *model.User {
+	t.Helper()
+	user := &model.User{
+		Username:    username,
+		Password:    "Password-" + username,
+		DisplayName: username,
+		Role:        common.RoleCommonUser,
+		Status:      common.UserStatusEnabled,
+	}
+	if err := user.Insert(); err != nil {
+		t.Fatalf("create user %s: %v", username, err)
+	}
+	return user
+}
+
+// createTestAdmin 創建一個管理員
+func createTestAdmin(t *testing.T, username string) *model.User {
+	t.Helper()
+	user := createTestUser(t, username)
+	if err := model.SetUserRole(user.Id, common.RoleAdminUser); err != nil {
+		t.Fatalf("promote user %s: %v", username, err)
+	}
+	user.Role = common.RoleAdminUser
+	return user
+}
+
+// testClient 通過 cookie 保持會話的測試客戶端
+type testClient struct {
+	server *httptest.Server
+	client *http.Client
+}
+
+// newTestClient 使用數據庫會話啟動測試服務器，register 用於註冊被測路由
+func newTestClient(t *testing.T, register func(engine *gin.Engine)) *testClient {
+	t.Helper()
+	engine := gin.New()
+	engine.Use(sessions.Sessions("session", model.NewSessionStore([]byte(common.SessionSecret))))
+	register(engine)
+	server := httptest.NewServer(engine)
+	t.Cleanup(server.Close)
+	jar, _ := cookiejar.New(nil)
+	return &testClient{server: server, client: &http.Client{Jar: jar}}
+}
+
+// do 發送 JSON 請求並解析統一格式的響應
+func (tc *testClient) do(t *testing.T, method, path string, body interface{}) map[string]interface{} {
+	t.Helper()
+	var reader *bytes.Reader
+	switch b := body.(type) {
+	case nil:
+		reader = bytes.NewReader(nil)
+	case []byte:
+		reader = bytes.NewReader(b)
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, tc.server.URL+path, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := tc.client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var result map[string]interface{}
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("%s %s: decode response: %v", method, path, err)
+	}
+	return result
+}
+
+// mustSucceed 要求響應的 success 為 true，並返回 data
+func mustSucceed(t *testing.T, result map[string]interface{}) interface{} {
+	t.Helper()
+	if result["success"] != true {
+		t.Fatalf("request failed: %v", result["message"])
+	}
+	return result["data"]
+}
+
+// withUserId 模擬已登入用戶，供需要 c.GetInt("id") 的處理器使用
+func withUserId(id int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("id", id)
+		c.Next()
+	}
+}
@@ -0,0 +1,553 @@
+package controller
+
+import (
+	"account-system/common"
+	"account-system/model"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 身份提供方支持的授權範圍
+var oauth2SupportedScopes = []string{"openid", "profile", "email", "offline_access"}
+
+// oauth2AuthorizeRequest 授權請求參數，GET 時來自查詢字符串，POST 時來自 JSON
+type oauth2AuthorizeRequest struct {
+	ClientId            string `form:"client_id" json:"client_id"`
+	RedirectURI         string `form:"redirect_uri" json:"redirect_uri"`
+	ResponseType        string `form:"response_type" json:"response_type"`
+	Scope               string `form:"scope" json:"scope"`
+	State               string `form:"state" json:"state"`
+	Nonce               string `form:"nonce" json:"nonce"`
+	CodeChallenge       string `form:"code_challenge" json:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method" json:"code_challenge_method"`
+	Approve             bool   `form:"-" json:"approve"`
+}
+
+// oauth2AuthorizeError 可以回跳給應用的授權錯誤
+type oauth2AuthorizeError struct {
+	Code        string
+	Description string
+}
+
+func (e *oauth2AuthorizeError) Error() string {
+	return e.Description
+}
+
+func isSupportedOAuth2Scope(scope string) bool {
+	return model.ScopeContains(strings.Join(oauth2SupportedScopes, " "), scope)
+}
+
+// normalizeOAuth2Scope 去除重複和多餘空白
+func normalizeOAuth2Scope(scope string) string {
+	seen := make(map[string]bool)
+	var scopes []string
+	for _, s := range strings.Fields(scope) {
+		if !seen[s] {
+			seen[s] = true
+			scopes = append(scopes, s)
+		}
+	}
+	return strings.Join(scopes, " ")
+}
+
+// buildOAuth2Redirect 在回調地址上附加參數
+func buildOAuth2Redirect(redirectURI string, params url.Values) string {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+	query := u.Query()
+	for key, values := range params {
+		for _, value := range values {
+			query.Add(key, value)
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// validateOAuth2AuthorizeRequest 校驗授權請求。應用或回調地址無效時返回普通錯誤，
+// 此時不能回跳；其他錯誤返回 *oauth2AuthorizeError，應回跳到應用
+func validateOAuth2AuthorizeRequest(req *oauth2AuthorizeRequest) (*model.OAuth2Client, error) {
+	client, err := model.GetOAuth2ClientByClientId(req.ClientId)
+	if err != nil || client.Status != common.OAuth2ClientStatusEnabled {
+		return nil, errors.New("應用不存在或已被停用")
+	}
+	if req.RedirectURI == "" || !client.HasRedirectURI(req.RedirectURI) {
+		return nil, errors.New("回調地址未登記")
+	}
+	if req.ResponseType != "code" {
+		return client, &oauth2AuthorizeError{"unsupported_response_type", "僅支持授權碼模式"}
+	}
+	req.Scope = normalizeOAuth2Scope(req.Scope)
+	if req.Scope == "" || !isSupportedOAuth2Scope(req.Scope) || !client.AllowsScope(req.Scope) {
+		return client, &oauth2AuthorizeError{"invalid_scope", "申請的授權範圍無效"}
+	}
+	if req.CodeChallenge == "" {
+		if client.Public {
+			return client, &oauth2AuthorizeError{"invalid_request", "公開客戶端必須使用 PKCE"}
+		}
+	} else {
+		if req.CodeChallengeMethod != "S256" {
+			return client, &oauth2AuthorizeError{"invalid_request", "code_challenge_method 僅支持 S256"}
+		}
+		if len(req.CodeChallenge) < 43 || len(req.CodeChallenge) > 128 {
+			return client, &oauth2AuthorizeError{"invalid_request", "code_challenge 格式錯誤"}
+		}
+	}
+	return client, nil
+}
+
+// respondOAuth2AuthorizeError 返回授權錯誤，能安全回跳時附帶回跳地址
+func respondOAuth2AuthorizeError(c *gin.Context, req *oauth2AuthorizeRequest, err error) {
+	var authorizeErr *oauth2AuthorizeError
+	if !errors.As(err, &authorizeErr) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	params := url.Values{
+		"error":             {authorizeErr.Code},
+		"error_description": {authorizeErr.Description},
+		"iss":               {common.ServerAddress},
+	}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": false,
+		"message": authorizeErr.Description,
+		"data": gin.H{
+			"redirect": buildOAuth2Redirect(req.RedirectURI, params),
+		},
+	})
+}
+
+// GetOAuth2Authorize 獲取授權確認頁面所需的信息
+func GetOAuth2Authorize(c *gin.Context) {
+	var req oauth2AuthorizeRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的參數",
+		})
+		return
+	}
+	client, err := validateOAuth2AuthorizeRequest(&req)
+	if err != nil {
+		respondOAuth2AuthorizeError(c, &req, err)
+		return
+	}
+	consented := false
+	if consent, err := model.GetOAuth2Consent(c.GetInt("id"), client.ClientId); err == nil {
+		consented = model.ScopeContains(consent.Scope, req.Scope)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"client_id":    client.ClientId,
+			"client_name":  client.Name,
+			"redirect_uri": req.RedirectURI,
+			"scopes":       strings.Fields(req.Scope),
+			"consented":    consented,
+		},
+	})
+}
+
+// OAuth2Authorize 用戶同意或拒絕授權，返回帶授權碼的回跳地址
+func OAuth2Authorize(c *gin.Context) {
+	var req oauth2AuthorizeRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的參數",
+		})
+		return
+	}
+	client, err := validateOAuth2AuthorizeRequest(&req)
+	if err != nil {
+		respondOAuth2AuthorizeError(c, &req, err)
+		return
+	}
+	if !req.Approve {
+		respondOAuth2AuthorizeError(c, &req, &oauth2AuthorizeError{"access_denied", "用戶拒絕了授權"})
+		return
+	}
+	userId := c.GetInt("id")
+	if err = model.SaveOAuth2Consent(userId, client.ClientId, req.Scope); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	code := &model.OAuth2AuthorizationCode{
+		ClientId:            client.ClientId,
+		UserId:              userId,
+		RedirectURI:         req.RedirectURI,
+		Scope:               req.Scope,
+		Nonce:               req.Nonce,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		AuthTime:            time.Now(),
+	}
+	raw, err := code.Insert()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	params := url.Values{
+		"code": {raw},
+		"iss":  {common.ServerAddress},
+	}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"redirect": buildOAuth2Redirect(req.RedirectURI, params),
+		},
+	})
+}
+
+// oauth2Error 按 RFC 6749 格式返回錯誤
+func oauth2Error(c *gin.Context, status int, code string, description string) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+	c.JSON(status, gin.H{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+// authenticateOAuth2Client 驗證令牌端點的客戶端身份，支持 client_secret_basic、client_secret_post 和公開客戶端
+func authenticateOAuth2Client(c *gin.Context) (*model.OAuth2Client, bool) {
+	clientId, secret, usingBasic := c.Request.BasicAuth()
+	if usingBasic {
+		clientId, _ = url.QueryUnescape(clientId)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientId = c.PostForm("client_id")
+		secret = c.PostForm("client_secret")
+	}
+	client, err := model.GetOAuth2ClientByClientId(clientId)
+	if err == nil && client.Status == common.OAuth2ClientStatusEnabled && (client.Public || client.ValidateSecret(secret)) {
+		return client, true
+	}
+	if usingBasic {
+		c.Header("WWW-Authenticate", `Basic realm="oauth2"`)
+	}
+	oauth2Error(c, http.StatusUnauthorized, "invalid_client", "客戶端認證失敗")
+	return nil, false
+}
+
+// verifyPKCE 校驗 code_verifier 是否與授權時的 code_challenge 匹配
+func verifyPKCE(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// addOAuth2UserClaims 根據授權範圍添加用戶信息聲明
+func addOAuth2UserClaims(claims jwt.MapClaims, user *model.User, scope string) {
+	if model.ScopeContains(scope, "profile") {
+		name := user.DisplayName
+		if name == "" {
+			name = user.Username
+		}
+		claims["name"] = name
+		claims["preferred_username"] = user.Username
+	}
+	if model.ScopeContains(scope, "email") && user.Email != "" {
+		claims["email"] = user.Email
+		claims["email_verified"] = user.EmailVerified
+	}
+}
+
+// issueOAuth2Tokens 簽發 access token，並按授權範圍簽發 id_token 和刷新令牌
+func issueOAuth2Tokens(c *gin.Context, client *model.OAuth2Client, user *model.User, scope string, nonce string, authTime time.Time) {
+	now := time.Now()
+	expiresAt := now.Add(time.Duration(common.OAuth2AccessTokenLifetime) * time.Second)
+	subject := strconv.Itoa(user.Id)
+	accessToken, err := model.SignOAuth2Token(jwt.MapClaims{
+		"iss":       common.ServerAddress,
+		"sub":       subject,
+		"aud":       client.ClientId,
+		"client_id": client.ClientId,
+		"scope":     scope,
+		"iat":       now.Unix(),
+		"exp":       expiresAt.Unix(),
+		"jti":       common.GetUUID(),
+	}, "at+jwt")
+	if err != nil {
+		common.SysError("failed to sign oauth2 access token: " + err.Error())
+		oauth2Error(c, http.StatusInternalServerError, "server_error", "簽發令牌失敗")
+		return
+	}
+	response := gin.H{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   common.OAuth2AccessTokenLifetime,
+		"scope":        scope,
+	}
+	if model.ScopeContains(scope, "openid") {
+		claims := jwt.MapClaims{
+			"iss":       common.ServerAddress,
+			"sub":       subject,
+			"aud":       client.ClientId,
+			"iat":       now.Unix(),
+			"exp":       expiresAt.Unix(),
+			"auth_time": authTime.Unix(),
+		}
+		if nonce != "" {
+			claims["nonce"] = nonce
+		}
+		addOAuth2UserClaims(claims, user, scope)
+		idToken, err := model.SignOAuth2Token(claims, "JWT")
+		if err != nil {
+			common.SysError("failed to sign oauth2 id token: " + err.Error())
+			oauth2Error(c, http.StatusInternalServerError, "server_error", "簽發令牌失敗")
+			return
+		}
+		response["id_token"] = idToken
+	}
+	if model.ScopeContains(scope, "offline_access") {
+		refreshToken := &model.OAuth2RefreshToken{
+			ClientId: client.ClientId,
+			UserId:   user.Id,
+			Scope:    scope,
+			AuthTime: authTime,
+		}
+		raw, err := refreshToken.Insert()
+		if err != nil {
+			oauth2Error(c, http.StatusInternalServerError, "server_error", "簽發令牌失敗")
+			return
+		}
+		response["refresh_token"] = raw
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+	c.JSON(http.StatusOK, response)
+}
+
+// getEnabledOAuth2User 獲取授權所屬的用戶，用戶已刪除或被禁用時返回 false
+func getEnabledOAuth2User(userId int) (*model.User, bool) {
+	user, err := model.GetUserById(userId, false)
+	if err != nil || user.Status != common.UserStatusEnabled {
+		return nil, false
+	}
+	return user, true
+}
+
+// OAuth2Token 令牌端點，支持 authorization_code 和 refresh_token 兩種授權類型
+func OAuth2Token(c *gin.Context) {
+	client, ok := authenticateOAuth2Client(c)
+	if !ok {
+		return
+	}
+	switch c.PostForm("grant_type") {
+	case "authorization_code":
+		code, err := model.ConsumeOAuth2AuthorizationCode(c.PostForm("code"))
+		if err != nil {
+			oauth2Error(c, http.StatusBadRequest, "invalid_grant", err.Error())
+			return
+		}
+		if code.ClientId != client.ClientId || code.RedirectURI != c.PostForm("redirect_uri") {
+			oauth2Error(c, http.StatusBadRequest, "invalid_grant", "授權碼與應用或回調地址不匹配")
+			return
+		}
+		if code.CodeChallenge != "" && !verifyPKCE(c.PostForm("code_verifier"), code.CodeChallenge) {
+			oauth2Error(c, http.StatusBadRequest, "invalid_grant", "code_verifier 校驗失敗")
+			return
+		}
+		user, ok := getEnabledOAuth2User(code.UserId)
+		if !ok {
+			oauth2Error(c, http.StatusBadRequest, "invalid_grant", "用戶不存在或已被禁用")
+			return
+		}
+		issueOAuth2Tokens(c, client, user, code.Scope, code.Nonce, code.AuthTime)
+	case "refresh_token":
+		token, err := model.ConsumeOAuth2RefreshToken(c.PostForm("refresh_token"), client.ClientId)
+		if err != nil {
+			oauth2Error(c, http.StatusBadRequest, "invalid_grant", err.Error())
+			return
+		}
+		scope := token.Scope
+		if requested := normalizeOAuth2Scope(c.PostForm("scope")); requested != "" {
+			// 刷新時只能縮小授權範圍
+			if !model.ScopeContains(token.Scope, requested) {
+				oauth2Error(c, http.StatusBadRequest, "invalid_scope", "申請的授權範圍超出原有授權")
+				return
+			}
+			scope = requested
+		}
+		user, ok := getEnabledOAuth2User(token.UserId)
+		if !ok {
+			oauth2Error(c, http.StatusBadRequest, "invalid_grant", "用戶不存在或已被禁用")
+			return
+		}
+		issueOAuth2Tokens(c, client, user, scope, "", token.AuthTime)
+	default:
+		oauth2Error(c, http.StatusBadRequest, "unsupported_grant_type", "不支持的授權類型")
+	}
+}
+
+// OAuth2Revoke 撤銷刷新令牌（RFC 7009），令牌無效時同樣返回成功
+func OAuth2Revoke(c *gin.Context) {
+	client, ok := authenticateOAuth2Client(c)
+	if !ok {
+		return
+	}
+	if token := c.PostForm("token"); token != "" {
+		if err := model.RevokeOAuth2RefreshToken(token, client.ClientId); err != nil {
+			oauth2Error(c, http.StatusServiceUnavailable, "temporarily_unavailable", err.Error())
+			return
+		}
+	}
+	c.Status(http.StatusOK)
+}
+
+// OAuth2Introspect 令牌內省（RFC 7662），供下游服務校驗 API 令牌，只允許開啟了內省權限的機密客戶端調用；
+// 令牌無效、已過期、額度用盡或用戶被禁用時只返回 active=false，且不會修改令牌的訪問時間和狀態
+func OAuth2Introspect(c *gin.Context) {
+	client, ok := authenticateOAuth2Client(c)
+	if !ok {
+		return
+	}
+	if client.Public || !client.Introspection {
+		oauth2Error(c, http.StatusForbidden, "unauthorized_client", "該應用無權調用令牌內省端點")
+		return
+	}
+	key := c.PostForm("token")
+	if key == "" {
+		oauth2Error(c, http.StatusBadRequest, "invalid_request", "缺少 token 參數")
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+	token, err := model.IntrospectUserToken(strings.TrimPrefix(key, "Bearer "))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"active": false})
+		return
+	}
+	// 組織令牌屬於組織而不是創建者，不返回 sub 和 username，以 organization_id 標識
+	var user *model.User
+	if token.OrganizationId == 0 {
+		user, err = model.GetUserById(token.UserId, false)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{"active": false})
+			return
+		}
+	}
+	// 與 TokenAuth 一致，組織令牌和使用帳戶額度的令牌返回組織或帳戶的餘額
+	remainQuota, err := model.GetTokenAvailableQuota(token)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"active": false})
+		return
+	}
+	response := gin.H{
+		"active":          true,
+		"token_type":      "Bearer",
+		"scope":           strings.Join(token.Scopes, " "),
+		"iss":             common.ServerAddress,
+		"iat":             token.CreatedTime.Unix(),
+		"token_id":        token.Id,
+		"name":            token.Name,
+		"remain_quota":    remainQuota,
+		"unlimited_quota": token.UnlimitedQuota,
+		"allowed_ips":     token.AllowedIPs,
+	}
+	if token.OrganizationId != 0 {
+		response["organization_id"] = token.OrganizationId
+	} else {
+		response["sub"] = strconv.Itoa(user.Id)
+		response["username"] = user.Username
+	}
+	// 永不過期的令牌不返回 exp
+	if !token.NeverExpire {
+		response["exp"] = token.ExpiredTime.Unix()
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// OAuth2UserInfo 使用 access token 獲取用戶信息
+func OAuth2UserInfo(c *gin.Context) {
+	tokenString := strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer ")
+	claims, err := model.ParseOAuth2Token(tokenString, "at+jwt")
+	if err != nil {
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+		oauth2Error(c, http.StatusUnauthorized, "invalid_token", "access token 無效")
+		return
+	}
+	subject, _ := claims.GetSubject()
+	userId, _ := strconv.Atoi(subject)
+	user, ok := getEnabledOAuth2User(userId)
+	if !ok {
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+		oauth2Error(c, http.StatusUnauthorized, "invalid_token", "用戶不存在或已被禁用")
+		return
+	}
+	scope, _ := claims["scope"].(string)
+	info := jwt.MapClaims{"sub": subject}
+	addOAuth2UserClaims(info, user, scope)
+	c.JSON(http.StatusOK, info)
+}
+
+// GetOAuth2JWKS 發布用於驗證令牌簽名的公鑰
+func GetOAuth2JWKS(c *gin.Context) {
+	keys, err := model.GetOAuth2JSONWebKeySet()
+	if err != nil {
+		common.SysError("failed to load oauth2 signing keys: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
+
+// GetOpenIDConfiguration OpenID Connect 發現文檔
+func GetOpenIDConfiguration(c *gin.Context) {
+	issuer := common.ServerAddress
+	c.JSON(http.StatusOK, gin.H{
+		"issuer":                                         issuer,
+		"authorization_endpoint":                         issuer + "/oauth2/authorize",
+		"token_endpoint":                                 issuer + "/api/oauth2/token",
+		"userinfo_endpoint":                              issuer + "/api/oauth2/userinfo",
+		"revocation_endpoint":                            issuer + "/api/oauth2/revoke",
+		"introspection_endpoint":                         issuer + "/api/oauth2/introspect",
+		"jwks_uri":                                       issuer + "/api/oauth2/jwks",
+		"scopes_supported":                               oauth2SupportedScopes,
+		"response_types_supported":                       []string{"code"},
+		"response_modes_supported":                       []string{"query"},
+		"grant_types_supported":                          []string{"authorization_code", "refresh_token"},
+		"subject_types_supported":                        []string{"public"},
+		"id_token_signing_alg_values_supported":          []string{jwt.SigningMethodRS256.Alg()},
+		"token_endpoint_auth_methods_supported":          []string{"client_secret_basic", "client_secret_post", "none"},
+		"revocation_endpoint_auth_methods_supported":     []string{"client_secret_basic", "client_secret_post", "none"},
+		"introspection_endpoint_auth_methods_supported":  []string{"client_secret_basic", "client_secret_post"},
+		"code_challenge_methods_supported":               []string{"S256"},
+		"claims_supported":                               []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "name", "preferred_username", "email", "email_verified"},
+		"authorization_response_iss_parameter_supported": true,
+	})
+}
@@ -0,0 +1,249 @@
+package controller
+
+import (
+	"account-system/common"
+	"account-system/model"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// validateOAuth2Client 校驗應用的名稱、回調地址和授權範圍
+func validateOAuth2Client(client *model.OAuth2Client) error {
+	if client.Name == "" || len(client.Name) > 64 {
+		return errors.New("應用名稱不能為空且長度不得超過 64")
+	}
+	if len(client.RedirectURIs) == 0 {
+		return errors.New("至少需要一個回調地址")
+	}
+	for _, redirectURI := range client.RedirectURIs {
+		u, err := url.Parse(redirectURI)
+		if err != nil || !u.IsAbs() || u.Fragment != "" {
+			return errors.New("回調地址無效：" + redirectURI)
+		}
+	}
+	client.Scopes = normalizeOAuth2Scope(client.Scopes)
+	if client.Scopes == "" {
+		client.Scopes = "openid profile email"
+	}
+	if !isSupportedOAuth2Scope(client.Scopes) {
+		return errors.New("包含不支持的授權範圍")
+	}
+	if client.Introspection && client.Public {
+		return errors.New("公開客戶端不能調用令牌內省端點")
+	}
+	if client.Status != common.OAuth2ClientStatusEnabled && client.Status != common.OAuth2ClientStatusDisabled {
+		return errors.New("無效的應用狀態")
+	}
+	return nil
+}
+
+// GetAllOAuth2Clients 獲取所有應用（管理員）
+func GetAllOAuth2Clients(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+	clients, total, err := model.GetAllOAuth2Clients(page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "獲取成功",
+		"data":    clients,
+		"total":   total,
+	})
+}
+
+// GetOAuth2Client 獲取應用（管理員）
+func GetOAuth2Client(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的應用 ID",
+		})
+		return
+	}
+	client, err := model.GetOAuth2ClientById(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "獲取成功",
+		"data":    client,
+	})
+}
+
+// CreateOAuth2Client 創建應用（管理員），客戶端密鑰只在創建時返回一次
+func CreateOAuth2Client(c *gin.Context) {
+	var client model.OAuth2Client
+	if err := json.NewDecoder(c.Request.Body).Decode(&client); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的參數",
+		})
+		return
+	}
+	client.Status = common.OAuth2ClientStatusEnabled
+	if err := validateOAuth2Client(&client); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	client.CreatedBy = c.GetInt("id")
+	secret, err := client.Insert()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "創建成功",
+		"data": gin.H{
+			"client":        client,
+			"client_secret": secret,
+		},
+	})
+}
+
+// UpdateOAuth2Client 更新應用（管理員）
+func UpdateOAuth2Client(c *gin.Context) {
+	var input model.OAuth2Client
+	if err := json.NewDecoder(c.Request.Body).Decode(&input); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的參數",
+		})
+		return
+	}
+	client, err := model.GetOAuth2ClientById(input.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	client.Name = input.Name
+	client.RedirectURIs = input.RedirectURIs
+	client.Scopes = input.Scopes
+	client.Status = input.Status
+	client.Introspection = input.Introspection
+	if err = validateOAuth2Client(client); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err = client.Update(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "更新成功",
+		"data":    client,
+	})
+}
+
+// ResetOAuth2ClientSecret 重新生成客戶端密鑰（管理員）
+func ResetOAuth2ClientSecret(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的應用 ID",
+		})
+		return
+	}
+	client, err := model.GetOAuth2ClientById(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	secret, err := client.ResetSecret()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "已重新生成客戶端密鑰",
+		"data":    secret,
+	})
+}
+
+// DeleteOAuth2Client 刪除應用（管理員），已簽發的授權碼和刷新令牌隨之失效
+func DeleteOAuth2Client(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的應用 ID",
+		})
+		return
+	}
+	client, err := model.GetOAuth2ClientById(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err = client.Delete(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "刪除成功",
+	})
+}
+
+// RotateOAuth2SigningKey 立即輪換令牌簽名密鑰（超級管理員）
+func RotateOAuth2SigningKey(c *gin.Context) {
+	key, err := model.RotateOAuth2SigningKey()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "簽名密鑰已輪換",
+		"data":    key,
+	})
+}
@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"account-system/common"
+	"account-system/model"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// introspect 以內省客戶端的身份調用 OAuth2Introspect
+func introspect(t *testing.T, clientId, secret, key string) map[string]interface{} {
+	t.Helper()
+	engine := gin.New()
+	engine.POST("/introspect", OAuth2Introspect)
+	form := url.Values{"client_id": {clientId}, "client_secret": {secret}, "token": {key}}
+	req := httptest.NewRequest(http.MethodPost, "/introspect", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, req)
+	var result map[string]interface{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &result); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	return result
+}
+
+func TestOAuth2IntrospectRemainQuota(t *testing.T) {
+	client := &model.OAuth2Client{Name: "introspect", Introspection: true}
+	secret, err := client.Insert()
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := createTestUser(t, "introspect_user")
+	org := &model.Organization{Name: "introspect", CreatedBy: user.Id}
+	if err = org.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = model.AdjustOrganizationQuota(org.Id, 700, "test"); err != nil {
+		t.Fatal(err)
+	}
+	newToken := func(token *model.Token) *model.Token {
+		token.UserId = user.Id
+		token.Name = "introspect"
+		token.Status = common.TokenStatusEnabled
+		token.NeverExpire = true
+		if err := token.Insert(); err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	personal := newToken(&model.Token{RemainQuota: 300})
+	account := newToken(&model.Token{UseAccountQuota: true})
+	if _, err = model.AdjustTokenQuota(account.Id, 500, "test"); err != nil {
+		t.Fatal(err)
+	}
+	organization := newToken(&model.Token{OrganizationId: org.Id})
+	accountQuota := func() int {
+		current, err := model.GetUserById(user.Id, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return current.Quota
+	}
+
+	tests := []struct {
+		name      string
+		key       string
+		wantQuota int
+	}{
+		{"personal token", personal.Key, 300},
+		{"account quota token", account.Key, accountQuota()},
+		{"organization token", organization.Key, 700},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := introspect(t, client.ClientId, secret, tt.key)
+			if result["active"] != true {
+				t.Fatalf("token is not active: %v", result)
+			}
+			if quota, _ := result["remain_quota"].(float64); int(quota) != tt.wantQuota {
+				t.Fatalf("remain_quota = %v, want %d", result["remain_quota"], tt.wantQuota)
+			}
+		})
+	}
+}
+
+// TestOAuth2IntrospectIdentity 個人令牌返回所有者，組織令牌只返回組織，不返回創建者
+func TestOAuth2IntrospectIdentity(t *testing.T) {
+	client := &model.OAuth2Client{Name: "introspect identity", Introspection: true}
+	secret, err := client.Insert()
+	if err != nil {
+		t.Fatal(err)
+	}
+	creator := createTestUser(t, "introspect_creator")
+	deleted := createTestUser(t, "introspect_deleted")
+	org := &model.Organization{Name: "introspect identity", CreatedBy: creator.Id}
+	if err = org.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	newToken := func(userId int, organizationId int) *model.Token {
+		token := &model.Token{UserId: userId, OrganizationId: organizationId, Name: "identity", Status: common.TokenStatusEnabled,
+			NeverExpire: true, UnlimitedQuota: organizationId == 0}
+		if err := token.Insert(); err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	personal := newToken(creator.Id, 0)
+	organization := newToken(creator.Id, org.Id)
+	orphan := newToken(deleted.Id, 0)
+	// 只刪除用戶記錄，模擬令牌仍然存在的情況
+	model.DB.Delete(deleted)
+
+	tests := []struct {
+		name       string
+		key        string
+		wantActive bool
+		wantSub    interface{}
+		wantUser   interface{}
+		wantOrg    interface{}
+	}{
+		{"personal token", personal.Key, true, strconv.Itoa(creator.Id), creator.Username, nil},
+		{"organization token", organization.Key, true, nil, nil, float64(org.Id)},
+		{"personal token of deleted user", orphan.Key, false, nil, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := introspect(t, client.ClientId, secret, tt.key)
+			if result["active"] != tt.wantActive {
+				t.Fatalf("active = %v, want %v", result["active"], tt.wantActive)
+			}
+			if result["sub"] != tt.wantSub || result["username"] != tt.wantUser || result["organization_id"] != tt.wantOrg {
+				t.Fatalf("sub = %v, username = %v, organization_id = %v, want %v, %v, %v",
+					result["sub"], result["username"], result["organization_id"], tt.wantSub, tt.wantUser, tt.wantOrg)
+			}
+		})
+	}
+}
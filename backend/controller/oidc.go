@@ -0,0 +1,436 @@
+package controller
+
+import (
+	"account-system/common"
+	"account-system/model"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 第三方登入流程的最長時間（秒）
+const oidcFlowTimeout = 10 * 60
+
+var (
+	oidcProviders    = make(map[string]*oidc.Provider)
+	oidcProvidersMux sync.Mutex
+)
+
+// oidcClaims 從 id_token 中讀取的用戶信息
+type oidcClaims struct {
+	Email             string      `json:"email"`
+	EmailVerified     interface{} `json:"email_verified"` // 部分提供方返回字符串
+	Name              string      `json:"name"`
+	PreferredUsername string      `json:"preferred_username"`
+}
+
+func (claims *oidcClaims) verifiedEmail() string {
+	switch v := claims.EmailVerified.(type) {
+	case bool:
+		if v {
+			return claims.Email
+		}
+	case string:
+		if v == "true" {
+			return claims.Email
+		}
+	}
+	return ""
+}
+
+// getOIDCProvider 獲取提供方的發現文檔，結果按簽發者緩存
+func getOIDCProvider(ctx context.Context, config *common.OIDCProvider) (*oidc.Provider, error) {
+	oidcProvidersMux.Lock()
+	defer oidcProvidersMux.Unlock()
+	if provider, ok := oidcProviders[config.Issuer]; ok {
+		return provider, nil
+	}
+	provider, err := oidc.NewProvider(ctx, config.Issuer)
+	if err != nil {
+		return nil, err
+	}
+	oidcProviders[config.Issuer] = provider
+	return provider, nil
+}
+
+// getOAuth2Config 構造 OAuth2 客戶端配置，回調地址為前端的 /oauth/{provider} 頁面
+func getOAuth2Config(config *common.OIDCProvider, provider *oidc.Provider) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     config.ClientId,
+		ClientSecret: config.ClientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  common.ServerAddress + "/oauth/" + config.Name,
+		Scopes:       config.Scopes,
+	}
+}
+
+// GetOIDCProviders 獲取已啟用的第三方登入提供方列表
+func GetOIDCProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    common.OIDCProviders,
+	})
+}
+
+// OIDCAuthorize 生成第三方登入授權地址，action=bind 時將第三方身份綁定到當前登入用戶
+func OIDCAuthorize(c *gin.Context) {
+	config, ok := common.GetOIDCProvider(c.Param("provider"))
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "第三方登入提供方不存在或未啟用",
+		})
+		return
+	}
+	session := sessions.Default(c)
+	action := c.DefaultQuery("action", "login")
+	if action != "login" && action != "bind" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的參數",
+		})
+		return
+	}
+	if action == "bind" && session.Get("id") == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "請先登入後再綁定第三方帳戶",
+		})
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	provider, err := getOIDCProvider(ctx, config)
+	if err != nil {
+		common.SysError("failed to discover OIDC provider " + config.Name + ": " + err.Error())
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無法連接第三方登入提供方，請稍後重試",
+		})
+		return
+	}
+	state := common.GetRandomString(32)
+	nonce := common.GetRandomString(32)
+	verifier := oauth2.GenerateVerifier()
+	session.Set("oidc_provider", config.Name)
+	session.Set("oidc_action", action)
+	session.Set("oidc_state", state)
+	session.Set("oidc_nonce", nonce)
+	session.Set("oidc_verifier", verifier)
+	session.Set("oidc_time", time.Now().Unix())
+	if err = session.Save(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "保存會話失敗: " + err.Error(),
+		})
+		return
+	}
+	url := getOAuth2Config(config, provider).AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    url,
+	})
+}
+
+// OIDCCallback 處理第三方登入回調，校驗 state、nonce 並用 PKCE 交換令牌
+func OIDCCallback(c *gin.Context) {
+	config, ok := common.GetOIDCProvider(c.Param("provider"))
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "第三方登入提供方不存在或未啟用",
+		})
+		return
+	}
+	if errMsg := c.Query("error"); errMsg != "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "第三方授權失敗: " + errMsg,
+		})
+		return
+	}
+
+	// 取出並清除授權流程數據，每個 state 只能使用一次
+	session := sessions.Default(c)
+	sessionProvider, _ := session.Get("oidc_provider").(string)
+	action, _ := session.Get("oidc_action").(string)
+	state, _ := session.Get("oidc_state").(string)
+	nonce, _ := session.Get("oidc_nonce").(string)
+	verifier, _ := session.Get("oidc_verifier").(string)
+	startTime, _ := session.Get("oidc_time").(int64)
+	for _, key := range []string{"oidc_provider", "oidc_action", "oidc_state", "oidc_nonce", "oidc_verifier", "oidc_time"} {
+		session.Delete(key)
+	}
+	session.Save()
+	if state == "" || sessionProvider != config.Name || time.Now().Unix()-startTime > oidcFlowTimeout ||
+		subtle.ConstantTimeCompare([]byte(state), []byte(c.Query("state"))) != 1 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "授權狀態無效或已過期，請重新登入",
+		})
+		return
+	}
+	code := c.Query("code")
+	if code == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的參數",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	subject, claims, err := exchangeOIDCCode(ctx, config, code, verifier, nonce)
+	if err != nil {
+		common.SysError("OIDC callback of provider " + config.Name + " failed: " + err.Error())
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "第三方身份驗證失敗",
+		})
+		return
+	}
+
+	identity, err := model.GetUserIdentity(config.Name, subject)
+	if err != nil {
+		identity = nil
+	}
+	if action == "bind" {
+		bindOIDCIdentity(c, config, identity, subject, claims)
+		return
+	}
+
+	var user *model.User
+	if identity != nil {
+		user, err = model.GetUserById(identity.UserId, false)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "綁定的用戶不存在或已註銷",
+			})
+			return
+		}
+		if err = identity.UpdateLoginTime(claims.verifiedEmail()); err != nil {
+			common.SysError("failed to update identity login time: " + err.Error())
+		}
+	} else {
+		user, err = registerOIDCUser(config, subject, claims)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+	if user.Status != common.UserStatusEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "用戶已被封禁",
+		})
+		return
+	}
+	if user.TwoFactorEnabled {
+		setupPendingTwoFactor(user, c)
+		return
+	}
+	setupLogin(user, c)
+}
+
+// exchangeOIDCCode 交換授權碼並驗證 id_token，返回 subject 和用戶信息
+func exchangeOIDCCode(ctx context.Context, config *common.OIDCProvider, code, verifier, nonce string) (string, *oidcClaims, error) {
+	provider, err := getOIDCProvider(ctx, config)
+	if err != nil {
+		return "", nil, err
+	}
+	token, err := getOAuth2Config(config, provider).Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return "", nil, err
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return "", nil, errors.New("token response does not contain id_token")
+	}
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: config.ClientId}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return "", nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(nonce)) != 1 {
+		return "", nil, errors.New("id_token nonce mismatch")
+	}
+	var claims oidcClaims
+	if err = idToken.Claims(&claims); err != nil {
+		return "", nil, err
+	}
+	return idToken.Subject, &claims, nil
+}
+
+// bindOIDCIdentity 將第三方身份綁定到當前登入用戶
+func bindOIDCIdentity(c *gin.Context, config *common.OIDCProvider, identity *model.UserIdentity, subject string, claims *oidcClaims) {
+	userId, ok := sessions.Default(c).Get("id").(int)
+	if !ok || userId == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "請先登入後再綁定第三方帳戶",
+		})
+		return
+	}
+	if identity != nil {
+		if identity.UserId != userId {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "該第三方帳戶已綁定其他用戶",
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "該第三方帳戶已綁定",
+		})
+		return
+	}
+	identity = &model.UserIdentity{
+		UserId:   userId,
+		Provider: config.Name,
+		Subject:  subject,
+		Email:    claims.verifiedEmail(),
+	}
+	if err := identity.Insert(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "綁定成功",
+		"data":    identity,
+	})
+}
+
+// registerOIDCUser 為首次登入的第三方身份自動創建用戶
+func registerOIDCUser(config *common.OIDCProvider, subject string, claims *oidcClaims) (*model.User, error) {
+	if !common.RegisterEnabled {
+		return nil, errors.New("管理員關閉了新用戶註冊")
+	}
+	email := claims.verifiedEmail()
+	if email != "" {
+		exist, err := model.CheckUserExistOrDeleted("", email)
+		if err != nil {
+			common.SysError("CheckUserExistOrDeleted error: " + err.Error())
+			return nil, errors.New("數據庫錯誤，請稍後重試")
+		}
+		if exist {
+			return nil, errors.New("該郵箱已被註冊，請使用原有方式登入後在個人設置中綁定")
+		}
+	}
+	candidate := claims.PreferredUsername
+	if candidate == "" && email != "" {
+		candidate = strings.Split(email, "@")[0]
+	}
+	if candidate == "" {
+		candidate = config.Name + "_" + strconv.Itoa(model.GetMaxUserId()+1)
+	}
+	username, err := model.GetAvailableUsername(candidate)
+	if err != nil {
+		return nil, err
+	}
+	displayName := claims.Name
+	if displayName == "" {
+		displayName = username
+	}
+	user := &model.User{
+		Username:      username,
+		DisplayName:   displayName,
+		Email:         email,
+		EmailVerified: email != "",
+		Role:          common.RoleCommonUser,
+		Status:        common.UserStatusEnabled,
+	}
+	identity := &model.UserIdentity{
+		Provider: config.Name,
+		Subject:  subject,
+		Email:    email,
+	}
+	if err = user.InsertWithIdentity(identity); err != nil {
+		return nil, err
+	}
+	common.SysLog("user " + username + " registered via OIDC provider " + config.Name)
+	return user, nil
+}
+
+// GetSelfIdentities 獲取當前用戶綁定的第三方身份
+func GetSelfIdentities(c *gin.Context) {
+	identities, err := model.GetUserIdentitiesByUserId(c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "獲取成功",
+		"data":    identities,
+	})
+}
+
+// DeleteSelfIdentity 解除第三方身份綁定
+func DeleteSelfIdentity(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的 ID",
+		})
+		return
+	}
+	userId := c.GetInt("id")
+	identity, err := model.GetUserIdentityById(id)
+	if err != nil || identity.UserId != userId {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "綁定不存在",
+		})
+		return
+	}
+	count, err := model.CountUserLoginMethods(userId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if count <= 1 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "這是您唯一的登入方式，請先設置密碼或綁定其他帳戶",
+		})
+		return
+	}
+	if err = identity.Delete(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "解除綁定成功",
+	})
+}
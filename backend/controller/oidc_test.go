@@ -0,0 +1,285 @@
+package controller
+
+import (
+	"account-system/common"
+	"account-system/model"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockIdP 模擬的 OpenID Connect 提供方，支持發現文檔、JWKS 和帶 PKCE 校驗的令牌端點
+type mockIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	mu     sync.Mutex
+	codes  map[string]mockIdPGrant
+}
+
+// mockIdPGrant 授權碼對應的授權信息
+type mockIdPGrant struct {
+	challenge string
+	nonce     string
+	subject   string
+	email     string
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &mockIdP{key: key, codes: make(map[string]mockIdPGrant)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		issuer := idp.server.URL
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                issuer,
+			"authorization_endpoint":                issuer + "/authorize",
+			"token_endpoint":                        issuer + "/token",
+			"jwks_uri":                              issuer + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test",
+				"alg": "RS256",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", idp.token)
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// token 兌換授權碼，code_verifier 必須與授權請求中的 code_challenge 匹配
+func (idp *mockIdP) token(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	idp.mu.Lock()
+	grant, ok := idp.codes[r.PostForm.Get("code")]
+	delete(idp.codes, r.PostForm.Get("code"))
+	idp.mu.Unlock()
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+	claims := jwt.MapClaims{
+		"iss":            idp.server.URL,
+		"sub":            grant.subject,
+		"aud":            "test-client",
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(time.Minute).Unix(),
+		"nonce":          grant.nonce,
+		"email":          grant.email,
+		"email_verified": grant.email != "",
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test"
+	idToken, err := token.SignedString(idp.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   60,
+		"id_token":     idToken,
+	})
+}
+
+// authorize 模擬用戶在提供方同意授權，返回授權碼；modify 可以篡改授權信息
+func (idp *mockIdP) authorize(t *testing.T, authURL, subject, email string, modify func(grant *mockIdPGrant)) (code, state string) {
+	t.Helper()
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		t.Fatalf("authorization request without PKCE: %s", authURL)
+	}
+	grant := mockIdPGrant{
+		challenge: query.Get("code_challenge"),
+		nonce:     query.Get("nonce"),
+		subject:   subject,
+		email:     email,
+	}
+	if modify != nil {
+		modify(&grant)
+	}
+	code = common.GetRandomString(16)
+	idp.mu.Lock()
+	idp.codes[code] = grant
+	idp.mu.Unlock()
+	return code, query.Get("state")
+}
+
+func setupOIDCTest(t *testing.T) *mockIdP {
+	t.Helper()
+	idp := newMockIdP(t)
+	providers, registerEnabled := common.OIDCProviders, common.RegisterEnabled
+	common.OIDCProviders = []common.OIDCProvider{{
+		Name:        "mock",
+		DisplayName: "Mock",
+		Issuer:      idp.server.URL,
+		ClientId:    "test-client",
+		Scopes:      []string{"openid", "email"},
+	}}
+	common.RegisterEnabled = true
+	t.Cleanup(func() {
+		common.OIDCProviders, common.RegisterEnabled = providers, registerEnabled
+	})
+	return idp
+}
+
+func newOIDCClient(t *testing.T) *testClient {
+	return newTestClient(t, func(engine *gin.Engine) {
+		engine.GET("/oauth/:provider/authorize", OIDCAuthorize)
+		engine.GET("/oauth/:provider/callback", OIDCCallback)
+		// 模擬密碼登入，用於測試綁定
+		engine.POST("/test/login/:id", func(c *gin.Context) {
+			id, _ := strconv.Atoi(c.Param("id"))
+			session := sessions.Default(c)
+			session.Set("id", id)
+			_ = session.Save()
+			c.JSON(http.StatusOK, gin.H{"success": true})
+		})
+	})
+}
+
+func TestOIDCCallback(t *testing.T) {
+	idp := setupOIDCTest(t)
+	tests := []struct {
+		name    string
+		subject string
+		modify  func(grant *mockIdPGrant)
+		state   func(state string) string
+		wantOK  bool
+	}{
+		{name: "valid", subject: "subject-valid", wantOK: true},
+		{name: "state mismatch", subject: "subject-state", state: func(string) string { return "forged" }},
+		{name: "missing state", subject: "subject-no-state", state: func(string) string { return "" }},
+		{name: "nonce mismatch", subject: "subject-nonce", modify: func(grant *mockIdPGrant) { grant.nonce = "forged" }},
+		{name: "pkce mismatch", subject: "subject-pkce", modify: func(grant *mockIdPGrant) { grant.challenge = "forged" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newOIDCClient(t)
+			authURL := mustSucceed(t, client.do(t, "GET", "/oauth/mock/authorize", nil)).(string)
+			code, state := idp.authorize(t, authURL, tt.subject, "", tt.modify)
+			if tt.state != nil {
+				state = tt.state(state)
+			}
+			result := client.do(t, "GET", "/oauth/mock/callback?code="+code+"&state="+url.QueryEscape(state), nil)
+			if ok := result["success"] == true; ok != tt.wantOK {
+				t.Fatalf("success = %v, want %v: %v", ok, tt.wantOK, result["message"])
+			}
+			_, err := model.GetUserIdentity("mock", tt.subject)
+			if linked := err == nil; linked != tt.wantOK {
+				t.Fatalf("identity linked = %v, want %v", linked, tt.wantOK)
+			}
+		})
+	}
+
+	t.Run("state is single use", func(t *testing.T) {
+		client := newOIDCClient(t)
+		authURL := mustSucceed(t, client.do(t, "GET", "/oauth/mock/authorize", nil)).(string)
+		code, state := idp.authorize(t, authURL, "subject-replay", "", nil)
+		callback := "/oauth/mock/callback?code=" + code + "&state=" + url.QueryEscape(state)
+		mustSucceed(t, client.do(t, "GET", callback, nil))
+		if result := client.do(t, "GET", callback, nil); result["success"] == true {
+			t.Fatal("callback with used state was accepted")
+		}
+	})
+}
+
+func TestOIDCIdentityLinking(t *testing.T) {
+	idp := setupOIDCTest(t)
+	login := func(t *testing.T, client *testClient, subject, email string) map[string]interface{} {
+		t.Helper()
+		authURL := mustSucceed(t, client.do(t, "GET", "/oauth/mock/authorize", nil)).(string)
+		code, state := idp.authorize(t, authURL, subject, email, nil)
+		return client.do(t, "GET", "/oauth/mock/callback?code="+code+"&state="+url.QueryEscape(state), nil)
+	}
+	bind := func(t *testing.T, client *testClient, userId int, subject string) map[string]interface{} {
+		t.Helper()
+		mustSucceed(t, client.do(t, "POST", "/test/login/"+strconv.Itoa(userId), nil))
+		authURL := mustSucceed(t, client.do(t, "GET", "/oauth/mock/authorize?action=bind", nil)).(string)
+		code, state := idp.authorize(t, authURL, subject, "", nil)
+		return client.do(t, "GET", "/oauth/mock/callback?code="+code+"&state="+url.QueryEscape(state), nil)
+	}
+
+	// 首次登入創建用戶並綁定身份，再次登入使用同一用戶
+	first := mustSucceed(t, login(t, newOIDCClient(t), "subject-link", "link@example.com")).(map[string]interface{})
+	second := mustSucceed(t, login(t, newOIDCClient(t), "subject-link", "link@example.com")).(map[string]interface{})
+	if first["id"] != second["id"] {
+		t.Fatalf("second login created user %v, want %v", second["id"], first["id"])
+	}
+	if first["email"] != "link@example.com" {
+		t.Fatalf("verified email = %v, want link@example.com", first["email"])
+	}
+
+	// 其他身份使用已註冊的郵箱時不能自動創建或接管帳戶
+	if result := login(t, newOIDCClient(t), "subject-takeover", "link@example.com"); result["success"] == true {
+		t.Fatal("identity with registered email took over the account")
+	}
+
+	owner := createTestUser(t, "oidc_owner")
+	other := createTestUser(t, "oidc_other")
+	tests := []struct {
+		name    string
+		userId  int
+		subject string
+		wantOK  bool
+	}{
+		{"bind new identity", owner.Id, "subject-bind", true},
+		{"bind again", owner.Id, "subject-bind", true},
+		{"bind identity of other user", other.Id, "subject-bind", false},
+		{"bind identity registered by login", other.Id, "subject-link", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := bind(t, newOIDCClient(t), tt.userId, tt.subject)
+			if ok := result["success"] == true; ok != tt.wantOK {
+				t.Fatalf("success = %v, want %v: %v", ok, tt.wantOK, result["message"])
+			}
+		})
+	}
+	identity, err := model.GetUserIdentity("mock", "subject-bind")
+	if err != nil || identity.UserId != owner.Id {
+		t.Fatalf("identity bound to %+v, want user %d", identity, owner.Id)
+	}
+
+	t.Run("bind requires login", func(t *testing.T) {
+		client := newOIDCClient(t)
+		if result := client.do(t, "GET", "/oauth/mock/authorize?action=bind", nil); result["success"] == true {
+			t.Fatal("bind started without login")
+		}
+	})
+}
@@ -0,0 +1,446 @@
+package controller
+
+import (
+	"account-system/common"
+	"account-system/model"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+// organizationRole 檢查當前用戶在路徑參數 id 指定的組織中的角色不低於 minRole，
+// 返回組織 ID 和當前用戶的角色，不滿足時返回錯誤響應
+func organizationRole(c *gin.Context, minRole string) (int, string, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的組織 ID",
+		})
+		return 0, "", false
+	}
+	role := model.GetOrganizationRole(id, c.GetInt("id"))
+	if role == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "組織不存在或您不是組織成員",
+		})
+		return 0, "", false
+	}
+	if common.OrganizationRoleRank(role) < common.OrganizationRoleRank(minRole) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無權進行此操作，組織權限不足",
+		})
+		return 0, "", false
+	}
+	return id, role, true
+}
+
+// GetSelfOrganizations 獲取當前用戶所在的組織
+func GetSelfOrganizations(c *gin.Context) {
+	orgs, err := model.GetOrganizationsByUserId(c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "獲取成功",
+		"data":    orgs,
+	})
+}
+
+// CreateOrganization 創建組織，創建者成為所有者
+func CreateOrganization(c *gin.Context) {
+	var org model.Organization
+	if err := json.NewDecoder(c.Request.Body).Decode(&org); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的參數",
+		})
+		return
+	}
+	org.CreatedBy = c.GetInt("id")
+	if err := org.Insert(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "創建成功",
+		"data":    org,
+	})
+}
+
+// GetOrganization 獲取組織信息（組織成員）
+func GetOrganization(c *gin.Context) {
+	id, role, ok := organizationRole(c, common.OrganizationRoleMember)
+	if !ok {
+		return
+	}
+	org, err := model.GetOrganizationById(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "組織不存在",
+		})
+		return
+	}
+	org.Role = role
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "獲取成功",
+		"data":    org,
+	})
+}
+
+// UpdateOrganization 更新組織名稱和描述（組織管理員）
+func UpdateOrganization(c *gin.Context) {
+	id, _, ok := organizationRole(c, common.OrganizationRoleAdmin)
+	if !ok {
+		return
+	}
+	var req struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的參數",
+		})
+		return
+	}
+	org := model.Organization{Id: id, Name: req.Name, Description: req.Description}
+	if err := org.Update(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "更新成功",
+	})
+}
+
+// DeleteOrganization 刪除組織及其令牌（組織所有者）
+func DeleteOrganization(c *gin.Context) {
+	id, _, ok := organizationRole(c, common.OrganizationRoleOwner)
+	if !ok {
+		return
+	}
+	org, err := model.GetOrganizationById(id)
+	if err == nil {
+		err = org.Delete()
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	common.SysLog(fmt.Sprintf("user %d deleted organization %d", c.GetInt("id"), id))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "刪除成功",
+	})
+}
+
+// GetOrganizationMembers 獲取組織成員（組織成員）
+func GetOrganizationMembers(c *gin.Context) {
+	id, _, ok := organizationRole(c, common.OrganizationRoleMember)
+	if !ok {
+		return
+	}
+	members, err := model.GetOrganizationMembers(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "獲取成功",
+		"data":    members,
+	})
+}
+
+// UpdateOrganizationMember 修改成員角色（組織管理員）
+func UpdateOrganizationMember(c *gin.Context) {
+	id, role, ok := organizationRole(c, common.OrganizationRoleAdmin)
+	if !ok {
+		return
+	}
+	var req struct {
+		UserId int    `json:"user_id"`
+		Role   string `json:"role"`
+	}
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil || req.UserId == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的參數",
+		})
+		return
+	}
+	if err := model.SetOrganizationMemberRole(id, req.UserId, req.Role, role); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "更新成功",
+	})
+}
+
+// RemoveOrganizationMember 移除成員或退出組織
+func RemoveOrganizationMember(c *gin.Context) {
+	id, role, ok := organizationRole(c, common.OrganizationRoleMember)
+	if !ok {
+		return
+	}
+	userId, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的用戶 ID",
+		})
+		return
+	}
+	if err = model.RemoveOrganizationMember(id, userId, c.GetInt("id"), role); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "移除成功",
+	})
+}
+
+// GetOrganizationInvitations 獲取組織尚未處理的邀請（組織管理員）
+func GetOrganizationInvitations(c *gin.Context) {
+	id, _, ok := organizationRole(c, common.OrganizationRoleAdmin)
+	if !ok {
+		return
+	}
+	invitations, err := model.GetOrganizationInvitations(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "獲取成功",
+		"data":    invitations,
+	})
+}
+
+// InviteOrganizationMember 通過用戶名邀請用戶加入組織（組織管理員）
+func InviteOrganizationMember(c *gin.Context) {
+	id, role, ok := organizationRole(c, common.OrganizationRoleAdmin)
+	if !ok {
+		return
+	}
+	var req struct {
+		Username string `json:"username"`
+		Role     string `json:"role"`
+	}
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil || req.Username == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的參數",
+		})
+		return
+	}
+	if req.Role == "" {
+		req.Role = common.OrganizationRoleMember
+	}
+	user, err := model.GetUserByUsername(req.Username)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "用戶不存在",
+		})
+		return
+	}
+	invitation, err := model.InviteOrganizationMember(id, user.Id, req.Role, c.GetInt("id"), role)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "邀請已發送",
+		"data":    invitation,
+	})
+}
+
+// DeleteOrganizationInvitation 撤銷邀請（組織管理員）
+func DeleteOrganizationInvitation(c *gin.Context) {
+	id, _, ok := organizationRole(c, common.OrganizationRoleAdmin)
+	if !ok {
+		return
+	}
+	invitationId, err := strconv.Atoi(c.Param("invitation_id"))
+	if err == nil {
+		err = model.DeleteOrganizationInvitation(invitationId, id)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "已撤銷邀請",
+	})
+}
+
+// GetSelfOrganizationInvitations 獲取當前用戶收到的邀請
+func GetSelfOrganizationInvitations(c *gin.Context) {
+	invitations, err := model.GetUserOrganizationInvitations(c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "獲取成功",
+		"data":    invitations,
+	})
+}
+
+// AcceptOrganizationInvitation 接受邀請
+func AcceptOrganizationInvitation(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的邀請 ID",
+		})
+		return
+	}
+	member, err := model.AcceptOrganizationInvitation(id, c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "已加入組織",
+		"data":    member,
+	})
+}
+
+// DeclineOrganizationInvitation 拒絕邀請
+func DeclineOrganizationInvitation(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err == nil {
+		err = model.DeclineOrganizationInvitation(id, c.GetInt("id"))
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "已拒絕邀請",
+	})
+}
+
+// GetOrganizationQuotaLedger 分頁獲取組織額度的流水（組織成員）
+func GetOrganizationQuotaLedger(c *gin.Context) {
+	id, _, ok := organizationRole(c, common.OrganizationRoleMember)
+	if !ok {
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+	entries, total, err := model.GetOrganizationQuotaLedger(id, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "獲取成功",
+		"data":    entries,
+		"total":   total,
+	})
+}
+
+// AdjustOrganizationQuota 調整組織額度（管理員），amount 為負數時扣減
+func AdjustOrganizationQuota(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的組織 ID",
+		})
+		return
+	}
+	var req QuotaRequest
+	if err = json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的參數",
+		})
+		return
+	}
+	if reason := []rune(req.Reason); len(reason) > 255 {
+		req.Reason = string(reason[:255])
+	}
+	entry, err := model.AdjustOrganizationQuota(id, req.Amount, req.Reason)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	common.SysLog(fmt.Sprintf("user %d adjusted quota of organization %d by %d", c.GetInt("id"), id, req.Amount))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "調整成功",
+		"data":    entry,
+	})
+}
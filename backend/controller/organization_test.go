@@ -0,0 +1,196 @@
+package controller
+
+import (
+	"account-system/common"
+	"account-system/middleware"
+	"account-system/model"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTokenAPIEngine 註冊與 /api/v1 相同的令牌訪問路由
+func newTokenAPIEngine() *gin.Engine {
+	engine := gin.New()
+	v1 := engine.Group("/v1")
+	v1.Use(middleware.TokenAuth())
+	v1.GET("/self", middleware.RequirePersonalToken(), middleware.RequireScopes(common.TokenScopeUserRead), GetSelf)
+	v1.GET("/token", middleware.RequireScopes(common.TokenScopeTokenRead), GetAllTokens)
+	v1.POST("/token", middleware.RequireScopes(common.TokenScopeTokenWrite), AddToken)
+	v1.PUT("/token", middleware.RequireScopes(common.TokenScopeTokenWrite), UpdateToken)
+	return engine
+}
+
+// doWithToken 以 API 令牌發送 JSON 請求，返回狀態碼和響應
+func doWithToken(t *testing.T, engine *gin.Engine, method, path, key string, body interface{}) (int, map[string]interface{}) {
+	t.Helper()
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+key)
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, req)
+	var result map[string]interface{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &result); err != nil {
+		t.Fatalf("%s %s: decode response: %v", method, path, err)
+	}
+	return recorder.Code, result
+}
+
+// createOrganizationWithMember 創建組織，並以指定角色加入成員
+func createOrganizationWithMember(t *testing.T, owner *model.User, member *model.User, role string) *model.Organization {
+	t.Helper()
+	org := &model.Organization{Name: "org-" + owner.Username, CreatedBy: owner.Id}
+	if err := org.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	invitation, err := model.InviteOrganizationMember(org.Id, member.Id, role, owner.Id, common.OrganizationRoleOwner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = model.AcceptOrganizationInvitation(invitation.Id, member.Id); err != nil {
+		t.Fatal(err)
+	}
+	return org
+}
+
+func TestOrganizationTokenIdentity(t *testing.T) {
+	// 組織令牌的創建者是管理員，組織令牌不能借用其身份和權限
+	creator := createTestAdmin(t, "org_token_creator")
+	member := createTestUser(t, "org_token_member")
+	org := createOrganizationWithMember(t, creator, member, common.OrganizationRoleMember)
+	scopes := []string{common.TokenScopeUserRead, common.TokenScopeTokenRead, common.TokenScopeTokenWrite}
+	newToken := func(organizationId int) *model.Token {
+		token := &model.Token{UserId: creator.Id, OrganizationId: organizationId, Name: "identity", Status: common.TokenStatusEnabled,
+			NeverExpire: true, UnlimitedQuota: organizationId == 0, Scopes: scopes}
+		if err := token.Insert(); err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	orgToken := newToken(org.Id)
+	personalToken := newToken(0)
+	engine := newTokenAPIEngine()
+
+	tests := []struct {
+		name        string
+		key         string
+		method      string
+		path        string
+		body        map[string]interface{}
+		wantStatus  int
+		wantSuccess bool
+	}{
+		{"personal token reads self", personalToken.Key, "GET", "/v1/self", nil, http.StatusOK, true},
+		{"organization token cannot read self", orgToken.Key, "GET", "/v1/self", nil, http.StatusForbidden, false},
+		{"organization token lists organization tokens", orgToken.Key, "GET", "/v1/token", nil, http.StatusOK, true},
+		{"organization token cannot update creator's token", orgToken.Key, "PUT", "/v1/token",
+			map[string]interface{}{"id": personalToken.Id, "name": "hijacked", "never_expire": true}, http.StatusOK, false},
+		{"organization token updates organization token", orgToken.Key, "PUT", "/v1/token",
+			map[string]interface{}{"id": orgToken.Id, "name": "identity", "status": common.TokenStatusEnabled, "never_expire": true, "scopes": scopes}, http.StatusOK, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, result := doWithToken(t, engine, tt.method, tt.path, tt.key, tt.body)
+			if status != tt.wantStatus || (result["success"] == true) != tt.wantSuccess {
+				t.Fatalf("status = %d, success = %v, want %d, %v: %v", status, result["success"], tt.wantStatus, tt.wantSuccess, result["message"])
+			}
+		})
+	}
+
+	t.Run("organization token creates token without admin privileges", func(t *testing.T) {
+		_, result := doWithToken(t, engine, "POST", "/v1/token", orgToken.Key,
+			map[string]interface{}{"name": "created", "remain_quota": 1000, "organization_id": 0})
+		data := mustSucceed(t, result).(map[string]interface{})
+		created, err := model.GetTokenById(int(data["id"].(float64)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if created.OrganizationId != org.Id || created.UserId != creator.Id || created.RemainQuota != 0 || created.UnlimitedQuota {
+			t.Fatalf("created token = %+v, want organization %d, creator %d and no quota", created, org.Id, creator.Id)
+		}
+	})
+	t.Run("personal token unchanged", func(t *testing.T) {
+		current, _ := model.GetTokenById(personalToken.Id)
+		if current.Name != "identity" {
+			t.Fatalf("personal token name = %q", current.Name)
+		}
+	})
+}
+
+func TestOrganizationTokenUsages(t *testing.T) {
+	owner := createTestUser(t, "org_usage_owner")
+	admin := createTestUser(t, "org_usage_admin")
+	member := createTestUser(t, "org_usage_member")
+	outsider := createTestUser(t, "org_usage_outsider")
+	org := createOrganizationWithMember(t, owner, admin, common.OrganizationRoleAdmin)
+	invitation, err := model.InviteOrganizationMember(org.Id, member.Id, common.OrganizationRoleMember, owner.Id, common.OrganizationRoleOwner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = model.AcceptOrganizationInvitation(invitation.Id, member.Id); err != nil {
+		t.Fatal(err)
+	}
+	orgToken := &model.Token{UserId: owner.Id, OrganizationId: org.Id, Name: "usage", Status: common.TokenStatusEnabled,
+		NeverExpire: true, Scopes: []string{common.TokenScopeTokenRead}}
+	if err = orgToken.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	personalToken := &model.Token{UserId: owner.Id, Name: "usage", Status: common.TokenStatusEnabled,
+		NeverExpire: true, UnlimitedQuota: true, Scopes: []string{common.TokenScopeTokenRead}}
+	if err = personalToken.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	engine := newTokenAPIEngine()
+	doWithToken(t, engine, "GET", "/v1/token", orgToken.Key, nil)
+	doWithToken(t, engine, "GET", "/v1/token", personalToken.Key, nil)
+	// 使用記錄異步寫入，StopJobs 會寫入隊列中的記錄
+	if err = model.StopJobs(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	query := func(userId int, path string) map[string]interface{} {
+		return newTestClient(t, func(engine *gin.Engine) {
+			engine.Use(withUserId(userId))
+			engine.GET("/org/:id/usage", GetOrganizationTokenUsages)
+			engine.GET("/token/usage", GetSelfTokenUsages)
+		}).do(t, "GET", path, nil)
+	}
+	orgPath := fmt.Sprintf("/org/%d/usage", org.Id)
+	tests := []struct {
+		name        string
+		userId      int
+		path        string
+		wantSuccess bool
+		wantTokens  []int
+	}{
+		{"owner", owner.Id, orgPath, true, []int{orgToken.Id}},
+		{"organization admin", admin.Id, orgPath, true, []int{orgToken.Id}},
+		{"member", member.Id, orgPath, false, nil},
+		{"outsider", outsider.Id, orgPath, false, nil},
+		{"self usage excludes organization tokens", owner.Id, "/token/usage", true, []int{personalToken.Id}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := query(tt.userId, tt.path)
+			if (result["success"] == true) != tt.wantSuccess {
+				t.Fatalf("success = %v, want %v: %v", result["success"], tt.wantSuccess, result["message"])
+			}
+			if !tt.wantSuccess {
+				return
+			}
+			var tokens []int
+			for _, usage := range result["data"].([]interface{}) {
+				tokens = append(tokens, int(usage.(map[string]interface{})["token_id"].(float64)))
+			}
+			if fmt.Sprint(tokens) != fmt.Sprint(tt.wantTokens) {
+				t.Fatalf("usages of tokens %v, want %v", tokens, tt.wantTokens)
+			}
+		})
+	}
+}
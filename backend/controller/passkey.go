@@ -0,0 +1,474 @@
+package controller
+
+import (
+	"account-system/common"
+	"account-system/model"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// PasskeyLoginRequest 通行密鑰登入請求，username 為空時使用可發現憑證登入
+type PasskeyLoginRequest struct {
+	Username string `json:"username"`
+}
+
+// decoyPasskeyMaxCredentials 虛構用戶最多返回的憑證數量
+const decoyPasskeyMaxCredentials = 3
+
+// decoyPasskeyUser 代替不存在或未註冊通行密鑰的用戶開始登入，使響應與真實用戶的形式相同，避免枚舉用戶名；
+// 憑證數量和 ID 由用戶名經 HMAC 確定性生成，重複請求返回相同的憑證，不同用戶名的憑證數量不同
+type decoyPasskeyUser struct {
+	username string
+}
+
+// WebAuthnID 返回無法解析為用戶的句柄，完成登入時必然失敗
+func (u *decoyPasskeyUser) WebAuthnID() []byte {
+	return []byte("0")
+}
+
+func (u *decoyPasskeyUser) WebAuthnName() string {
+	return u.username
+}
+
+func (u *decoyPasskeyUser) WebAuthnDisplayName() string {
+	return u.username
+}
+
+func (u *decoyPasskeyUser) WebAuthnIcon() string {
+	return ""
+}
+
+func (u *decoyPasskeyUser) WebAuthnCredentials() []webauthn.Credential {
+	username := strings.ToLower(u.username)
+	sum, _ := hex.DecodeString(common.HashTokenKey("passkey-count:" + username))
+	credentials := make([]webauthn.Credential, 1+int(sum[0])%decoyPasskeyMaxCredentials)
+	for i := range credentials {
+		sum, _ = hex.DecodeString(common.HashTokenKey("passkey:" + username + ":" + strconv.Itoa(i)))
+		credentials[i].ID = sum[:16]
+	}
+	return credentials
+}
+
+// newWebAuthn 根據當前配置創建 WebAuthn 實例
+func newWebAuthn() (*webauthn.WebAuthn, error) {
+	if common.WebAuthnRPID == "" || len(common.WebAuthnRPOrigins) == 0 {
+		return nil, errors.New("管理員未配置通行密鑰")
+	}
+	return webauthn.New(&webauthn.Config{
+		RPID:          common.WebAuthnRPID,
+		RPDisplayName: common.SystemName,
+		RPOrigins:     common.WebAuthnRPOrigins,
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementPreferred,
+			UserVerification: protocol.VerificationPreferred,
+		},
+	})
+}
+
+// saveWebAuthnSession 將 WebAuthn 儀式數據保存到會話中
+func saveWebAuthnSession(c *gin.Context, key string, data *webauthn.SessionData) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	session := sessions.Default(c)
+	session.Set(key, string(raw))
+	return session.Save()
+}
+
+// loadWebAuthnSession 從會話中取出 WebAuthn 儀式數據，取出後即刪除，防止重放
+func loadWebAuthnSession(c *gin.Context, key string) (*webauthn.SessionData, error) {
+	session := sessions.Default(c)
+	raw, ok := session.Get(key).(string)
+	session.Delete(key)
+	session.Save()
+	if !ok || raw == "" {
+		return nil, errors.New("通行密鑰會話不存在或已過期，請重試")
+	}
+	var data webauthn.SessionData
+	if err := json.Unmarshal([]byte(raw), &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// webAuthnErrorMessage 提取 WebAuthn 錯誤的詳細信息
+func webAuthnErrorMessage(err error) string {
+	var protocolErr *protocol.Error
+	if errors.As(err, &protocolErr) && protocolErr.DevInfo != "" {
+		return protocolErr.Details + ": " + protocolErr.DevInfo
+	}
+	return err.Error()
+}
+
+// GetPasskeys 獲取當前用戶的通行密鑰列表
+func GetPasskeys(c *gin.Context) {
+	passkeys, err := model.GetPasskeysByUserId(c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "獲取成功",
+		"data":    passkeys,
+	})
+}
+
+// BeginPasskeyRegistration 開始註冊通行密鑰
+func BeginPasskeyRegistration(c *gin.Context) {
+	wa, err := newWebAuthn()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	user, err := model.GetUserById(c.GetInt("id"), false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	passkeyUser, err := model.NewPasskeyUser(user)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	// 排除已註冊的憑證，避免同一驗證器重複註冊
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(passkeyUser.Passkeys))
+	for _, credential := range passkeyUser.WebAuthnCredentials() {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+	options, data, err := wa.BeginRegistration(passkeyUser, webauthn.WithExclusions(exclusions))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": webAuthnErrorMessage(err),
+		})
+		return
+	}
+	if err = saveWebAuthnSession(c, "passkey_registration", data); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "保存會話失敗: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    options,
+	})
+}
+
+// FinishPasskeyRegistration 完成註冊通行密鑰，請求體為瀏覽器返回的憑證，名稱通過 name 查詢參數傳入
+func FinishPasskeyRegistration(c *gin.Context) {
+	wa, err := newWebAuthn()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	data, err := loadWebAuthnSession(c, "passkey_registration")
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	user, err := model.GetUserById(c.GetInt("id"), false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	passkeyUser, err := model.NewPasskeyUser(user)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	parsed, err := protocol.ParseCredentialCreationResponseBody(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的憑證: " + webAuthnErrorMessage(err),
+		})
+		return
+	}
+	credential, err := wa.CreateCredential(passkeyUser, *data, parsed)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "通行密鑰驗證失敗: " + webAuthnErrorMessage(err),
+		})
+		return
+	}
+	name := strings.TrimSpace(c.Query("name"))
+	if name == "" {
+		name = "通行密鑰 " + strconv.Itoa(len(passkeyUser.Passkeys)+1)
+	}
+	passkey := model.NewPasskeyFromCredential(user.Id, name, credential)
+	if err = passkey.Insert(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "通行密鑰註冊成功",
+		"data":    passkey,
+	})
+}
+
+// UpdatePasskey 重命名通行密鑰
+func UpdatePasskey(c *gin.Context) {
+	var req model.Passkey
+	err := json.NewDecoder(c.Request.Body).Decode(&req)
+	req.Name = strings.TrimSpace(req.Name)
+	if err != nil || req.Id == 0 || req.Name == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的參數",
+		})
+		return
+	}
+	passkey, err := model.GetPasskeyById(req.Id)
+	if err != nil || passkey.UserId != c.GetInt("id") {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "通行密鑰不存在",
+		})
+		return
+	}
+	passkey.Name = req.Name
+	if err = passkey.UpdateName(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "更新成功",
+	})
+}
+
+// DeletePasskey 刪除通行密鑰
+func DeletePasskey(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的通行密鑰 ID",
+		})
+		return
+	}
+	passkey, err := model.GetPasskeyById(id)
+	if err != nil || passkey.UserId != c.GetInt("id") {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "通行密鑰不存在",
+		})
+		return
+	}
+	if err = passkey.Delete(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "刪除成功",
+	})
+}
+
+// BeginPasskeyLogin 開始通行密鑰登入
+func BeginPasskeyLogin(c *gin.Context) {
+	if !common.PasskeyLoginEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "管理員關閉了通行密鑰登入",
+		})
+		return
+	}
+	wa, err := newWebAuthn()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	var req PasskeyLoginRequest
+	// 請求體可以為空
+	_ = json.NewDecoder(c.Request.Body).Decode(&req)
+	req.Username = strings.TrimSpace(req.Username)
+
+	var options *protocol.CredentialAssertion
+	var data *webauthn.SessionData
+	if req.Username == "" {
+		options, data, err = wa.BeginDiscoverableLogin()
+	} else {
+		var user *model.User
+		var passkeyUser *model.PasskeyUser
+		user, err = model.GetUserByUsername(req.Username)
+		if err == nil {
+			passkeyUser, err = model.NewPasskeyUser(user)
+		}
+		if err == nil && len(passkeyUser.Passkeys) > 0 {
+			options, data, err = wa.BeginLogin(passkeyUser)
+		} else {
+			// 用戶不存在或未註冊通行密鑰時返回相同形式的響應
+			options, data, err = wa.BeginLogin(&decoyPasskeyUser{username: req.Username})
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": webAuthnErrorMessage(err),
+		})
+		return
+	}
+	if err = saveWebAuthnSession(c, "passkey_login", data); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "保存會話失敗: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    options,
+	})
+}
+
+// FinishPasskeyLogin 完成通行密鑰登入
+func FinishPasskeyLogin(c *gin.Context) {
+	if !common.PasskeyLoginEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "管理員關閉了通行密鑰登入",
+		})
+		return
+	}
+	wa, err := newWebAuthn()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	data, err := loadWebAuthnSession(c, "passkey_login")
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBody(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的憑證: " + webAuthnErrorMessage(err),
+		})
+		return
+	}
+
+	var passkeyUser *model.PasskeyUser
+	loadUser := func(userHandle []byte) (*model.PasskeyUser, error) {
+		id, err := model.ParseUserHandle(userHandle)
+		if err != nil {
+			return nil, err
+		}
+		user, err := model.GetUserById(id, false)
+		if err != nil {
+			return nil, err
+		}
+		return model.NewPasskeyUser(user)
+	}
+	var credential *webauthn.Credential
+	if len(data.UserID) == 0 {
+		credential, err = wa.ValidateDiscoverableLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+			passkeyUser, err = loadUser(userHandle)
+			return passkeyUser, err
+		}, *data, parsed)
+	} else {
+		passkeyUser, err = loadUser(data.UserID)
+		if err != nil {
+			// 與憑證不屬於該用戶時的錯誤相同，不暴露用戶是否存在
+			err = protocol.ErrBadRequest.WithDetails("User does not own the credential returned")
+		} else {
+			credential, err = wa.ValidateLogin(passkeyUser, *data, parsed)
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "通行密鑰驗證失敗: " + webAuthnErrorMessage(err),
+		})
+		return
+	}
+
+	passkey, err := model.GetPasskeyByCredentialId(credential.ID)
+	if err != nil || passkey.UserId != passkeyUser.User.Id {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "通行密鑰不存在",
+		})
+		return
+	}
+	if err = passkey.UpdateUsage(credential); err != nil {
+		common.SysError("failed to update passkey usage: " + err.Error())
+	}
+	if credential.Authenticator.CloneWarning {
+		common.SysError("passkey " + strconv.Itoa(passkey.Id) + " of user " + strconv.Itoa(passkey.UserId) + " may be cloned: sign counter did not increase")
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "該通行密鑰的簽名計數異常，可能已被複製，請使用其他方式登入",
+		})
+		return
+	}
+	if passkeyUser.User.Status != common.UserStatusEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "用戶已被封禁",
+		})
+		return
+	}
+	// 通行密鑰本身即為強認證，無需再進行兩步驗證
+	setupLogin(passkeyUser.User, c)
+}
@@ -0,0 +1,260 @@
+package controller
+
+import (
+	"account-system/common"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"strconv"
+	"testing"
+)
+
+const testWebAuthnOrigin = "http://localhost"
+
+// softAuthenticator 軟件實現的 WebAuthn 驗證器，使用 ES256 密鑰和 none 證明
+type softAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialId []byte
+	signCount    uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentialId := make([]byte, 32)
+	_, _ = rand.Read(credentialId)
+	return &softAuthenticator{key: key, credentialId: credentialId}
+}
+
+var b64 = base64.RawURLEncoding
+
+// authenticatorData 構造驗證器數據，attested 為 true 時附帶憑證公鑰
+func (a *softAuthenticator) authenticatorData(t *testing.T, attested bool) []byte {
+	t.Helper()
+	rpIdHash := sha256.Sum256([]byte(common.WebAuthnRPID))
+	data := append([]byte{}, rpIdHash[:]...)
+	flags := byte(0x01 | 0x04) // UP | UV
+	if attested {
+		flags |= 0x40 // AT
+	}
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	if attested {
+		data = append(data, make([]byte, 16)...) // AAGUID
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.credentialId)))
+		data = append(data, a.credentialId...)
+		publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+			PublicKeyData: webauthncose.PublicKeyData{
+				KeyType:   int64(webauthncose.EllipticKey),
+				Algorithm: int64(webauthncose.AlgES256),
+			},
+			Curve:  int64(webauthncose.P256),
+			XCoord: a.key.X.FillBytes(make([]byte, 32)),
+			YCoord: a.key.Y.FillBytes(make([]byte, 32)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, publicKey...)
+	}
+	return data
+}
+
+func clientDataJSON(t *testing.T, typ, challenge string) []byte {
+	t.Helper()
+	data, err := json.Marshal(map[string]string{
+		"type":      typ,
+		"challenge": challenge,
+		"origin":    testWebAuthnOrigin,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// create 根據註冊選項生成憑證創建響應
+func (a *softAuthenticator) create(t *testing.T, challenge string) map[string]interface{} {
+	t.Helper()
+	attestation, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authenticatorData(t, true),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]interface{}{
+		"id":    b64.EncodeToString(a.credentialId),
+		"rawId": b64.EncodeToString(a.credentialId),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64.EncodeToString(clientDataJSON(t, "webauthn.create", challenge)),
+			"attestationObject": b64.EncodeToString(attestation),
+		},
+	}
+}
+
+// assert 根據登入選項生成斷言響應，每次調用簽名計數加一
+func (a *softAuthenticator) assert(t *testing.T, challenge string, userHandle []byte) map[string]interface{} {
+	t.Helper()
+	a.signCount++
+	authData := a.authenticatorData(t, false)
+	clientData := clientDataJSON(t, "webauthn.get", challenge)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]interface{}{
+		"id":    b64.EncodeToString(a.credentialId),
+		"rawId": b64.EncodeToString(a.credentialId),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64.EncodeToString(clientData),
+			"authenticatorData": b64.EncodeToString(authData),
+			"signature":         b64.EncodeToString(signature),
+			"userHandle":        b64.EncodeToString(userHandle),
+		},
+	}
+}
+
+func setupPasskeyTest(t *testing.T) {
+	t.Helper()
+	rpId, origins, enabled := common.WebAuthnRPID, common.WebAuthnRPOrigins, common.PasskeyLoginEnabled
+	common.WebAuthnRPID = "localhost"
+	common.WebAuthnRPOrigins = []string{testWebAuthnOrigin}
+	common.PasskeyLoginEnabled = true
+	t.Cleanup(func() {
+		common.WebAuthnRPID, common.WebAuthnRPOrigins, common.PasskeyLoginEnabled = rpId, origins, enabled
+	})
+}
+
+func newPasskeyClient(t *testing.T, userId int) *testClient {
+	return newTestClient(t, func(engine *gin.Engine) {
+		engine.POST("/register/begin", withUserId(userId), BeginPasskeyRegistration)
+		engine.POST("/register/finish", withUserId(userId), FinishPasskeyRegistration)
+		engine.POST("/login/begin", BeginPasskeyLogin)
+		engine.POST("/login/finish", FinishPasskeyLogin)
+	})
+}
+
+// challengeOf 從 WebAuthn 選項中取出挑戰
+func challengeOf(t *testing.T, data interface{}) string {
+	t.Helper()
+	publicKey := data.(map[string]interface{})["publicKey"].(map[string]interface{})
+	return publicKey["challenge"].(string)
+}
+
+func TestPasskeyRegistrationAndLogin(t *testing.T) {
+	setupPasskeyTest(t)
+	user := createTestUser(t, "passkey_user")
+	authenticator := newSoftAuthenticator(t)
+
+	client := newPasskeyClient(t, user.Id)
+	options := mustSucceed(t, client.do(t, "POST", "/register/begin", nil))
+	mustSucceed(t, client.do(t, "POST", "/register/finish?name=test", authenticator.create(t, challengeOf(t, options))))
+
+	userHandle := []byte(strconv.Itoa(user.Id))
+	tests := []struct {
+		name       string
+		username   string
+		userHandle []byte
+		wantOK     bool
+	}{
+		{"username", user.Username, userHandle, true},
+		{"discoverable", "", userHandle, true},
+		{"discoverable with foreign user handle", "", []byte("1"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newPasskeyClient(t, 0)
+			options := mustSucceed(t, client.do(t, "POST", "/login/begin", map[string]string{"username": tt.username}))
+			result := client.do(t, "POST", "/login/finish", authenticator.assert(t, challengeOf(t, options), tt.userHandle))
+			if ok := result["success"] == true; ok != tt.wantOK {
+				t.Fatalf("success = %v, want %v: %v", ok, tt.wantOK, result["message"])
+			}
+			if tt.wantOK {
+				data := result["data"].(map[string]interface{})
+				if int(data["id"].(float64)) != user.Id {
+					t.Fatalf("logged in as %v, want %d", data["id"], user.Id)
+				}
+			}
+		})
+	}
+
+	t.Run("replayed assertion", func(t *testing.T) {
+		client := newPasskeyClient(t, 0)
+		options := mustSucceed(t, client.do(t, "POST", "/login/begin", map[string]string{"username": user.Username}))
+		assertion := authenticator.assert(t, challengeOf(t, options), userHandle)
+		mustSucceed(t, client.do(t, "POST", "/login/finish", assertion))
+		if result := client.do(t, "POST", "/login/finish", assertion); result["success"] == true {
+			t.Fatal("replayed assertion was accepted")
+		}
+	})
+}
+
+// TestPasskeyLoginDoesNotEnumerateUsers 不存在的用戶和未註冊通行密鑰的用戶與已註冊的用戶返回相同形式的登入選項，
+// 虛構的憑證在重複請求間保持不變，數量隨用戶名變化而不是固定為一個
+func TestPasskeyLoginDoesNotEnumerateUsers(t *testing.T) {
+	setupPasskeyTest(t)
+	registered := createTestUser(t, "passkey_registered")
+	authenticator := newSoftAuthenticator(t)
+	client := newPasskeyClient(t, registered.Id)
+	options := mustSucceed(t, client.do(t, "POST", "/register/begin", nil))
+	mustSucceed(t, client.do(t, "POST", "/register/finish", authenticator.create(t, challengeOf(t, options))))
+	createTestUser(t, "passkey_without_key")
+
+	allowCredentials := func(username string) []string {
+		client := newPasskeyClient(t, 0)
+		result := client.do(t, "POST", "/login/begin", map[string]string{"username": username})
+		publicKey := mustSucceed(t, result).(map[string]interface{})["publicKey"].(map[string]interface{})
+		credentials, _ := publicKey["allowCredentials"].([]interface{})
+		var ids []string
+		for _, credential := range credentials {
+			ids = append(ids, credential.(map[string]interface{})["id"].(string))
+		}
+		return ids
+	}
+	if got := len(allowCredentials(registered.Username)); got != 1 {
+		t.Fatalf("registered user has %d allowed credentials, want 1", got)
+	}
+	for _, username := range []string{"passkey_without_key", "passkey_nobody"} {
+		t.Run(username, func(t *testing.T) {
+			first := allowCredentials(username)
+			if len(first) < 1 || len(first) > decoyPasskeyMaxCredentials {
+				t.Fatalf("got %d allowed credentials, want 1 to %d", len(first), decoyPasskeyMaxCredentials)
+			}
+			if second := allowCredentials(username); fmt.Sprint(first) != fmt.Sprint(second) {
+				t.Fatalf("decoy credentials change between requests: %v, %v", first, second)
+			}
+			client := newPasskeyClient(t, 0)
+			options := mustSucceed(t, client.do(t, "POST", "/login/begin", map[string]string{"username": username}))
+			result := client.do(t, "POST", "/login/finish", authenticator.assert(t, challengeOf(t, options), nil))
+			if result["success"] == true {
+				t.Fatal("login succeeded for decoy user")
+			}
+		})
+	}
+	t.Run("decoy credential count varies", func(t *testing.T) {
+		counts := map[int]bool{}
+		for i := 0; i < 20; i++ {
+			counts[len(allowCredentials(fmt.Sprintf("passkey_nobody_%d", i)))] = true
+		}
+		if len(counts) < 2 {
+			t.Fatalf("all decoys have the same number of credentials: %v", counts)
+		}
+	})
+}
@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"account-system/common"
+	"account-system/model"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+)
+
+// RequestPasswordReset 發送密碼重置驗證碼，無論郵箱是否已註冊都返回相同結果
+func RequestPasswordReset(c *gin.Context) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil || strings.TrimSpace(req.Email) == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的參數",
+		})
+		return
+	}
+	email := strings.TrimSpace(req.Email)
+	user, err := model.GetUserByEmail(email)
+	if err == nil && user.Status == common.UserStatusEnabled {
+		// 異步發送，避免響應時間暴露郵箱是否已註冊
+		go sendPasswordResetCode(user.Email)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "如果該郵箱已註冊，驗證碼已發送，請查收郵件",
+	})
+}
+
+func sendPasswordResetCode(email string) {
+	code, err := model.CreateVerificationCode(common.PasswordResetPurpose, email)
+	if err != nil {
+		common.SysError("failed to create password reset code: " + err.Error())
+		return
+	}
+	subject := fmt.Sprintf("%s 密碼重置", common.SystemName)
+	content := fmt.Sprintf("<p>您正在重置 %s 的密碼。</p><p>驗證碼為：<strong>%s</strong></p><p>驗證碼 %d 分鐘內有效，如非本人操作，請忽略此郵件。</p>",
+		common.SystemName, code, common.VerificationCodeLifetime/60)
+	if err = common.SendEmail(subject, email, content); err != nil {
+		common.SysError("failed to send password reset email: " + err.Error())
+	}
+}
+
+// ConfirmPasswordReset 使用驗證碼設置新密碼，成功後撤銷所有會話和訪問令牌
+func ConfirmPasswordReset(c *gin.Context) {
+	var req struct {
+		Email    string `json:"email"`
+		Code     string `json:"code"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的參數",
+		})
+		return
+	}
+	email := strings.TrimSpace(req.Email)
+	if email == "" || req.Code == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "郵箱和驗證碼不能為空",
+		})
+		return
+	}
+	// 先做不依賴帳號的檢查，避免驗證碼被消耗後才發現密碼不合規
+	if err := model.ValidateNewPassword(0, req.Password, "", email); err != nil {
+		respondPasswordPolicyError(c, err)
+		return
+	}
+	if err := model.ConsumeVerificationCode(common.PasswordResetPurpose, email, req.Code); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	user, err := model.GetUserByEmail(email)
+	if err != nil || user.Status != common.UserStatusEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": model.ErrInvalidVerificationCode.Error(),
+		})
+		return
+	}
+	if err = model.ValidateNewPassword(user.Id, req.Password, user.Username, user.Email); err != nil {
+		respondPasswordPolicyError(c, err)
+		return
+	}
+	if err = user.ResetPassword(req.Password); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	common.SysLog(fmt.Sprintf("user %d reset password via email", user.Id))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "密碼已重置，請使用新密碼登入",
+	})
+}
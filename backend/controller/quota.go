@@ -0,0 +1,271 @@
+package controller
+
+import (
+	"account-system/common"
+	"account-system/model"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// QuotaRequest 下游服務扣減或退還額度的請求，令牌通過明文密鑰或 ID 指定
+type QuotaRequest struct {
+	Key     string `json:"key"`
+	TokenId int    `json:"token_id"`
+	Amount  int    `json:"amount"`
+	Reason  string `json:"reason"`
+}
+
+// decodeQuotaRequest 解析額度請求並確定令牌 ID，失敗時返回錯誤響應
+func decodeQuotaRequest(c *gin.Context) (*QuotaRequest, int, bool) {
+	var req QuotaRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的參數",
+		})
+		return nil, 0, false
+	}
+	tokenId := req.TokenId
+	if req.Key != "" {
+		token, err := model.GetTokenByKey(strings.TrimPrefix(req.Key, "Bearer "))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "無效的令牌",
+			})
+			return nil, 0, false
+		}
+		tokenId = token.Id
+	}
+	if tokenId == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "未指定令牌",
+		})
+		return nil, 0, false
+	}
+	if reason := []rune(req.Reason); len(reason) > 255 {
+		req.Reason = string(reason[:255])
+	}
+	return &req, tokenId, true
+}
+
+func changeQuota(c *gin.Context, consume bool) {
+	req, tokenId, ok := decodeQuotaRequest(c)
+	if !ok {
+		return
+	}
+	var entry *model.QuotaLedger
+	var err error
+	message := "扣減成功"
+	if consume {
+		entry, err = model.ConsumeTokenQuota(tokenId, req.Amount, req.Reason)
+	} else {
+		entry, err = model.RefundTokenQuota(tokenId, req.Amount, req.Reason)
+		message = "退還成功"
+	}
+	if errors.Is(err, model.ErrInsufficientQuota) || errors.Is(err, model.ErrInsufficientUserQuota) ||
+		errors.Is(err, model.ErrInsufficientOrganizationQuota) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+			"data": gin.H{
+				"insufficient_quota": true,
+			},
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": message,
+		"data":    entry,
+	})
+}
+
+// ConsumeQuota 原子地扣減令牌額度，額度不足時拒絕（無限額度令牌除外）
+func ConsumeQuota(c *gin.Context) {
+	changeQuota(c, true)
+}
+
+// RefundQuota 退還令牌額度
+func RefundQuota(c *gin.Context) {
+	changeQuota(c, false)
+}
+
+// AdjustQuota 調整令牌可用的額度並記入流水（管理員），amount 為負數時扣減，
+// 使用帳戶額度或組織額度的令牌調整對應的帳戶或組織額度
+func AdjustQuota(c *gin.Context) {
+	req, tokenId, ok := decodeQuotaRequest(c)
+	if !ok {
+		return
+	}
+	if req.Reason == "" {
+		req.Reason = "手動調整"
+	}
+	entry, err := model.AdjustTokenQuota(tokenId, req.Amount, req.Reason)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	common.SysLog(fmt.Sprintf("user %d adjusted quota of token %d by %d", c.GetInt("id"), tokenId, req.Amount))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "調整成功",
+		"data":    entry,
+	})
+}
+
+// GetTokenQuotaLedger 獲取令牌的額度流水
+func GetTokenQuotaLedger(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的令牌 ID",
+		})
+		return
+	}
+	token, err := model.GetTokenById(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if !canAccessToken(c, token, false) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無權訪問該令牌",
+		})
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+	entries, total, err := model.GetQuotaLedgerByTokenId(id, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "獲取成功",
+		"data":    entries,
+		"total":   total,
+	})
+}
+
+// AuditTokenQuota 核對令牌餘額與流水是否一致（管理員）
+func AuditTokenQuota(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的令牌 ID",
+		})
+		return
+	}
+	balance, ledgerBalance, err := model.AuditTokenQuota(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "獲取成功",
+		"data": gin.H{
+			"balance":        balance,
+			"ledger_balance": ledgerBalance,
+			"consistent":     balance == ledgerBalance,
+		},
+	})
+}
+
+// RebuildTokenQuota 按流水重新計算令牌餘額（管理員）
+func RebuildTokenQuota(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的令牌 ID",
+		})
+		return
+	}
+	before, after, err := model.RebuildTokenQuota(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "重建成功",
+		"data": gin.H{
+			"before": before,
+			"after":  after,
+		},
+	})
+}
+
+// ConsumeSelfQuota 扣減調用令牌自身的額度，供收到用戶令牌的下游服務直接計費
+func ConsumeSelfQuota(c *gin.Context) {
+	var req QuotaRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的參數",
+		})
+		return
+	}
+	if reason := []rune(req.Reason); len(reason) > 255 {
+		req.Reason = string(reason[:255])
+	}
+	entry, err := model.ConsumeTokenQuota(c.GetInt("token_id"), req.Amount, req.Reason)
+	if errors.Is(err, model.ErrInsufficientQuota) || errors.Is(err, model.ErrInsufficientUserQuota) ||
+		errors.Is(err, model.ErrInsufficientOrganizationQuota) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+			"data": gin.H{
+				"insufficient_quota": true,
+			},
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.Set("quota_consumed", req.Amount)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "扣減成功",
+		"data":    entry,
+	})
+}
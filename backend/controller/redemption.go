@@ -0,0 +1,231 @@
+package controller
+
+import (
+	"account-system/common"
+	"account-system/model"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// GetAllRedemptionCodes 獲取兌換碼列表（管理員），可按批次名稱 name 過濾
+func GetAllRedemptionCodes(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+	codes, total, err := model.GetAllRedemptionCodes(c.Query("name"), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "獲取成功",
+		"data":    codes,
+		"total":   total,
+	})
+}
+
+// GenerateRedemptionCodes 批量生成兌換碼（管理員），明文只在此處返回一次；
+// 查詢參數 format=csv 時以 CSV 文件導出
+func GenerateRedemptionCodes(c *gin.Context) {
+	var req struct {
+		Name        string     `json:"name"`
+		Quota       int        `json:"quota"`
+		Count       int        `json:"count"`
+		MaxUses     int        `json:"max_uses"`
+		ExpiredTime *time.Time `json:"expired_time"`
+	}
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的參數",
+		})
+		return
+	}
+	if req.Name == "" || len(req.Name) > 64 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "批次名稱不能為空且長度不得超過 64",
+		})
+		return
+	}
+	codes, err := model.GenerateRedemptionCodes(model.RedemptionCode{
+		Name:        req.Name,
+		Quota:       req.Quota,
+		MaxUses:     req.MaxUses,
+		ExpiredTime: req.ExpiredTime,
+		CreatedBy:   c.GetInt("id"),
+	}, req.Count)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if c.Query("format") == "csv" {
+		var buf bytes.Buffer
+		writer := csv.NewWriter(&buf)
+		writer.Write([]string{"name", "code", "quota", "max_uses", "expired_time"})
+		for _, code := range codes {
+			expiredTime := ""
+			if code.ExpiredTime != nil {
+				expiredTime = code.ExpiredTime.Format(time.RFC3339)
+			}
+			writer.Write([]string{code.Name, code.Code, strconv.Itoa(code.Quota), strconv.Itoa(code.MaxUses), expiredTime})
+		}
+		writer.Flush()
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="redemption-codes-%d.csv"`, time.Now().Unix()))
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "生成成功，請立即導出兌換碼，之後將無法再次查看",
+		"data":    codes,
+	})
+}
+
+// UpdateRedemptionCodeStatus 啟用或停用兌換碼（管理員）
+func UpdateRedemptionCodeStatus(c *gin.Context) {
+	var req struct {
+		Id     int `json:"id"`
+		Status int `json:"status"`
+	}
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的參數",
+		})
+		return
+	}
+	code, err := model.GetRedemptionCodeById(req.Id)
+	if err == nil {
+		err = code.UpdateStatus(req.Status)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "更新成功",
+		"data":    code,
+	})
+}
+
+// DeleteRedemptionCode 刪除兌換碼（管理員）
+func DeleteRedemptionCode(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的兌換碼 ID",
+		})
+		return
+	}
+	code, err := model.GetRedemptionCodeById(id)
+	if err == nil {
+		err = code.Delete()
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "刪除成功",
+	})
+}
+
+// GetRedemptions 獲取兌換碼的兌換記錄（管理員）
+func GetRedemptions(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的兌換碼 ID",
+		})
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+	redemptions, total, err := model.GetRedemptionsByCodeId(id, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "獲取成功",
+		"data":    redemptions,
+		"total":   total,
+	})
+}
+
+// Redeem 使用兌換碼為自己的令牌或帳戶充值，token_id 為 0 時充值到帳戶額度
+func Redeem(c *gin.Context) {
+	var req struct {
+		Code    string `json:"code"`
+		TokenId int    `json:"token_id"`
+	}
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的參數",
+		})
+		return
+	}
+	userId := c.GetInt("id")
+	redemption, err := model.Redeem(req.Code, userId, req.TokenId)
+	if err != nil {
+		common.SysLog(fmt.Sprintf("user %d failed to redeem code: %s", userId, err.Error()))
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": fmt.Sprintf("兌換成功，獲得 %d 額度", redemption.Quota),
+		"data":    redemption,
+	})
+}
+
+// GetSelfQuotaLedger 獲取當前用戶帳戶額度的流水
+func GetSelfQuotaLedger(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+	entries, total, err := model.GetUserQuotaLedger(c.GetInt("id"), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "獲取成功",
+		"data":    entries,
+		"total":   total,
+	})
+}
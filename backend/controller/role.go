@@ -0,0 +1,190 @@
+package controller
+
+import (
+	"account-system/common"
+	"account-system/model"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+// GetAllRoles 獲取所有角色及其用戶數
+func GetAllRoles(c *gin.Context) {
+	roles, err := model.GetAllRoles()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "獲取成功",
+		"data":    roles,
+	})
+}
+
+// GetPermissions 獲取所有可以授予的權限
+func GetPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "獲取成功",
+		"data":    common.Permissions,
+	})
+}
+
+// CreateRole 創建自定義角色
+func CreateRole(c *gin.Context) {
+	var role model.Role
+	if err := json.NewDecoder(c.Request.Body).Decode(&role); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的參數",
+		})
+		return
+	}
+	if err := role.Insert(c.GetInt("role"), c.GetStringSlice("permissions")); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "創建成功",
+		"data":    role,
+	})
+}
+
+// UpdateRole 更新角色的描述和權限
+func UpdateRole(c *gin.Context) {
+	var role model.Role
+	if err := json.NewDecoder(c.Request.Body).Decode(&role); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的參數",
+		})
+		return
+	}
+	if err := role.Update(c.GetInt("role"), c.GetStringSlice("permissions")); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	common.SysLog(fmt.Sprintf("user %d updated permissions of role %d", c.GetInt("id"), role.Id))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "更新成功",
+		"data":    role,
+	})
+}
+
+// DeleteRole 刪除沒有用戶的自定義角色
+func DeleteRole(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的角色 ID",
+		})
+		return
+	}
+	role, err := model.GetRoleById(id)
+	if err == nil {
+		if role.Level >= c.GetInt("role") {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "無法刪除等級大於等於自己的角色",
+			})
+			return
+		}
+		err = role.Delete()
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "刪除成功",
+	})
+}
+
+// AssignUserRole 為用戶分配角色；不能操作權限大於等於自己的用戶，
+// 角色的等級必須低於自己，且不能包含自己沒有的權限
+func AssignUserRole(c *gin.Context) {
+	var req struct {
+		Id     int `json:"id"`
+		RoleId int `json:"role_id"`
+	}
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil || req.Id == 0 || req.RoleId == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的參數",
+		})
+		return
+	}
+	myRole := c.GetInt("role")
+	user, err := model.GetUserById(req.Id, false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "用戶不存在",
+		})
+		return
+	}
+	if user.Role >= myRole {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無法修改權限大於等於自己的用戶",
+		})
+		return
+	}
+	role, err := model.GetRoleById(req.RoleId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "角色不存在",
+		})
+		return
+	}
+	if role.Level >= myRole {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無法將用戶權限設為大於等於自己的權限",
+		})
+		return
+	}
+	if !model.HasAllPermissions(c.GetStringSlice("permissions"), role.Permissions) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無法分配包含自己沒有的權限的角色",
+		})
+		return
+	}
+	if err = model.AssignUserRole(user.Id, role.Id); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	common.SysLog(fmt.Sprintf("user %d assigned role %s to user %d", c.GetInt("id"), role.Name, user.Id))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "分配成功",
+		"data": gin.H{
+			"role":    role.Level,
+			"role_id": role.Id,
+		},
+	})
+}
@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"account-system/common"
+	"account-system/middleware"
+	"account-system/model"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"testing"
+)
+
+// TestRequirePermission 權限按數據庫中的角色檢查，登入後角色的變化立即生效
+func TestRequirePermission(t *testing.T) {
+	reader := &model.Role{Name: "require-permission-reader", Level: common.RoleCommonUser, Permissions: []string{common.PermissionUserRead}}
+	if err := reader.Insert(common.RoleRootUser, []string{common.PermissionAll}); err != nil {
+		t.Fatal(err)
+	}
+	// 等級為管理員的自定義角色不能訪問未授予權限的管理接口
+	adminReader := &model.Role{Name: "require-permission-admin-reader", Level: common.RoleAdminUser, Permissions: []string{common.PermissionUserRead}}
+	if err := adminReader.Insert(common.RoleRootUser, []string{common.PermissionAll}); err != nil {
+		t.Fatal(err)
+	}
+	ok := func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"success": true})
+	}
+	tests := []struct {
+		name        string
+		beforeLogin func(user *model.User) error
+		afterLogin  func(user *model.User) error
+		path        string
+		want        bool
+	}{
+		{name: "common user", path: "/user-read", want: false},
+		{name: "custom role", beforeLogin: func(user *model.User) error { return model.AssignUserRole(user.Id, reader.Id) }, path: "/user-read", want: true},
+		{name: "custom role missing permission", beforeLogin: func(user *model.User) error { return model.AssignUserRole(user.Id, reader.Id) }, path: "/user-delete", want: false},
+		{name: "custom role cannot manage quota", beforeLogin: func(user *model.User) error { return model.AssignUserRole(user.Id, reader.Id) }, path: "/quota", want: false},
+		{name: "custom admin level role", beforeLogin: func(user *model.User) error { return model.AssignUserRole(user.Id, adminReader.Id) }, path: "/user-read", want: true},
+		{name: "custom admin level role cannot manage quota", beforeLogin: func(user *model.User) error { return model.AssignUserRole(user.Id, adminReader.Id) }, path: "/quota", want: false},
+		{name: "custom admin level role cannot manage redemption codes", beforeLogin: func(user *model.User) error { return model.AssignUserRole(user.Id, adminReader.Id) }, path: "/redemption", want: false},
+		{name: "custom admin level role cannot read usage", beforeLogin: func(user *model.User) error { return model.AssignUserRole(user.Id, adminReader.Id) }, path: "/usage", want: false},
+		{name: "admin manages quota", beforeLogin: func(user *model.User) error { return model.SetUserRole(user.Id, common.RoleAdminUser) }, path: "/quota", want: true},
+		{name: "admin manages redemption codes", beforeLogin: func(user *model.User) error { return model.SetUserRole(user.Id, common.RoleAdminUser) }, path: "/redemption", want: true},
+		{name: "admin reads usage", beforeLogin: func(user *model.User) error { return model.SetUserRole(user.Id, common.RoleAdminUser) }, path: "/usage", want: true},
+		{name: "admin", beforeLogin: func(user *model.User) error { return model.SetUserRole(user.Id, common.RoleAdminUser) }, path: "/user-delete", want: true},
+		{name: "admin cannot manage roles", beforeLogin: func(user *model.User) error { return model.SetUserRole(user.Id, common.RoleAdminUser) }, path: "/role-manage", want: false},
+		{name: "root", beforeLogin: func(user *model.User) error { return model.SetUserRole(user.Id, common.RoleRootUser) }, path: "/role-manage", want: true},
+		{name: "demoted after login", beforeLogin: func(user *model.User) error { return model.SetUserRole(user.Id, common.RoleAdminUser) },
+			afterLogin: func(user *model.User) error { return model.SetUserRole(user.Id, common.RoleCommonUser) }, path: "/user-read", want: false},
+		{name: "role granted after login", afterLogin: func(user *model.User) error { return model.AssignUserRole(user.Id, reader.Id) }, path: "/user-read", want: true},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := createTestUser(t, fmt.Sprintf("require_permission_%d", i))
+			if tt.beforeLogin != nil {
+				if err := tt.beforeLogin(user); err != nil {
+					t.Fatal(err)
+				}
+			}
+			client := newTestClient(t, func(engine *gin.Engine) {
+				engine.POST("/login", Login)
+				engine.GET("/user-read", middleware.RequirePermission(common.PermissionUserRead), ok)
+				engine.GET("/user-delete", middleware.RequirePermission(common.PermissionUserDelete), ok)
+				engine.GET("/role-manage", middleware.RequirePermission(common.PermissionRoleManage), ok)
+				engine.GET("/quota", middleware.RequirePermission(common.PermissionQuotaManage), ok)
+				engine.GET("/redemption", middleware.RequirePermission(common.PermissionRedemptionManage), ok)
+				engine.GET("/usage", middleware.RequirePermission(common.PermissionUsageRead), ok)
+			})
+			mustSucceed(t, client.do(t, "POST", "/login", map[string]interface{}{"username": user.Username, "password": "Password-" + user.Username}))
+			if tt.afterLogin != nil {
+				if err := tt.afterLogin(user); err != nil {
+					t.Fatal(err)
+				}
+			}
+			result := client.do(t, "GET", tt.path, nil)
+			if got := result["success"] == true; got != tt.want {
+				t.Fatalf("GET %s success = %v, want %v: %v", tt.path, got, tt.want, result["message"])
+			}
+		})
+	}
+}
+
+// TestTokenAdminPermissions 查看其他用戶的令牌需要 token.manage，設置令牌額度需要 quota.manage，與用戶等級無關
+func TestTokenAdminPermissions(t *testing.T) {
+	adminReader := &model.Role{Name: "token-admin-reader", Level: common.RoleAdminUser, Permissions: []string{common.PermissionUserRead}}
+	if err := adminReader.Insert(common.RoleRootUser, []string{common.PermissionAll}); err != nil {
+		t.Fatal(err)
+	}
+	owner := createTestUser(t, "token_permission_owner")
+	token := &model.Token{UserId: owner.Id, Name: "owner", Status: common.TokenStatusEnabled, NeverExpire: true}
+	if err := token.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name          string
+		assign        func(user *model.User) error
+		wantAccess    bool
+		wantQuota     int
+		wantUnlimited bool
+	}{
+		{"built-in admin", func(user *model.User) error { return model.SetUserRole(user.Id, common.RoleAdminUser) }, true, 500, true},
+		{"custom admin level role", func(user *model.User) error { return model.AssignUserRole(user.Id, adminReader.Id) }, false, 0, false},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := createTestUser(t, fmt.Sprintf("token_permission_%d", i))
+			if err := tt.assign(user); err != nil {
+				t.Fatal(err)
+			}
+			client := newTokenClient(t, user.Id)
+			result := client.do(t, "GET", fmt.Sprintf("/token/%d", token.Id), nil)
+			if got := result["success"] == true; got != tt.wantAccess {
+				t.Fatalf("access other user's token = %v, want %v: %v", got, tt.wantAccess, result["message"])
+			}
+			created := createTokenAs(t, user.Id, map[string]interface{}{"name": "quota", "remain_quota": 500, "unlimited_quota": true, "never_expire": true})
+			if created.RemainQuota != tt.wantQuota || created.UnlimitedQuota != tt.wantUnlimited {
+				t.Fatalf("created token quota = %d, unlimited = %v, want %d, %v", created.RemainQuota, created.UnlimitedQuota, tt.wantQuota, tt.wantUnlimited)
+			}
+		})
+	}
+}
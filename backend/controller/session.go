@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"account-system/common"
+	"account-system/model"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+// sessionItem 會話列表項，標記是否為當前會話
+type sessionItem struct {
+	*model.Session
+	Current bool `json:"current"`
+}
+
+// GetSelfSessions 獲取當前用戶的所有登入會話
+func GetSelfSessions(c *gin.Context) {
+	records, err := model.GetSessionsByUserId(c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	currentId := sessions.Default(c).ID()
+	items := make([]sessionItem, len(records))
+	for i, record := range records {
+		items[i] = sessionItem{Session: record, Current: record.IsCurrentSession(currentId)}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "獲取成功",
+		"data":    items,
+	})
+}
+
+// DeleteSelfSessions 登出當前會話以外的所有設備
+func DeleteSelfSessions(c *gin.Context) {
+	err := model.RevokeUserSessions(c.GetInt("id"), sessions.Default(c).ID())
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "已登出其他所有設備",
+	})
+}
+
+// DeleteSelfSession 登出指定會話
+func DeleteSelfSession(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的會話 ID",
+		})
+		return
+	}
+	if err = model.RevokeSessionById(c.GetInt("id"), id); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "已登出該設備",
+	})
+}
+
+// DeleteUserSessions 登出指定用戶的所有會話（管理員）
+func DeleteUserSessions(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的用戶 ID",
+		})
+		return
+	}
+	myRole := c.GetInt("role")
+	existingUser, err := model.GetUserById(id, false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if existingUser.Role >= myRole {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無法修改權限大於等於自己的用戶",
+		})
+		return
+	}
+	if err = model.RevokeUserSessions(id, ""); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	common.SysLog("all sessions of user " + strconv.Itoa(id) + " were revoked by user " + strconv.Itoa(c.GetInt("id")))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "已登出該用戶的所有設備",
+	})
+}
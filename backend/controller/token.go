@@ -4,18 +4,70 @@ import (
 	"account-system/common"
 	"account-system/model"
 	"encoding/json"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
-// GetAllTokens 獲取所有令牌
+// tokenOrganizationId 獲取令牌路由的組織上下文：通過組織令牌調用時為令牌所屬的組織，
+// 否則為請求指定的組織，0 表示個人令牌；manage 為 true 時要求組織管理員權限，不滿足時返回錯誤響應
+func tokenOrganizationId(c *gin.Context, requested int, manage bool) (int, bool) {
+	if organizationId := c.GetInt("token_organization_id"); organizationId != 0 {
+		return organizationId, true
+	}
+	if requested == 0 {
+		return 0, true
+	}
+	userId := c.GetInt("id")
+	role := model.GetOrganizationRole(requested, userId)
+	allowed := role != ""
+	if manage {
+		allowed = common.OrganizationRoleRank(role) >= common.OrganizationRoleRank(common.OrganizationRoleAdmin)
+	}
+	if !allowed && !model.UserHasPermission(userId, common.PermissionTokenManage) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無權管理該組織的令牌",
+		})
+		return 0, false
+	}
+	return requested, true
+}
+
+// canAccessToken 檢查當前用戶能否查看（manage 為 false）或管理令牌：個人令牌只有所有者可以訪問，
+// 組織令牌所有成員可以查看、組織管理員可以管理；通過組織令牌調用時只能訪問同一組織的令牌
+func canAccessToken(c *gin.Context, token *model.Token, manage bool) bool {
+	if organizationId := c.GetInt("token_organization_id"); organizationId != 0 {
+		return token.OrganizationId == organizationId
+	}
+	userId := c.GetInt("id")
+	if model.UserHasPermission(userId, common.PermissionTokenManage) {
+		return true
+	}
+	if token.OrganizationId == 0 {
+		return token.UserId == userId
+	}
+	role := model.GetOrganizationRole(token.OrganizationId, userId)
+	if manage {
+		return common.OrganizationRoleRank(role) >= common.OrganizationRoleRank(common.OrganizationRoleAdmin)
+	}
+	return role != ""
+}
+
+// GetAllTokens 獲取個人令牌，查詢參數 organization_id 指定時獲取組織令牌
 func GetAllTokens(c *gin.Context) {
 	userId := c.GetInt("id")
+	organizationId, _ := strconv.Atoi(c.Query("organization_id"))
+	organizationId, ok := tokenOrganizationId(c, organizationId, false)
+	if !ok {
+		return
+	}
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
-	tokens, total, err := model.GetTokensByUserId(userId, page, pageSize)
+	tokens, total, err := model.GetTokensByOwner(userId, organizationId, page, pageSize)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -31,13 +83,18 @@ func GetAllTokens(c *gin.Context) {
 	})
 }
 
-// SearchTokens 搜索令牌
+// SearchTokens 搜索令牌，組織上下文同 GetAllTokens
 func SearchTokens(c *gin.Context) {
 	userId := c.GetInt("id")
+	organizationId, _ := strconv.Atoi(c.Query("organization_id"))
+	organizationId, ok := tokenOrganizationId(c, organizationId, false)
+	if !ok {
+		return
+	}
 	keyword := c.Query("keyword")
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
-	tokens, total, err := model.SearchTokens(userId, keyword, page, pageSize)
+	tokens, total, err := model.SearchTokens(userId, organizationId, keyword, page, pageSize)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -71,9 +128,7 @@ func GetToken(c *gin.Context) {
 		})
 		return
 	}
-	// 檢查令牌是否屬於當前用戶
-	userId := c.GetInt("id")
-	if token.UserId != userId && !model.IsAdmin(userId) {
+	if !canAccessToken(c, token, false) {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"message": "無權訪問該令牌",
@@ -87,6 +142,47 @@ func GetToken(c *gin.Context) {
 	})
 }
 
+// normalizeRequestedScopes 檢查令牌的權限範圍；通過令牌調用時，不能授予超出調用令牌自身的範圍
+func normalizeRequestedScopes(c *gin.Context, scopes []string) ([]string, bool) {
+	scopes, err := model.NormalizeTokenScopes(scopes)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return nil, false
+	}
+	if c.GetInt("token_id") != 0 {
+		if missing := model.MissingTokenScopes(c.GetStringSlice("token_scopes"), scopes); len(missing) > 0 {
+			c.JSON(http.StatusForbidden, gin.H{
+				"success": false,
+				"message": "不能授予調用令牌自身沒有的權限範圍：" + strings.Join(missing, ", "),
+				"data": gin.H{
+					"missing_scopes": missing,
+				},
+			})
+			return nil, false
+		}
+	}
+	return scopes, true
+}
+
+// applyTokenLifetimePolicy 按令牌所有者角色的最長有效期檢查過期時間，不符合時返回錯誤響應
+func applyTokenLifetimePolicy(c *gin.Context, token *model.Token, ownerId int) bool {
+	role, _, err := model.GetUserRoleAndStatus(ownerId)
+	if err == nil {
+		err = token.ApplyLifetimePolicy(role)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return false
+	}
+	return true
+}
+
 // AddToken 添加令牌
 func AddToken(c *gin.Context) {
 	var token model.Token
@@ -98,7 +194,62 @@ func AddToken(c *gin.Context) {
 		})
 		return
 	}
+	var ok bool
+	// 組織令牌需要組織管理員權限，並從組織額度扣減
+	if token.OrganizationId, ok = tokenOrganizationId(c, token.OrganizationId, true); !ok {
+		return
+	}
+	if token.OrganizationId != 0 {
+		token.UseAccountQuota = false
+		token.RemainQuota = 0
+	}
 	userId := c.GetInt("id")
+	// 只有擁有 quota.manage 權限的管理員可以設置初始額度和無限額度，普通用戶通過兌換碼或帳戶額度獲得額度
+	if !model.UserHasPermission(userId, common.PermissionQuotaManage) {
+		token.RemainQuota = 0
+		token.UnlimitedQuota = false
+	}
+	if token.Scopes, ok = normalizeRequestedScopes(c, token.Scopes); !ok {
+		return
+	}
+	if token.AllowedIPs, err = model.NormalizeTokenAllowedIPs(token.AllowedIPs); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err = token.NormalizeRateLimit(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if (token.UseAccountQuota || token.OrganizationId != 0) && token.UnlimitedQuota {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "使用帳戶額度或組織額度的令牌不能設為無限額度",
+		})
+		return
+	}
+	if !token.NeverExpire && !token.ExpiredTime.IsZero() && token.ExpiredTime.Before(time.Now()) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "過期時間必須晚於當前時間",
+		})
+		return
+	}
+	// 有效期從創建時起算，不使用請求中的時間
+	token.CreatedTime = time.Now()
+	token.RotatedTime = nil
+	// 通過組織令牌創建時沒有用戶身份，創建者記為調用令牌的創建者
+	if userId == 0 {
+		userId = c.GetInt("token_user_id")
+	}
+	if !applyTokenLifetimePolicy(c, &token, userId) {
+		return
+	}
 	token.UserId = userId
 	token.Status = common.TokenStatusEnabled
 	err = token.Insert()
@@ -109,9 +260,10 @@ func AddToken(c *gin.Context) {
 		})
 		return
 	}
+	// 明文密鑰只在此處返回一次，之後只能看到前綴
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"message": "添加成功",
+		"message": "添加成功，請立即保存令牌，之後將無法再次查看",
 		"data":    token,
 	})
 }
@@ -143,21 +295,71 @@ func UpdateToken(c *gin.Context) {
 		})
 		return
 	}
-	// 檢查令牌是否屬於當前用戶
-	userId := c.GetInt("id")
-	if existingToken.UserId != userId && !model.IsAdmin(userId) {
+	if !canAccessToken(c, existingToken, true) {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"message": "無權修改該令牌",
 		})
 		return
 	}
+	// 令牌不能在個人和組織之間轉移
+	token.OrganizationId = existingToken.OrganizationId
+	if token.OrganizationId != 0 {
+		token.UseAccountQuota = false
+	}
+	// 餘額只能由管理員通過 /api/quota/adjust 調整並記入流水，無限額度只有擁有 quota.manage 權限的管理員可以修改
+	token.RemainQuota = existingToken.RemainQuota
+	if !model.UserHasPermission(c.GetInt("id"), common.PermissionQuotaManage) {
+		token.UnlimitedQuota = existingToken.UnlimitedQuota
+	}
+	var ok bool
+	if token.Scopes, ok = normalizeRequestedScopes(c, token.Scopes); !ok {
+		return
+	}
+	if token.AllowedIPs, err = model.NormalizeTokenAllowedIPs(token.AllowedIPs); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err = token.NormalizeRateLimit(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if (token.UseAccountQuota || token.OrganizationId != 0) && token.UnlimitedQuota {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "使用帳戶額度或組織額度的令牌不能設為無限額度",
+		})
+		return
+	}
+	// 有效期限制從創建或最近一次輪換時起算，不使用請求中的值
+	token.CreatedTime = existingToken.CreatedTime
+	token.RotatedTime = existingToken.RotatedTime
+	// 未指定過期時間時保持不變，過期時間有變化時重新檢查有效期限制
+	if token.ExpiredTime.IsZero() && !token.NeverExpire {
+		if existingToken.NeverExpire {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "取消永不過期時需要指定過期時間",
+			})
+			return
+		}
+		token.ExpiredTime = existingToken.ExpiredTime
+	} else if token.NeverExpire != existingToken.NeverExpire || !token.ExpiredTime.Equal(existingToken.ExpiredTime) {
+		if !applyTokenLifetimePolicy(c, &token, existingToken.UserId) {
+			return
+		}
+	}
+	if token.NeverExpire && token.ExpiredTime.IsZero() {
+		token.ExpiredTime = existingToken.CreatedTime
+	}
 	// 保留原始用戶 ID
 	token.UserId = existingToken.UserId
-	// 保留原始密鑰
-	token.Key = existingToken.Key
-	// 保留創建時間
-	token.CreatedTime = existingToken.CreatedTime
 	// 更新訪問時間
 	token.AccessedTime = time.Now()
 	err = token.Update()
@@ -193,9 +395,7 @@ func DeleteToken(c *gin.Context) {
 		})
 		return
 	}
-	// 檢查令牌是否屬於當前用戶
-	userId := c.GetInt("id")
-	if token.UserId != userId && !model.IsAdmin(userId) {
+	if !canAccessToken(c, token, true) {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"message": "無權刪除該令牌",
@@ -215,3 +415,67 @@ func DeleteToken(c *gin.Context) {
 		"message": "刪除成功",
 	})
 }
+
+// RotateToken 輪換令牌密鑰，舊密鑰在寬限期內仍然有效
+func RotateToken(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的令牌 ID",
+		})
+		return
+	}
+	// 寬限期以秒為單位，未指定時使用默認值，0 表示舊密鑰立即失效
+	var req struct {
+		GracePeriod *int64 `json:"grace_period"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err = json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "無效的參數",
+			})
+			return
+		}
+	}
+	gracePeriod := common.TokenRotationGracePeriod
+	if req.GracePeriod != nil {
+		gracePeriod = *req.GracePeriod
+	}
+	if gracePeriod < 0 || gracePeriod > common.TokenRotationMaxGracePeriod {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("寬限期必須在 0 到 %d 秒之間", common.TokenRotationMaxGracePeriod),
+		})
+		return
+	}
+	// 檢查令牌是否存在
+	token, err := model.GetTokenById(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if !canAccessToken(c, token, true) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無權輪換該令牌",
+		})
+		return
+	}
+	if err = token.RotateKey(time.Duration(gracePeriod) * time.Second); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "輪換成功，請立即保存新令牌，之後將無法再次查看",
+		"data":    token,
+	})
+}
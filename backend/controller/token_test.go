@@ -0,0 +1,292 @@
+package controller
+
+import (
+	"account-system/common"
+	"account-system/middleware"
+	"account-system/model"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// newTokenClient 以指定用戶的身份調用令牌管理接口
+func newTokenClient(t *testing.T, userId int) *testClient {
+	return newTestClient(t, func(engine *gin.Engine) {
+		engine.Use(withUserId(userId))
+		engine.GET("/token/:id", GetToken)
+		engine.POST("/token", AddToken)
+		engine.PUT("/token", UpdateToken)
+		engine.POST("/quota/adjust", AdjustQuota)
+	})
+}
+
+// createTokenAs 以指定用戶的身份創建令牌並返回數據庫中的令牌
+func createTokenAs(t *testing.T, userId int, body map[string]interface{}) *model.Token {
+	t.Helper()
+	data := mustSucceed(t, newTokenClient(t, userId).do(t, "POST", "/token", body)).(map[string]interface{})
+	token, err := model.GetTokenById(int(data["id"].(float64)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// tokenLedgerSum 令牌所有流水的金額之和
+func tokenLedgerSum(t *testing.T, tokenId int) int {
+	t.Helper()
+	entries, _, err := model.GetQuotaLedgerByTokenId(tokenId, 1, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := 0
+	for _, entry := range entries {
+		sum += entry.Amount
+	}
+	return sum
+}
+
+func TestAddTokenQuotaIsAdminOnly(t *testing.T) {
+	user := createTestUser(t, "token_quota_user")
+	admin := createTestAdmin(t, "token_quota_admin")
+	tests := []struct {
+		name          string
+		userId        int
+		body          map[string]interface{}
+		wantQuota     int
+		wantUnlimited bool
+	}{
+		{"user quota ignored", user.Id, map[string]interface{}{"name": "a", "remain_quota": 1000}, 0, false},
+		{"user unlimited ignored", user.Id, map[string]interface{}{"name": "b", "unlimited_quota": true}, 0, false},
+		{"admin quota", admin.Id, map[string]interface{}{"name": "c", "remain_quota": 1000}, 1000, false},
+		{"admin unlimited", admin.Id, map[string]interface{}{"name": "d", "unlimited_quota": true}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := createTokenAs(t, tt.userId, tt.body)
+			if token.RemainQuota != tt.wantQuota || token.UnlimitedQuota != tt.wantUnlimited {
+				t.Fatalf("quota = %d, unlimited = %v, want %d, %v", token.RemainQuota, token.UnlimitedQuota, tt.wantQuota, tt.wantUnlimited)
+			}
+			if sum := tokenLedgerSum(t, token.Id); sum != token.RemainQuota {
+				t.Fatalf("ledger sum = %d, want %d", sum, token.RemainQuota)
+			}
+		})
+	}
+}
+
+func TestUpdateTokenQuotaIsAdminOnly(t *testing.T) {
+	user := createTestUser(t, "update_quota_user")
+	admin := createTestAdmin(t, "update_quota_admin")
+	token := createTokenAs(t, user.Id, map[string]interface{}{"name": "update"})
+	mustSucceed(t, newTokenClient(t, admin.Id).do(t, "POST", "/quota/adjust", map[string]interface{}{"token_id": token.Id, "amount": 500}))
+	tests := []struct {
+		name          string
+		userId        int
+		body          map[string]interface{}
+		wantQuota     int
+		wantUnlimited bool
+	}{
+		{"user quota ignored", user.Id, map[string]interface{}{"remain_quota": 99999}, 500, false},
+		{"user unlimited ignored", user.Id, map[string]interface{}{"unlimited_quota": true}, 500, false},
+		{"admin quota ignored", admin.Id, map[string]interface{}{"remain_quota": 99999}, 500, false},
+		{"admin unlimited", admin.Id, map[string]interface{}{"unlimited_quota": true}, 500, true},
+		{"user keeps unlimited", user.Id, map[string]interface{}{"unlimited_quota": false}, 500, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := map[string]interface{}{"id": token.Id, "name": "update"}
+			for key, value := range tt.body {
+				body[key] = value
+			}
+			mustSucceed(t, newTokenClient(t, tt.userId).do(t, "PUT", "/token", body))
+			current, _ := model.GetTokenById(token.Id)
+			if current.RemainQuota != tt.wantQuota || current.UnlimitedQuota != tt.wantUnlimited {
+				t.Fatalf("quota = %d, unlimited = %v, want %d, %v", current.RemainQuota, current.UnlimitedQuota, tt.wantQuota, tt.wantUnlimited)
+			}
+			if sum := tokenLedgerSum(t, token.Id); sum != current.RemainQuota {
+				t.Fatalf("ledger sum = %d, want %d", sum, current.RemainQuota)
+			}
+		})
+	}
+}
+
+func TestAdjustQuota(t *testing.T) {
+	admin := createTestAdmin(t, "adjust_quota_admin")
+	user := createTestUser(t, "adjust_quota_user")
+	token := createTokenAs(t, user.Id, map[string]interface{}{"name": "adjust"})
+	client := newTokenClient(t, admin.Id)
+	tests := []struct {
+		name      string
+		amount    int
+		wantOK    bool
+		wantQuota int
+	}{
+		{"increase", 500, true, 500},
+		{"decrease", -200, true, 300},
+		{"below zero", -301, false, 300},
+		{"zero", 0, false, 300},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := client.do(t, "POST", "/quota/adjust", map[string]interface{}{"token_id": token.Id, "amount": tt.amount})
+			if ok := result["success"] == true; ok != tt.wantOK {
+				t.Fatalf("success = %v, want %v: %v", ok, tt.wantOK, result["message"])
+			}
+			current, _ := model.GetTokenById(token.Id)
+			if current.RemainQuota != tt.wantQuota {
+				t.Fatalf("quota = %d, want %d", current.RemainQuota, tt.wantQuota)
+			}
+			if sum := tokenLedgerSum(t, token.Id); sum != tt.wantQuota {
+				t.Fatalf("ledger sum = %d, want %d", sum, tt.wantQuota)
+			}
+		})
+	}
+
+	t.Run("account quota token", func(t *testing.T) {
+		accountToken := createTokenAs(t, user.Id, map[string]interface{}{"name": "account", "use_account_quota": true})
+		before, _ := model.GetUserById(user.Id, false)
+		mustSucceed(t, client.do(t, "POST", "/quota/adjust", map[string]interface{}{"token_id": accountToken.Id, "amount": 70}))
+		after, _ := model.GetUserById(user.Id, false)
+		if after.Quota != before.Quota+70 {
+			t.Fatalf("account quota = %d, want %d", after.Quota, before.Quota+70)
+		}
+		entries, _, _ := model.GetUserQuotaLedger(user.Id, 1, 1)
+		if len(entries) == 0 || entries[0].Type != common.QuotaLedgerTypeAdjust || entries[0].ViaTokenId != accountToken.Id {
+			t.Fatalf("account ledger entry = %+v, want adjust via token %d", entries, accountToken.Id)
+		}
+	})
+}
+
+func TestTokenLifetimeAnchor(t *testing.T) {
+	defer func(days int, policy string) {
+		common.TokenMaxLifetimeUser = days
+		common.TokenLifetimePolicy = policy
+	}(common.TokenMaxLifetimeUser, common.TokenLifetimePolicy)
+	common.TokenMaxLifetimeUser = 30
+	common.TokenLifetimePolicy = common.TokenLifetimePolicyReject
+
+	user := createTestUser(t, "token_lifetime_user")
+	client := newTokenClient(t, user.Id)
+	token := createTokenAs(t, user.Id, map[string]interface{}{"name": "lifetime"})
+	// 令牌創建於 20 天前，剩餘可延長的有效期為 10 天
+	model.DB.Model(token).Update("created_time", time.Now().Add(-20*24*time.Hour))
+	days := func(n int) string { return time.Now().Add(time.Duration(n) * 24 * time.Hour).Format(time.RFC3339) }
+	tests := []struct {
+		name        string
+		method      string
+		body        map[string]interface{}
+		wantSuccess bool
+	}{
+		{"create within limit", "POST", map[string]interface{}{"name": "a", "expired_time": days(29)}, true},
+		{"create with forged created time", "POST", map[string]interface{}{"name": "b", "expired_time": days(40), "created_time": days(20)}, false},
+		{"extend within limit", "PUT", map[string]interface{}{"id": token.Id, "name": "lifetime", "expired_time": days(9)}, true},
+		{"extend past creation limit", "PUT", map[string]interface{}{"id": token.Id, "name": "lifetime", "expired_time": days(25)}, false},
+		{"extend with forged created time", "PUT", map[string]interface{}{"id": token.Id, "name": "lifetime", "expired_time": days(25), "created_time": days(0)}, false},
+		{"extend with forged rotated time", "PUT", map[string]interface{}{"id": token.Id, "name": "lifetime", "expired_time": days(25), "rotated_time": days(0)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := client.do(t, tt.method, "/token", tt.body)
+			if success, _ := result["success"].(bool); success != tt.wantSuccess {
+				t.Fatalf("success = %v, want %v: %v", success, tt.wantSuccess, result["message"])
+			}
+		})
+	}
+}
+
+// TestTokenAuthOwnerState 所有者被禁用或刪除時個人令牌返回 403
+func TestTokenAuthOwnerState(t *testing.T) {
+	engine := newTokenAPIEngine()
+	tests := []struct {
+		name       string
+		update     func(user *model.User)
+		wantStatus int
+	}{
+		{name: "enabled owner", update: func(user *model.User) {}, wantStatus: http.StatusOK},
+		{name: "disabled owner", update: func(user *model.User) {
+			model.DB.Model(user).Update("status", common.UserStatusDisabled)
+		}, wantStatus: http.StatusForbidden},
+		{name: "deleted owner", update: func(user *model.User) {
+			// 只刪除用戶記錄，模擬令牌仍然存在的情況
+			model.DB.Delete(user)
+		}, wantStatus: http.StatusForbidden},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := createTestUser(t, fmt.Sprintf("token_owner_state_%d", i))
+			token := &model.Token{UserId: user.Id, Name: "owner", Status: common.TokenStatusEnabled, NeverExpire: true,
+				UnlimitedQuota: true, Scopes: []string{common.TokenScopeTokenRead}}
+			if err := token.Insert(); err != nil {
+				t.Fatal(err)
+			}
+			tt.update(user)
+			status, result := doWithToken(t, engine, "GET", "/v1/token", token.Key, nil)
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %v", status, tt.wantStatus, result["message"])
+			}
+			if tt.wantStatus == http.StatusForbidden && result["message"] != "用戶已被禁用" {
+				t.Fatalf("message = %v", result["message"])
+			}
+		})
+	}
+}
+
+// TestConsumeQuotaInsufficient 令牌、帳戶和組織額度不足時都返回 insufficient_quota
+func TestConsumeQuotaInsufficient(t *testing.T) {
+	owner := createTestUser(t, "insufficient_owner")
+	org := &model.Organization{Name: "insufficient", CreatedBy: owner.Id}
+	if err := org.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := model.AdjustOrganizationQuota(org.Id, 10, "test"); err != nil {
+		t.Fatal(err)
+	}
+	newToken := func(token *model.Token) *model.Token {
+		token.UserId = owner.Id
+		token.Name = "insufficient"
+		token.Status = common.TokenStatusEnabled
+		token.NeverExpire = true
+		token.Scopes = []string{common.TokenScopeQuotaConsume}
+		if err := token.Insert(); err != nil {
+			t.Fatal(err)
+		}
+		if token.OrganizationId == 0 {
+			if _, err := model.AdjustTokenQuota(token.Id, 10, "test"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return token
+	}
+	tokens := []struct {
+		name  string
+		token *model.Token
+	}{
+		{"token quota", newToken(&model.Token{})},
+		{"account quota", newToken(&model.Token{UseAccountQuota: true})},
+		{"organization quota", newToken(&model.Token{OrganizationId: org.Id})},
+	}
+	admin := createTestAdmin(t, "insufficient_admin")
+	client := newTestClient(t, func(engine *gin.Engine) {
+		engine.Use(withUserId(admin.Id))
+		engine.POST("/quota/consume", ConsumeQuota)
+	})
+	engine := gin.New()
+	engine.POST("/v1/quota/consume", middleware.TokenAuth(), ConsumeSelfQuota)
+	// 超過任何一種額度來源的餘額
+	body := map[string]interface{}{"amount": 1000000, "reason": "insufficient"}
+	for _, tt := range tokens {
+		t.Run(tt.name+" via consume api", func(t *testing.T) {
+			result := client.do(t, "POST", "/quota/consume", map[string]interface{}{"token_id": tt.token.Id, "amount": body["amount"]})
+			if data, _ := result["data"].(map[string]interface{}); result["success"] == true || data["insufficient_quota"] != true {
+				t.Fatalf("result = %v, want insufficient_quota", result)
+			}
+		})
+		t.Run(tt.name+" via token", func(t *testing.T) {
+			_, result := doWithToken(t, engine, "POST", "/v1/quota/consume", tt.token.Key, body)
+			if data, _ := result["data"].(map[string]interface{}); result["success"] == true || data["insufficient_quota"] != true {
+				t.Fatalf("result = %v, want insufficient_quota", result)
+			}
+		})
+	}
+}
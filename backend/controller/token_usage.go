@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"account-system/common"
+	"account-system/model"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// parseTokenUsageFilter 從查詢參數解析使用記錄的過濾條件，時間為 Unix 秒
+func parseTokenUsageFilter(c *gin.Context) model.TokenUsageFilter {
+	filter := model.TokenUsageFilter{Route: c.Query("route")}
+	filter.TokenId, _ = strconv.Atoi(c.Query("token_id"))
+	filter.UserId, _ = strconv.Atoi(c.Query("user_id"))
+	filter.OrganizationId, _ = strconv.Atoi(c.Query("organization_id"))
+	filter.StatusCode, _ = strconv.Atoi(c.Query("status_code"))
+	if start, err := strconv.ParseInt(c.Query("start_timestamp"), 10, 64); err == nil {
+		filter.StartTime = time.Unix(start, 0)
+	}
+	if end, err := strconv.ParseInt(c.Query("end_timestamp"), 10, 64); err == nil {
+		filter.EndTime = time.Unix(end, 0)
+	}
+	return filter
+}
+
+func respondTokenUsages(c *gin.Context, filter model.TokenUsageFilter) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+	usages, total, err := model.QueryTokenUsages(filter, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "獲取成功",
+		"data":    usages,
+		"total":   total,
+	})
+}
+
+// GetSelfTokenUsages 查詢當前用戶個人令牌的使用記錄，組織令牌的記錄通過 GetOrganizationTokenUsages 查詢
+func GetSelfTokenUsages(c *gin.Context) {
+	filter := parseTokenUsageFilter(c)
+	filter.UserId = c.GetInt("id")
+	filter.OrganizationId = 0
+	filter.PersonalOnly = true
+	respondTokenUsages(c, filter)
+}
+
+// GetOrganizationTokenUsages 查詢組織令牌的使用記錄（組織管理員）
+func GetOrganizationTokenUsages(c *gin.Context) {
+	id, _, ok := organizationRole(c, common.OrganizationRoleAdmin)
+	if !ok {
+		return
+	}
+	filter := parseTokenUsageFilter(c)
+	filter.OrganizationId = id
+	respondTokenUsages(c, filter)
+}
+
+// GetAllTokenUsages 查詢所有令牌的使用記錄（管理員）
+func GetAllTokenUsages(c *gin.Context) {
+	respondTokenUsages(c, parseTokenUsageFilter(c))
+}
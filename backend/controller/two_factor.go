@@ -0,0 +1,314 @@
+package controller
+
+import (
+	"account-system/common"
+	"account-system/model"
+	"encoding/json"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// TwoFactorRequest 兩步驗證請求
+type TwoFactorRequest struct {
+	Code string `json:"code"`
+}
+
+// setupPendingTwoFactor 密碼驗證通過後，寫入等待兩步驗證的臨時會話
+func setupPendingTwoFactor(user *model.User, c *gin.Context) {
+	session := sessions.Default(c)
+	session.Clear()
+	session.Set("pending_2fa_id", user.Id)
+	session.Set("pending_2fa_time", time.Now().Unix())
+	session.Set("pending_2fa_attempts", 0)
+	err := session.Save()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "保存會話失敗: " + err.Error(),
+			"success": false,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "請輸入兩步驗證碼",
+		"success": true,
+		"data": gin.H{
+			"require_2fa": true,
+		},
+	})
+}
+
+// clearPendingTwoFactor 清除等待兩步驗證的臨時會話
+func clearPendingTwoFactor(session sessions.Session) {
+	session.Delete("pending_2fa_id")
+	session.Delete("pending_2fa_time")
+	session.Delete("pending_2fa_attempts")
+}
+
+// LoginTwoFactor 登入第二步：驗證 TOTP 驗證碼或恢復碼
+func LoginTwoFactor(c *gin.Context) {
+	session := sessions.Default(c)
+	pendingId, ok := session.Get("pending_2fa_id").(int)
+	pendingTime, _ := session.Get("pending_2fa_time").(int64)
+	attempts, _ := session.Get("pending_2fa_attempts").(int)
+	if !ok || pendingId == 0 || time.Now().Unix()-pendingTime > common.TwoFactorPendingTimeout {
+		clearPendingTwoFactor(session)
+		session.Save()
+		c.JSON(http.StatusOK, gin.H{
+			"message": "兩步驗證會話已過期，請重新登入",
+			"success": false,
+		})
+		return
+	}
+	var req TwoFactorRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&req)
+	if err != nil || req.Code == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "無效的參數",
+			"success": false,
+		})
+		return
+	}
+	user, err := model.GetUserById(pendingId, true)
+	if err != nil || user.Status != common.UserStatusEnabled {
+		clearPendingTwoFactor(session)
+		session.Save()
+		c.JSON(http.StatusOK, gin.H{
+			"message": "用戶不存在或已被封禁",
+			"success": false,
+		})
+		return
+	}
+	if err = user.ValidateTwoFactorCode(req.Code); err != nil {
+		attempts++
+		if attempts >= common.TwoFactorMaxAttempts {
+			clearPendingTwoFactor(session)
+			session.Save()
+			c.JSON(http.StatusOK, gin.H{
+				"message": "驗證碼錯誤次數過多，請重新登入",
+				"success": false,
+			})
+			return
+		}
+		session.Set("pending_2fa_attempts", attempts)
+		session.Save()
+		c.JSON(http.StatusOK, gin.H{
+			"message": err.Error(),
+			"success": false,
+		})
+		return
+	}
+	clearPendingTwoFactor(session)
+	setupLogin(user, c)
+}
+
+// GetTwoFactorStatus 獲取當前用戶的兩步驗證狀態
+func GetTwoFactorStatus(c *gin.Context) {
+	user, err := model.GetUserById(c.GetInt("id"), false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "獲取成功",
+		"data": gin.H{
+			"enabled":                  user.TwoFactorEnabled,
+			"remaining_recovery_codes": user.RemainingRecoveryCodes(),
+		},
+	})
+}
+
+// SetupTwoFactor 生成新的 TOTP 密鑰和供掃描的 provisioning URI
+func SetupTwoFactor(c *gin.Context) {
+	user, err := model.GetUserById(c.GetInt("id"), false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	secret, err := common.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "生成密鑰失敗: " + err.Error(),
+		})
+		return
+	}
+	if err = user.SetTwoFactorSecret(secret); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "請使用驗證器應用掃描二維碼，並輸入驗證碼完成啟用",
+		"data": gin.H{
+			"secret": secret,
+			"uri":    common.TOTPProvisioningURI(secret, user.Username),
+		},
+	})
+}
+
+// EnableTwoFactor 使用驗證碼確認並啟用兩步驗證
+func EnableTwoFactor(c *gin.Context) {
+	var req TwoFactorRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&req)
+	if err != nil || req.Code == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的參數",
+		})
+		return
+	}
+	user, err := model.GetUserById(c.GetInt("id"), false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	codes, err := user.EnableTwoFactor(req.Code)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "兩步驗證已啟用，請妥善保存恢復碼，它們只會顯示一次",
+		"data":    codes,
+	})
+}
+
+// DisableTwoFactor 停用兩步驗證，需要提供驗證碼或恢復碼
+func DisableTwoFactor(c *gin.Context) {
+	var req TwoFactorRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&req)
+	if err != nil || req.Code == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的參數",
+		})
+		return
+	}
+	user, err := model.GetUserById(c.GetInt("id"), false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err = user.ValidateTwoFactorCode(req.Code); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err = user.DisableTwoFactor(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "兩步驗證已停用",
+	})
+}
+
+// RegenerateRecoveryCodes 重新生成恢復碼，需要提供驗證碼
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var req TwoFactorRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&req)
+	if err != nil || req.Code == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的參數",
+		})
+		return
+	}
+	user, err := model.GetUserById(c.GetInt("id"), false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err = user.ValidateTwoFactorCode(req.Code); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	codes, err := user.RegenerateRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "恢復碼已重新生成，舊的恢復碼已失效",
+		"data":    codes,
+	})
+}
+
+// ResetUserTwoFactor 重置指定用戶的兩步驗證（管理員）
+func ResetUserTwoFactor(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的用戶 ID",
+		})
+		return
+	}
+	myRole := c.GetInt("role")
+	existingUser, err := model.GetUserById(id, false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if existingUser.Role >= myRole {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無法修改權限大於等於自己的用戶",
+		})
+		return
+	}
+	if err = existingUser.DisableTwoFactor(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	common.SysLog("two-factor authentication of user " + strconv.Itoa(id) + " was reset by user " + strconv.Itoa(c.GetInt("id")))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "兩步驗證已重置",
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"account-system/common"
 	"account-system/model"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
@@ -38,9 +39,11 @@ func setupLogin(user *model.User, c *gin.Context) {
 		Username:    user.Username,
 		DisplayName: user.DisplayName,
 		Role:        user.Role,
+		RoleId:      user.RoleId,
 		Status:      user.Status,
 		Email:       user.Email,
 	}
+	cleanUser.Permissions, _ = model.GetUserPermissions(user.Id)
 	c.JSON(http.StatusOK, gin.H{
 		"message": "登入成功",
 		"success": true,
@@ -48,6 +51,25 @@ func setupLogin(user *model.User, c *gin.Context) {
 	})
 }
 
+// respondPasswordPolicyError 返回密碼策略檢查失敗的結果，違規項放在 data.violations 中
+func respondPasswordPolicyError(c *gin.Context, err error) {
+	var policyErr *common.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": false,
+		"message": policyErr.Error(),
+		"data": gin.H{
+			"violations": policyErr.Violations,
+		},
+	})
+}
+
 // Login 用戶登入
 func Login(c *gin.Context) {
 	if !common.PasswordLoginEnabled {
@@ -87,6 +109,10 @@ func Login(c *gin.Context) {
 		})
 		return
 	}
+	if user.TwoFactorEnabled {
+		setupPendingTwoFactor(&user, c)
+		return
+	}
 	setupLogin(&user, c)
 }
 
@@ -106,8 +132,11 @@ func Register(c *gin.Context) {
 		})
 		return
 	}
-	var user model.User
-	err := json.NewDecoder(c.Request.Body).Decode(&user)
+	var req struct {
+		model.User
+		VerificationCode string `json:"verification_code"`
+	}
+	err := json.NewDecoder(c.Request.Body).Decode(&req)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -115,6 +144,8 @@ func Register(c *gin.Context) {
 		})
 		return
 	}
+	user := req.User
+	user.Email = strings.TrimSpace(user.Email)
 	// 驗證用戶輸入
 	if user.Username == "" || user.Password == "" {
 		c.JSON(http.StatusOK, gin.H{
@@ -123,11 +154,8 @@ func Register(c *gin.Context) {
 		})
 		return
 	}
-	if len(user.Password) < 8 {
-		c.JSON(http.StatusOK, gin.H{
-			"success": false,
-			"message": "密碼長度不得小於 8 位",
-		})
+	if err := model.ValidateNewPassword(0, user.Password, user.Username, user.Email); err != nil {
+		respondPasswordPolicyError(c, err)
 		return
 	}
 	if common.EmailVerificationEnabled {
@@ -138,7 +166,22 @@ func Register(c *gin.Context) {
 			})
 			return
 		}
-		// 這裡可以添加郵箱驗證碼檢查邏輯
+		if req.VerificationCode == "" {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "請輸入郵箱驗證碼",
+			})
+			return
+		}
+	}
+	if user.Email != "" {
+		if err = common.CheckEmailAddress(user.Email); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
 	}
 	exist, err := model.CheckUserExistOrDeleted(user.Username, user.Email)
 	if err != nil {
@@ -156,13 +199,26 @@ func Register(c *gin.Context) {
 		})
 		return
 	}
+	// 未開啟郵箱驗證時，提交了驗證碼也同樣校驗並標記郵箱已驗證
+	emailVerified := false
+	if user.Email != "" && req.VerificationCode != "" {
+		if err = model.ConsumeVerificationCode(common.EmailVerificationPurpose, user.Email, req.VerificationCode); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		emailVerified = true
+	}
 	cleanUser := model.User{
-		Username:    user.Username,
-		Password:    user.Password,
-		DisplayName: user.Username,
-		Email:       user.Email,
-		Role:        common.RoleCommonUser,
-		Status:      common.UserStatusEnabled,
+		Username:      user.Username,
+		Password:      user.Password,
+		DisplayName:   user.Username,
+		Email:         user.Email,
+		EmailVerified: emailVerified,
+		Role:          common.RoleCommonUser,
+		Status:        common.UserStatusEnabled,
 	}
 	if err := cleanUser.Insert(); err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -199,6 +255,7 @@ func GetSelf(c *gin.Context) {
 		})
 		return
 	}
+	user.Permissions, _ = model.GetUserPermissions(id)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "獲取成功",
@@ -218,14 +275,13 @@ func UpdateSelf(c *gin.Context) {
 		return
 	}
 	updatePassword := user.Password != ""
-	if updatePassword && len(user.Password) < 8 {
-		c.JSON(http.StatusOK, gin.H{
-			"success": false,
-			"message": "密碼長度不得小於 8 位",
-		})
-		return
-	}
 	user.Id = c.GetInt("id")
+	if updatePassword {
+		if err = model.ValidateNewPassword(user.Id, user.Password, user.Username, user.Email); err != nil {
+			respondPasswordPolicyError(c, err)
+			return
+		}
+	}
 	err = user.Update(updatePassword)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -234,6 +290,12 @@ func UpdateSelf(c *gin.Context) {
 		})
 		return
 	}
+	if updatePassword {
+		// 修改密碼後登出其他設備，保留當前會話
+		if err = model.RevokeUserSessions(user.Id, sessions.Default(c).ID()); err != nil {
+			common.SysError("failed to revoke sessions: " + err.Error())
+		}
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "更新成功",
@@ -271,9 +333,7 @@ func GenerateAccessToken(c *gin.Context) {
 		})
 		return
 	}
-	token := common.GetUUID()
-	user.SetAccessToken(token)
-	err = user.Update(false)
+	token, err := user.GenerateAccessToken()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -366,11 +426,8 @@ func CreateUser(c *gin.Context) {
 		})
 		return
 	}
-	if len(user.Password) < 8 {
-		c.JSON(http.StatusOK, gin.H{
-			"success": false,
-			"message": "密碼長度不得小於 8 位",
-		})
+	if err := model.ValidateNewPassword(0, user.Password, user.Username, user.Email); err != nil {
+		respondPasswordPolicyError(c, err)
 		return
 	}
 	if user.DisplayName == "" {
@@ -402,6 +459,8 @@ func CreateUser(c *gin.Context) {
 	if user.Status == 0 {
 		user.Status = common.UserStatusEnabled
 	}
+	// 帳戶額度只能通過額度流水變化
+	user.Quota = 0
 	err = user.Insert()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -416,7 +475,7 @@ func CreateUser(c *gin.Context) {
 	})
 }
 
-// UpdateUser 更新用戶（管理員）
+// UpdateUser 更新用戶資料（管理員），角色和狀態通過 ManageUser 修改
 func UpdateUser(c *gin.Context) {
 	var user model.User
 	err := json.NewDecoder(c.Request.Body).Decode(&user)
@@ -435,13 +494,6 @@ func UpdateUser(c *gin.Context) {
 		return
 	}
 	updatePassword := user.Password != ""
-	if updatePassword && len(user.Password) < 8 {
-		c.JSON(http.StatusOK, gin.H{
-			"success": false,
-			"message": "密碼長度不得小於 8 位",
-		})
-		return
-	}
 	myRole := c.GetInt("role")
 	existingUser, err := model.GetUserById(user.Id, false)
 	if err != nil {
@@ -465,6 +517,12 @@ func UpdateUser(c *gin.Context) {
 		})
 		return
 	}
+	if updatePassword {
+		if err = model.ValidateNewPassword(user.Id, user.Password, user.Username, user.Email); err != nil {
+			respondPasswordPolicyError(c, err)
+			return
+		}
+	}
 	err = user.Update(updatePassword)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -473,12 +531,124 @@ func UpdateUser(c *gin.Context) {
 		})
 		return
 	}
+	if updatePassword {
+		if err = model.RevokeUserSessions(user.Id, ""); err != nil {
+			common.SysError("failed to revoke sessions: " + err.Error())
+		}
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "更新成功",
 	})
 }
 
+// roleLadder 按權限從低到高排列的角色，升級和降級時移動一級
+var roleLadder = []int{common.RoleGuestUser, common.RoleCommonUser, common.RoleAdminUser, common.RoleRootUser}
+
+// adjacentRole 返回角色在 roleLadder 中相鄰的角色，step 為 1 時升級，為 -1 時降級
+func adjacentRole(role int, step int) (int, bool) {
+	for i, r := range roleLadder {
+		if r == role {
+			if i+step < 0 || i+step >= len(roleLadder) {
+				return 0, false
+			}
+			return roleLadder[i+step], true
+		}
+	}
+	return 0, false
+}
+
+// ManageUser 啟用、禁用、升級或降級用戶（管理員）；不能操作權限大於等於自己的用戶，
+// 但可以降級自己，最後一個超級管理員除外；禁用時撤銷用戶的會話和令牌
+func ManageUser(c *gin.Context) {
+	var req struct {
+		Id     int    `json:"id"`
+		Action string `json:"action"`
+	}
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil || req.Id == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的參數",
+		})
+		return
+	}
+	myId := c.GetInt("id")
+	myRole := c.GetInt("role")
+	user, err := model.GetUserById(req.Id, false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "用戶不存在",
+		})
+		return
+	}
+	selfDemote := user.Id == myId && req.Action == "demote"
+	if user.Role >= myRole && !selfDemote {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無法修改權限大於等於自己的用戶",
+		})
+		return
+	}
+	switch req.Action {
+	case "enable":
+		err = model.EnableUser(user.Id)
+	case "disable":
+		err = model.DisableUser(user.Id)
+	case "promote", "demote":
+		step := 1
+		if req.Action == "demote" {
+			step = -1
+		}
+		role, ok := adjacentRole(user.Role, step)
+		if !ok || !common.IsValidateRole(role) {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "用戶已是最高或最低的角色",
+			})
+			return
+		}
+		if role >= myRole {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "無法將用戶權限設為大於等於自己的權限",
+			})
+			return
+		}
+		err = model.SetUserRole(user.Id, role)
+	default:
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的操作",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	common.SysLog(fmt.Sprintf("user %d performed %s on user %d", myId, req.Action, user.Id))
+	user, err = model.GetUserById(user.Id, false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "操作成功",
+		"data": gin.H{
+			"role":   user.Role,
+			"status": user.Status,
+		},
+	})
+}
+
 // DeleteUser 刪除用戶（管理員）
 func DeleteUser(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
@@ -518,3 +688,42 @@ func DeleteUser(c *gin.Context) {
 		"message": "刪除成功",
 	})
 }
+
+// UnlockUser 解除用戶的登入鎖定（管理員）
+func UnlockUser(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無效的用戶 ID",
+		})
+		return
+	}
+	myRole := c.GetInt("role")
+	existingUser, err := model.GetUserById(id, false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if existingUser.Role >= myRole {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "無法修改權限大於等於自己的用戶",
+		})
+		return
+	}
+	if err = model.UnlockUserLogin(id); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "已解除登入鎖定",
+	})
+}
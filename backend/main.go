@@ -2,17 +2,21 @@ package main
 
 import (
 	"account-system/common"
+	"account-system/middleware"
 	"account-system/model"
 	"account-system/router"
+	"context"
 	"embed"
 	"fmt"
 	"github.com/gin-contrib/sessions"
-	"github.com/gin-contrib/sessions/cookie"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 //go:embed web/dist
@@ -52,13 +56,20 @@ func main() {
 		}
 	}()
 
+	// 啟動後台任務：標記過期和額度用盡的令牌、發送過期提醒、清理過期的會話、授權、退役簽名密鑰、使用記錄和速率限制器
+	model.StartJobs(append(model.DefaultJobs(), middleware.CleanupLimitersJob()))
+
 	// 初始化 HTTP 服務器
 	server := gin.New()
 	server.Use(gin.Logger())
 	server.Use(gin.Recovery())
+	if err = server.SetTrustedProxies(common.TrustedProxies); err != nil {
+		common.FatalLog("failed to set trusted proxies: " + err.Error())
+	}
+	server.Use(middleware.ClientIP())
 
-	// 初始化會話存儲
-	store := cookie.NewStore([]byte(common.SessionSecret))
+	// 初始化會話存儲，會話保存在數據庫中以便撤銷
+	store := model.NewSessionStore([]byte(common.SessionSecret))
 	store.Options(sessions.Options{
 		Path:     "/",
 		MaxAge:   2592000, // 30 天
@@ -78,9 +89,28 @@ func main() {
 	}
 
 	// 啟動服務器
-	common.SysLog(fmt.Sprintf("Server is running on port %s", port))
-	err = server.Run(":" + port)
-	if err != nil {
-		common.FatalLog("failed to start HTTP server: " + err.Error())
+	httpServer := &http.Server{
+		Addr:    ":" + port,
+		Handler: server,
+	}
+	go func() {
+		common.SysLog(fmt.Sprintf("Server is running on port %s", port))
+		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			common.FatalLog("failed to start HTTP server: " + err.Error())
+		}
+	}()
+
+	// 收到退出信號後停止接收新請求，等待進行中的請求和後台任務結束
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	<-ctx.Done()
+	stop()
+	common.SysLog("shutting down server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err = httpServer.Shutdown(shutdownCtx); err != nil {
+		common.SysError("failed to shut down HTTP server: " + err.Error())
+	}
+	if err = model.StopJobs(shutdownCtx); err != nil {
+		common.SysError("failed to stop background jobs: " + err.Error())
 	}
 }
@@ -3,10 +3,16 @@ package middleware
 import (
 	"account-system/common"
 	"account-system/model"
+	"errors"
+	"fmt"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // 驗證用戶信息是否有效
@@ -17,14 +23,29 @@ func validUserInfo(username interface{}, role interface{}) bool {
 	return true
 }
 
-// authHelper 認證輔助函數
-func authHelper(c *gin.Context, minRole int) {
+// authHelper 認證輔助函數，permissions 不為空時還要求用戶的角色授予其中所有權限
+func authHelper(c *gin.Context, minRole int, permissions ...string) {
 	session := sessions.Default(c)
 	username := session.Get("username")
 	role := session.Get("role")
 	id := session.Get("id")
 	status := session.Get("status")
 	useAccessToken := false
+	if username != nil {
+		// 以數據庫中的角色和狀態為準，避免會話中緩存的舊值繼續生效
+		var err error
+		role, status, err = model.GetUserRoleAndStatus(id.(int))
+		if err != nil {
+			session.Clear()
+			session.Save()
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"message": "無權進行此操作，用戶不存在",
+			})
+			c.Abort()
+			return
+		}
+	}
 	if username == nil {
 		// 檢查訪問令牌
 		accessToken := c.Request.Header.Get("Authorization")
@@ -77,6 +98,28 @@ func authHelper(c *gin.Context, minRole int) {
 		c.Abort()
 		return
 	}
+	if len(permissions) > 0 {
+		granted, err := model.GetUserPermissions(id.(int))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "無權進行此操作，獲取用戶權限失敗",
+			})
+			c.Abort()
+			return
+		}
+		for _, permission := range permissions {
+			if !model.HasPermission(granted, permission) {
+				c.JSON(http.StatusOK, gin.H{
+					"success": false,
+					"message": "無權進行此操作，缺少權限：" + permission,
+				})
+				c.Abort()
+				return
+			}
+		}
+		c.Set("permissions", granted)
+	}
 	c.Set("username", username)
 	c.Set("role", role)
 	c.Set("id", id)
@@ -110,6 +153,13 @@ func AdminAuth() func(c *gin.Context) {
 	}
 }
 
+// RequirePermission 用戶認證，並要求用戶的角色授予所有指定的權限
+func RequirePermission(permissions ...string) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		authHelper(c, common.RoleCommonUser, permissions...)
+	}
+}
+
 // RootAuth 超級管理員認證
 func RootAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
@@ -120,42 +170,162 @@ func RootAuth() func(c *gin.Context) {
 // TokenAuth 令牌認證
 func TokenAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
+		start := time.Now()
 		key := c.Request.Header.Get("Authorization")
 		key = strings.TrimPrefix(key, "Bearer ")
-		token, err := model.ValidateUserToken(key)
-		if err != nil {
+		// 校驗碼錯誤的令牌直接拒絕，不查詢數據庫
+		if !common.IsTokenKeyWellFormed(key, common.TokenKeyTypeAPI) {
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"success": false,
-				"message": err.Error(),
+				"message": "令牌格式或校驗碼錯誤",
 			})
 			c.Abort()
 			return
 		}
-		userEnabled, err := model.IsUserEnabled(token.UserId)
+		token, err := model.ValidateUserToken(key)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
+			c.JSON(http.StatusUnauthorized, gin.H{
 				"success": false,
 				"message": err.Error(),
 			})
 			c.Abort()
 			return
 		}
-		if !userEnabled {
+		clientIP := c.ClientIP()
+		if !token.IsIPAllowed(clientIP) {
+			common.SysLog(fmt.Sprintf("token %d rejected: client ip %s is not in the allowlist", token.Id, clientIP))
 			c.JSON(http.StatusForbidden, gin.H{
 				"success": false,
-				"message": "用戶已被禁用",
+				"message": "該令牌不允許從當前 IP 地址使用",
+				"data": gin.H{
+					"ip_not_allowed": true,
+				},
+			})
+			c.Abort()
+			return
+		}
+		// 組織令牌屬於組織，不依賴創建者的狀態，從組織額度扣減
+		var owner *model.User
+		var organization *model.Organization
+		if token.OrganizationId != 0 {
+			organization, err = model.GetOrganizationById(token.OrganizationId)
+			if err != nil {
+				c.JSON(http.StatusForbidden, gin.H{
+					"success": false,
+					"message": "令牌所屬的組織不存在",
+				})
+				c.Abort()
+				return
+			}
+		} else {
+			owner, err = model.GetTokenOwner(token.UserId)
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"success": false,
+					"message": err.Error(),
+				})
+				c.Abort()
+				return
+			}
+			// 所有者已被刪除時與被禁用時的響應相同
+			if err != nil || owner.Status != common.UserStatusEnabled {
+				c.JSON(http.StatusForbidden, gin.H{
+					"success": false,
+					"message": "用戶已被禁用",
+				})
+				c.Abort()
+				return
+			}
+			// 令牌的速率限制不能超過所有者分組的速率限制
+			token.ApplyGroupRateLimit(model.GetUserGroupRateLimit(owner.Group))
+		}
+		if allowed, retryAfter := allowTokenRequest(token); !allowed {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(seconds))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"success": false,
+				"message": "該令牌請求過於頻繁，請稍後再試",
+				"data": gin.H{
+					"retry_after": seconds,
+				},
 			})
 			c.Abort()
 			return
 		}
-		c.Set("id", token.UserId)
+		// 組織令牌代表組織而不是創建者，不設置用戶身份，用戶相關的接口通過 RequirePersonalToken 拒絕組織令牌
+		if token.OrganizationId == 0 {
+			c.Set("id", token.UserId)
+		}
+		c.Set("token_user_id", token.UserId)
 		c.Set("token_id", token.Id)
-		c.Set("token_key", token.Key)
+		c.Set("token_organization_id", token.OrganizationId)
+		c.Set("token_key_prefix", token.KeyPrefix)
+		// 告知調用方本次使用的是新密鑰還是輪換前的舊密鑰，便於確認遷移進度
+		if token.UsedPreviousKey {
+			c.Set("token_key_used", "previous")
+			c.Header("X-Token-Key-Used", "previous")
+			c.Header("X-Token-Key-Expires", token.PreviousKeyExpiredTime.UTC().Format(http.TimeFormat))
+		} else {
+			c.Set("token_key_used", "current")
+			c.Header("X-Token-Key-Used", "current")
+		}
 		c.Set("token_name", token.Name)
+		c.Set("token_scopes", token.Scopes)
 		c.Set("token_unlimited_quota", token.UnlimitedQuota)
-		if !token.UnlimitedQuota {
+		if organization != nil {
+			c.Set("token_quota", organization.Quota)
+		} else if token.UseAccountQuota {
+			c.Set("token_quota", owner.Quota)
+		} else if !token.UnlimitedQuota {
 			c.Set("token_quota", token.RemainQuota)
 		}
 		c.Next()
+		// 處理函數扣減額度後通過 quota_consumed 報告扣減數量
+		model.RecordTokenUsage(&model.TokenUsage{
+			TokenId:        token.Id,
+			UserId:         token.UserId,
+			OrganizationId: token.OrganizationId,
+			Method:         c.Request.Method,
+			Route:          c.FullPath(),
+			StatusCode:     c.Writer.Status(),
+			Latency:        time.Since(start).Milliseconds(),
+			ClientIP:       clientIP,
+			QuotaConsumed:  c.GetInt("quota_consumed"),
+			CreatedTime:    start,
+		})
+	}
+}
+
+// RequireScopes 要求令牌具有指定的權限範圍，需放在 TokenAuth 之後，缺少時返回 403 並列出缺少的範圍
+func RequireScopes(scopes ...string) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		missing := model.MissingTokenScopes(c.GetStringSlice("token_scopes"), scopes)
+		if len(missing) > 0 {
+			c.JSON(http.StatusForbidden, gin.H{
+				"success": false,
+				"message": "令牌缺少所需的權限範圍：" + strings.Join(missing, ", "),
+				"data": gin.H{
+					"missing_scopes": missing,
+				},
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequirePersonalToken 只允許個人令牌訪問，需放在 TokenAuth 之後；組織令牌沒有用戶身份，訪問用戶相關的接口時返回 403
+func RequirePersonalToken() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if c.GetInt("token_organization_id") != 0 {
+			c.JSON(http.StatusForbidden, gin.H{
+				"success": false,
+				"message": "組織令牌不能訪問用戶相關的接口",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
 	}
 }
@@ -0,0 +1,14 @@
+package middleware
+
+import (
+	"account-system/common"
+	"github.com/gin-gonic/gin"
+)
+
+// ClientIP 將 gin 按信任的反向代理解析出的客戶端 IP 保存到請求上下文中，需要在會話中間件之前註冊
+func ClientIP() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = common.WithClientIP(c.Request, c.ClientIP())
+		c.Next()
+	}
+}
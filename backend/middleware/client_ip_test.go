@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"account-system/common"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	if err := engine.SetTrustedProxies([]string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	engine.Use(ClientIP())
+	engine.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, common.GetRequestIP(c.Request))
+	})
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{"direct", "203.0.113.7:1234", nil, "203.0.113.7"},
+		{"forged forwarded for", "203.0.113.7:1234", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "203.0.113.7"},
+		{"forged real ip", "203.0.113.7:1234", map[string]string{"X-Real-IP": "198.51.100.1"}, "203.0.113.7"},
+		{"trusted proxy", "10.0.0.2:1234", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "198.51.100.1"},
+		{"trusted proxy chain", "10.0.0.2:1234", map[string]string{"X-Forwarded-For": "198.51.100.1, 203.0.113.9"}, "203.0.113.9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, req)
+			if got := w.Body.String(); got != tt.want {
+				t.Fatalf("client ip = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("without middleware", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "203.0.113.7:1234"
+		req.Header.Set("X-Forwarded-For", "198.51.100.1")
+		if got := common.GetRequestIP(req); got != "203.0.113.7" {
+			t.Fatalf("client ip = %q, want 203.0.113.7", got)
+		}
+	})
+}
+
+// TestDefaultTrustedProxies 默認只信任本機的反向代理，私有網段中的客戶端不能偽造 X-Forwarded-For
+func TestDefaultTrustedProxies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	if err := engine.SetTrustedProxies(common.TrustedProxies); err != nil {
+		t.Fatal(err)
+	}
+	engine.Use(ClientIP())
+	engine.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, common.GetRequestIP(c.Request))
+	})
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		want       string
+	}{
+		{"loopback proxy", "127.0.0.1:1234", "198.51.100.1"},
+		{"ipv6 loopback proxy", "[::1]:1234", "198.51.100.1"},
+		{"class a private network", "10.0.0.2:1234", "10.0.0.2"},
+		{"class b private network", "172.16.0.2:1234", "172.16.0.2"},
+		{"class c private network", "192.168.1.2:1234", "192.168.1.2"},
+		{"unique local address", "[fd00::2]:1234", "fd00::2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("X-Forwarded-For", "198.51.100.1")
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, req)
+			if got := w.Body.String(); got != tt.want {
+				t.Fatalf("client ip = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,6 +2,8 @@ package middleware
 
 import (
 	"account-system/common"
+	"account-system/model"
+	"context"
 	"github.com/gin-gonic/gin"
 	"golang.org/x/time/rate"
 	"net/http"
@@ -19,6 +21,9 @@ var (
 
 	criticalLimiters    = make(map[string]*rate.Limiter)
 	criticalLimitersMux sync.Mutex
+
+	tokenLimiters    = make(map[int]*rate.Limiter)
+	tokenLimitersMux sync.Mutex
 )
 
 // 獲取 API 速率限制器
@@ -63,22 +68,69 @@ func getCriticalLimiter(key string) *rate.Limiter {
 	return limiter
 }
 
+// 獲取令牌速率限制器，令牌的限制配置修改後同步更新已有的限制器
+func getTokenLimiter(token *model.Token) *rate.Limiter {
+	tokenLimitersMux.Lock()
+	defer tokenLimitersMux.Unlock()
+
+	limit := rate.Limit(float64(token.RateLimitNum) / float64(token.RateLimitDuration))
+	limiter, exists := tokenLimiters[token.Id]
+	if !exists {
+		limiter = rate.NewLimiter(limit, token.RateLimitBurst)
+		tokenLimiters[token.Id] = limiter
+	} else if limiter.Limit() != limit || limiter.Burst() != token.RateLimitBurst {
+		limiter.SetLimit(limit)
+		limiter.SetBurst(token.RateLimitBurst)
+	}
+
+	return limiter
+}
+
+// allowTokenRequest 檢查令牌是否超出速率限制，超出時返回需要等待的時間
+func allowTokenRequest(token *model.Token) (bool, time.Duration) {
+	if token.RateLimitNum <= 0 || token.RateLimitDuration <= 0 {
+		return true, 0
+	}
+	reservation := getTokenLimiter(token).Reserve()
+	if !reservation.OK() {
+		return false, time.Duration(token.RateLimitDuration) * time.Second
+	}
+	if delay := reservation.Delay(); delay > 0 {
+		reservation.Cancel()
+		return false, delay
+	}
+	return true, 0
+}
+
 // 清理過期的限制器
 func cleanupLimiters() {
-	for {
-		time.Sleep(time.Hour)
+	apiLimitersMux.Lock()
+	apiLimiters = make(map[string]*rate.Limiter)
+	apiLimitersMux.Unlock()
+
+	webLimitersMux.Lock()
+	webLimiters = make(map[string]*rate.Limiter)
+	webLimitersMux.Unlock()
 
-		apiLimitersMux.Lock()
-		apiLimiters = make(map[string]*rate.Limiter)
-		apiLimitersMux.Unlock()
+	criticalLimitersMux.Lock()
+	criticalLimiters = make(map[string]*rate.Limiter)
+	criticalLimitersMux.Unlock()
 
-		webLimitersMux.Lock()
-		webLimiters = make(map[string]*rate.Limiter)
-		webLimitersMux.Unlock()
+	tokenLimitersMux.Lock()
+	tokenLimiters = make(map[int]*rate.Limiter)
+	tokenLimitersMux.Unlock()
+}
 
-		criticalLimitersMux.Lock()
-		criticalLimiters = make(map[string]*rate.Limiter)
-		criticalLimitersMux.Unlock()
+// CleanupLimitersJob 每小時清理進程內的速率限制器，每個實例都需要執行，隨 StopJobs 停止
+func CleanupLimitersJob() model.Job {
+	return model.Job{
+		Name:     "cleanup_rate_limiters",
+		Interval: time.Hour,
+		Local:    true,
+		Run: func(ctx context.Context) error {
+			cleanupLimiters()
+			return nil
+		},
 	}
 }
 
@@ -142,8 +194,3 @@ func CriticalRateLimit() gin.HandlerFunc {
 		c.Next()
 	}
 }
-
-// 初始化速率限制器清理
-func init() {
-	go cleanupLimiters()
-}
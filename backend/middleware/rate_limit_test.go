@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCleanupLimitersJob(t *testing.T) {
+	job := CleanupLimitersJob()
+	if !job.Local {
+		t.Fatal("limiters are per process, the cleanup job must run on every instance")
+	}
+	tests := []struct {
+		name   string
+		create func()
+		count  func() int
+	}{
+		{name: "api", create: func() { getApiLimiter("1.2.3.4") }, count: func() int { return len(apiLimiters) }},
+		{name: "web", create: func() { getWebLimiter("1.2.3.4") }, count: func() int { return len(webLimiters) }},
+		{name: "critical", create: func() { getCriticalLimiter("1.2.3.4") }, count: func() int { return len(criticalLimiters) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.create()
+			if tt.count() == 0 {
+				t.Fatal("limiter was not created")
+			}
+			if err := job.Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if n := tt.count(); n != 0 {
+				t.Errorf("%d limiters left after cleanup", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package model
+
+import (
+	"account-system/common"
+	"fmt"
+	"strings"
+)
+
+// migratePlaintextCredentials 將舊版以明文保存的 API 令牌和系統管理令牌就地轉為哈希，
+// 完成後刪除明文列；已遷移的數據庫直接跳過
+func migratePlaintextCredentials() error {
+	if err := migratePlaintextColumn(&Token{}, "idx_tokens_key", "key", "key_hash", "key_prefix"); err != nil {
+		return err
+	}
+	return migratePlaintextColumn(&User{}, "idx_users_access_token", "access_token", "access_token_hash", "access_token_prefix")
+}
+
+func migratePlaintextColumn(model interface{}, index, plainColumn, hashColumn, prefixColumn string) error {
+	migrator := DB.Migrator()
+	if !migrator.HasColumn(model, plainColumn) {
+		return nil
+	}
+	var rows []map[string]interface{}
+	err := DB.Unscoped().Model(model).
+		Where(fmt.Sprintf("%s IS NULL OR %s = ''", hashColumn, hashColumn)).Find(&rows).Error
+	if err != nil {
+		return err
+	}
+	migrated := 0
+	for _, row := range rows {
+		if row[plainColumn] == nil {
+			continue
+		}
+		// char 列可能帶有填充空格
+		plain := strings.TrimRight(fmt.Sprint(row[plainColumn]), " ")
+		if plain == "" {
+			continue
+		}
+		err = DB.Unscoped().Model(model).Where("id = ?", row["id"]).Updates(map[string]interface{}{
+			hashColumn:   common.HashTokenKey(plain),
+			prefixColumn: common.TokenKeyPrefix(plain),
+		}).Error
+		if err != nil {
+			return err
+		}
+		migrated++
+	}
+	// 先刪除明文列上的唯一索引，SQLite 不允許刪除帶索引的列
+	if migrator.HasIndex(model, index) {
+		if err = migrator.DropIndex(model, index); err != nil {
+			return err
+		}
+	}
+	if err = migrator.DropColumn(model, plainColumn); err != nil {
+		return err
+	}
+	// SQLite 刪除列時會重建數據表，需要重新創建其他索引
+	if err = migrator.AutoMigrate(model); err != nil {
+		return err
+	}
+	common.SysLog(fmt.Sprintf("hashed %d plaintext credentials in column %s", migrated, plainColumn))
+	return nil
+}
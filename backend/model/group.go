@@ -0,0 +1,226 @@
+package model
+
+import (
+	"account-system/common"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"regexp"
+	"time"
+)
+
+// Group 用戶分組，由管理員定義；用戶加入分組時獲得分組的默認額度，
+// 成員令牌未設置速率限制時使用分組的速率限制
+type Group struct {
+	Id                int       `json:"id"`
+	Name              string    `json:"name" gorm:"type:varchar(32);uniqueIndex"` // 創建後不可修改
+	Description       string    `json:"description" gorm:"type:varchar(255)"`
+	DefaultQuota      int       `json:"default_quota" gorm:"default:0"` // 加入分組時發放到帳戶的額度
+	RateLimitNum      int       `json:"rate_limit_num"`                 // 每個時間窗口允許的請求數，0 表示不限制
+	RateLimitDuration int64     `json:"rate_limit_duration"`            // 時間窗口 (秒)
+	RateLimitBurst    int       `json:"rate_limit_burst"`               // 允許的突發請求數
+	CreatedTime       time.Time `json:"created_time" gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP"`
+	MemberCount       int64     `json:"member_count" gorm:"-"`
+}
+
+var groupNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,32}$`)
+
+// validate 檢查分組配置
+func (group *Group) validate() error {
+	if !groupNamePattern.MatchString(group.Name) {
+		return errors.New("分組名稱只能包含字母、數字、下劃線和連字符，且長度不得超過 32")
+	}
+	if len(group.Description) > 255 {
+		return errors.New("分組描述長度不得超過 255")
+	}
+	if group.DefaultQuota < 0 {
+		return errors.New("默認額度不能為負數")
+	}
+	return normalizeRateLimit(&group.RateLimitNum, &group.RateLimitDuration, &group.RateLimitBurst)
+}
+
+// Insert 創建分組
+func (group *Group) Insert() error {
+	if err := group.validate(); err != nil {
+		return err
+	}
+	var count int64
+	DB.Model(&Group{}).Where("name = ?", group.Name).Count(&count)
+	if count > 0 {
+		return errors.New("分組名稱已存在")
+	}
+	group.Id = 0
+	group.CreatedTime = time.Now()
+	return DB.Create(group).Error
+}
+
+// Update 更新分組的描述、默認額度和速率限制，分組名稱不可修改
+func (group *Group) Update() error {
+	current, err := GetGroupById(group.Id)
+	if err != nil {
+		return errors.New("分組不存在")
+	}
+	group.Name = current.Name
+	if err = group.validate(); err != nil {
+		return err
+	}
+	return DB.Model(group).Select("description", "default_quota", "rate_limit_num", "rate_limit_duration", "rate_limit_burst").
+		Updates(group).Error
+}
+
+// Delete 刪除分組，默認分組和仍有成員的分組不能刪除
+func (group *Group) Delete() error {
+	if group.Id == 0 {
+		return errors.New("id 為空！")
+	}
+	if group.Name == common.DefaultUserGroup {
+		return errors.New("默認分組不能刪除")
+	}
+	var count int64
+	if err := DB.Model(&User{}).Where("`group` = ?", group.Name).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("分組中還有 %d 個用戶，請先將其移到其他分組", count)
+	}
+	return DB.Delete(group).Error
+}
+
+// GetAllGroups 獲取所有分組及其成員數
+func GetAllGroups() (groups []*Group, err error) {
+	if err = DB.Order("id").Find(&groups).Error; err != nil {
+		return nil, err
+	}
+	var counts []struct {
+		Group string
+		Count int64
+	}
+	err = DB.Model(&User{}).Select("`group`, COUNT(*) AS count").Group("`group`").Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]int64, len(counts))
+	for _, c := range counts {
+		byName[c.Group] = c.Count
+	}
+	for _, group := range groups {
+		group.MemberCount = byName[group.Name]
+	}
+	return groups, nil
+}
+
+// GetGroupById 通過 ID 獲取分組
+func GetGroupById(id int) (*Group, error) {
+	if id == 0 {
+		return nil, errors.New("id 為空！")
+	}
+	var group Group
+	err := DB.First(&group, "id = ?", id).Error
+	return &group, err
+}
+
+// GetGroupByName 通過名稱獲取分組
+func GetGroupByName(name string) (*Group, error) {
+	var group Group
+	err := DB.First(&group, "name = ?", name).Error
+	return &group, err
+}
+
+// GetGroupMembers 分頁獲取分組中的用戶
+func GetGroupMembers(name string, page, pageSize int) (users []*User, total int64, err error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 10
+	}
+	query := DB.Model(&User{}).Where("`group` = ?", name)
+	if err = query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = query.Omit("password").Order("id desc").Limit(pageSize).Offset((page - 1) * pageSize).Find(&users).Error
+	return users, total, err
+}
+
+// MoveUsersToGroup 將用戶移到分組，只能移動角色低於 myRole 的用戶；
+// grantQuota 為 true 時向新加入的用戶發放分組的默認額度，已在分組中的用戶不重複發放
+func MoveUsersToGroup(userIds []int, groupId int, grantQuota bool, myRole int) (moved int, err error) {
+	group, err := GetGroupById(groupId)
+	if err != nil {
+		return 0, errors.New("分組不存在")
+	}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		var users []*User
+		if err := tx.Select("id", "role", "group").Where("id IN ?", userIds).Find(&users).Error; err != nil {
+			return err
+		}
+		if len(users) != len(userIds) {
+			return errors.New("用戶不存在")
+		}
+		for _, user := range users {
+			if user.Role >= myRole {
+				return errors.New("無法修改權限大於等於自己的用戶")
+			}
+		}
+		for _, user := range users {
+			if user.Group == group.Name {
+				continue
+			}
+			result := tx.Model(&User{}).Where("id = ? AND `group` = ?", user.Id, user.Group).Update("group", group.Name)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				continue
+			}
+			moved++
+			if grantQuota && group.DefaultQuota > 0 {
+				reason := "加入分組 " + group.Name
+				if _, err := changeUserQuota(tx, user.Id, 0, group.DefaultQuota, common.QuotaLedgerTypeGrant, reason); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	return moved, err
+}
+
+// joinGroup 為新用戶確定分組並發放分組的默認額度，需要在創建用戶的事務中調用
+func (user *User) joinGroup(tx *gorm.DB) error {
+	var group Group
+	if err := tx.First(&group, "name = ?", user.Group).Error; err != nil {
+		return errors.New("分組不存在")
+	}
+	if group.DefaultQuota <= 0 {
+		return nil
+	}
+	_, err := changeUserQuota(tx, user.Id, 0, group.DefaultQuota, common.QuotaLedgerTypeGrant, "加入分組 "+group.Name)
+	return err
+}
+
+// GetUserGroupRateLimit 獲取用戶所在分組的速率限制，分組不存在時不限制
+func GetUserGroupRateLimit(groupName string) (num int, duration int64, burst int) {
+	var group Group
+	if err := DB.Select("rate_limit_num", "rate_limit_duration", "rate_limit_burst").
+		First(&group, "name = ?", groupName).Error; err != nil {
+		return 0, 0, 0
+	}
+	return group.RateLimitNum, group.RateLimitDuration, group.RateLimitBurst
+}
+
+// createDefaultGroupIfNeed 創建內置的默認分組
+func createDefaultGroupIfNeed() error {
+	var count int64
+	if err := DB.Model(&Group{}).Where("name = ?", common.DefaultUserGroup).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	return DB.Create(&Group{
+		Name:        common.DefaultUserGroup,
+		Description: "默認分組",
+		CreatedTime: time.Now(),
+	}).Error
+}
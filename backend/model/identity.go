@@ -0,0 +1,145 @@
+package model
+
+import (
+	"account-system/common"
+	"errors"
+	"gorm.io/gorm"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// UserIdentity 用戶綁定的第三方身份
+type UserIdentity struct {
+	Id            int       `json:"id"`
+	UserId        int       `json:"user_id" gorm:"index"`
+	Provider      string    `json:"provider" gorm:"type:varchar(32);uniqueIndex:idx_provider_subject"`
+	Subject       string    `json:"subject" gorm:"type:varchar(255);uniqueIndex:idx_provider_subject"`
+	Email         string    `json:"email" gorm:"type:varchar(255)"`
+	CreatedTime   time.Time `json:"created_time" gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP"`
+	LastLoginTime time.Time `json:"last_login_time" gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP"`
+}
+
+// Insert 插入新的第三方身份
+func (identity *UserIdentity) Insert() error {
+	identity.CreatedTime = time.Now()
+	identity.LastLoginTime = time.Now()
+	return DB.Create(identity).Error
+}
+
+// UpdateLoginTime 更新最後登入時間
+func (identity *UserIdentity) UpdateLoginTime(email string) error {
+	identity.LastLoginTime = time.Now()
+	updates := map[string]interface{}{
+		"last_login_time": identity.LastLoginTime,
+	}
+	if email != "" {
+		identity.Email = email
+		updates["email"] = email
+	}
+	return DB.Model(identity).Updates(updates).Error
+}
+
+// Delete 解除第三方身份綁定
+func (identity *UserIdentity) Delete() error {
+	if identity.Id == 0 {
+		return errors.New("id 為空！")
+	}
+	return DB.Delete(identity).Error
+}
+
+// GetUserIdentity 通過提供方和 subject 查找第三方身份
+func GetUserIdentity(provider, subject string) (*UserIdentity, error) {
+	var identity UserIdentity
+	err := DB.First(&identity, "provider = ? AND subject = ?", provider, subject).Error
+	return &identity, err
+}
+
+// GetUserIdentityById 通過 ID 獲取第三方身份
+func GetUserIdentityById(id int) (*UserIdentity, error) {
+	if id == 0 {
+		return nil, errors.New("id 為空！")
+	}
+	identity := UserIdentity{Id: id}
+	err := DB.First(&identity, "id = ?", id).Error
+	return &identity, err
+}
+
+// GetUserIdentitiesByUserId 獲取用戶綁定的所有第三方身份
+func GetUserIdentitiesByUserId(userId int) (identities []*UserIdentity, err error) {
+	if userId == 0 {
+		return nil, errors.New("用戶 ID 為空！")
+	}
+	err = DB.Where("user_id = ?", userId).Order("id desc").Find(&identities).Error
+	return identities, err
+}
+
+// CountUserLoginMethods 統計用戶可用的登入方式數量（密碼、第三方身份、通行密鑰）
+func CountUserLoginMethods(userId int) (int64, error) {
+	var count, n int64
+	if err := DB.Model(&User{}).Where("id = ? AND password <> ''", userId).Count(&n).Error; err != nil {
+		return 0, err
+	}
+	count += n
+	if err := DB.Model(&UserIdentity{}).Where("user_id = ?", userId).Count(&n).Error; err != nil {
+		return 0, err
+	}
+	count += n
+	if err := DB.Model(&Passkey{}).Where("user_id = ?", userId).Count(&n).Error; err != nil {
+		return 0, err
+	}
+	count += n
+	return count, nil
+}
+
+// InsertWithIdentity 創建通過第三方身份註冊的用戶並完成綁定
+func (user *User) InsertWithIdentity(identity *UserIdentity) error {
+	if user.Group == "" {
+		user.Group = common.DefaultUserGroup
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		if err := user.joinBuiltinRole(tx); err != nil {
+			return err
+		}
+		if err := user.joinGroup(tx); err != nil {
+			return err
+		}
+		identity.UserId = user.Id
+		identity.CreatedTime = time.Now()
+		identity.LastLoginTime = time.Now()
+		return tx.Create(identity).Error
+	})
+}
+
+var usernameSanitizer = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
+// GetAvailableUsername 根據候選名稱生成未被佔用的用戶名
+func GetAvailableUsername(candidate string) (string, error) {
+	const maxLength = 12
+	base := usernameSanitizer.ReplaceAllString(candidate, "")
+	if base == "" {
+		base = "user"
+	}
+	if len(base) > maxLength {
+		base = base[:maxLength]
+	}
+	username := base
+	for i := 0; i < 5; i++ {
+		exist, err := CheckUserExistOrDeleted(username, "")
+		if err != nil {
+			return "", err
+		}
+		if !exist {
+			return username, nil
+		}
+		prefix := base
+		if len(prefix) > maxLength-5 {
+			prefix = prefix[:maxLength-5]
+		}
+		username = prefix + "_" + strings.ToLower(common.GetRandomString(4))
+	}
+	return "", errors.New("無法生成可用的用戶名")
+}
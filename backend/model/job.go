@@ -0,0 +1,177 @@
+package model
+
+import (
+	"account-system/common"
+	"context"
+	"fmt"
+	"gorm.io/gorm/clause"
+	"sync"
+	"time"
+)
+
+// JobLease 後台任務的租約，多實例部署時同一任務在一個周期內只由持有租約的實例執行
+type JobLease struct {
+	Name        string     `json:"name" gorm:"type:varchar(64);primaryKey"`
+	Owner       string     `json:"owner" gorm:"type:varchar(64)"`
+	ExpiredTime time.Time  `json:"expired_time" gorm:"type:timestamp"`
+	LastRunTime *time.Time `json:"last_run_time" gorm:"type:timestamp"`
+	LastError   string     `json:"last_error" gorm:"type:text"`
+}
+
+// Job 周期性執行的後台任務
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Local    bool // 每個實例都需要執行的任務，例如清理進程內的緩存，不使用租約也不記錄執行結果
+	Run      func(ctx context.Context) error
+}
+
+var (
+	jobInstanceId = common.GetUUID() // 當前實例的標識，用於區分租約持有者
+	jobCancel     context.CancelFunc
+	jobWaitGroup  sync.WaitGroup
+)
+
+// acquireJobLease 嘗試獲取或續期任務租約，租約未過期且由其他實例持有時返回 false
+func acquireJobLease(name string, ttl time.Duration) (bool, error) {
+	err := DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&JobLease{Name: name, ExpiredTime: time.Unix(0, 0)}).Error
+	if err != nil {
+		return false, err
+	}
+	now := time.Now()
+	result := DB.Model(&JobLease{}).
+		Where("name = ? AND (owner = ? OR expired_time < ?)", name, jobInstanceId, now).
+		Updates(map[string]interface{}{
+			"owner":        jobInstanceId,
+			"expired_time": now.Add(ttl),
+		})
+	return result.RowsAffected == 1, result.Error
+}
+
+// runJob 在持有租約時執行一次任務並記錄結果，任務中的 panic 不會影響其他任務
+func runJob(ctx context.Context, job Job) {
+	if !job.Local {
+		acquired, err := acquireJobLease(job.Name, job.Interval)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to acquire lease of job %s: %s", job.Name, err.Error()))
+			return
+		}
+		if !acquired {
+			return
+		}
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			common.SysError(fmt.Sprintf("job %s panicked: %v", job.Name, r))
+		}
+	}()
+	err := job.Run(ctx)
+	lastError := ""
+	if err != nil {
+		lastError = err.Error()
+		common.SysError(fmt.Sprintf("job %s failed: %s", job.Name, lastError))
+	}
+	if job.Local {
+		return
+	}
+	DB.Model(&JobLease{}).Where("name = ?", job.Name).Updates(map[string]interface{}{
+		"last_run_time": time.Now(),
+		"last_error":    lastError,
+	})
+}
+
+// StartJobs 啟動後台任務，每個任務啟動時執行一次，之後按間隔執行
+func StartJobs(jobs []Job) {
+	ctx, cancel := context.WithCancel(context.Background())
+	jobCancel = cancel
+	for _, job := range jobs {
+		if job.Interval <= 0 {
+			continue
+		}
+		jobWaitGroup.Add(1)
+		go func(job Job) {
+			defer jobWaitGroup.Done()
+			ticker := time.NewTicker(job.Interval)
+			defer ticker.Stop()
+			for {
+				runJob(ctx, job)
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}(job)
+	}
+}
+
+// StopJobs 停止後台任務並等待正在執行的任務結束，然後將隊列中的使用記錄寫入數據庫，超過 ctx 的期限時直接返回；
+// 正常停止後釋放當前實例持有的租約，重啟或其他實例無需等待租約過期
+func StopJobs(ctx context.Context) error {
+	if jobCancel != nil {
+		jobCancel()
+		jobCancel = nil
+		done := make(chan struct{})
+		go func() {
+			jobWaitGroup.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		err := DB.Model(&JobLease{}).Where("owner = ?", jobInstanceId).Update("expired_time", time.Unix(0, 0)).Error
+		if err != nil {
+			return err
+		}
+	}
+	return flushTokenUsages(ctx)
+}
+
+// DefaultJobs 系統內置的後台任務
+func DefaultJobs() []Job {
+	jobs := []Job{
+		{
+			Name:     "sweep_tokens",
+			Interval: time.Duration(common.TokenSweepInterval) * time.Second,
+			Run:      SweepTokens,
+		},
+		{
+			Name:     "delete_expired_oauth2_grants",
+			Interval: time.Hour,
+			Run: func(ctx context.Context) error {
+				return DeleteExpiredOAuth2Grants()
+			},
+		},
+		{
+			Name:     "delete_expired_sessions",
+			Interval: time.Hour,
+			Run: func(ctx context.Context) error {
+				return DeleteExpiredSessions()
+			},
+		},
+		{
+			Name:     "delete_retired_oauth2_signing_keys",
+			Interval: time.Hour,
+			Run: func(ctx context.Context) error {
+				return DeleteRetiredOAuth2SigningKeys()
+			},
+		},
+		{
+			Name:     "delete_expired_token_usages",
+			Interval: time.Hour,
+			Run: func(ctx context.Context) error {
+				return DeleteExpiredTokenUsages()
+			},
+		},
+	}
+	if common.TokenExpiryNoticeDays > 0 {
+		jobs = append(jobs, Job{
+			Name:     "notify_expiring_tokens",
+			Interval: time.Hour,
+			Run:      NotifyExpiringTokens,
+		})
+	}
+	return jobs
+}
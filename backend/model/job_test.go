@@ -0,0 +1,89 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDefaultJobsPurgeSessions(t *testing.T) {
+	for _, job := range DefaultJobs() {
+		if job.Name == "delete_expired_sessions" {
+			return
+		}
+	}
+	t.Fatal("delete_expired_sessions is not registered")
+}
+
+func TestStartJobsLease(t *testing.T) {
+	tests := []struct {
+		name      string
+		local     bool
+		leaseHeld bool // 其他實例持有租約
+		wantRun   bool
+		wantLease bool
+	}{
+		{name: "leased job", wantRun: true, wantLease: true},
+		{name: "leased job held elsewhere", leaseHeld: true, wantRun: false, wantLease: true},
+		{name: "local job", local: true, wantRun: true, wantLease: false},
+		{name: "local job ignores lease", local: true, leaseHeld: true, wantRun: true, wantLease: true},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := fmt.Sprintf("test_job_%d", i)
+			if tt.leaseHeld {
+				DB.Create(&JobLease{Name: name, Owner: "other", ExpiredTime: time.Now().Add(time.Hour)})
+			}
+			var runs int32
+			StartJobs([]Job{{
+				Name:     name,
+				Interval: time.Hour,
+				Local:    tt.local,
+				Run: func(ctx context.Context) error {
+					atomic.AddInt32(&runs, 1)
+					return nil
+				},
+			}})
+			if err := StopJobs(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if got := atomic.LoadInt32(&runs) > 0; got != tt.wantRun {
+				t.Errorf("ran = %v, want %v", got, tt.wantRun)
+			}
+			var count int64
+			DB.Model(&JobLease{}).Where("name = ?", name).Count(&count)
+			if got := count == 1; got != tt.wantLease {
+				t.Errorf("lease stored = %v, want %v", got, tt.wantLease)
+			}
+		})
+	}
+}
+
+func TestStopJobsFlushesTokenUsages(t *testing.T) {
+	tests := []struct {
+		name  string
+		count int
+	}{
+		{name: "empty queue", count: 0},
+		{name: "single batch", count: 3},
+		{name: "multiple batches", count: tokenUsageBatchSize*2 + 1},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokenId := 9000 + i
+			for j := 0; j < tt.count; j++ {
+				RecordTokenUsage(&TokenUsage{TokenId: tokenId, Method: "GET", Route: "/api/test", StatusCode: 200})
+			}
+			if err := StopJobs(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			var count int64
+			DB.Model(&TokenUsage{}).Where("token_id = ?", tokenId).Count(&count)
+			if count != int64(tt.count) {
+				t.Errorf("stored %d usages, want %d", count, tt.count)
+			}
+		})
+	}
+}
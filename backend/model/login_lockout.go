@@ -0,0 +1,123 @@
+package model
+
+import (
+	"account-system/common"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"time"
+)
+
+// loginFailureDelay 根據連續失敗次數計算下次嘗試前需要等待的時間，按指數增長
+func loginFailureDelay(failures int) time.Duration {
+	if failures < common.LoginFailureDelayThreshold {
+		return 0
+	}
+	maxDelay := time.Duration(common.LoginFailureMaxDelay) * time.Second
+	delay := time.Duration(common.LoginFailureBaseDelay) * time.Second
+	for i := common.LoginFailureDelayThreshold; i < failures && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
+// loginFailuresExpired 超過鎖定時長沒有新的失敗記錄時，之前的失敗不再計數
+func (user *User) loginFailuresExpired(now time.Time) bool {
+	window := time.Duration(common.LoginLockoutDuration) * time.Second
+	return user.LastFailedLoginTime == nil || now.Sub(*user.LastFailedLoginTime) > window
+}
+
+// IsLoginLocked 帳號是否處於臨時鎖定狀態
+func (user *User) IsLoginLocked() bool {
+	return user.LockedUntil != nil && time.Now().Before(*user.LockedUntil)
+}
+
+// errLoginFailed 登入失敗的統一錯誤，帳號被鎖定時同樣返回，不暴露帳號是否存在
+var errLoginFailed = errors.New("用戶名或密碼錯誤，或用戶已被封禁")
+
+// checkLoginLockout 檢查帳號是否被鎖定或仍在失敗後的等待期內，此時不校驗密碼
+func (user *User) checkLoginLockout(now time.Time) error {
+	if !common.LoginLockoutEnabled {
+		return nil
+	}
+	if user.LockedUntil != nil && now.Before(*user.LockedUntil) {
+		return errLoginFailed
+	}
+	if user.loginFailuresExpired(now) {
+		return nil
+	}
+	if now.Before(user.LastFailedLoginTime.Add(loginFailureDelay(user.FailedLoginCount))) {
+		return errLoginFailed
+	}
+	return nil
+}
+
+// reserveLoginAttempt 校驗密碼前原子地將本次嘗試計為失敗，帳號已鎖定或進行中的嘗試已達到鎖定閾值時返回錯誤，
+// 並發請求也不能超過閾值次數地校驗密碼；登入成功後由 resetLoginFailures 清除
+func (user *User) reserveLoginAttempt(now time.Time) error {
+	if !common.LoginLockoutEnabled {
+		return nil
+	}
+	windowStart := now.Add(-time.Duration(common.LoginLockoutDuration) * time.Second)
+	expired := "last_failed_login_time IS NULL OR last_failed_login_time < ?"
+	// failed_login_count 排在 last_failed_login_time 之前更新，MySQL 中 CASE 讀取的仍是原來的失敗時間
+	result := DB.Model(&User{}).
+		Where("id = ? AND (locked_until IS NULL OR locked_until <= ?)", user.Id, now).
+		Where(DB.Where(expired, windowStart).Or("failed_login_count < ?", common.LoginLockoutThreshold)).
+		Updates(map[string]interface{}{
+			"failed_login_count":     gorm.Expr("CASE WHEN "+expired+" THEN 1 ELSE failed_login_count + 1 END", windowStart),
+			"last_failed_login_time": now,
+		})
+	if result.Error != nil {
+		common.SysError("failed to reserve login attempt: " + result.Error.Error())
+		return errLoginFailed
+	}
+	if result.RowsAffected != 1 {
+		return errLoginFailed
+	}
+	DB.Model(&User{}).Where("id = ?", user.Id).Select("failed_login_count").Scan(&user.FailedLoginCount)
+	user.LastFailedLoginTime = &now
+	return nil
+}
+
+// recordLoginFailure 密碼錯誤時調用，失敗已在 reserveLoginAttempt 中計數，達到閾值時臨時鎖定帳號
+func (user *User) recordLoginFailure(now time.Time) {
+	if !common.LoginLockoutEnabled || user.FailedLoginCount < common.LoginLockoutThreshold {
+		return
+	}
+	lockedUntil := now.Add(time.Duration(common.LoginLockoutDuration) * time.Second)
+	// 鎖定後清零計數，解鎖後重新開始統計
+	DB.Model(&User{}).Where("id = ?", user.Id).Updates(map[string]interface{}{
+		"locked_until":       lockedUntil,
+		"failed_login_count": 0,
+	})
+	user.LockedUntil = &lockedUntil
+	common.SysLog(fmt.Sprintf("user %d locked until %s after repeated login failures", user.Id, lockedUntil.Format(time.RFC3339)))
+}
+
+// resetLoginFailures 登入成功後清除失敗記錄
+func (user *User) resetLoginFailures() {
+	if user.FailedLoginCount == 0 && user.LockedUntil == nil {
+		return
+	}
+	DB.Model(&User{}).Where("id = ?", user.Id).Updates(map[string]interface{}{
+		"failed_login_count":     0,
+		"last_failed_login_time": nil,
+		"locked_until":           nil,
+	})
+}
+
+// UnlockUserLogin 解除帳號的登入鎖定並清除失敗記錄（管理員）
+func UnlockUserLogin(id int) error {
+	if id == 0 {
+		return errors.New("id 為空！")
+	}
+	return DB.Model(&User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"failed_login_count":     0,
+		"last_failed_login_time": nil,
+		"locked_until":           nil,
+	}).Error
+}
@@ -0,0 +1,128 @@
+package model
+
+import (
+	"account-system/common"
+	"sync"
+	"testing"
+	"time"
+)
+
+// setupLockout 關閉失敗後的等待，只測試鎖定閾值
+func setupLockout(t *testing.T, threshold int) {
+	t.Helper()
+	enabled, delayThreshold, lockoutThreshold := common.LoginLockoutEnabled, common.LoginFailureDelayThreshold, common.LoginLockoutThreshold
+	common.LoginLockoutEnabled = true
+	common.LoginFailureDelayThreshold = 1000
+	common.LoginLockoutThreshold = threshold
+	t.Cleanup(func() {
+		common.LoginLockoutEnabled, common.LoginFailureDelayThreshold, common.LoginLockoutThreshold = enabled, delayThreshold, lockoutThreshold
+	})
+}
+
+func login(username, password string) error {
+	user := &User{Username: username, Password: password}
+	return user.ValidateAndFill()
+}
+
+func TestLoginLockout(t *testing.T) {
+	setupLockout(t, 3)
+	tests := []struct {
+		name     string
+		username string
+		failures int
+		wantOK   bool
+	}{
+		{"no failures", "lockout_none", 0, true},
+		{"below threshold", "lockout_below", 2, true},
+		{"locked", "lockout_locked", 3, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := createTestUser(t, tt.username)
+			for i := 0; i < tt.failures; i++ {
+				if err := login(user.Username, "wrong-password"); err != errLoginFailed {
+					t.Fatalf("failure %d: error = %v, want %v", i, err, errLoginFailed)
+				}
+			}
+			err := login(user.Username, "Password-"+user.Username)
+			if (err == nil) != tt.wantOK {
+				t.Fatalf("login error = %v, want ok %v", err, tt.wantOK)
+			}
+			// 鎖定時與密碼錯誤返回相同的錯誤
+			if !tt.wantOK && err != errLoginFailed {
+				t.Fatalf("locked error = %v, want %v", err, errLoginFailed)
+			}
+			var current User
+			DB.First(&current, "id = ?", user.Id)
+			if tt.wantOK && current.FailedLoginCount != 0 {
+				t.Fatalf("failed_login_count = %d after success, want 0", current.FailedLoginCount)
+			}
+			if locked := current.IsLoginLocked(); locked == tt.wantOK {
+				t.Fatalf("locked = %v, want %v", locked, !tt.wantOK)
+			}
+		})
+	}
+
+	t.Run("lock expired", func(t *testing.T) {
+		user := createTestUser(t, "lockout_expired")
+		for i := 0; i < 3; i++ {
+			_ = login(user.Username, "wrong-password")
+		}
+		DB.Model(&User{}).Where("id = ?", user.Id).Update("locked_until", time.Now().Add(-time.Second))
+		if err := login(user.Username, "Password-"+user.Username); err != nil {
+			t.Fatalf("login after lock expired: %v", err)
+		}
+	})
+
+	t.Run("unknown user", func(t *testing.T) {
+		if err := login("lockout_nobody", "wrong-password"); err != errLoginFailed {
+			t.Fatalf("error = %v, want %v", err, errLoginFailed)
+		}
+	})
+}
+
+// TestLoginLockoutConcurrentAttempts 並發嘗試也會在達到閾值後鎖定帳號，之後正確的密碼同樣被拒絕
+func TestLoginLockoutConcurrentAttempts(t *testing.T) {
+	setupLockout(t, 5)
+	user := createTestUser(t, "lockout_concurrent")
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = login(user.Username, "wrong-password")
+		}()
+	}
+	wg.Wait()
+	var current User
+	DB.First(&current, "id = ?", user.Id)
+	if !current.IsLoginLocked() {
+		t.Fatalf("account not locked after concurrent failures, failed_login_count = %d", current.FailedLoginCount)
+	}
+	if err := login(user.Username, "Password-"+user.Username); err != errLoginFailed {
+		t.Fatalf("login while locked: error = %v, want %v", err, errLoginFailed)
+	}
+}
+
+// TestReserveLoginAttempt 進行中的嘗試達到閾值後不再允許校驗密碼
+func TestReserveLoginAttempt(t *testing.T) {
+	setupLockout(t, 3)
+	user := createTestUser(t, "lockout_reserve")
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := user.reserveLoginAttempt(now); err != nil {
+			t.Fatalf("reservation %d: %v", i, err)
+		}
+	}
+	if err := user.reserveLoginAttempt(now); err != errLoginFailed {
+		t.Fatalf("reservation beyond threshold: error = %v, want %v", err, errLoginFailed)
+	}
+	// 超過鎖定時長後重新開始計數
+	later := now.Add(time.Duration(common.LoginLockoutDuration+1) * time.Second)
+	if err := user.reserveLoginAttempt(later); err != nil {
+		t.Fatalf("reservation after window: %v", err)
+	}
+	if user.FailedLoginCount != 1 {
+		t.Fatalf("failed_login_count = %d after window, want 1", user.FailedLoginCount)
+	}
+}
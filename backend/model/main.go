@@ -64,17 +64,39 @@ func InitDB() error {
 	DB = db
 
 	// 自動遷移數據表結構
-	err = db.AutoMigrate(&User{}, &Token{})
+	err = db.AutoMigrate(&User{}, &Token{}, &Passkey{}, &UserIdentity{}, &Session{},
+		&OAuth2Client{}, &OAuth2Consent{}, &OAuth2AuthorizationCode{}, &OAuth2RefreshToken{}, &OAuth2SigningKey{}, &VerificationCode{}, &PasswordHistory{}, &QuotaLedger{}, &TokenUsage{}, &JobLease{}, &RedemptionCode{}, &Redemption{}, &Group{},
+		&Organization{}, &OrganizationMember{}, &OrganizationInvitation{}, &Role{})
 	if err != nil {
 		return fmt.Errorf("failed to migrate database: %v", err)
 	}
 
+	if err = migratePlaintextCredentials(); err != nil {
+		return fmt.Errorf("failed to migrate plaintext credentials: %v", err)
+	}
+
+	if err = initQuotaLedger(); err != nil {
+		return fmt.Errorf("failed to initialize quota ledger: %v", err)
+	}
+
+	if err = initTokenUsageOrganization(); err != nil {
+		return fmt.Errorf("failed to initialize organization of token usages: %v", err)
+	}
+
+	if err = createDefaultGroupIfNeed(); err != nil {
+		return fmt.Errorf("failed to create default group: %v", err)
+	}
+
 	// 創建根用戶帳號（如果需要）
 	err = createRootAccountIfNeed()
 	if err != nil {
 		return fmt.Errorf("failed to create root account: %v", err)
 	}
 
+	if err = createBuiltinRolesIfNeed(); err != nil {
+		return fmt.Errorf("failed to create built-in roles: %v", err)
+	}
+
 	return nil
 }
 
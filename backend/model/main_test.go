@@ -0,0 +1,47 @@
+package model
+
+import (
+	"account-system/common"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestMain 在臨時目錄中使用 SQLite 數據庫運行模型測試
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "account-system-model")
+	if err != nil {
+		panic(err)
+	}
+	if err = os.Chdir(dir); err != nil {
+		panic(err)
+	}
+	// 並發測試需要等待寫鎖而不是直接返回 database is locked
+	os.Setenv("SQLITE_PATH", filepath.Join(dir, "test.db")+"?_busy_timeout=5000&_journal_mode=WAL")
+	os.Setenv("SESSION_SECRET", "test-session-secret")
+	os.Setenv("TOKEN_HASH_SECRET", "test-token-hash-secret")
+	common.LoadEnv()
+	if err = InitDB(); err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	_ = CloseDB()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// createTestUser 創建一個啟用的普通用戶
+func createTestUser(t *testing.T, username string) *User {
+	t.Helper()
+	user := &User{
+		Username:    username,
+		Password:    "Password-" + username,
+		DisplayName: username,
+		Role:        common.RoleCommonUser,
+		Status:      common.UserStatusEnabled,
+	}
+	if err := user.Insert(); err != nil {
+		t.Fatalf("create user %s: %v", username, err)
+	}
+	return user
+}
@@ -0,0 +1,186 @@
+package model
+
+import (
+	"account-system/common"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+// OAuth2Client 通過本系統登入的第三方應用
+type OAuth2Client struct {
+	Id            int       `json:"id"`
+	ClientId      string    `json:"client_id" gorm:"type:varchar(64);uniqueIndex"`
+	SecretHash    string    `json:"-" gorm:"type:char(64)"`
+	Name          string    `json:"name" gorm:"type:varchar(64)"`
+	RedirectURIs  []string  `json:"redirect_uris" gorm:"type:text;serializer:json"`
+	Scopes        string    `json:"scopes" gorm:"type:varchar(255)"` // 允許申請的範圍，以空格分隔
+	Public        bool      `json:"public"`                          // 公開客戶端沒有密鑰，必須使用 PKCE
+	Introspection bool      `json:"introspection"`                   // 是否允許調用令牌內省端點，僅限機密客戶端
+	Status        int       `json:"status" gorm:"type:int;default:1"`
+	CreatedBy     int       `json:"created_by"`
+	CreatedTime   time.Time `json:"created_time" gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP"`
+}
+
+// OAuth2Consent 用戶對應用的授權記錄，已授權的範圍不再重複詢問
+type OAuth2Consent struct {
+	Id          int       `json:"id"`
+	UserId      int       `json:"user_id" gorm:"uniqueIndex:idx_consent_user_client"`
+	ClientId    string    `json:"client_id" gorm:"type:varchar(64);uniqueIndex:idx_consent_user_client"`
+	Scope       string    `json:"scope" gorm:"type:varchar(255)"`
+	CreatedTime time.Time `json:"created_time" gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP"`
+}
+
+func hashOAuth2Secret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Insert 創建應用，返回只顯示一次的客戶端密鑰
+func (client *OAuth2Client) Insert() (string, error) {
+	client.ClientId = common.GetUUID()
+	client.CreatedTime = time.Now()
+	secret := ""
+	if !client.Public {
+		secret = common.GetRandomString(48)
+		client.SecretHash = hashOAuth2Secret(secret)
+	}
+	if err := DB.Create(client).Error; err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// Update 更新應用信息
+func (client *OAuth2Client) Update() error {
+	return DB.Model(client).Select("name", "redirect_uris", "scopes", "status", "introspection").Updates(client).Error
+}
+
+// ResetSecret 重新生成客戶端密鑰，舊密鑰立即失效
+func (client *OAuth2Client) ResetSecret() (string, error) {
+	if client.Public {
+		return "", errors.New("公開客戶端沒有密鑰")
+	}
+	secret := common.GetRandomString(48)
+	client.SecretHash = hashOAuth2Secret(secret)
+	if err := DB.Model(client).Update("secret_hash", client.SecretHash).Error; err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// Delete 刪除應用及其簽發的授權
+func (client *OAuth2Client) Delete() error {
+	if client.Id == 0 {
+		return errors.New("id 為空！")
+	}
+	if err := DB.Delete(client).Error; err != nil {
+		return err
+	}
+	DB.Where("client_id = ?", client.ClientId).Delete(&OAuth2Consent{})
+	DB.Where("client_id = ?", client.ClientId).Delete(&OAuth2AuthorizationCode{})
+	DB.Where("client_id = ?", client.ClientId).Delete(&OAuth2RefreshToken{})
+	return nil
+}
+
+// ValidateSecret 驗證客戶端密鑰
+func (client *OAuth2Client) ValidateSecret(secret string) bool {
+	if client.Public || client.SecretHash == "" || secret == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(client.SecretHash), []byte(hashOAuth2Secret(secret))) == 1
+}
+
+// HasRedirectURI 檢查回調地址是否已登記，要求完全匹配
+func (client *OAuth2Client) HasRedirectURI(redirectURI string) bool {
+	for _, uri := range client.RedirectURIs {
+		if uri == redirectURI {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsScope 檢查應用是否允許申請給定的所有範圍
+func (client *OAuth2Client) AllowsScope(scope string) bool {
+	return ScopeContains(client.Scopes, scope)
+}
+
+// ScopeContains 檢查 granted 是否包含 requested 中的所有範圍
+func ScopeContains(granted, requested string) bool {
+	allowed := make(map[string]bool)
+	for _, s := range strings.Fields(granted) {
+		allowed[s] = true
+	}
+	for _, s := range strings.Fields(requested) {
+		if !allowed[s] {
+			return false
+		}
+	}
+	return true
+}
+
+// GetOAuth2ClientById 通過 ID 獲取應用
+func GetOAuth2ClientById(id int) (*OAuth2Client, error) {
+	if id == 0 {
+		return nil, errors.New("id 為空！")
+	}
+	client := OAuth2Client{Id: id}
+	err := DB.First(&client, "id = ?", id).Error
+	return &client, err
+}
+
+// GetOAuth2ClientByClientId 通過 client_id 獲取應用
+func GetOAuth2ClientByClientId(clientId string) (*OAuth2Client, error) {
+	if clientId == "" {
+		return nil, errors.New("client_id 為空！")
+	}
+	var client OAuth2Client
+	err := DB.First(&client, "client_id = ?", clientId).Error
+	return &client, err
+}
+
+// GetAllOAuth2Clients 獲取所有應用
+func GetAllOAuth2Clients(page, pageSize int) (clients []*OAuth2Client, total int64, err error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 10
+	}
+	if err = DB.Model(&OAuth2Client{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = DB.Order("id desc").Limit(pageSize).Offset((page - 1) * pageSize).Find(&clients).Error
+	return clients, total, err
+}
+
+// GetOAuth2Consent 獲取用戶對應用的授權記錄
+func GetOAuth2Consent(userId int, clientId string) (*OAuth2Consent, error) {
+	var consent OAuth2Consent
+	err := DB.First(&consent, "user_id = ? AND client_id = ?", userId, clientId).Error
+	return &consent, err
+}
+
+// SaveOAuth2Consent 記錄用戶授權，與已有授權範圍合併
+func SaveOAuth2Consent(userId int, clientId string, scope string) error {
+	consent, err := GetOAuth2Consent(userId, clientId)
+	if err != nil {
+		return DB.Create(&OAuth2Consent{
+			UserId:      userId,
+			ClientId:    clientId,
+			Scope:       scope,
+			CreatedTime: time.Now(),
+		}).Error
+	}
+	merged := strings.Fields(consent.Scope)
+	for _, s := range strings.Fields(scope) {
+		if !ScopeContains(consent.Scope, s) {
+			merged = append(merged, s)
+		}
+	}
+	return DB.Model(consent).Update("scope", strings.Join(merged, " ")).Error
+}
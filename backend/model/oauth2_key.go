@@ -0,0 +1,229 @@
+package model
+
+import (
+	"account-system/common"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// OAuth2SigningKey 簽發 id_token 和 access token 的 RSA 密鑰
+type OAuth2SigningKey struct {
+	Id          int        `json:"id"`
+	Kid         string     `json:"kid" gorm:"type:varchar(64);uniqueIndex"`
+	PrivateKey  string     `json:"-" gorm:"type:text"` // PKCS#8 PEM
+	CreatedTime time.Time  `json:"created_time" gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP"`
+	RetiredTime *time.Time `json:"retired_time" gorm:"type:timestamp;index"` // 為空表示當前使用中的密鑰
+}
+
+// JSONWebKey JWKS 中的一個公鑰
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+const oauth2SigningKeyBits = 2048
+
+// 緩存當前簽名密鑰，定期從數據庫重新加載以感知其他實例的輪換
+const oauth2SigningKeyCacheTTL = 5 * time.Minute
+
+var (
+	oauth2SigningKeyLock     sync.Mutex
+	oauth2SigningKeyCache    *OAuth2SigningKey
+	oauth2SigningKeyParsed   *rsa.PrivateKey
+	oauth2SigningKeyLoadTime time.Time
+)
+
+func (key *OAuth2SigningKey) parse() (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(key.PrivateKey))
+	if block == nil {
+		return nil, errors.New("簽名密鑰格式錯誤")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("簽名密鑰不是 RSA 密鑰")
+	}
+	return rsaKey, nil
+}
+
+// toJSONWebKey 導出公鑰
+func (key *OAuth2SigningKey) toJSONWebKey() (*JSONWebKey, error) {
+	privateKey, err := key.parse()
+	if err != nil {
+		return nil, err
+	}
+	return &JSONWebKey{
+		Kty: "RSA",
+		Use: "sig",
+		Alg: jwt.SigningMethodRS256.Alg(),
+		Kid: key.Kid,
+		N:   base64.RawURLEncoding.EncodeToString(privateKey.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(privateKey.E)).Bytes()),
+	}, nil
+}
+
+// createOAuth2SigningKey 生成新密鑰並將舊密鑰標記為已退役
+func createOAuth2SigningKey() (*OAuth2SigningKey, error) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, oauth2SigningKeyBits)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	key := &OAuth2SigningKey{
+		Kid:         common.GetUUID(),
+		PrivateKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		CreatedTime: now,
+	}
+	if err = DB.Model(&OAuth2SigningKey{}).Where("retired_time IS NULL").Update("retired_time", now).Error; err != nil {
+		return nil, err
+	}
+	if err = DB.Create(key).Error; err != nil {
+		return nil, err
+	}
+	common.SysLog("oauth2 signing key rotated, new kid: " + key.Kid)
+	return key, nil
+}
+
+// getOAuth2SigningKey 獲取當前簽名密鑰，超過輪換間隔時自動生成新密鑰
+func getOAuth2SigningKey() (*OAuth2SigningKey, *rsa.PrivateKey, error) {
+	oauth2SigningKeyLock.Lock()
+	defer oauth2SigningKeyLock.Unlock()
+	rotationInterval := time.Duration(common.OAuth2SigningKeyRotationInterval) * time.Second
+	if oauth2SigningKeyCache != nil && time.Since(oauth2SigningKeyLoadTime) < oauth2SigningKeyCacheTTL &&
+		time.Since(oauth2SigningKeyCache.CreatedTime) < rotationInterval {
+		return oauth2SigningKeyCache, oauth2SigningKeyParsed, nil
+	}
+	var key OAuth2SigningKey
+	err := DB.Where("retired_time IS NULL").Order("id desc").First(&key).Error
+	current := &key
+	if err != nil || time.Since(key.CreatedTime) >= rotationInterval {
+		if current, err = createOAuth2SigningKey(); err != nil {
+			return nil, nil, err
+		}
+	}
+	privateKey, err := current.parse()
+	if err != nil {
+		return nil, nil, err
+	}
+	oauth2SigningKeyCache = current
+	oauth2SigningKeyParsed = privateKey
+	oauth2SigningKeyLoadTime = time.Now()
+	return current, privateKey, nil
+}
+
+// RotateOAuth2SigningKey 立即輪換簽名密鑰，舊密鑰在令牌有效期內仍會發布在 JWKS 中
+func RotateOAuth2SigningKey() (*OAuth2SigningKey, error) {
+	oauth2SigningKeyLock.Lock()
+	defer oauth2SigningKeyLock.Unlock()
+	key, err := createOAuth2SigningKey()
+	if err != nil {
+		return nil, err
+	}
+	oauth2SigningKeyCache = nil
+	return key, nil
+}
+
+// oauth2SigningKeyRetirementDeadline 退役時間早於該時間的密鑰不再用於驗證簽名；
+// 退役密鑰需保留到其簽發的最後一個令牌過期，另加一個緩存周期以覆蓋其他實例
+func oauth2SigningKeyRetirementDeadline() time.Time {
+	retention := time.Duration(common.OAuth2AccessTokenLifetime)*time.Second + oauth2SigningKeyCacheTTL
+	return time.Now().Add(-retention)
+}
+
+// getPublishedOAuth2SigningKeys 獲取仍可用於驗證簽名的密鑰
+func getPublishedOAuth2SigningKeys() ([]*OAuth2SigningKey, error) {
+	if _, _, err := getOAuth2SigningKey(); err != nil {
+		return nil, err
+	}
+	var keys []*OAuth2SigningKey
+	err := DB.Where("retired_time IS NULL OR retired_time >= ?", oauth2SigningKeyRetirementDeadline()).Order("id desc").Find(&keys).Error
+	return keys, err
+}
+
+// DeleteRetiredOAuth2SigningKeys 刪除已超過保留期的退役簽名密鑰，由後台任務定期執行
+func DeleteRetiredOAuth2SigningKeys() error {
+	return DB.Where("retired_time IS NOT NULL AND retired_time < ?", oauth2SigningKeyRetirementDeadline()).Delete(&OAuth2SigningKey{}).Error
+}
+
+// GetOAuth2JSONWebKeySet 獲取用於 JWKS 端點的公鑰列表
+func GetOAuth2JSONWebKeySet() ([]*JSONWebKey, error) {
+	keys, err := getPublishedOAuth2SigningKeys()
+	if err != nil {
+		return nil, err
+	}
+	jwks := make([]*JSONWebKey, 0, len(keys))
+	for _, key := range keys {
+		jwk, err := key.toJSONWebKey()
+		if err != nil {
+			common.SysError("invalid oauth2 signing key " + key.Kid + ": " + err.Error())
+			continue
+		}
+		jwks = append(jwks, jwk)
+	}
+	return jwks, nil
+}
+
+// SignOAuth2Token 使用當前密鑰簽發 JWT，typ 為 JWT 頭部的類型
+func SignOAuth2Token(claims jwt.MapClaims, typ string) (string, error) {
+	key, privateKey, err := getOAuth2SigningKey()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = key.Kid
+	if typ != "" {
+		token.Header["typ"] = typ
+	}
+	return token.SignedString(privateKey)
+}
+
+// ParseOAuth2Token 驗證本系統簽發的 JWT，並檢查頭部類型和簽發者
+func ParseOAuth2Token(tokenString string, typ string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Header["typ"] != typ {
+			return nil, errors.New("令牌類型錯誤")
+		}
+		kid, _ := token.Header["kid"].(string)
+		keys, err := getPublishedOAuth2SigningKeys()
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			if key.Kid == kid {
+				privateKey, err := key.parse()
+				if err != nil {
+					return nil, err
+				}
+				return &privateKey.PublicKey, nil
+			}
+		}
+		return nil, errors.New("簽名密鑰不存在")
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}), jwt.WithIssuer(common.ServerAddress))
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := claims["exp"]; !ok {
+		return nil, errors.New("令牌缺少過期時間")
+	}
+	return claims, nil
+}
@@ -0,0 +1,68 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetiredOAuth2SigningKeys(t *testing.T) {
+	expired, err := RotateOAuth2SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	retained, err := RotateOAuth2SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := RotateOAuth2SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	DB.Model(expired).Update("retired_time", oauth2SigningKeyRetirementDeadline().Add(-time.Minute))
+
+	published := func() map[string]bool {
+		keys, err := getPublishedOAuth2SigningKeys()
+		if err != nil {
+			t.Fatal(err)
+		}
+		kids := make(map[string]bool, len(keys))
+		for _, key := range keys {
+			kids[key.Kid] = true
+		}
+		return kids
+	}
+	stored := func(key *OAuth2SigningKey) bool {
+		var count int64
+		DB.Model(&OAuth2SigningKey{}).Where("id = ?", key.Id).Count(&count)
+		return count == 1
+	}
+
+	// 讀取公鑰時不刪除數據
+	kids := published()
+	tests := []struct {
+		name          string
+		key           *OAuth2SigningKey
+		wantPublished bool
+	}{
+		{"expired", expired, false},
+		{"retained", retained, true},
+		{"current", current, true},
+	}
+	for _, tt := range tests {
+		if kids[tt.key.Kid] != tt.wantPublished {
+			t.Errorf("%s key published = %v, want %v", tt.name, kids[tt.key.Kid], tt.wantPublished)
+		}
+		if !stored(tt.key) {
+			t.Errorf("%s key deleted by read path", tt.name)
+		}
+	}
+
+	if err = DeleteRetiredOAuth2SigningKeys(); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		if stored(tt.key) != tt.wantPublished {
+			t.Errorf("%s key stored = %v after pruning, want %v", tt.name, stored(tt.key), tt.wantPublished)
+		}
+	}
+}
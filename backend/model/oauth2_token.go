@@ -0,0 +1,117 @@
+package model
+
+import (
+	"account-system/common"
+	"errors"
+	"time"
+)
+
+// OAuth2AuthorizationCode 授權碼，只保存哈希，兌換後立即刪除
+type OAuth2AuthorizationCode struct {
+	Id                  int       `json:"id"`
+	CodeHash            string    `json:"-" gorm:"type:char(64);uniqueIndex"`
+	ClientId            string    `json:"client_id" gorm:"type:varchar(64);index"`
+	UserId              int       `json:"user_id" gorm:"index"`
+	RedirectURI         string    `json:"redirect_uri" gorm:"type:varchar(512)"`
+	Scope               string    `json:"scope" gorm:"type:varchar(255)"`
+	Nonce               string    `json:"-" gorm:"type:varchar(255)"`
+	CodeChallenge       string    `json:"-" gorm:"type:varchar(128)"`
+	CodeChallengeMethod string    `json:"-" gorm:"type:varchar(16)"`
+	AuthTime            time.Time `json:"auth_time" gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP"`
+	ExpiredTime         time.Time `json:"expired_time" gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP;index"`
+}
+
+// OAuth2RefreshToken 刷新令牌，只保存哈希，每次使用後輪換
+type OAuth2RefreshToken struct {
+	Id          int       `json:"id"`
+	TokenHash   string    `json:"-" gorm:"type:char(64);uniqueIndex"`
+	ClientId    string    `json:"client_id" gorm:"type:varchar(64);index"`
+	UserId      int       `json:"user_id" gorm:"index"`
+	Scope       string    `json:"scope" gorm:"type:varchar(255)"`
+	AuthTime    time.Time `json:"auth_time" gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP"`
+	CreatedTime time.Time `json:"created_time" gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP"`
+	ExpiredTime time.Time `json:"expired_time" gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP;index"`
+}
+
+// Insert 保存授權碼，返回明文授權碼
+func (code *OAuth2AuthorizationCode) Insert() (string, error) {
+	raw := common.GetRandomString(43)
+	code.CodeHash = hashOAuth2Secret(raw)
+	code.ExpiredTime = time.Now().Add(time.Duration(common.OAuth2AuthorizationCodeLifetime) * time.Second)
+	if err := DB.Create(code).Error; err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// ConsumeOAuth2AuthorizationCode 兌換授權碼，授權碼只能使用一次
+func ConsumeOAuth2AuthorizationCode(raw string) (*OAuth2AuthorizationCode, error) {
+	if raw == "" {
+		return nil, errors.New("授權碼為空")
+	}
+	var code OAuth2AuthorizationCode
+	if err := DB.First(&code, "code_hash = ?", hashOAuth2Secret(raw)).Error; err != nil {
+		return nil, errors.New("授權碼無效")
+	}
+	// 以刪除是否成功判斷授權碼是否已被並發使用
+	result := DB.Delete(&code)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errors.New("授權碼無效")
+	}
+	if time.Now().After(code.ExpiredTime) {
+		return nil, errors.New("授權碼已過期")
+	}
+	return &code, nil
+}
+
+// Insert 保存刷新令牌，返回明文令牌
+func (token *OAuth2RefreshToken) Insert() (string, error) {
+	raw := common.GetRandomString(48)
+	token.TokenHash = hashOAuth2Secret(raw)
+	token.CreatedTime = time.Now()
+	token.ExpiredTime = token.CreatedTime.Add(time.Duration(common.OAuth2RefreshTokenLifetime) * time.Second)
+	if err := DB.Create(token).Error; err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// ConsumeOAuth2RefreshToken 使用刷新令牌，舊令牌隨即作廢
+func ConsumeOAuth2RefreshToken(raw string, clientId string) (*OAuth2RefreshToken, error) {
+	if raw == "" {
+		return nil, errors.New("刷新令牌為空")
+	}
+	var token OAuth2RefreshToken
+	err := DB.First(&token, "token_hash = ? AND client_id = ?", hashOAuth2Secret(raw), clientId).Error
+	if err != nil {
+		return nil, errors.New("刷新令牌無效")
+	}
+	result := DB.Delete(&token)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errors.New("刷新令牌無效")
+	}
+	if time.Now().After(token.ExpiredTime) {
+		return nil, errors.New("刷新令牌已過期")
+	}
+	return &token, nil
+}
+
+// RevokeOAuth2RefreshToken 撤銷應用的刷新令牌，令牌不存在時不報錯
+func RevokeOAuth2RefreshToken(raw string, clientId string) error {
+	return DB.Where("token_hash = ? AND client_id = ?", hashOAuth2Secret(raw), clientId).Delete(&OAuth2RefreshToken{}).Error
+}
+
+// DeleteExpiredOAuth2Grants 刪除過期的授權碼和刷新令牌
+func DeleteExpiredOAuth2Grants() error {
+	now := time.Now()
+	if err := DB.Where("expired_time <= ?", now).Delete(&OAuth2AuthorizationCode{}).Error; err != nil {
+		return err
+	}
+	return DB.Where("expired_time <= ?", now).Delete(&OAuth2RefreshToken{}).Error
+}
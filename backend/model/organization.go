@@ -0,0 +1,381 @@
+package model
+
+import (
+	"account-system/common"
+	"errors"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+const organizationInvitationTTL = 7 * 24 * time.Hour
+
+// Organization 組織，組織令牌屬於組織而不是創建者，成員離開後令牌仍然可用；
+// 組織令牌從組織額度扣減
+type Organization struct {
+	Id          int            `json:"id"`
+	Name        string         `json:"name" gorm:"type:varchar(64)"`
+	Description string         `json:"description" gorm:"type:varchar(255)"`
+	Quota       int            `json:"quota" gorm:"type:int;default:0"` // 組織額度，變化記錄在額度流水中
+	CreatedBy   int            `json:"created_by"`
+	CreatedTime time.Time      `json:"created_time" gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+	Role        string         `json:"role,omitempty" gorm:"-"` // 當前用戶在組織中的角色
+}
+
+// OrganizationMember 組織成員
+type OrganizationMember struct {
+	Id             int       `json:"id"`
+	OrganizationId int       `json:"organization_id" gorm:"uniqueIndex:idx_organization_member"`
+	UserId         int       `json:"user_id" gorm:"uniqueIndex:idx_organization_member;index"`
+	Role           string    `json:"role" gorm:"type:varchar(16)"`
+	CreatedTime    time.Time `json:"created_time" gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP"`
+	Username       string    `json:"username" gorm:"-:migration;->"`
+}
+
+// OrganizationInvitation 組織邀請，被邀請的用戶接受後成為成員
+type OrganizationInvitation struct {
+	Id               int       `json:"id"`
+	OrganizationId   int       `json:"organization_id" gorm:"uniqueIndex:idx_organization_invitation"`
+	UserId           int       `json:"user_id" gorm:"uniqueIndex:idx_organization_invitation;index"`
+	Role             string    `json:"role" gorm:"type:varchar(16)"`
+	InvitedBy        int       `json:"invited_by"`
+	ExpiredTime      time.Time `json:"expired_time" gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP"`
+	CreatedTime      time.Time `json:"created_time" gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP"`
+	Username         string    `json:"username" gorm:"-:migration;->"`
+	OrganizationName string    `json:"organization_name" gorm:"-:migration;->"`
+}
+
+// validate 檢查組織信息
+func (org *Organization) validate() error {
+	org.Name = strings.TrimSpace(org.Name)
+	if org.Name == "" || len(org.Name) > 64 {
+		return errors.New("組織名稱不能為空且長度不得超過 64")
+	}
+	if len(org.Description) > 255 {
+		return errors.New("組織描述長度不得超過 255")
+	}
+	return nil
+}
+
+// Insert 創建組織，創建者成為組織的所有者
+func (org *Organization) Insert() error {
+	if err := org.validate(); err != nil {
+		return err
+	}
+	org.Id = 0
+	org.Quota = 0
+	org.CreatedTime = time.Now()
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(org).Error; err != nil {
+			return err
+		}
+		org.Role = common.OrganizationRoleOwner
+		return tx.Create(&OrganizationMember{
+			OrganizationId: org.Id,
+			UserId:         org.CreatedBy,
+			Role:           common.OrganizationRoleOwner,
+			CreatedTime:    org.CreatedTime,
+		}).Error
+	})
+}
+
+// Update 更新組織名稱和描述
+func (org *Organization) Update() error {
+	if err := org.validate(); err != nil {
+		return err
+	}
+	return DB.Model(org).Select("name", "description").Updates(org).Error
+}
+
+// Delete 刪除組織，同時刪除成員、邀請和組織令牌
+func (org *Organization) Delete() error {
+	if org.Id == 0 {
+		return errors.New("id 為空！")
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("organization_id = ?", org.Id).Delete(&Token{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("organization_id = ?", org.Id).Delete(&OrganizationMember{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("organization_id = ?", org.Id).Delete(&OrganizationInvitation{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(org).Error
+	})
+}
+
+// GetOrganizationById 通過 ID 獲取組織
+func GetOrganizationById(id int) (*Organization, error) {
+	if id == 0 {
+		return nil, errors.New("id 為空！")
+	}
+	var org Organization
+	err := DB.First(&org, "id = ?", id).Error
+	return &org, err
+}
+
+// GetOrganizationsByUserId 獲取用戶所在的組織及其在組織中的角色
+func GetOrganizationsByUserId(userId int) (orgs []*Organization, err error) {
+	var members []*OrganizationMember
+	if err = DB.Where("user_id = ?", userId).Find(&members).Error; err != nil {
+		return nil, err
+	}
+	if len(members) == 0 {
+		return orgs, nil
+	}
+	roles := make(map[int]string, len(members))
+	ids := make([]int, len(members))
+	for i, member := range members {
+		roles[member.OrganizationId] = member.Role
+		ids[i] = member.OrganizationId
+	}
+	if err = DB.Where("id IN ?", ids).Order("id").Find(&orgs).Error; err != nil {
+		return nil, err
+	}
+	for _, org := range orgs {
+		org.Role = roles[org.Id]
+	}
+	return orgs, nil
+}
+
+// GetOrganizationRole 獲取用戶在組織中的角色，不是成員時返回空字符串
+func GetOrganizationRole(organizationId int, userId int) string {
+	var member OrganizationMember
+	err := DB.Select("role").Where("organization_id = ? AND user_id = ?", organizationId, userId).First(&member).Error
+	if err != nil {
+		return ""
+	}
+	return member.Role
+}
+
+// GetOrganizationMembers 獲取組織的所有成員
+func GetOrganizationMembers(organizationId int) (members []*OrganizationMember, err error) {
+	err = DB.Table("organization_members").
+		Select("organization_members.*, users.username").
+		Joins("LEFT JOIN users ON users.id = organization_members.user_id").
+		Where("organization_members.organization_id = ?", organizationId).
+		Order("organization_members.id").Find(&members).Error
+	return members, err
+}
+
+// ensureAnotherOwner 確認除指定用戶外組織中還有其他所有者
+func ensureAnotherOwner(tx *gorm.DB, organizationId int, userId int) error {
+	var count int64
+	err := tx.Model(&OrganizationMember{}).
+		Where("organization_id = ? AND user_id <> ? AND role = ?", organizationId, userId, common.OrganizationRoleOwner).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return errors.New("組織至少需要保留一個所有者")
+	}
+	return nil
+}
+
+// SetOrganizationMemberRole 修改成員角色；所有者可以修改任何成員，
+// 其他角色只能修改權限低於自己的成員，且不能授予高於自己的角色
+func SetOrganizationMemberRole(organizationId int, userId int, role string, actorRole string) error {
+	if common.OrganizationRoleRank(role) == 0 {
+		return errors.New("無效的組織角色")
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var member OrganizationMember
+		if err := tx.Where("organization_id = ? AND user_id = ?", organizationId, userId).First(&member).Error; err != nil {
+			return errors.New("用戶不是組織成員")
+		}
+		actorRank := common.OrganizationRoleRank(actorRole)
+		if actorRole != common.OrganizationRoleOwner &&
+			(actorRank <= common.OrganizationRoleRank(member.Role) || actorRank < common.OrganizationRoleRank(role)) {
+			return errors.New("無權修改該成員的角色")
+		}
+		if member.Role == common.OrganizationRoleOwner && role != common.OrganizationRoleOwner {
+			if err := ensureAnotherOwner(tx, organizationId, userId); err != nil {
+				return err
+			}
+		}
+		return tx.Model(&member).Update("role", role).Error
+	})
+}
+
+// RemoveOrganizationMember 移除成員；成員可以自行退出，其他情況只能移除權限低於自己的成員，
+// 所有者可以移除任何成員；組織令牌屬於組織，不受成員離開影響
+func RemoveOrganizationMember(organizationId int, userId int, actorId int, actorRole string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var member OrganizationMember
+		if err := tx.Where("organization_id = ? AND user_id = ?", organizationId, userId).First(&member).Error; err != nil {
+			return errors.New("用戶不是組織成員")
+		}
+		if userId != actorId && actorRole != common.OrganizationRoleOwner &&
+			common.OrganizationRoleRank(actorRole) <= common.OrganizationRoleRank(member.Role) {
+			return errors.New("無權移除該成員")
+		}
+		if member.Role == common.OrganizationRoleOwner {
+			if err := ensureAnotherOwner(tx, organizationId, userId); err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&member).Error
+	})
+}
+
+// InviteOrganizationMember 邀請用戶加入組織，不能邀請高於自己角色的成員；
+// 重複邀請同一用戶時更新角色並重新計算過期時間
+func InviteOrganizationMember(organizationId int, userId int, role string, inviterId int, inviterRole string) (*OrganizationInvitation, error) {
+	rank := common.OrganizationRoleRank(role)
+	if rank == 0 {
+		return nil, errors.New("無效的組織角色")
+	}
+	if rank > common.OrganizationRoleRank(inviterRole) {
+		return nil, errors.New("不能邀請高於自己角色的成員")
+	}
+	if GetOrganizationRole(organizationId, userId) != "" {
+		return nil, errors.New("用戶已是組織成員")
+	}
+	now := time.Now()
+	invitation := &OrganizationInvitation{
+		OrganizationId: organizationId,
+		UserId:         userId,
+		Role:           role,
+		InvitedBy:      inviterId,
+		ExpiredTime:    now.Add(organizationInvitationTTL),
+		CreatedTime:    now,
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("organization_id = ? AND user_id = ?", organizationId, userId).Delete(&OrganizationInvitation{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(invitation).Error
+	})
+	return invitation, err
+}
+
+// GetOrganizationInvitations 獲取組織尚未處理的邀請
+func GetOrganizationInvitations(organizationId int) (invitations []*OrganizationInvitation, err error) {
+	err = DB.Table("organization_invitations").
+		Select("organization_invitations.*, users.username").
+		Joins("LEFT JOIN users ON users.id = organization_invitations.user_id").
+		Where("organization_invitations.organization_id = ? AND organization_invitations.expired_time > ?", organizationId, time.Now()).
+		Order("organization_invitations.id desc").Find(&invitations).Error
+	return invitations, err
+}
+
+// GetUserOrganizationInvitations 獲取用戶收到的未過期邀請
+func GetUserOrganizationInvitations(userId int) (invitations []*OrganizationInvitation, err error) {
+	err = DB.Table("organization_invitations").
+		Select("organization_invitations.*, organizations.name AS organization_name").
+		Joins("JOIN organizations ON organizations.id = organization_invitations.organization_id AND organizations.deleted_at IS NULL").
+		Where("organization_invitations.user_id = ? AND organization_invitations.expired_time > ?", userId, time.Now()).
+		Order("organization_invitations.id desc").Find(&invitations).Error
+	return invitations, err
+}
+
+// AcceptOrganizationInvitation 接受邀請並成為組織成員
+func AcceptOrganizationInvitation(id int, userId int) (member *OrganizationMember, err error) {
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		var invitation OrganizationInvitation
+		err := tx.Where("id = ? AND user_id = ? AND expired_time > ?", id, userId, time.Now()).First(&invitation).Error
+		if err != nil {
+			return errors.New("邀請不存在或已過期")
+		}
+		if err = tx.Select("id").First(&Organization{}, "id = ?", invitation.OrganizationId).Error; err != nil {
+			return errors.New("組織不存在")
+		}
+		if err = tx.Delete(&invitation).Error; err != nil {
+			return err
+		}
+		member = &OrganizationMember{
+			OrganizationId: invitation.OrganizationId,
+			UserId:         userId,
+			Role:           invitation.Role,
+			CreatedTime:    time.Now(),
+		}
+		if err = tx.Create(member).Error; err != nil {
+			return errors.New("您已是組織成員")
+		}
+		return nil
+	})
+	return member, err
+}
+
+// DeleteOrganizationInvitation 撤銷組織的邀請
+func DeleteOrganizationInvitation(id int, organizationId int) error {
+	result := DB.Where("id = ? AND organization_id = ?", id, organizationId).Delete(&OrganizationInvitation{})
+	if result.Error == nil && result.RowsAffected == 0 {
+		return errors.New("邀請不存在")
+	}
+	return result.Error
+}
+
+// DeclineOrganizationInvitation 拒絕收到的邀請
+func DeclineOrganizationInvitation(id int, userId int) error {
+	result := DB.Where("id = ? AND user_id = ?", id, userId).Delete(&OrganizationInvitation{})
+	if result.Error == nil && result.RowsAffected == 0 {
+		return errors.New("邀請不存在")
+	}
+	return result.Error
+}
+
+// changeOrganizationQuota 在事務中原子地修改組織額度並記錄流水，扣減時不允許透支；
+// viaTokenId 為通過組織令牌修改時的令牌 ID，否則為 0
+func changeOrganizationQuota(tx *gorm.DB, organizationId int, viaTokenId int, amount int, ledgerType string, reason string) (*QuotaLedger, error) {
+	query := tx.Model(&Organization{}).Where("id = ?", organizationId)
+	if amount < 0 {
+		query = query.Where("quota >= ?", -amount)
+	}
+	result := query.Update("quota", gorm.Expr("quota + ?", amount))
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	var org Organization
+	if err := tx.Select("id", "quota").First(&org, "id = ?", organizationId).Error; err != nil {
+		return nil, errors.New("組織不存在")
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInsufficientOrganizationQuota
+	}
+	entry := &QuotaLedger{
+		OrganizationId: organizationId,
+		ViaTokenId:     viaTokenId,
+		Type:           ledgerType,
+		Amount:         amount,
+		BalanceAfter:   org.Quota,
+		Reason:         reason,
+		CreatedTime:    time.Now(),
+	}
+	if err := tx.Create(entry).Error; err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// AdjustOrganizationQuota 調整組織額度
+func AdjustOrganizationQuota(organizationId int, amount int, reason string) (entry *QuotaLedger, err error) {
+	if amount == 0 {
+		return nil, errors.New("調整額度不能為 0")
+	}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		entry, err = changeOrganizationQuota(tx, organizationId, 0, amount, common.QuotaLedgerTypeAdjust, reason)
+		return err
+	})
+	return entry, err
+}
+
+// GetOrganizationQuotaLedger 分頁獲取組織額度的流水
+func GetOrganizationQuotaLedger(organizationId int, page, pageSize int) (entries []*QuotaLedger, total int64, err error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 10
+	}
+	query := DB.Model(&QuotaLedger{}).Where("organization_id = ? AND token_id = 0", organizationId)
+	if err = query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = query.Order("id desc").Limit(pageSize).Offset((page - 1) * pageSize).Find(&entries).Error
+	return entries, total, err
+}
@@ -0,0 +1,93 @@
+package model
+
+import (
+	"account-system/common"
+	"fmt"
+	"testing"
+)
+
+// TestDeleteUserOrganizations 刪除用戶時移除其組織成員身份、邀請和個人令牌，組織唯一的所有者不能被刪除
+func TestDeleteUserOrganizations(t *testing.T) {
+	tests := []struct {
+		name string
+		// 被刪除用戶在組織中的角色，另一個所有者存在時 coOwner 為 true
+		role        string
+		coOwner     bool
+		wantDeleted bool
+	}{
+		{name: "sole owner", role: common.OrganizationRoleOwner, wantDeleted: false},
+		{name: "owner with another owner", role: common.OrganizationRoleOwner, coOwner: true, wantDeleted: true},
+		{name: "member", role: common.OrganizationRoleMember, wantDeleted: true},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := createTestUser(t, fmt.Sprintf("delete_org_user_%d", i))
+			other := createTestUser(t, fmt.Sprintf("delete_org_other_%d", i))
+			// 由 Insert 的創建者成為所有者
+			creator := other
+			if tt.role == common.OrganizationRoleOwner && !tt.coOwner {
+				creator = user
+			}
+			org := &Organization{Name: fmt.Sprintf("delete user %d", i), CreatedBy: creator.Id}
+			if err := org.Insert(); err != nil {
+				t.Fatal(err)
+			}
+			if creator != user {
+				invitation, err := InviteOrganizationMember(org.Id, user.Id, tt.role, other.Id, common.OrganizationRoleOwner)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err = AcceptOrganizationInvitation(invitation.Id, user.Id); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// 另一個組織的待處理邀請
+			pending := &Organization{Name: fmt.Sprintf("delete user pending %d", i), CreatedBy: other.Id}
+			if err := pending.Insert(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := InviteOrganizationMember(pending.Id, user.Id, common.OrganizationRoleMember, other.Id, common.OrganizationRoleOwner); err != nil {
+				t.Fatal(err)
+			}
+			personal := &Token{UserId: user.Id, Name: "personal", Status: common.TokenStatusEnabled, NeverExpire: true}
+			orgToken := &Token{UserId: user.Id, OrganizationId: org.Id, Name: "organization", Status: common.TokenStatusEnabled, NeverExpire: true}
+			for _, token := range []*Token{personal, orgToken} {
+				if err := token.Insert(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := DeleteUserById(user.Id)
+			if (err == nil) != tt.wantDeleted {
+				t.Fatalf("err = %v, want deleted %v", err, tt.wantDeleted)
+			}
+			count := func(model interface{}, query string, args ...interface{}) int64 {
+				var count int64
+				DB.Model(model).Where(query, args...).Count(&count)
+				return count
+			}
+			var want int64 = 1
+			if tt.wantDeleted {
+				want = 0
+			}
+			if got := count(&User{}, "id = ?", user.Id); got != want {
+				t.Errorf("users = %d, want %d", got, want)
+			}
+			if got := count(&OrganizationMember{}, "user_id = ?", user.Id); got != want {
+				t.Errorf("memberships = %d, want %d", got, want)
+			}
+			if got := count(&OrganizationInvitation{}, "user_id = ?", user.Id); got != want {
+				t.Errorf("invitations = %d, want %d", got, want)
+			}
+			if got := count(&Token{}, "id = ?", personal.Id); got != want {
+				t.Errorf("personal tokens = %d, want %d", got, want)
+			}
+			if got := count(&Token{}, "id = ?", orgToken.Id); got != 1 {
+				t.Errorf("organization tokens = %d, want 1", got)
+			}
+			if got := GetOrganizationRole(org.Id, other.Id); tt.wantDeleted && got != common.OrganizationRoleOwner {
+				t.Errorf("remaining owner role = %q", got)
+			}
+		})
+	}
+}
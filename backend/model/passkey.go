@@ -0,0 +1,197 @@
+package model
+
+import (
+	"encoding/base64"
+	"errors"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Passkey 通行密鑰（WebAuthn 憑證）模型
+type Passkey struct {
+	Id              int        `json:"id"`
+	UserId          int        `json:"user_id" gorm:"index"`
+	Name            string     `json:"name" gorm:"type:varchar(64)"`
+	CredentialId    string     `json:"credential_id" gorm:"type:varchar(255);uniqueIndex"` // base64url 編碼
+	PublicKey       []byte     `json:"-"`
+	AttestationType string     `json:"-" gorm:"type:varchar(32)"`
+	AAGUID          []byte     `json:"-"`
+	Transports      string     `json:"transports" gorm:"type:varchar(255)"` // 以逗號分隔
+	BackupEligible  bool       `json:"backup_eligible"`
+	BackupState     bool       `json:"backup_state"`
+	SignCount       uint32     `json:"sign_count"`
+	CloneWarning    bool       `json:"clone_warning"`
+	CreatedTime     time.Time  `json:"created_time" gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP"`
+	LastUsedTime    *time.Time `json:"last_used_time" gorm:"type:timestamp"`
+}
+
+// PasskeyUser 將用戶及其通行密鑰適配為 webauthn.User 接口
+type PasskeyUser struct {
+	User     *User
+	Passkeys []*Passkey
+}
+
+// NewPasskeyUser 加載用戶的所有通行密鑰
+func NewPasskeyUser(user *User) (*PasskeyUser, error) {
+	passkeys, err := GetPasskeysByUserId(user.Id)
+	if err != nil {
+		return nil, err
+	}
+	return &PasskeyUser{User: user, Passkeys: passkeys}, nil
+}
+
+// WebAuthnID 返回用戶句柄，使用用戶 ID 的十進制字符串
+func (u *PasskeyUser) WebAuthnID() []byte {
+	return []byte(strconv.Itoa(u.User.Id))
+}
+
+func (u *PasskeyUser) WebAuthnName() string {
+	return u.User.Username
+}
+
+func (u *PasskeyUser) WebAuthnDisplayName() string {
+	if u.User.DisplayName != "" {
+		return u.User.DisplayName
+	}
+	return u.User.Username
+}
+
+func (u *PasskeyUser) WebAuthnIcon() string {
+	return ""
+}
+
+func (u *PasskeyUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.Passkeys))
+	for _, passkey := range u.Passkeys {
+		credential, err := passkey.ToCredential()
+		if err != nil {
+			continue
+		}
+		credentials = append(credentials, *credential)
+	}
+	return credentials
+}
+
+// ParseUserHandle 從用戶句柄解析出用戶 ID
+func ParseUserHandle(userHandle []byte) (int, error) {
+	id, err := strconv.Atoi(string(userHandle))
+	if err != nil || id == 0 {
+		return 0, errors.New("無效的用戶句柄")
+	}
+	return id, nil
+}
+
+// NewPasskeyFromCredential 根據註冊結果創建通行密鑰
+func NewPasskeyFromCredential(userId int, name string, credential *webauthn.Credential) *Passkey {
+	transports := make([]string, len(credential.Transport))
+	for i, t := range credential.Transport {
+		transports[i] = string(t)
+	}
+	return &Passkey{
+		UserId:          userId,
+		Name:            name,
+		CredentialId:    base64.RawURLEncoding.EncodeToString(credential.ID),
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		AAGUID:          credential.Authenticator.AAGUID,
+		Transports:      strings.Join(transports, ","),
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+		SignCount:       credential.Authenticator.SignCount,
+	}
+}
+
+// ToCredential 轉換為 webauthn.Credential
+func (passkey *Passkey) ToCredential() (*webauthn.Credential, error) {
+	id, err := base64.RawURLEncoding.DecodeString(passkey.CredentialId)
+	if err != nil {
+		return nil, err
+	}
+	var transports []protocol.AuthenticatorTransport
+	if passkey.Transports != "" {
+		for _, t := range strings.Split(passkey.Transports, ",") {
+			transports = append(transports, protocol.AuthenticatorTransport(t))
+		}
+	}
+	return &webauthn.Credential{
+		ID:              id,
+		PublicKey:       passkey.PublicKey,
+		AttestationType: passkey.AttestationType,
+		Transport:       transports,
+		Flags: webauthn.CredentialFlags{
+			BackupEligible: passkey.BackupEligible,
+			BackupState:    passkey.BackupState,
+		},
+		Authenticator: webauthn.Authenticator{
+			AAGUID:       passkey.AAGUID,
+			SignCount:    passkey.SignCount,
+			CloneWarning: passkey.CloneWarning,
+		},
+	}, nil
+}
+
+// Insert 插入新通行密鑰
+func (passkey *Passkey) Insert() error {
+	passkey.CreatedTime = time.Now()
+	return DB.Create(passkey).Error
+}
+
+// UpdateName 重命名通行密鑰
+func (passkey *Passkey) UpdateName() error {
+	if passkey.Id == 0 {
+		return errors.New("id 為空！")
+	}
+	return DB.Model(passkey).Update("name", passkey.Name).Error
+}
+
+// UpdateUsage 登入成功後更新簽名計數器和最後使用時間
+func (passkey *Passkey) UpdateUsage(credential *webauthn.Credential) error {
+	now := time.Now()
+	passkey.SignCount = credential.Authenticator.SignCount
+	passkey.CloneWarning = credential.Authenticator.CloneWarning
+	passkey.BackupState = credential.Flags.BackupState
+	passkey.LastUsedTime = &now
+	return DB.Model(passkey).Updates(map[string]interface{}{
+		"sign_count":     passkey.SignCount,
+		"clone_warning":  passkey.CloneWarning,
+		"backup_state":   passkey.BackupState,
+		"last_used_time": now,
+	}).Error
+}
+
+// Delete 刪除通行密鑰
+func (passkey *Passkey) Delete() error {
+	if passkey.Id == 0 {
+		return errors.New("id 為空！")
+	}
+	return DB.Delete(passkey).Error
+}
+
+// GetPasskeyById 通過 ID 獲取通行密鑰
+func GetPasskeyById(id int) (*Passkey, error) {
+	if id == 0 {
+		return nil, errors.New("id 為空！")
+	}
+	passkey := Passkey{Id: id}
+	err := DB.First(&passkey, "id = ?", id).Error
+	return &passkey, err
+}
+
+// GetPasskeyByCredentialId 通過憑證 ID 獲取通行密鑰
+func GetPasskeyByCredentialId(credentialId []byte) (*Passkey, error) {
+	var passkey Passkey
+	err := DB.First(&passkey, "credential_id = ?", base64.RawURLEncoding.EncodeToString(credentialId)).Error
+	return &passkey, err
+}
+
+// GetPasskeysByUserId 獲取用戶的所有通行密鑰
+func GetPasskeysByUserId(userId int) (passkeys []*Passkey, err error) {
+	if userId == 0 {
+		return nil, errors.New("用戶 ID 為空！")
+	}
+	err = DB.Where("user_id = ?", userId).Order("id desc").Find(&passkeys).Error
+	return passkeys, err
+}
@@ -0,0 +1,86 @@
+package model
+
+import (
+	"account-system/common"
+	"fmt"
+	"time"
+)
+
+// PasswordHistory 用戶設置過的密碼哈希，用於禁止重複使用最近的密碼
+type PasswordHistory struct {
+	Id           int       `json:"id"`
+	UserId       int       `json:"user_id" gorm:"index"`
+	PasswordHash string    `json:"-" gorm:"type:varchar(255);not null"`
+	CreatedTime  time.Time `json:"created_time"`
+}
+
+// recordPasswordHistory 記錄新設置的密碼哈希，只保留最近 PasswordHistoryCount 條
+func recordPasswordHistory(userId int, passwordHash string) {
+	if userId == 0 || passwordHash == "" || common.PasswordHistoryCount <= 0 {
+		return
+	}
+	entry := &PasswordHistory{UserId: userId, PasswordHash: passwordHash, CreatedTime: time.Now()}
+	if err := DB.Create(entry).Error; err != nil {
+		common.SysError("failed to record password history: " + err.Error())
+		return
+	}
+	var keepIds []int
+	DB.Model(&PasswordHistory{}).Where("user_id = ?", userId).
+		Order("id desc").Limit(common.PasswordHistoryCount).Pluck("id", &keepIds)
+	DB.Where("user_id = ? AND id NOT IN ?", userId, keepIds).Delete(&PasswordHistory{})
+}
+
+// isRecentPassword 檢查密碼是否與當前密碼或最近使用過的密碼相同
+func isRecentPassword(userId int, password string) bool {
+	if common.PasswordHistoryCount <= 0 {
+		return false
+	}
+	var current string
+	DB.Model(&User{}).Where("id = ?", userId).Select("password").Scan(&current)
+	if current != "" && common.ValidatePasswordAndHash(password, current) {
+		return true
+	}
+	var hashes []string
+	DB.Model(&PasswordHistory{}).Where("user_id = ?", userId).
+		Order("id desc").Limit(common.PasswordHistoryCount).Pluck("password_hash", &hashes)
+	for _, hash := range hashes {
+		if common.ValidatePasswordAndHash(password, hash) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateNewPassword 按密碼策略檢查用戶的新密碼，userId 為 0 表示新用戶，不檢查歷史密碼；
+// 違反策略時返回 *common.PasswordPolicyError
+func ValidateNewPassword(userId int, password string, username string, email string) error {
+	result := common.CheckPasswordPolicy(password, username, email)
+	if userId == 0 {
+		return result.OrNil()
+	}
+	if common.PasswordForbidUserInfo {
+		// 同時檢查修改前的用戶名和郵箱
+		var stored User
+		if err := DB.Select("username", "email").First(&stored, userId).Error; err == nil &&
+			(stored.Username != username || stored.Email != email) {
+			for _, v := range common.CheckPasswordPolicy(password, stored.Username, stored.Email).Violations {
+				if v.Rule == common.PasswordRuleUserInfo && !hasPasswordViolation(result, v.Rule) {
+					result.Add(v.Rule, v.Message)
+				}
+			}
+		}
+	}
+	if isRecentPassword(userId, password) {
+		result.Add(common.PasswordRuleHistory, fmt.Sprintf("不能與最近 %d 次使用過的密碼相同", common.PasswordHistoryCount))
+	}
+	return result.OrNil()
+}
+
+func hasPasswordViolation(result *common.PasswordPolicyError, rule string) bool {
+	for _, v := range result.Violations {
+		if v.Rule == rule {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,266 @@
+package model
+
+import (
+	"account-system/common"
+	"errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+var (
+	ErrInsufficientQuota     = errors.New("令牌額度不足")
+	ErrInsufficientUserQuota = errors.New("帳戶額度不足")
+
+	ErrInsufficientOrganizationQuota = errors.New("組織額度不足")
+)
+
+// QuotaLedger 額度流水，只追加不修改；同一令牌所有流水的金額之和等於令牌餘額，
+// TokenId 為 0 的流水記錄帳戶額度的變化，同一用戶這些流水的金額之和等於帳戶餘額；
+// OrganizationId 不為 0 的流水記錄組織額度的變化
+type QuotaLedger struct {
+	Id             int       `json:"id"`
+	TokenId        int       `json:"token_id" gorm:"index"`
+	UserId         int       `json:"user_id" gorm:"index"`
+	OrganizationId int       `json:"organization_id" gorm:"index;default:0"`
+	ViaTokenId     int       `json:"via_token_id" gorm:"index;default:0"` // 經由令牌修改帳戶額度或組織額度時記錄令牌 ID
+	Type           string    `json:"type" gorm:"type:varchar(16)"`
+	Amount         int       `json:"amount"` // 正數為增加，負數為扣減
+	BalanceAfter   int       `json:"balance_after"`
+	Reason         string    `json:"reason" gorm:"type:varchar(255)"`
+	CreatedTime    time.Time `json:"created_time" gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP;index"`
+}
+
+// changeTokenQuota 在事務中以 SQL 表達式原子地修改餘額並記錄流水；
+// 扣減時要求令牌處於啟用狀態，且除無限額度令牌外不允許透支，調減時餘額不能小於 0
+func changeTokenQuota(tx *gorm.DB, tokenId int, amount int, ledgerType string, reason string) (*QuotaLedger, error) {
+	query := tx.Model(&Token{}).Where("id = ?", tokenId)
+	if ledgerType == common.QuotaLedgerTypeConsume {
+		query = query.Where("status = ?", common.TokenStatusEnabled).
+			Where("unlimited_quota = ? OR remain_quota >= ?", true, -amount)
+	} else if amount < 0 {
+		query = query.Where("remain_quota >= ?", -amount)
+	}
+	result := query.Update("remain_quota", gorm.Expr("remain_quota + ?", amount))
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	var token Token
+	if err := tx.Select("id", "user_id", "status", "remain_quota", "unlimited_quota").First(&token, "id = ?", tokenId).Error; err != nil {
+		return nil, errors.New("令牌不存在")
+	}
+	if result.RowsAffected == 0 {
+		if ledgerType == common.QuotaLedgerTypeConsume && token.Status != common.TokenStatusEnabled {
+			return nil, errors.New("令牌不可用")
+		}
+		return nil, ErrInsufficientQuota
+	}
+	// 退還額度後恢復因額度用盡而停用的令牌
+	if amount > 0 && token.Status == common.TokenStatusExhausted && token.RemainQuota > 0 {
+		if err := tx.Model(&token).Update("status", common.TokenStatusEnabled).Error; err != nil {
+			return nil, err
+		}
+	}
+	entry := &QuotaLedger{
+		TokenId:      tokenId,
+		UserId:       token.UserId,
+		Type:         ledgerType,
+		Amount:       amount,
+		BalanceAfter: token.RemainQuota,
+		Reason:       reason,
+		CreatedTime:  time.Now(),
+	}
+	if err := tx.Create(entry).Error; err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// changeQuotaByToken 修改令牌可用的額度：組織令牌修改組織額度，使用帳戶額度的令牌修改所有者的帳戶額度，
+// 其他令牌修改令牌自身的額度
+func changeQuotaByToken(tx *gorm.DB, tokenId int, amount int, ledgerType string, reason string) (*QuotaLedger, error) {
+	var token Token
+	if err := tx.Select("id", "user_id", "organization_id", "status", "use_account_quota").First(&token, "id = ?", tokenId).Error; err != nil {
+		return nil, errors.New("令牌不存在")
+	}
+	if token.OrganizationId == 0 && !token.UseAccountQuota {
+		return changeTokenQuota(tx, tokenId, amount, ledgerType, reason)
+	}
+	if ledgerType == common.QuotaLedgerTypeConsume && token.Status != common.TokenStatusEnabled {
+		return nil, errors.New("令牌不可用")
+	}
+	if token.OrganizationId != 0 {
+		return changeOrganizationQuota(tx, token.OrganizationId, tokenId, amount, ledgerType, reason)
+	}
+	return changeUserQuota(tx, token.UserId, tokenId, amount, ledgerType, reason)
+}
+
+// changeUserQuota 在事務中原子地修改帳戶額度並記錄流水，扣減時不允許透支；
+// viaTokenId 為通過令牌修改時的令牌 ID，否則為 0
+func changeUserQuota(tx *gorm.DB, userId int, viaTokenId int, amount int, ledgerType string, reason string) (*QuotaLedger, error) {
+	query := tx.Model(&User{}).Where("id = ?", userId)
+	if amount < 0 {
+		query = query.Where("quota >= ?", -amount)
+	}
+	result := query.Update("quota", gorm.Expr("quota + ?", amount))
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	var user User
+	if err := tx.Select("id", "quota").First(&user, "id = ?", userId).Error; err != nil {
+		return nil, errors.New("用戶不存在")
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInsufficientUserQuota
+	}
+	entry := &QuotaLedger{
+		UserId:       userId,
+		ViaTokenId:   viaTokenId,
+		Type:         ledgerType,
+		Amount:       amount,
+		BalanceAfter: user.Quota,
+		Reason:       reason,
+		CreatedTime:  time.Now(),
+	}
+	if err := tx.Create(entry).Error; err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// GetTokenAvailableQuota 獲取令牌實際可用的額度：組織令牌為組織額度，使用帳戶額度的令牌為所有者的帳戶額度，
+// 其他令牌為令牌自身的餘額
+func GetTokenAvailableQuota(token *Token) (int, error) {
+	if token.OrganizationId != 0 {
+		var organization Organization
+		err := DB.Select("id", "quota").First(&organization, "id = ?", token.OrganizationId).Error
+		return organization.Quota, err
+	}
+	if token.UseAccountQuota {
+		var user User
+		err := DB.Select("id", "quota").First(&user, "id = ?", token.UserId).Error
+		return user.Quota, err
+	}
+	return token.RemainQuota, nil
+}
+
+// ConsumeTokenQuota 扣減令牌額度，使用帳戶額度的令牌扣減所有者的帳戶額度
+func ConsumeTokenQuota(tokenId int, amount int, reason string) (entry *QuotaLedger, err error) {
+	if amount <= 0 {
+		return nil, errors.New("扣減額度必須大於 0")
+	}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		entry, err = changeQuotaByToken(tx, tokenId, -amount, common.QuotaLedgerTypeConsume, reason)
+		return err
+	})
+	return entry, err
+}
+
+// RefundTokenQuota 退還令牌額度，規則同 ConsumeTokenQuota
+func RefundTokenQuota(tokenId int, amount int, reason string) (entry *QuotaLedger, err error) {
+	if amount <= 0 {
+		return nil, errors.New("退還額度必須大於 0")
+	}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		entry, err = changeQuotaByToken(tx, tokenId, amount, common.QuotaLedgerTypeRefund, reason)
+		return err
+	})
+	return entry, err
+}
+
+// AdjustTokenQuota 調整令牌可用的額度（管理員），amount 為負數時扣減，規則同 ConsumeTokenQuota
+func AdjustTokenQuota(tokenId int, amount int, reason string) (entry *QuotaLedger, err error) {
+	if amount == 0 {
+		return nil, errors.New("調整額度不能為 0")
+	}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		entry, err = changeQuotaByToken(tx, tokenId, amount, common.QuotaLedgerTypeAdjust, reason)
+		return err
+	})
+	return entry, err
+}
+
+// GetQuotaLedgerByTokenId 分頁獲取令牌的額度流水，使用帳戶額度或組織額度的令牌返回經由該令牌修改帳戶或組織額度的流水
+func GetQuotaLedgerByTokenId(tokenId int, page, pageSize int) (entries []*QuotaLedger, total int64, err error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 10
+	}
+	query := DB.Model(&QuotaLedger{}).Where("token_id = ? OR via_token_id = ?", tokenId, tokenId)
+	if err = query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = query.Order("id desc").Limit(pageSize).Offset((page - 1) * pageSize).Find(&entries).Error
+	return entries, total, err
+}
+
+// GetUserQuotaLedger 分頁獲取帳戶額度的流水
+func GetUserQuotaLedger(userId int, page, pageSize int) (entries []*QuotaLedger, total int64, err error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 10
+	}
+	query := DB.Model(&QuotaLedger{}).Where("user_id = ? AND token_id = 0 AND organization_id = 0", userId)
+	if err = query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = query.Order("id desc").Limit(pageSize).Offset((page - 1) * pageSize).Find(&entries).Error
+	return entries, total, err
+}
+
+// AuditTokenQuota 比較令牌當前餘額與流水彙總的餘額
+func AuditTokenQuota(tokenId int) (balance int, ledgerBalance int, err error) {
+	token, err := GetTokenById(tokenId)
+	if err != nil {
+		return 0, 0, err
+	}
+	err = DB.Model(&QuotaLedger{}).Where("token_id = ?", tokenId).
+		Select("COALESCE(SUM(amount), 0)").Scan(&ledgerBalance).Error
+	return token.RemainQuota, ledgerBalance, err
+}
+
+// RebuildTokenQuota 按流水重新計算令牌餘額，返回修正前後的餘額
+func RebuildTokenQuota(tokenId int) (before int, after int, err error) {
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		var token Token
+		if err := tx.Select("id", "remain_quota").First(&token, "id = ?", tokenId).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&QuotaLedger{}).Where("token_id = ?", tokenId).
+			Select("COALESCE(SUM(amount), 0)").Scan(&after).Error; err != nil {
+			return err
+		}
+		before = token.RemainQuota
+		return tx.Model(&token).Update("remain_quota", after).Error
+	})
+	return before, after, err
+}
+
+// initQuotaLedger 為沒有流水記錄的已有令牌補記期初餘額，使流水彙總與餘額一致
+func initQuotaLedger() error {
+	var tokens []*Token
+	err := DB.Select("id", "user_id", "remain_quota").
+		Where("remain_quota <> 0 AND id NOT IN (?)", DB.Model(&QuotaLedger{}).Select("token_id")).
+		Find(&tokens).Error
+	if err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		err = DB.Create(&QuotaLedger{
+			TokenId:      token.Id,
+			UserId:       token.UserId,
+			Type:         common.QuotaLedgerTypeAdjust,
+			Amount:       token.RemainQuota,
+			BalanceAfter: token.RemainQuota,
+			Reason:       "期初餘額",
+			CreatedTime:  time.Now(),
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+package model
+
+import (
+	"account-system/common"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// availableQuota 返回令牌實際扣減的餘額：組織額度、帳戶額度或令牌自身額度
+func availableQuota(t *testing.T, token *Token) int {
+	t.Helper()
+	switch {
+	case token.OrganizationId != 0:
+		var organization Organization
+		if err := DB.First(&organization, "id = ?", token.OrganizationId).Error; err != nil {
+			t.Fatal(err)
+		}
+		return organization.Quota
+	case token.UseAccountQuota:
+		var user User
+		if err := DB.First(&user, "id = ?", token.UserId).Error; err != nil {
+			t.Fatal(err)
+		}
+		return user.Quota
+	}
+	return token.RemainQuota
+}
+
+// ledgerBalance 按令牌的額度來源彙總流水，應等於 availableQuota 返回的餘額
+func ledgerBalance(t *testing.T, token *Token) int {
+	t.Helper()
+	query := DB.Model(&QuotaLedger{})
+	switch {
+	case token.OrganizationId != 0:
+		query = query.Where("organization_id = ?", token.OrganizationId)
+	case token.UseAccountQuota:
+		query = query.Where("user_id = ? AND token_id = 0 AND organization_id = 0", token.UserId)
+	default:
+		query = query.Where("token_id = ?", token.Id)
+	}
+	var sum int
+	if err := query.Select("COALESCE(SUM(amount), 0)").Scan(&sum).Error; err != nil {
+		t.Fatal(err)
+	}
+	return sum
+}
+
+// TestConsumeTokenQuotaConcurrent 並發扣減不會透支，成功的扣減都記入流水且流水彙總等於餘額
+func TestConsumeTokenQuotaConcurrent(t *testing.T) {
+	const (
+		amount   = 10
+		attempts = 20
+		funded   = 100 // 足夠 10 次扣減
+	)
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, user *User) *Token
+		// 無限額度的令牌所有扣減都可以成功
+		unlimited bool
+	}{
+		{name: "token quota", setup: func(t *testing.T, user *User) *Token {
+			token := newQuotaToken(t, &Token{UserId: user.Id})
+			if _, err := AdjustTokenQuota(token.Id, funded, "test"); err != nil {
+				t.Fatal(err)
+			}
+			return token
+		}},
+		{name: "account quota", setup: func(t *testing.T, user *User) *Token {
+			token := newQuotaToken(t, &Token{UserId: user.Id, UseAccountQuota: true})
+			// 清空分組贈送的額度
+			if user.Quota > 0 {
+				if _, err := AdjustTokenQuota(token.Id, -user.Quota, "test"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := AdjustTokenQuota(token.Id, funded, "test"); err != nil {
+				t.Fatal(err)
+			}
+			return token
+		}},
+		{name: "organization quota", setup: func(t *testing.T, user *User) *Token {
+			org := &Organization{Name: "quota " + user.Username, CreatedBy: user.Id}
+			if err := org.Insert(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := AdjustOrganizationQuota(org.Id, funded, "test"); err != nil {
+				t.Fatal(err)
+			}
+			return newQuotaToken(t, &Token{UserId: user.Id, OrganizationId: org.Id})
+		}},
+		{name: "unlimited quota", unlimited: true, setup: func(t *testing.T, user *User) *Token {
+			return newQuotaToken(t, &Token{UserId: user.Id, UnlimitedQuota: true})
+		}},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := createTestUser(t, fmt.Sprintf("quota_concurrent_%d", i))
+			token, err := GetTokenById(tt.setup(t, user).Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			before := availableQuota(t, token)
+			var succeeded int32
+			var wg sync.WaitGroup
+			for j := 0; j < attempts; j++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if _, err := ConsumeTokenQuota(token.Id, amount, "concurrent"); err == nil {
+						atomic.AddInt32(&succeeded, 1)
+					}
+				}()
+			}
+			wg.Wait()
+
+			stored, _ := GetTokenById(token.Id)
+			after := availableQuota(t, stored)
+			if succeeded == 0 {
+				t.Fatal("no consume succeeded")
+			}
+			if !tt.unlimited && (int(succeeded) > funded/amount || after < 0) {
+				t.Fatalf("%d consumes succeeded with balance %d, overdrawn", succeeded, after)
+			}
+			if after != before-int(succeeded)*amount {
+				t.Fatalf("balance = %d, want %d after %d consumes", after, before-int(succeeded)*amount, succeeded)
+			}
+			if sum := ledgerBalance(t, stored); sum != after {
+				t.Fatalf("ledger sum = %d, want %d", sum, after)
+			}
+		})
+	}
+}
+
+func TestChangeTokenQuotaRules(t *testing.T) {
+	user := createTestUser(t, "quota_rules")
+	token := newQuotaToken(t, &Token{UserId: user.Id})
+	disabled := newQuotaToken(t, &Token{UserId: user.Id})
+	DB.Model(disabled).Update("status", common.TokenStatusDisabled)
+	tests := []struct {
+		name        string
+		change      func() error
+		wantErr     error // 為 nil 時要求成功
+		wantAnyErr  bool
+		wantBalance int
+	}{
+		{name: "adjust", change: func() error { _, err := AdjustTokenQuota(token.Id, 50, "test"); return err }, wantBalance: 50},
+		{name: "consume", change: func() error { _, err := ConsumeTokenQuota(token.Id, 30, "test"); return err }, wantBalance: 20},
+		{name: "consume more than balance", change: func() error { _, err := ConsumeTokenQuota(token.Id, 21, "test"); return err }, wantErr: ErrInsufficientQuota, wantBalance: 20},
+		{name: "consume zero", change: func() error { _, err := ConsumeTokenQuota(token.Id, 0, "test"); return err }, wantAnyErr: true, wantBalance: 20},
+		{name: "adjust below zero", change: func() error { _, err := AdjustTokenQuota(token.Id, -21, "test"); return err }, wantErr: ErrInsufficientQuota, wantBalance: 20},
+		{name: "refund", change: func() error { _, err := RefundTokenQuota(token.Id, 5, "test"); return err }, wantBalance: 25},
+		{name: "consume whole balance", change: func() error { _, err := ConsumeTokenQuota(token.Id, 25, "test"); return err }, wantBalance: 0},
+		{name: "consume disabled token", change: func() error { _, err := ConsumeTokenQuota(disabled.Id, 1, "test"); return err }, wantAnyErr: true, wantBalance: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.change()
+			switch {
+			case tt.wantErr != nil && !errors.Is(err, tt.wantErr):
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			case tt.wantAnyErr && err == nil:
+				t.Fatal("expected an error")
+			case tt.wantErr == nil && !tt.wantAnyErr && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			}
+			stored, _ := GetTokenById(token.Id)
+			if stored.RemainQuota != tt.wantBalance {
+				t.Fatalf("balance = %d, want %d", stored.RemainQuota, tt.wantBalance)
+			}
+			if sum := ledgerBalance(t, stored); sum != tt.wantBalance {
+				t.Fatalf("ledger sum = %d, want %d", sum, tt.wantBalance)
+			}
+		})
+	}
+}
+
+// newQuotaToken 創建啟用且永不過期的令牌
+// TestGetQuotaLedgerByTokenId 令牌的流水包含經由該令牌修改帳戶額度或組織額度的記錄，不包含其他令牌的記錄
+func TestGetQuotaLedgerByTokenId(t *testing.T) {
+	tests := []struct {
+		name  string
+		token func(t *testing.T, user *User) *Token
+	}{
+		{name: "token quota", token: func(t *testing.T, user *User) *Token {
+			return newQuotaToken(t, &Token{UserId: user.Id})
+		}},
+		{name: "account quota", token: func(t *testing.T, user *User) *Token {
+			return newQuotaToken(t, &Token{UserId: user.Id, UseAccountQuota: true})
+		}},
+		{name: "organization quota", token: func(t *testing.T, user *User) *Token {
+			org := &Organization{Name: "ledger " + user.Username, CreatedBy: user.Id}
+			if err := org.Insert(); err != nil {
+				t.Fatal(err)
+			}
+			return newQuotaToken(t, &Token{UserId: user.Id, OrganizationId: org.Id})
+		}},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := createTestUser(t, fmt.Sprintf("quota_ledger_%d", i))
+			token := tt.token(t, user)
+			// 同一額度來源的另一個令牌
+			other := newQuotaToken(t, &Token{UserId: user.Id, UseAccountQuota: token.UseAccountQuota, OrganizationId: token.OrganizationId})
+			if token.OrganizationId != 0 {
+				if _, err := AdjustOrganizationQuota(token.OrganizationId, 200, "fund"); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				for _, id := range []int{token.Id, other.Id} {
+					if _, err := AdjustTokenQuota(id, 100, "fund"); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			for _, id := range []int{token.Id, other.Id} {
+				if _, err := ConsumeTokenQuota(id, 10, fmt.Sprintf("consume %d", id)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			entries, total, err := GetQuotaLedgerByTokenId(token.Id, 1, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if total == 0 || int(total) != len(entries) {
+				t.Fatalf("total = %d, entries = %d", total, len(entries))
+			}
+			for _, entry := range entries {
+				if entry.TokenId != token.Id && entry.ViaTokenId != token.Id {
+					t.Fatalf("entry %+v does not belong to token %d", entry, token.Id)
+				}
+			}
+			if entries[0].Type != common.QuotaLedgerTypeConsume || entries[0].Reason != fmt.Sprintf("consume %d", token.Id) {
+				t.Fatalf("latest entry = %+v, want consume by token %d", entries[0], token.Id)
+			}
+		})
+	}
+}
+
+func newQuotaToken(t *testing.T, token *Token) *Token {
+	t.Helper()
+	token.Name = "quota"
+	token.Status = common.TokenStatusEnabled
+	token.NeverExpire = true
+	if err := token.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
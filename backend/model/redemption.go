@@ -0,0 +1,197 @@
+package model
+
+import (
+	"account-system/common"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"time"
+)
+
+// RedemptionCode 兌換碼，數據庫中只保存哈希，明文只在生成時返回一次
+type RedemptionCode struct {
+	Id          int        `json:"id"`
+	Name        string     `json:"name" gorm:"type:varchar(64);index"` // 批次名稱
+	Code        string     `json:"code,omitempty" gorm:"-"`            // 明文，只在生成時返回
+	CodeHash    string     `json:"-" gorm:"type:char(64);uniqueIndex"`
+	CodePrefix  string     `json:"code_prefix" gorm:"type:varchar(16)"`
+	Quota       int        `json:"quota"`
+	MaxUses     int        `json:"max_uses" gorm:"default:1"`
+	UsedCount   int        `json:"used_count" gorm:"default:0"`
+	Status      int        `json:"status" gorm:"type:int;default:1"`
+	ExpiredTime *time.Time `json:"expired_time" gorm:"type:timestamp"` // 為空表示永不過期
+	CreatedBy   int        `json:"created_by"`
+	CreatedTime time.Time  `json:"created_time" gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP"`
+}
+
+// Redemption 兌換記錄，同一用戶對同一兌換碼只能兌換一次
+type Redemption struct {
+	Id          int       `json:"id"`
+	CodeId      int       `json:"code_id" gorm:"uniqueIndex:idx_redemption_code_user"`
+	UserId      int       `json:"user_id" gorm:"uniqueIndex:idx_redemption_code_user"`
+	TokenId     int       `json:"token_id"` // 為 0 表示兌換到帳戶額度
+	Quota       int       `json:"quota"`
+	LedgerId    int       `json:"ledger_id"`
+	CreatedTime time.Time `json:"created_time" gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP;index"`
+}
+
+const maxRedemptionCodeBatch = 1000
+
+// GenerateRedemptionCodes 批量生成兌換碼，返回的兌換碼帶有明文
+func GenerateRedemptionCodes(template RedemptionCode, count int) ([]*RedemptionCode, error) {
+	if count <= 0 || count > maxRedemptionCodeBatch {
+		return nil, fmt.Errorf("生成數量必須在 1 到 %d 之間", maxRedemptionCodeBatch)
+	}
+	if template.Quota <= 0 {
+		return nil, errors.New("兌換額度必須大於 0")
+	}
+	if template.MaxUses <= 0 {
+		template.MaxUses = 1
+	}
+	if template.ExpiredTime != nil && template.ExpiredTime.Before(time.Now()) {
+		return nil, errors.New("過期時間必須晚於當前時間")
+	}
+	now := time.Now()
+	codes := make([]*RedemptionCode, count)
+	for i := range codes {
+		code := template
+		code.Id = 0
+		code.Code = common.GenerateTokenKey(common.TokenKeyTypeRedeem)
+		code.CodeHash = common.HashTokenKey(code.Code)
+		code.CodePrefix = common.TokenKeyPrefix(code.Code)
+		code.UsedCount = 0
+		code.Status = common.RedemptionCodeStatusEnabled
+		code.CreatedTime = now
+		codes[i] = &code
+	}
+	if err := DB.Create(&codes).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// GetAllRedemptionCodes 分頁獲取兌換碼，可按批次名稱過濾
+func GetAllRedemptionCodes(name string, page, pageSize int) (codes []*RedemptionCode, total int64, err error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 10
+	}
+	query := DB.Model(&RedemptionCode{})
+	if name != "" {
+		query = query.Where("name = ?", name)
+	}
+	if err = query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = query.Order("id desc").Limit(pageSize).Offset((page - 1) * pageSize).Find(&codes).Error
+	return codes, total, err
+}
+
+// GetRedemptionCodeById 通過 ID 獲取兌換碼
+func GetRedemptionCodeById(id int) (*RedemptionCode, error) {
+	if id == 0 {
+		return nil, errors.New("id 為空！")
+	}
+	var code RedemptionCode
+	err := DB.First(&code, "id = ?", id).Error
+	return &code, err
+}
+
+// UpdateStatus 啟用或停用兌換碼
+func (code *RedemptionCode) UpdateStatus(status int) error {
+	if status != common.RedemptionCodeStatusEnabled && status != common.RedemptionCodeStatusDisabled {
+		return errors.New("無效的兌換碼狀態")
+	}
+	code.Status = status
+	return DB.Model(code).Update("status", status).Error
+}
+
+// Delete 刪除兌換碼，兌換記錄保留
+func (code *RedemptionCode) Delete() error {
+	if code.Id == 0 {
+		return errors.New("id 為空！")
+	}
+	return DB.Delete(code).Error
+}
+
+// GetRedemptionsByCodeId 分頁獲取兌換碼的兌換記錄
+func GetRedemptionsByCodeId(codeId int, page, pageSize int) (redemptions []*Redemption, total int64, err error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 10
+	}
+	query := DB.Model(&Redemption{}).Where("code_id = ?", codeId)
+	if err = query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = query.Order("id desc").Limit(pageSize).Offset((page - 1) * pageSize).Find(&redemptions).Error
+	return redemptions, total, err
+}
+
+// Redeem 兌換額度到用戶的令牌，tokenId 為 0 或令牌使用帳戶額度時兌換到帳戶額度，組織令牌兌換到組織額度；
+// 使用次數的增加、兌換記錄和額度流水在同一事務中完成，兌換碼不會被超額使用
+func Redeem(key string, userId int, tokenId int) (redemption *Redemption, err error) {
+	invalid := errors.New("兌換碼無效或已過期")
+	if key == "" || !common.IsTokenKeyWellFormed(key, common.TokenKeyTypeRedeem) {
+		return nil, invalid
+	}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		var code RedemptionCode
+		if err := tx.First(&code, "code_hash = ?", common.HashTokenKey(key)).Error; err != nil {
+			return invalid
+		}
+		if code.Status != common.RedemptionCodeStatusEnabled || (code.ExpiredTime != nil && code.ExpiredTime.Before(time.Now())) {
+			return invalid
+		}
+		var count int64
+		tx.Model(&Redemption{}).Where("code_id = ? AND user_id = ?", code.Id, userId).Count(&count)
+		if count > 0 {
+			return errors.New("您已經兌換過該兌換碼")
+		}
+		result := tx.Model(&RedemptionCode{}).
+			Where("id = ? AND status = ? AND used_count < max_uses", code.Id, common.RedemptionCodeStatusEnabled).
+			Update("used_count", gorm.Expr("used_count + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("兌換碼已被用完")
+		}
+		reason := "兌換碼 " + code.CodePrefix
+		var entry *QuotaLedger
+		var err error
+		if tokenId != 0 {
+			// 個人令牌只能由所有者充值，組織令牌可以由任何成員充值
+			var token Token
+			err = tx.Select("id", "user_id", "organization_id").First(&token, "id = ?", tokenId).Error
+			if err != nil || (token.OrganizationId == 0 && token.UserId != userId) ||
+				(token.OrganizationId != 0 && GetOrganizationRole(token.OrganizationId, userId) == "") {
+				return errors.New("令牌不存在")
+			}
+			entry, err = changeQuotaByToken(tx, tokenId, code.Quota, common.QuotaLedgerTypeRedeem, reason)
+		} else {
+			entry, err = changeUserQuota(tx, userId, 0, code.Quota, common.QuotaLedgerTypeRedeem, reason)
+		}
+		if err != nil {
+			return err
+		}
+		redemption = &Redemption{
+			CodeId:      code.Id,
+			UserId:      userId,
+			TokenId:     tokenId,
+			Quota:       code.Quota,
+			LedgerId:    entry.Id,
+			CreatedTime: time.Now(),
+		}
+		// 唯一索引保證並發請求中同一用戶只有一次兌換成功
+		if err = tx.Create(redemption).Error; err != nil {
+			return errors.New("您已經兌換過該兌換碼")
+		}
+		return nil
+	})
+	return redemption, err
+}
@@ -0,0 +1,132 @@
+package model
+
+import (
+	"account-system/common"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestRedeemDoubleSpend 兌換碼的使用次數不會超過上限，同一用戶只能兌換一次，並發兌換時同樣成立
+func TestRedeemDoubleSpend(t *testing.T) {
+	const quota = 100
+	tests := []struct {
+		name            string
+		maxUses         int
+		users           int
+		attemptsPerUser int
+		concurrent      bool
+		wantRedeemed    int // 並發時為成功次數的上限
+	}{
+		{name: "same user twice", maxUses: 5, users: 1, attemptsPerUser: 2, wantRedeemed: 1},
+		{name: "max uses reached", maxUses: 2, users: 3, attemptsPerUser: 1, wantRedeemed: 2},
+		{name: "same user concurrent", maxUses: 5, users: 1, attemptsPerUser: 10, concurrent: true, wantRedeemed: 1},
+		{name: "many users concurrent", maxUses: 3, users: 10, attemptsPerUser: 1, concurrent: true, wantRedeemed: 3},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			codes, err := GenerateRedemptionCodes(RedemptionCode{Name: tt.name, Quota: quota, MaxUses: tt.maxUses}, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code := codes[0]
+			users := make([]*User, tt.users)
+			for j := range users {
+				users[j] = createTestUser(t, fmt.Sprintf("redeem%d_%d", i, j))
+			}
+
+			var mutex sync.Mutex
+			redeemed := make(map[int]int)
+			attempt := func(user *User) {
+				if _, err := Redeem(code.Code, user.Id, 0); err == nil {
+					mutex.Lock()
+					redeemed[user.Id]++
+					mutex.Unlock()
+				}
+			}
+			var wg sync.WaitGroup
+			for _, user := range users {
+				for k := 0; k < tt.attemptsPerUser; k++ {
+					if !tt.concurrent {
+						attempt(user)
+						continue
+					}
+					wg.Add(1)
+					go func(user *User) {
+						defer wg.Done()
+						attempt(user)
+					}(user)
+				}
+			}
+			wg.Wait()
+
+			total := 0
+			for _, user := range users {
+				if redeemed[user.Id] > 1 {
+					t.Errorf("user %d redeemed %d times", user.Id, redeemed[user.Id])
+				}
+				var current User
+				DB.Select("id", "quota").First(&current, "id = ?", user.Id)
+				if current.Quota != quota*redeemed[user.Id] {
+					t.Errorf("user %d quota = %d, want %d", user.Id, current.Quota, quota*redeemed[user.Id])
+				}
+				total += redeemed[user.Id]
+			}
+			if tt.concurrent && (total == 0 || total > tt.wantRedeemed) {
+				t.Fatalf("redeemed %d times, want 1 to %d", total, tt.wantRedeemed)
+			}
+			if !tt.concurrent && total != tt.wantRedeemed {
+				t.Fatalf("redeemed %d times, want %d", total, tt.wantRedeemed)
+			}
+			var stored RedemptionCode
+			DB.First(&stored, "id = ?", code.Id)
+			var records int64
+			DB.Model(&Redemption{}).Where("code_id = ?", code.Id).Count(&records)
+			if stored.UsedCount != total || int(records) != total {
+				t.Fatalf("used_count = %d, redemptions = %d, want %d", stored.UsedCount, records, total)
+			}
+		})
+	}
+}
+
+func TestRedeemInvalidCode(t *testing.T) {
+	user := createTestUser(t, "redeem_invalid")
+	past := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name   string
+		key    func(t *testing.T) string
+		wantOk bool
+	}{
+		{name: "valid", key: func(t *testing.T) string { return newRedemptionCode(t, nil, common.RedemptionCodeStatusEnabled) }, wantOk: true},
+		{name: "malformed", key: func(t *testing.T) string { return "not-a-code" }},
+		{name: "wrong checksum", key: func(t *testing.T) string {
+			key := newRedemptionCode(t, nil, common.RedemptionCodeStatusEnabled)
+			last := "0"
+			if key[len(key)-1] == '0' {
+				last = "1"
+			}
+			return key[:len(key)-1] + last
+		}},
+		{name: "disabled", key: func(t *testing.T) string { return newRedemptionCode(t, nil, common.RedemptionCodeStatusDisabled) }},
+		{name: "expired", key: func(t *testing.T) string { return newRedemptionCode(t, &past, common.RedemptionCodeStatusEnabled) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Redeem(tt.key(t), user.Id, 0); (err == nil) != tt.wantOk {
+				t.Fatalf("err = %v, want ok %v", err, tt.wantOk)
+			}
+		})
+	}
+}
+
+// newRedemptionCode 生成兌換碼並直接設置狀態和過期時間，返回明文
+func newRedemptionCode(t *testing.T, expiredTime *time.Time, status int) string {
+	t.Helper()
+	codes, err := GenerateRedemptionCodes(RedemptionCode{Name: "invalid", Quota: 1}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	DB.Model(codes[0]).Updates(map[string]interface{}{"expired_time": expiredTime, "status": status})
+	return codes[0].Code
+}
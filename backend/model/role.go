@@ -0,0 +1,338 @@
+package model
+
+import (
+	"account-system/common"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"regexp"
+	"time"
+)
+
+// Role 角色，將一組權限授予用戶；Level 為角色對應的用戶等級（RoleGuestUser 等），
+// 用於「不能操作權限大於等於自己的用戶」的判斷，分配角色時同步到用戶的 role 字段；
+// 管理接口按權限授權，自定義角色的等級不會帶來等級以外的權限
+type Role struct {
+	Id          int       `json:"id"`
+	Name        string    `json:"name" gorm:"type:varchar(32);uniqueIndex"` // 創建後不可修改
+	Description string    `json:"description" gorm:"type:varchar(255)"`
+	Level       int       `json:"level"` // 創建後不可修改
+	Permissions []string  `json:"permissions" gorm:"type:text;serializer:json"`
+	BuiltIn     bool      `json:"built_in" gorm:"default:false"` // 內置角色由舊的用戶等級遷移而來，不能刪除
+	CreatedTime time.Time `json:"created_time" gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP"`
+	MemberCount int64     `json:"member_count" gorm:"-"`
+}
+
+// builtinRoles 與用戶等級一一對應的內置角色
+var builtinRoles = []Role{
+	{Name: "guest", Description: "訪客", Level: common.RoleGuestUser, Permissions: []string{}},
+	{Name: "user", Description: "普通用戶", Level: common.RoleCommonUser, Permissions: []string{}},
+	{Name: "admin", Description: "管理員", Level: common.RoleAdminUser, Permissions: []string{
+		common.PermissionUserRead,
+		common.PermissionUserCreate,
+		common.PermissionUserUpdate,
+		common.PermissionUserManage,
+		common.PermissionUserDelete,
+		common.PermissionRoleRead,
+		common.PermissionTokenManage,
+		common.PermissionQuotaManage,
+		common.PermissionRedemptionManage,
+		common.PermissionGroupManage,
+		common.PermissionOAuth2Manage,
+		common.PermissionUsageRead,
+	}},
+	{Name: "root", Description: "超級管理員", Level: common.RoleRootUser, Permissions: []string{common.PermissionAll}},
+}
+
+// adminPermissions 原先由管理員等級授予的管理權限，升級前創建的內置管理員角色沒有這些權限
+var adminPermissions = []string{
+	common.PermissionTokenManage,
+	common.PermissionQuotaManage,
+	common.PermissionRedemptionManage,
+	common.PermissionGroupManage,
+	common.PermissionOAuth2Manage,
+	common.PermissionUsageRead,
+}
+
+var roleNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,32}$`)
+
+// HasPermission 檢查權限列表是否包含指定權限
+func HasPermission(permissions []string, permission string) bool {
+	for _, p := range permissions {
+		if p == common.PermissionAll || p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// HasAllPermissions 檢查 granted 是否包含 permissions 中的所有權限，用於防止授予超出自己的權限
+func HasAllPermissions(granted []string, permissions []string) bool {
+	for _, p := range permissions {
+		if !HasPermission(granted, p) {
+			return false
+		}
+	}
+	return true
+}
+
+// validate 檢查角色配置並去除重複的權限
+func (role *Role) validate() error {
+	if !roleNamePattern.MatchString(role.Name) {
+		return errors.New("角色名稱只能包含字母、數字、下劃線和連字符，且長度不得超過 32")
+	}
+	if len(role.Description) > 255 {
+		return errors.New("角色描述長度不得超過 255")
+	}
+	seen := make(map[string]bool, len(role.Permissions))
+	permissions := make([]string, 0, len(role.Permissions))
+	for _, p := range role.Permissions {
+		if !common.IsValidPermission(p) {
+			return fmt.Errorf("無效的權限：%s", p)
+		}
+		if !seen[p] {
+			seen[p] = true
+			permissions = append(permissions, p)
+		}
+	}
+	role.Permissions = permissions
+	return nil
+}
+
+// Insert 創建自定義角色；角色等級必須低於操作者的等級，且只能授予操作者擁有的權限
+func (role *Role) Insert(myLevel int, myPermissions []string) error {
+	if err := role.validate(); err != nil {
+		return err
+	}
+	if !common.IsValidateRole(role.Level) {
+		return errors.New("無效的角色等級")
+	}
+	if role.Level >= myLevel {
+		return errors.New("無法創建等級大於等於自己的角色")
+	}
+	if !HasAllPermissions(myPermissions, role.Permissions) {
+		return errors.New("無法授予自己沒有的權限")
+	}
+	var count int64
+	DB.Model(&Role{}).Where("name = ?", role.Name).Count(&count)
+	if count > 0 {
+		return errors.New("角色名稱已存在")
+	}
+	role.Id = 0
+	role.BuiltIn = false
+	role.CreatedTime = time.Now()
+	return DB.Create(role).Error
+}
+
+// Update 更新角色的描述和權限，名稱和等級不可修改；只能修改等級低於自己的角色
+func (role *Role) Update(myLevel int, myPermissions []string) error {
+	current, err := GetRoleById(role.Id)
+	if err != nil {
+		return errors.New("角色不存在")
+	}
+	if current.Level >= myLevel {
+		return errors.New("無法修改等級大於等於自己的角色")
+	}
+	role.Name = current.Name
+	role.Level = current.Level
+	role.BuiltIn = current.BuiltIn
+	if err = role.validate(); err != nil {
+		return err
+	}
+	if !HasAllPermissions(myPermissions, role.Permissions) {
+		return errors.New("無法授予自己沒有的權限")
+	}
+	return DB.Model(role).Select("description", "permissions").Updates(role).Error
+}
+
+// Delete 刪除自定義角色，內置角色和仍有用戶的角色不能刪除
+func (role *Role) Delete() error {
+	if role.Id == 0 {
+		return errors.New("id 為空！")
+	}
+	if role.BuiltIn {
+		return errors.New("內置角色不能刪除")
+	}
+	var count int64
+	if err := DB.Model(&User{}).Where("role_id = ?", role.Id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("還有 %d 個用戶使用此角色，請先為其分配其他角色", count)
+	}
+	return DB.Delete(role).Error
+}
+
+// GetAllRoles 獲取所有角色及其用戶數
+func GetAllRoles() (roles []*Role, err error) {
+	if err = DB.Order("level, id").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	var counts []struct {
+		RoleId int
+		Count  int64
+	}
+	err = DB.Model(&User{}).Select("role_id, COUNT(*) AS count").Group("role_id").Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+	byId := make(map[int]int64, len(counts))
+	for _, c := range counts {
+		byId[c.RoleId] = c.Count
+	}
+	for _, role := range roles {
+		role.MemberCount = byId[role.Id]
+	}
+	return roles, nil
+}
+
+// GetRoleById 通過 ID 獲取角色
+func GetRoleById(id int) (*Role, error) {
+	if id == 0 {
+		return nil, errors.New("id 為空！")
+	}
+	var role Role
+	err := DB.First(&role, "id = ?", id).Error
+	return &role, err
+}
+
+// builtinRoleId 獲取用戶等級對應的內置角色 ID
+func builtinRoleId(tx *gorm.DB, level int) (int, error) {
+	var role Role
+	if err := tx.Select("id").First(&role, "built_in = ? AND level = ?", true, level).Error; err != nil {
+		return 0, errors.New("內置角色不存在")
+	}
+	return role.Id, nil
+}
+
+// joinBuiltinRole 為新用戶分配其等級對應的內置角色，需要在創建用戶的事務中調用
+func (user *User) joinBuiltinRole(tx *gorm.DB) error {
+	// 以數據庫中的等級為準，等級為零值時創建用戶會使用字段的默認值
+	var current User
+	if err := tx.Select("role").First(&current, "id = ?", user.Id).Error; err != nil {
+		return err
+	}
+	roleId, err := builtinRoleId(tx, current.Role)
+	if err != nil {
+		return err
+	}
+	user.Role = current.Role
+	user.RoleId = roleId
+	return tx.Model(&User{}).Where("id = ?", user.Id).Update("role_id", roleId).Error
+}
+
+// UserHasPermission 檢查用戶的角色是否授予指定權限
+func UserHasPermission(userId int, permission string) bool {
+	permissions, err := GetUserPermissions(userId)
+	return err == nil && HasPermission(permissions, permission)
+}
+
+// GetUserPermissions 獲取用戶角色授予的權限，未分配角色的用戶使用其等級對應的內置角色
+func GetUserPermissions(userId int) ([]string, error) {
+	var user User
+	if err := DB.Select("role", "role_id").First(&user, "id = ?", userId).Error; err != nil {
+		return nil, err
+	}
+	var role Role
+	query := DB.Select("permissions")
+	if user.RoleId != 0 {
+		query = query.Where("id = ?", user.RoleId)
+	} else {
+		query = query.Where("built_in = ? AND level = ?", true, user.Role)
+	}
+	if err := query.Find(&role).Error; err != nil {
+		return nil, err
+	}
+	return role.Permissions, nil
+}
+
+// AssignUserRole 為用戶分配角色並同步用戶等級；降級超級管理員時要求系統中還有其他啟用的超級管理員
+func AssignUserRole(id int, roleId int) error {
+	role, err := GetRoleById(roleId)
+	if err != nil {
+		return errors.New("角色不存在")
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var user User
+		if err := tx.Select("id", "role").First(&user, "id = ?", id).Error; err != nil {
+			return errors.New("用戶不存在")
+		}
+		if user.Role >= common.RoleRootUser && role.Level < common.RoleRootUser {
+			var count int64
+			err := tx.Model(&User{}).
+				Where("id <> ? AND role >= ? AND status = ?", id, common.RoleRootUser, common.UserStatusEnabled).
+				Count(&count).Error
+			if err != nil {
+				return err
+			}
+			if count == 0 {
+				return errors.New("不能降級最後一個超級管理員")
+			}
+		}
+		return tx.Model(&user).Updates(map[string]interface{}{
+			"role":    role.Level,
+			"role_id": role.Id,
+		}).Error
+	})
+}
+
+// createBuiltinRolesIfNeed 創建內置角色，並為尚未分配角色的用戶分配其等級對應的內置角色
+func createBuiltinRolesIfNeed() error {
+	for _, builtin := range builtinRoles {
+		var count int64
+		if err := DB.Model(&Role{}).Where("built_in = ? AND level = ?", true, builtin.Level).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		role := builtin
+		role.BuiltIn = true
+		role.CreatedTime = time.Now()
+		if err := DB.Create(&role).Error; err != nil {
+			return err
+		}
+	}
+	if err := migrateAdminPermissions(); err != nil {
+		return err
+	}
+	return migrateUserRoles()
+}
+
+// migrateAdminPermissions 為升級前創建的內置管理員角色授予原先由等級授予的管理權限；
+// 角色已有其中任一權限時說明已經遷移過，不覆蓋超級管理員之後的修改
+func migrateAdminPermissions() error {
+	var role Role
+	if err := DB.First(&role, "built_in = ? AND level = ?", true, common.RoleAdminUser).Error; err != nil {
+		return err
+	}
+	for _, permission := range adminPermissions {
+		if HasPermission(role.Permissions, permission) {
+			return nil
+		}
+	}
+	role.Permissions = append(role.Permissions, adminPermissions...)
+	if err := DB.Model(&role).Select("permissions").Updates(&role).Error; err != nil {
+		return err
+	}
+	common.SysLog("granted management permissions to built-in role " + role.Name)
+	return nil
+}
+
+// migrateUserRoles 將升級前按等級授權的用戶遷移到對應的內置角色
+func migrateUserRoles() error {
+	for _, builtin := range builtinRoles {
+		roleId, err := builtinRoleId(DB, builtin.Level)
+		if err != nil {
+			return err
+		}
+		result := DB.Model(&User{}).Where("role_id = 0 AND role = ?", builtin.Level).Update("role_id", roleId)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			common.SysLog(fmt.Sprintf("assigned built-in role %s to %d users", builtin.Name, result.RowsAffected))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+package model
+
+import (
+	"account-system/common"
+	"fmt"
+	"testing"
+)
+
+func TestHasPermission(t *testing.T) {
+	tests := []struct {
+		name       string
+		granted    []string
+		permission string
+		want       bool
+	}{
+		{name: "no permissions", granted: nil, permission: common.PermissionUserRead, want: false},
+		{name: "granted", granted: []string{common.PermissionUserRead}, permission: common.PermissionUserRead, want: true},
+		{name: "other permission", granted: []string{common.PermissionUserRead}, permission: common.PermissionUserDelete, want: false},
+		{name: "all permissions", granted: []string{common.PermissionAll}, permission: common.PermissionRoleManage, want: true},
+		{name: "prefix is not a wildcard", granted: []string{"user"}, permission: common.PermissionUserRead, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HasPermission(tt.granted, tt.permission); got != tt.want {
+				t.Fatalf("HasPermission(%v, %q) = %v, want %v", tt.granted, tt.permission, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRoleEscalation 不能創建或修改等級大於等於自己的角色，也不能授予自己沒有的權限
+func TestRoleEscalation(t *testing.T) {
+	admin := []string{common.PermissionUserRead, common.PermissionRoleManage}
+	root := []string{common.PermissionAll}
+	existing := &Role{Name: "escalation-target", Level: common.RoleCommonUser, Permissions: []string{common.PermissionUserRead}}
+	if err := existing.Insert(common.RoleRootUser, root); err != nil {
+		t.Fatal(err)
+	}
+	adminRole := &Role{Name: "escalation-admin", Level: common.RoleAdminUser, Permissions: []string{common.PermissionUserRead}}
+	if err := adminRole.Insert(common.RoleRootUser, root); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		action  func() error
+		wantErr bool
+	}{
+		{"create lower role with own permissions", func() error {
+			return (&Role{Name: "escalation-a", Level: common.RoleCommonUser, Permissions: []string{common.PermissionUserRead}}).Insert(common.RoleAdminUser, admin)
+		}, false},
+		{"create role at own level", func() error {
+			return (&Role{Name: "escalation-b", Level: common.RoleAdminUser}).Insert(common.RoleAdminUser, admin)
+		}, true},
+		{"create role above own level", func() error {
+			return (&Role{Name: "escalation-c", Level: common.RoleRootUser}).Insert(common.RoleAdminUser, admin)
+		}, true},
+		{"grant permission not held", func() error {
+			return (&Role{Name: "escalation-d", Level: common.RoleCommonUser, Permissions: []string{common.PermissionUserDelete}}).Insert(common.RoleAdminUser, admin)
+		}, true},
+		{"grant all permissions", func() error {
+			return (&Role{Name: "escalation-e", Level: common.RoleCommonUser, Permissions: []string{common.PermissionAll}}).Insert(common.RoleAdminUser, admin)
+		}, true},
+		{"unknown permission", func() error {
+			return (&Role{Name: "escalation-f", Level: common.RoleCommonUser, Permissions: []string{"user.everything"}}).Insert(common.RoleRootUser, root)
+		}, true},
+		{"duplicate name", func() error {
+			return (&Role{Name: existing.Name, Level: common.RoleCommonUser}).Insert(common.RoleRootUser, root)
+		}, true},
+		{"update lower role", func() error {
+			return (&Role{Id: existing.Id, Permissions: []string{common.PermissionUserRead, common.PermissionRoleManage}}).Update(common.RoleAdminUser, admin)
+		}, false},
+		{"update lower role with permission not held", func() error {
+			return (&Role{Id: existing.Id, Permissions: []string{common.PermissionUserDelete}}).Update(common.RoleAdminUser, admin)
+		}, true},
+		{"update role at own level", func() error {
+			return (&Role{Id: adminRole.Id, Permissions: []string{common.PermissionUserRead}}).Update(common.RoleAdminUser, admin)
+		}, true},
+		{"update cannot change level", func() error {
+			role := &Role{Id: existing.Id, Level: common.RoleRootUser, Permissions: []string{common.PermissionUserRead}}
+			if err := role.Update(common.RoleRootUser, root); err != nil {
+				return err
+			}
+			if stored, _ := GetRoleById(existing.Id); stored.Level != common.RoleCommonUser {
+				t.Errorf("level changed to %d", stored.Level)
+			}
+			return nil
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.action(); (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUserPermissions(t *testing.T) {
+	custom := &Role{Name: "permissions-reader", Level: common.RoleCommonUser, Permissions: []string{common.PermissionUserRead}}
+	if err := custom.Insert(common.RoleRootUser, []string{common.PermissionAll}); err != nil {
+		t.Fatal(err)
+	}
+	// 等級為管理員的自定義角色只有所授予的權限
+	customAdmin := &Role{Name: "permissions-admin-reader", Level: common.RoleAdminUser, Permissions: []string{common.PermissionUserRead}}
+	if err := customAdmin.Insert(common.RoleRootUser, []string{common.PermissionAll}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		assign     func(user *User) error
+		wantLevel  int
+		permission string
+		want       bool
+	}{
+		{"common user", func(*User) error { return nil }, common.RoleCommonUser, common.PermissionUserRead, false},
+		{"custom role", func(user *User) error { return AssignUserRole(user.Id, custom.Id) }, common.RoleCommonUser, common.PermissionUserRead, true},
+		{"custom role other permission", func(user *User) error { return AssignUserRole(user.Id, custom.Id) }, common.RoleCommonUser, common.PermissionUserDelete, false},
+		{"admin", func(user *User) error { return SetUserRole(user.Id, common.RoleAdminUser) }, common.RoleAdminUser, common.PermissionUserDelete, true},
+		{"admin cannot manage roles", func(user *User) error { return SetUserRole(user.Id, common.RoleAdminUser) }, common.RoleAdminUser, common.PermissionRoleManage, false},
+		{"admin manages quota", func(user *User) error { return SetUserRole(user.Id, common.RoleAdminUser) }, common.RoleAdminUser, common.PermissionQuotaManage, true},
+		{"custom admin level role", func(user *User) error { return AssignUserRole(user.Id, customAdmin.Id) }, common.RoleAdminUser, common.PermissionUserRead, true},
+		{"custom admin level role cannot manage quota", func(user *User) error { return AssignUserRole(user.Id, customAdmin.Id) }, common.RoleAdminUser, common.PermissionQuotaManage, false},
+		{"custom admin level role cannot manage redemption codes", func(user *User) error { return AssignUserRole(user.Id, customAdmin.Id) }, common.RoleAdminUser, common.PermissionRedemptionManage, false},
+		{"root", func(user *User) error { return SetUserRole(user.Id, common.RoleRootUser) }, common.RoleRootUser, common.PermissionRoleManage, true},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := createTestUser(t, fmt.Sprintf("permissions_%d", i))
+			if err := tt.assign(user); err != nil {
+				t.Fatal(err)
+			}
+			role, _, err := GetUserRoleAndStatus(user.Id)
+			if err != nil || role != tt.wantLevel {
+				t.Fatalf("level = %d (err %v), want %d", role, err, tt.wantLevel)
+			}
+			granted, err := GetUserPermissions(user.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := HasPermission(granted, tt.permission); got != tt.want {
+				t.Fatalf("permission %s = %v, want %v (granted %v)", tt.permission, got, tt.want, granted)
+			}
+		})
+	}
+}
+
+// TestMigrateAdminPermissions 升級前的內置管理員角色獲得原先由等級授予的管理權限，已遷移或修改過的角色保持不變
+func TestMigrateAdminPermissions(t *testing.T) {
+	var admin Role
+	if err := DB.First(&admin, "built_in = ? AND level = ?", true, common.RoleAdminUser).Error; err != nil {
+		t.Fatal(err)
+	}
+	original := admin.Permissions
+	t.Cleanup(func() {
+		admin.Permissions = original
+		DB.Model(&admin).Select("permissions").Updates(&admin)
+	})
+	userPermissions := []string{common.PermissionUserRead, common.PermissionUserManage, common.PermissionRoleRead}
+	tests := []struct {
+		name        string
+		permissions []string
+		want        []string
+	}{
+		{"before upgrade", userPermissions, append(append([]string{}, userPermissions...), adminPermissions...)},
+		{"already migrated", original, original},
+		{"quota management revoked", append(append([]string{}, userPermissions...), common.PermissionUsageRead),
+			append(append([]string{}, userPermissions...), common.PermissionUsageRead)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			admin.Permissions = tt.permissions
+			if err := DB.Model(&admin).Select("permissions").Updates(&admin).Error; err != nil {
+				t.Fatal(err)
+			}
+			if err := createBuiltinRolesIfNeed(); err != nil {
+				t.Fatal(err)
+			}
+			migrated, err := GetRoleById(admin.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(migrated.Permissions) != fmt.Sprint(tt.want) {
+				t.Fatalf("permissions = %v, want %v", migrated.Permissions, tt.want)
+			}
+		})
+	}
+}
+
+func TestAssignUserRoleKeepsLastRoot(t *testing.T) {
+	// 測試數據庫中已有初始化時創建的超級管理員，先將其降級，使新用戶成為唯一的超級管理員
+	var roots []User
+	DB.Where("role >= ?", common.RoleRootUser).Find(&roots)
+	user := createTestUser(t, "last_root")
+	if err := SetUserRole(user.Id, common.RoleRootUser); err != nil {
+		t.Fatal(err)
+	}
+	for _, root := range roots {
+		if err := SetUserRole(root.Id, common.RoleAdminUser); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() {
+		for _, root := range roots {
+			SetUserRole(root.Id, common.RoleRootUser)
+		}
+	})
+	tests := []struct {
+		name    string
+		role    int
+		wantErr bool
+	}{
+		{"demote last root", common.RoleAdminUser, true},
+		{"keep root", common.RoleRootUser, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := SetUserRole(user.Id, tt.role); (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package model
+
+import (
+	"account-system/common"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"github.com/gin-contrib/sessions"
+	"github.com/gorilla/securecookie"
+	gsessions "github.com/gorilla/sessions"
+	"net/http"
+	"time"
+)
+
+// Session 服務端會話，cookie 中只保存簽名後的會話 ID
+type Session struct {
+	Id           int       `json:"id"`
+	KeyHash      string    `json:"-" gorm:"type:char(64);uniqueIndex"` // 會話 ID 的 SHA-256 哈希
+	UserId       int       `json:"user_id" gorm:"index"`
+	Data         string    `json:"-" gorm:"type:text"`
+	Device       string    `json:"device" gorm:"type:varchar(128)"`
+	Ip           string    `json:"ip" gorm:"type:varchar(64)"`
+	UserAgent    string    `json:"user_agent" gorm:"type:varchar(512)"`
+	CreatedTime  time.Time `json:"created_time" gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP"`
+	LastSeenTime time.Time `json:"last_seen_time" gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP"`
+	ExpiredTime  time.Time `json:"expired_time" gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP;index"`
+}
+
+// 最後活躍時間的更新間隔，避免每個請求都寫數據庫
+const sessionTouchInterval = time.Minute
+
+// 未登入會話的有效期，這類會話只用於通行密鑰、第三方登入和兩步驗證等儀式，不使用 cookie 的完整有效期，
+// 避免未認證的請求在會話表中長期佔用記錄；與第三方登入流程的時限相同，兩步驗證的等待時間更長時以其為準
+const anonymousSessionMaxAge = 10 * 60
+
+// SessionStore 基於數據庫的會話存儲，實現 sessions.Store 接口
+type SessionStore struct {
+	Codecs  []securecookie.Codec
+	options *gsessions.Options
+}
+
+// NewSessionStore 創建數據庫會話存儲，過期會話由後台任務 delete_expired_sessions 清理
+func NewSessionStore(keyPairs ...[]byte) *SessionStore {
+	store := &SessionStore{
+		Codecs: securecookie.CodecsFromPairs(keyPairs...),
+		options: &gsessions.Options{
+			Path:   "/",
+			MaxAge: 86400 * 30,
+		},
+	}
+	return store
+}
+
+// Options 設置 cookie 選項
+func (s *SessionStore) Options(options sessions.Options) {
+	s.options = options.ToGorillaOptions()
+	for _, codec := range s.Codecs {
+		if sc, ok := codec.(*securecookie.SecureCookie); ok {
+			sc.MaxAge(s.options.MaxAge)
+		}
+	}
+}
+
+// Get 從請求級註冊表中獲取會話
+func (s *SessionStore) Get(r *http.Request, name string) (*gsessions.Session, error) {
+	return gsessions.GetRegistry(r).Get(s, name)
+}
+
+// New 根據 cookie 中的會話 ID 從數據庫加載會話，會話不存在或已撤銷時返回空會話
+func (s *SessionStore) New(r *http.Request, name string) (*gsessions.Session, error) {
+	session := gsessions.NewSession(s, name)
+	opts := *s.options
+	session.Options = &opts
+	session.IsNew = true
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+	var id string
+	if err = securecookie.DecodeMulti(name, cookie.Value, &id, s.Codecs...); err != nil {
+		return session, nil
+	}
+	var record Session
+	err = DB.Where("key_hash = ? AND expired_time > ?", hashSessionId(id), time.Now()).First(&record).Error
+	if err != nil {
+		return session, nil
+	}
+	if err = securecookie.DecodeMulti(name, record.Data, &session.Values, s.Codecs...); err != nil {
+		return session, nil
+	}
+	session.ID = id
+	session.IsNew = false
+	if time.Since(record.LastSeenTime) > sessionTouchInterval {
+		DB.Model(&record).Updates(map[string]interface{}{
+			"last_seen_time": time.Now(),
+			"ip":             common.GetRequestIP(r),
+		})
+	}
+	return session, nil
+}
+
+// Save 將會話寫入數據庫，空會話會被刪除；已被撤銷的會話不會被重新寫入
+func (s *SessionStore) Save(r *http.Request, w http.ResponseWriter, session *gsessions.Session) error {
+	if session.Options.MaxAge <= 0 || len(session.Values) == 0 {
+		if session.ID != "" {
+			DB.Where("key_hash = ?", hashSessionId(session.ID)).Delete(&Session{})
+		}
+		opts := *session.Options
+		opts.MaxAge = -1
+		http.SetCookie(w, gsessions.NewCookie(session.Name(), "", &opts))
+		return nil
+	}
+	userId, _ := session.Values["id"].(int)
+	var record Session
+	if session.ID != "" {
+		err := DB.Where("key_hash = ?", hashSessionId(session.ID)).First(&record).Error
+		if err != nil {
+			// 會話在請求處理期間已被撤銷
+			return nil
+		}
+		if record.UserId != userId {
+			// 登入用戶發生變化時更換會話 ID，防止會話固定攻擊
+			DB.Delete(&record)
+			record = Session{}
+			session.ID = ""
+		}
+	}
+	data, err := securecookie.EncodeMulti(session.Name(), session.Values, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	options := session.Options
+	if userId == 0 {
+		maxAge := anonymousSessionMaxAge
+		if int(common.TwoFactorPendingTimeout) > maxAge {
+			maxAge = int(common.TwoFactorPendingTimeout)
+		}
+		if options.MaxAge > maxAge {
+			opts := *options
+			opts.MaxAge = maxAge
+			options = &opts
+		}
+	}
+	now := time.Now()
+	expiredTime := now.Add(time.Duration(options.MaxAge) * time.Second)
+	if session.ID == "" {
+		session.ID = base64.RawURLEncoding.EncodeToString(securecookie.GenerateRandomKey(32))
+		userAgent := r.UserAgent()
+		if len(userAgent) > 512 {
+			userAgent = userAgent[:512]
+		}
+		record = Session{
+			KeyHash:      hashSessionId(session.ID),
+			UserId:       userId,
+			Data:         data,
+			Device:       common.ParseDevice(userAgent),
+			Ip:           common.GetRequestIP(r),
+			UserAgent:    userAgent,
+			CreatedTime:  now,
+			LastSeenTime: now,
+			ExpiredTime:  expiredTime,
+		}
+		err = DB.Create(&record).Error
+	} else {
+		err = DB.Model(&record).Updates(map[string]interface{}{
+			"data":           data,
+			"last_seen_time": now,
+			"expired_time":   expiredTime,
+		}).Error
+	}
+	if err != nil {
+		return err
+	}
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, gsessions.NewCookie(session.Name(), encoded, options))
+	return nil
+}
+
+func hashSessionId(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsCurrentSession 判斷會話記錄是否對應給定的會話 ID
+func (session *Session) IsCurrentSession(sessionId string) bool {
+	return sessionId != "" && session.KeyHash == hashSessionId(sessionId)
+}
+
+// GetSessionsByUserId 獲取用戶所有未過期的會話
+func GetSessionsByUserId(userId int) (records []*Session, err error) {
+	if userId == 0 {
+		return nil, errors.New("用戶 ID 為空！")
+	}
+	err = DB.Where("user_id = ? AND expired_time > ?", userId, time.Now()).Order("last_seen_time desc").Find(&records).Error
+	return records, err
+}
+
+// RevokeSessionById 撤銷用戶的指定會話
+func RevokeSessionById(userId int, id int) error {
+	if userId == 0 || id == 0 {
+		return errors.New("id 為空！")
+	}
+	result := DB.Where("id = ? AND user_id = ?", id, userId).Delete(&Session{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("會話不存在")
+	}
+	return nil
+}
+
+// RevokeUserSessions 撤銷用戶的所有會話，keepSessionId 不為空時保留該會話
+func RevokeUserSessions(userId int, keepSessionId string) error {
+	if userId == 0 {
+		return errors.New("用戶 ID 為空！")
+	}
+	query := DB.Where("user_id = ?", userId)
+	if keepSessionId != "" {
+		query = query.Where("key_hash <> ?", hashSessionId(keepSessionId))
+	}
+	return query.Delete(&Session{}).Error
+}
+
+// DeleteExpiredSessions 刪除所有過期會話
+func DeleteExpiredSessions() error {
+	return DB.Where("expired_time <= ?", time.Now()).Delete(&Session{}).Error
+}
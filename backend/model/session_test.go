@@ -0,0 +1,50 @@
+package model
+
+import (
+	gsessions "github.com/gorilla/sessions"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestSessionStoreMaxAge 未登入會話只保存較短的時間，登入後使用完整有效期
+func TestSessionStoreMaxAge(t *testing.T) {
+	const maxAge = 86400 * 30
+	store := NewSessionStore([]byte("test-session-secret"))
+	user := createTestUser(t, "session_max_age")
+	tests := []struct {
+		name       string
+		values     map[interface{}]interface{}
+		wantMaxAge int
+	}{
+		{name: "anonymous ceremony", values: map[interface{}]interface{}{"passkey_login": "data"}, wantMaxAge: anonymousSessionMaxAge},
+		{name: "logged in", values: map[interface{}]interface{}{"id": user.Id, "username": user.Username}, wantMaxAge: maxAge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := gsessions.NewSession(store, "session")
+			session.Options = &gsessions.Options{Path: "/", MaxAge: maxAge}
+			session.Values = tt.values
+			recorder := httptest.NewRecorder()
+			if err := store.Save(httptest.NewRequest(http.MethodGet, "/", nil), recorder, session); err != nil {
+				t.Fatal(err)
+			}
+			var record Session
+			if err := DB.Where("key_hash = ?", hashSessionId(session.ID)).First(&record).Error; err != nil {
+				t.Fatal(err)
+			}
+			want := time.Now().Add(time.Duration(tt.wantMaxAge) * time.Second)
+			if diff := record.ExpiredTime.Sub(want); diff > time.Minute || diff < -time.Minute {
+				t.Fatalf("session expires at %v, want about %v", record.ExpiredTime, want)
+			}
+			cookies := recorder.Result().Cookies()
+			if len(cookies) != 1 || cookies[0].MaxAge != tt.wantMaxAge {
+				t.Fatalf("cookies = %v, want max age %d", cookies, tt.wantMaxAge)
+			}
+			if session.Options.MaxAge != maxAge {
+				t.Fatalf("session options changed to max age %d", session.Options.MaxAge)
+			}
+		})
+	}
+}
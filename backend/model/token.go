@@ -1,47 +1,95 @@
 package model
 
 import (
+	"account-system/common"
 	"errors"
 	"gorm.io/gorm"
 	"time"
-	"account-system/common"
 )
 
 // Token 令牌模型
 type Token struct {
-	Id               int            `json:"id"`
-	UserId           int            `json:"user_id" gorm:"index"`
-	Key              string         `json:"key" gorm:"type:varchar(64);uniqueIndex"`
-	Name             string         `json:"name" gorm:"type:varchar(64)"`
-	Status           int            `json:"status" gorm:"type:int;default:1"`
-	CreatedTime      time.Time      `json:"created_time" gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP"`
-	AccessedTime     time.Time      `json:"accessed_time" gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP"`
-	ExpiredTime      time.Time      `json:"expired_time" gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP"`
-	RemainQuota      int            `json:"remain_quota" gorm:"type:int;default:0"`
-	UnlimitedQuota   bool           `json:"unlimited_quota" gorm:"type:tinyint(1);default:0"`
-	DeletedAt        gorm.DeletedAt `gorm:"index"`
+	Id        int    `json:"id"`
+	UserId    int    `json:"user_id" gorm:"index"`   // 個人令牌的所有者，組織令牌的創建者
+	Key       string `json:"key,omitempty" gorm:"-"` // 明文密鑰，只在創建時返回一次
+	KeyHash   string `json:"-" gorm:"type:char(64);index"`
+	KeyPrefix string `json:"key_prefix" gorm:"type:varchar(16)"`
+	// 輪換後仍在寬限期內的舊密鑰
+	PreviousKeyHash        string         `json:"-" gorm:"type:char(64);index"`
+	PreviousKeyPrefix      string         `json:"previous_key_prefix" gorm:"type:varchar(16)"`
+	PreviousKeyExpiredTime *time.Time     `json:"previous_key_expired_time" gorm:"type:timestamp"`
+	RotatedTime            *time.Time     `json:"rotated_time" gorm:"type:timestamp"`     // 最近一次輪換密鑰的時間
+	UsedPreviousKey        bool           `json:"-" gorm:"-"`                             // 本次驗證是否使用了舊密鑰
+	OrganizationId         int            `json:"organization_id" gorm:"index;default:0"` // 組織令牌所屬的組織，為 0 表示個人令牌
+	Name                   string         `json:"name" gorm:"type:varchar(64)"`
+	Status                 int            `json:"status" gorm:"type:int;default:1"`
+	CreatedTime            time.Time      `json:"created_time" gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP"`
+	AccessedTime           time.Time      `json:"accessed_time" gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP"`
+	ExpiredTime            time.Time      `json:"expired_time" gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP"`
+	NeverExpire            bool           `json:"never_expire" gorm:"default:false"` // 永不過期時忽略 ExpiredTime
+	ExpiryNoticeTime       *time.Time     `json:"-" gorm:"type:timestamp"`           // 已發送即將過期提醒的時間，修改過期時間後重置
+	RateLimitNum           int            `json:"rate_limit_num"`                    // 每個時間窗口允許的請求數，0 表示不限制
+	RateLimitDuration      int64          `json:"rate_limit_duration"`               // 時間窗口 (秒)
+	RateLimitBurst         int            `json:"rate_limit_burst"`                  // 允許的突發請求數
+	RemainQuota            int            `json:"remain_quota" gorm:"type:int;default:0"`
+	UnlimitedQuota         bool           `json:"unlimited_quota" gorm:"type:tinyint(1);default:0"`
+	UseAccountQuota        bool           `json:"use_account_quota" gorm:"default:false"`       // 從所有者的帳戶額度扣減，忽略 RemainQuota
+	Scopes                 []string       `json:"scopes" gorm:"type:text;serializer:json"`      // 權限範圍，路由通過 RequireScopes 聲明所需範圍
+	AllowedIPs             []string       `json:"allowed_ips" gorm:"type:text;serializer:json"` // 允許使用令牌的 IP 或 CIDR，為空時不限制
+	DeletedAt              gorm.DeletedAt `gorm:"index"`
 }
 
-// Insert 插入新令牌
+// Insert 插入新令牌，明文密鑰只保留在返回的 token.Key 中
 func (token *Token) Insert() error {
-	token.Key = common.GetUUID()
+	token.Key = common.GenerateTokenKey(common.TokenKeyTypeAPI)
+	token.KeyHash = common.HashTokenKey(token.Key)
+	token.KeyPrefix = common.TokenKeyPrefix(token.Key)
 	token.CreatedTime = time.Now()
 	token.AccessedTime = time.Now()
-	token.ExpiredTime = time.Now().AddDate(10, 0, 0) // 默認10年有效期
-	result := DB.Create(token)
-	return result.Error
+	token.RotatedTime = nil
+	if token.ExpiredTime.IsZero() {
+		if token.NeverExpire {
+			token.ExpiredTime = token.CreatedTime // 永不過期的令牌不使用該字段
+		} else {
+			token.ExpiredTime = token.CreatedTime.Add(defaultTokenLifetime)
+		}
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(token).Error; err != nil {
+			return err
+		}
+		if token.RemainQuota == 0 {
+			return nil
+		}
+		// 初始額度記入流水
+		return tx.Create(&QuotaLedger{
+			TokenId:      token.Id,
+			UserId:       token.UserId,
+			Type:         common.QuotaLedgerTypeAdjust,
+			Amount:       token.RemainQuota,
+			BalanceAfter: token.RemainQuota,
+			Reason:       "初始額度",
+			CreatedTime:  token.CreatedTime,
+		}).Error
+	})
 }
 
-// Update 更新令牌
+// Update 更新令牌，不修改額度餘額；餘額只能通過 AdjustTokenQuota 等記入流水的方式修改
 func (token *Token) Update() error {
-	result := DB.Model(token).Updates(map[string]interface{}{
-		"name":            token.Name,
-		"status":          token.Status,
-		"expired_time":    token.ExpiredTime,
-		"remain_quota":    token.RemainQuota,
-		"unlimited_quota": token.UnlimitedQuota,
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var current Token
+		if err := tx.Select("id", "remain_quota", "expired_time", "never_expire").First(&current, "id = ?", token.Id).Error; err != nil {
+			return err
+		}
+		token.RemainQuota = current.RemainQuota
+		columns := []interface{}{"status", "expired_time", "never_expire", "unlimited_quota", "use_account_quota", "scopes", "allowed_ips",
+			"rate_limit_num", "rate_limit_duration", "rate_limit_burst"}
+		if !current.ExpiredTime.Equal(token.ExpiredTime) || current.NeverExpire != token.NeverExpire {
+			token.ExpiryNoticeTime = nil
+			columns = append(columns, "expiry_notice_time")
+		}
+		return tx.Model(token).Select("name", columns...).Updates(token).Error
 	})
-	return result.Error
 }
 
 // Delete 刪除令牌
@@ -53,32 +101,81 @@ func (token *Token) Delete() error {
 	return result.Error
 }
 
-// ValidateUserToken 驗證用戶令牌
-func ValidateUserToken(key string) (*Token, error) {
+var (
+	errTokenExpired   = errors.New("令牌已過期")
+	errTokenExhausted = errors.New("令牌額度已用盡")
+)
+
+// checkUserToken 查找並檢查令牌是否可用，不修改數據庫
+func checkUserToken(key string) (*Token, error) {
 	if key == "" {
 		return nil, errors.New("令牌為空")
 	}
-	var token Token
-	err := DB.Where("key = ?", key).First(&token).Error
+	token, err := findTokenByKey(key)
 	if err != nil {
 		return nil, errors.New("無效的令牌")
 	}
 	if token.Status != common.TokenStatusEnabled {
-		return &token, errors.New("令牌已被禁用")
+		return token, errors.New("令牌已被禁用")
 	}
-	if token.ExpiredTime.Before(time.Now()) {
-		token.Status = common.TokenStatusExpired
-		DB.Save(&token)
-		return &token, errors.New("令牌已過期")
+	if !token.NeverExpire && token.ExpiredTime.Before(time.Now()) {
+		return token, errTokenExpired
 	}
-	if !token.UnlimitedQuota && token.RemainQuota <= 0 {
+	if !token.UnlimitedQuota && !token.UseAccountQuota && token.OrganizationId == 0 && token.RemainQuota <= 0 {
+		return token, errTokenExhausted
+	}
+	return token, nil
+}
+
+// ValidateUserToken 驗證用戶令牌，記錄訪問時間，並將已過期或額度用盡的令牌標記為對應狀態
+func ValidateUserToken(key string) (*Token, error) {
+	token, err := checkUserToken(key)
+	// 只更新單個字段，避免覆蓋並發的額度變化
+	switch err {
+	case nil:
+		token.AccessedTime = time.Now()
+		DB.Model(token).Update("accessed_time", token.AccessedTime)
+	case errTokenExpired:
+		token.Status = common.TokenStatusExpired
+		DB.Model(token).Update("status", token.Status)
+	case errTokenExhausted:
 		token.Status = common.TokenStatusExhausted
-		DB.Save(&token)
-		return &token, errors.New("令牌額度已用盡")
+		DB.Model(&Token{}).Where("id = ? AND unlimited_quota = ? AND use_account_quota = ? AND organization_id = 0 AND remain_quota <= 0", token.Id, false, false).
+			Update("status", token.Status)
 	}
-	token.AccessedTime = time.Now()
-	DB.Save(&token)
-	return &token, nil
+	return token, err
+}
+
+// IntrospectUserToken 按與 ValidateUserToken 相同的規則檢查令牌，但不記錄訪問時間也不修改狀態，
+// 並要求令牌所屬用戶未被禁用（組織令牌要求組織存在）
+func IntrospectUserToken(key string) (*Token, error) {
+	token, err := checkUserToken(key)
+	if err != nil {
+		return token, err
+	}
+	// 組織令牌不依賴創建者，只要求組織存在
+	if token.OrganizationId != 0 {
+		if _, err = GetOrganizationById(token.OrganizationId); err != nil {
+			return token, errors.New("組織不存在")
+		}
+		return token, nil
+	}
+	enabled, err := IsUserEnabled(token.UserId)
+	if err != nil {
+		return token, err
+	}
+	if !enabled {
+		return token, errors.New("用戶已被禁用")
+	}
+	return token, nil
+}
+
+// GetTokenByKey 通過明文密鑰獲取令牌
+func GetTokenByKey(key string) (*Token, error) {
+	if key == "" {
+		return nil, errors.New("令牌為空")
+	}
+	return findTokenByKey(key)
 }
 
 // GetTokenById 通過 ID 獲取令牌
@@ -91,9 +188,19 @@ func GetTokenById(id int) (*Token, error) {
 	return &token, err
 }
 
-// GetTokensByUserId 獲取用戶的所有令牌
-func GetTokensByUserId(userId int, page, pageSize int) (tokens []*Token, total int64, err error) {
-	if userId == 0 {
+// tokenOwnerScope 按所有者篩選令牌，organizationId 不為 0 時篩選組織令牌，否則篩選用戶的個人令牌
+func tokenOwnerScope(userId int, organizationId int) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if organizationId != 0 {
+			return db.Where("organization_id = ?", organizationId)
+		}
+		return db.Where("user_id = ? AND organization_id = 0", userId)
+	}
+}
+
+// GetTokensByOwner 獲取用戶的個人令牌，organizationId 不為 0 時獲取組織令牌
+func GetTokensByOwner(userId int, organizationId int, page, pageSize int) (tokens []*Token, total int64, err error) {
+	if userId == 0 && organizationId == 0 {
 		return nil, 0, errors.New("用戶 ID 為空！")
 	}
 	if page < 1 {
@@ -116,14 +223,14 @@ func GetTokensByUserId(userId int, page, pageSize int) (tokens []*Token, total i
 	}
 
 	// 獲取總數
-	err = tx.Model(&Token{}).Where("user_id = ?", userId).Count(&total).Error
+	err = tx.Model(&Token{}).Scopes(tokenOwnerScope(userId, organizationId)).Count(&total).Error
 	if err != nil {
 		tx.Rollback()
 		return nil, 0, err
 	}
 
 	// 獲取分頁數據
-	err = tx.Where("user_id = ?", userId).Order("id desc").Limit(pageSize).Offset(offset).Find(&tokens).Error
+	err = tx.Scopes(tokenOwnerScope(userId, organizationId)).Order("id desc").Limit(pageSize).Offset(offset).Find(&tokens).Error
 	if err != nil {
 		tx.Rollback()
 		return nil, 0, err
@@ -137,9 +244,9 @@ func GetTokensByUserId(userId int, page, pageSize int) (tokens []*Token, total i
 	return tokens, total, nil
 }
 
-// SearchTokens 搜索令牌
-func SearchTokens(userId int, keyword string, page, pageSize int) (tokens []*Token, total int64, err error) {
-	if userId == 0 {
+// SearchTokens 搜索令牌，所有者規則同 GetTokensByOwner
+func SearchTokens(userId int, organizationId int, keyword string, page, pageSize int) (tokens []*Token, total int64, err error) {
+	if userId == 0 && organizationId == 0 {
 		return nil, 0, errors.New("用戶 ID 為空！")
 	}
 	if page < 1 {
@@ -161,9 +268,9 @@ func SearchTokens(userId int, keyword string, page, pageSize int) (tokens []*Tok
 		return nil, 0, err
 	}
 
-	query := DB.Model(&Token{}).Where("user_id = ?", userId)
+	query := DB.Model(&Token{}).Scopes(tokenOwnerScope(userId, organizationId))
 	if keyword != "" {
-		query = query.Where("name LIKE ? OR key LIKE ?", "%"+keyword+"%", "%"+keyword+"%")
+		query = query.Where("name LIKE ? OR key_prefix LIKE ?", "%"+keyword+"%", keyword+"%")
 	}
 
 	// 獲取總數
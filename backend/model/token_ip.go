@@ -0,0 +1,64 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+const maxTokenAllowedIPs = 64
+
+// NormalizeTokenAllowedIPs 檢查令牌的 IP 白名單，每項為單個 IP 或 CIDR 網段，統一轉為規範格式
+func NormalizeTokenAllowedIPs(entries []string) ([]string, error) {
+	if len(entries) > maxTokenAllowedIPs {
+		return nil, fmt.Errorf("IP 白名單不能超過 %d 項", maxTokenAllowedIPs)
+	}
+	seen := make(map[string]bool)
+	result := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			_, network, err := net.ParseCIDR(entry)
+			if err != nil {
+				return nil, errors.New("無效的 CIDR 網段：" + entry)
+			}
+			entry = network.String()
+		} else {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, errors.New("無效的 IP 地址：" + entry)
+			}
+			entry = ip.String()
+		}
+		if !seen[entry] {
+			seen[entry] = true
+			result = append(result, entry)
+		}
+	}
+	return result, nil
+}
+
+// IsIPAllowed 檢查客戶端 IP 是否在令牌的白名單中，白名單為空時不限制
+func (token *Token) IsIPAllowed(clientIP string) bool {
+	if len(token.AllowedIPs) == 0 {
+		return true
+	}
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return false
+	}
+	for _, entry := range token.AllowedIPs {
+		if strings.Contains(entry, "/") {
+			if _, network, err := net.ParseCIDR(entry); err == nil && network.Contains(ip) {
+				return true
+			}
+		} else if allowed := net.ParseIP(entry); allowed != nil && allowed.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
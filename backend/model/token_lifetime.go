@@ -0,0 +1,70 @@
+package model
+
+import (
+	"account-system/common"
+	"fmt"
+	"time"
+)
+
+const defaultTokenLifetime = 10 * 365 * 24 * time.Hour
+
+// TokenMaxLifetime 按令牌所有者的角色獲取令牌的最長有效期，0 表示不限制（允許永不過期）
+func TokenMaxLifetime(role int) time.Duration {
+	days := common.TokenMaxLifetimeUser
+	if role >= common.RoleRootUser {
+		days = common.TokenMaxLifetimeRoot
+	} else if role >= common.RoleAdminUser {
+		days = common.TokenMaxLifetimeAdmin
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// lifetimeStart 有效期的起點：最近一次輪換密鑰的時間，未輪換時為創建時間，尚未創建的令牌為當前時間
+func (token *Token) lifetimeStart() time.Time {
+	if token.RotatedTime != nil {
+		return *token.RotatedTime
+	}
+	if !token.CreatedTime.IsZero() {
+		return token.CreatedTime
+	}
+	return time.Now()
+}
+
+// ApplyLifetimePolicy 按所有者角色的最長有效期檢查令牌的過期時間，未指定過期時間時使用最長有效期；
+// 最長有效期從創建或最近一次輪換密鑰時起算，修改過期時間不能延長密鑰的使用期限；
+// 超出時按 TokenLifetimePolicy 縮短到最長有效期或返回錯誤
+func (token *Token) ApplyLifetimePolicy(role int) error {
+	start := token.lifetimeStart()
+	maxLifetime := TokenMaxLifetime(role)
+	if !token.NeverExpire && token.ExpiredTime.IsZero() {
+		if maxLifetime > 0 {
+			token.ExpiredTime = start.Add(maxLifetime)
+		} else {
+			token.ExpiredTime = start.Add(defaultTokenLifetime)
+		}
+		return nil
+	}
+	if maxLifetime <= 0 {
+		return nil
+	}
+	days := int(maxLifetime / (24 * time.Hour))
+	if token.NeverExpire {
+		if common.TokenLifetimePolicy != common.TokenLifetimePolicyClamp {
+			return fmt.Errorf("不允許創建永不過期的令牌，令牌有效期最長為 %d 天", days)
+		}
+		token.NeverExpire = false
+		token.ExpiredTime = start.Add(maxLifetime)
+		return nil
+	}
+	deadline := start.Add(maxLifetime)
+	if token.ExpiredTime.After(deadline) {
+		if common.TokenLifetimePolicy != common.TokenLifetimePolicyClamp {
+			if !deadline.After(time.Now()) {
+				return fmt.Errorf("令牌已超過最長有效期 %d 天，請輪換密鑰後再修改過期時間", days)
+			}
+			return fmt.Errorf("令牌有效期最長為 %d 天，請選擇 %s 之前的過期時間", days, deadline.Format("2006-01-02 15:04"))
+		}
+		token.ExpiredTime = deadline
+	}
+	return nil
+}
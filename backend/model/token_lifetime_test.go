@@ -0,0 +1,87 @@
+package model
+
+import (
+	"account-system/common"
+	"testing"
+	"time"
+)
+
+func TestApplyLifetimePolicyAnchor(t *testing.T) {
+	maxLifetime := 30 * 24 * time.Hour
+	defer func(days int, policy string) {
+		common.TokenMaxLifetimeUser = days
+		common.TokenLifetimePolicy = policy
+	}(common.TokenMaxLifetimeUser, common.TokenLifetimePolicy)
+	common.TokenMaxLifetimeUser = 30
+
+	now := time.Now()
+	ago := func(days int) time.Time { return now.Add(-time.Duration(days) * 24 * time.Hour) }
+	timePtr := func(t time.Time) *time.Time { return &t }
+	tests := []struct {
+		name        string
+		policy      string
+		createdTime time.Time
+		rotatedTime *time.Time
+		expiredTime time.Time
+		neverExpire bool
+		wantErr     bool
+		wantExpired time.Time // 為零時表示過期時間不變
+	}{
+		{name: "new token within limit", policy: common.TokenLifetimePolicyReject, expiredTime: now.Add(maxLifetime - time.Hour)},
+		{name: "new token over limit", policy: common.TokenLifetimePolicyReject, expiredTime: now.Add(maxLifetime + time.Hour), wantErr: true},
+		{name: "extend from creation within limit", policy: common.TokenLifetimePolicyReject, createdTime: ago(20), expiredTime: now.Add(9 * 24 * time.Hour)},
+		{name: "extend from creation over limit", policy: common.TokenLifetimePolicyReject, createdTime: ago(20), expiredTime: now.Add(20 * 24 * time.Hour), wantErr: true},
+		{name: "extend past limit is clamped to creation", policy: common.TokenLifetimePolicyClamp, createdTime: ago(20), expiredTime: now.Add(20 * 24 * time.Hour), wantExpired: ago(20).Add(maxLifetime)},
+		{name: "never expire is clamped to creation", policy: common.TokenLifetimePolicyClamp, createdTime: ago(20), neverExpire: true, wantExpired: ago(20).Add(maxLifetime)},
+		{name: "token older than limit", policy: common.TokenLifetimePolicyReject, createdTime: ago(40), expiredTime: now.Add(time.Hour), wantErr: true},
+		{name: "rotation restarts lifetime", policy: common.TokenLifetimePolicyReject, createdTime: ago(40), rotatedTime: timePtr(ago(1)), expiredTime: now.Add(28 * 24 * time.Hour)},
+		{name: "rotation does not allow more than limit", policy: common.TokenLifetimePolicyReject, createdTime: ago(40), rotatedTime: timePtr(ago(1)), expiredTime: now.Add(30 * 24 * time.Hour), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			common.TokenLifetimePolicy = tt.policy
+			token := &Token{
+				CreatedTime: tt.createdTime,
+				RotatedTime: tt.rotatedTime,
+				ExpiredTime: tt.expiredTime,
+				NeverExpire: tt.neverExpire,
+			}
+			err := token.ApplyLifetimePolicy(common.RoleCommonUser)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			want := tt.expiredTime
+			if !tt.wantExpired.IsZero() {
+				want = tt.wantExpired
+			}
+			if !token.ExpiredTime.Equal(want) || token.NeverExpire {
+				t.Errorf("expired time = %v (never expire %v), want %v", token.ExpiredTime, token.NeverExpire, want)
+			}
+		})
+	}
+}
+
+func TestRotateKeyRecordsRotatedTime(t *testing.T) {
+	user := createTestUser(t, "lifetime-rotation")
+	token := &Token{UserId: user.Id, Name: "rotated", Status: 1, NeverExpire: true, RotatedTime: new(time.Time)}
+	if err := token.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	if token.RotatedTime != nil {
+		t.Fatal("new token should not have a rotated time")
+	}
+	before := time.Now()
+	if err := token.RotateKey(0); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := GetTokenById(token.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.RotatedTime == nil || stored.RotatedTime.Before(before.Add(-time.Second)) {
+		t.Fatalf("rotated time = %v, want after %v", stored.RotatedTime, before)
+	}
+}
@@ -0,0 +1,59 @@
+package model
+
+import "errors"
+
+const (
+	defaultTokenRateLimitDuration = 60
+	maxTokenRateLimitNum          = 1000000
+	maxTokenRateLimitDuration     = 24 * 60 * 60
+)
+
+// NormalizeRateLimit 檢查令牌的速率限制配置，RateLimitNum 為 0 表示不限制；
+// 未指定時間窗口時默認為 60 秒，未指定突發數量時默認等於 RateLimitNum
+func (token *Token) NormalizeRateLimit() error {
+	return normalizeRateLimit(&token.RateLimitNum, &token.RateLimitDuration, &token.RateLimitBurst)
+}
+
+// ApplyGroupRateLimit 合併所有者分組的速率限制，取兩者中更嚴格的一個，分組的限制是令牌速率的上限；
+// 突發數量取兩者中較小的值，num 為 0 表示分組不限制
+func (token *Token) ApplyGroupRateLimit(num int, duration int64, burst int) {
+	if num <= 0 || duration <= 0 {
+		return
+	}
+	if token.RateLimitNum <= 0 || token.RateLimitDuration <= 0 {
+		token.RateLimitNum, token.RateLimitDuration, token.RateLimitBurst = num, duration, burst
+		return
+	}
+	// 比較 num/duration，交叉相乘避免浮點誤差
+	if int64(num)*token.RateLimitDuration < int64(token.RateLimitNum)*duration {
+		token.RateLimitNum, token.RateLimitDuration = num, duration
+	}
+	if burst < token.RateLimitBurst {
+		token.RateLimitBurst = burst
+	}
+}
+
+// normalizeRateLimit 令牌和分組共用的速率限制檢查
+func normalizeRateLimit(num *int, duration *int64, burst *int) error {
+	if *num < 0 || *duration < 0 || *burst < 0 {
+		return errors.New("速率限制不能為負數")
+	}
+	if *num == 0 {
+		*duration = 0
+		*burst = 0
+		return nil
+	}
+	if *num > maxTokenRateLimitNum || *burst > maxTokenRateLimitNum {
+		return errors.New("速率限制的請求數過大")
+	}
+	if *duration == 0 {
+		*duration = defaultTokenRateLimitDuration
+	}
+	if *duration > maxTokenRateLimitDuration {
+		return errors.New("速率限制的時間窗口不能超過 1 天")
+	}
+	if *burst == 0 {
+		*burst = *num
+	}
+	return nil
+}
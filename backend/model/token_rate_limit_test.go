@@ -0,0 +1,36 @@
+package model
+
+import "testing"
+
+func TestApplyGroupRateLimit(t *testing.T) {
+	type limit struct {
+		num      int
+		duration int64
+		burst    int
+	}
+	tests := []struct {
+		name  string
+		token limit
+		group limit
+		want  limit
+	}{
+		{name: "no limits", token: limit{}, group: limit{}, want: limit{}},
+		{name: "group unlimited", token: limit{10, 60, 10}, group: limit{}, want: limit{10, 60, 10}},
+		{name: "token unlimited uses group", token: limit{}, group: limit{100, 60, 20}, want: limit{100, 60, 20}},
+		{name: "token stricter", token: limit{10, 60, 5}, group: limit{100, 60, 20}, want: limit{10, 60, 5}},
+		{name: "group stricter", token: limit{1000, 60, 1000}, group: limit{100, 60, 20}, want: limit{100, 60, 20}},
+		{name: "different windows", token: limit{100, 3600, 100}, group: limit{10, 60, 10}, want: limit{100, 3600, 10}},
+		{name: "group stricter with longer window", token: limit{10, 60, 10}, group: limit{100, 3600, 50}, want: limit{100, 3600, 10}},
+		{name: "smaller burst kept", token: limit{1000, 60, 3}, group: limit{100, 60, 20}, want: limit{100, 60, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := &Token{RateLimitNum: tt.token.num, RateLimitDuration: tt.token.duration, RateLimitBurst: tt.token.burst}
+			token.ApplyGroupRateLimit(tt.group.num, tt.group.duration, tt.group.burst)
+			got := limit{token.RateLimitNum, token.RateLimitDuration, token.RateLimitBurst}
+			if got != tt.want {
+				t.Fatalf("limit = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
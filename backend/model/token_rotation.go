@@ -0,0 +1,67 @@
+package model
+
+import (
+	"account-system/common"
+	"errors"
+	"time"
+)
+
+// findTokenByKey 通過明文密鑰查找令牌，輪換寬限期內的舊密鑰同樣有效，並標記 UsedPreviousKey
+func findTokenByKey(key string) (*Token, error) {
+	if !common.IsTokenKeyWellFormed(key, common.TokenKeyTypeAPI) {
+		return nil, errors.New("令牌格式或校驗碼錯誤")
+	}
+	hash := common.HashTokenKey(key)
+	var token Token
+	err := DB.Where("key_hash = ?", hash).First(&token).Error
+	if err == nil {
+		return &token, nil
+	}
+	err = DB.Where("previous_key_hash = ? AND previous_key_expired_time > ?", hash, time.Now()).First(&token).Error
+	if err != nil {
+		return nil, err
+	}
+	token.UsedPreviousKey = true
+	return &token, nil
+}
+
+// RotateKey 為令牌生成新密鑰，舊密鑰在寬限期內仍然有效，寬限期為 0 時立即失效；
+// 寬限期內再次輪換時，更早的密鑰立即失效
+func (token *Token) RotateKey(gracePeriod time.Duration) error {
+	if token.Id == 0 {
+		return errors.New("id 為空！")
+	}
+	key := common.GenerateTokenKey(common.TokenKeyTypeAPI)
+	rotated := *token
+	rotated.Key = key
+	rotated.KeyHash = common.HashTokenKey(key)
+	rotated.KeyPrefix = common.TokenKeyPrefix(key)
+	rotated.PreviousKeyHash = ""
+	rotated.PreviousKeyPrefix = ""
+	rotated.PreviousKeyExpiredTime = nil
+	now := time.Now()
+	rotated.RotatedTime = &now
+	if gracePeriod > 0 {
+		expiredTime := now.Add(gracePeriod)
+		rotated.PreviousKeyHash = token.KeyHash
+		rotated.PreviousKeyPrefix = token.KeyPrefix
+		rotated.PreviousKeyExpiredTime = &expiredTime
+	}
+	// 以舊的哈希為條件，避免並發輪換互相覆蓋
+	result := DB.Model(&Token{}).Where("id = ? AND key_hash = ?", token.Id, token.KeyHash).Updates(map[string]interface{}{
+		"key_hash":                  rotated.KeyHash,
+		"key_prefix":                rotated.KeyPrefix,
+		"previous_key_hash":         rotated.PreviousKeyHash,
+		"previous_key_prefix":       rotated.PreviousKeyPrefix,
+		"previous_key_expired_time": rotated.PreviousKeyExpiredTime,
+		"rotated_time":              rotated.RotatedTime,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("令牌已被輪換，請刷新後重試")
+	}
+	*token = rotated
+	return nil
+}
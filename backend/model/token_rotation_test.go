@@ -0,0 +1,69 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRotateKeyGracePeriod(t *testing.T) {
+	user := createTestUser(t, "rotation")
+	tests := []struct {
+		name         string
+		gracePeriod  time.Duration
+		expireGrace  bool // 模擬寬限期已結束
+		rotateTwice  bool
+		wantOldValid bool
+	}{
+		{name: "old key valid during grace period", gracePeriod: time.Hour, wantOldValid: true},
+		{name: "zero grace period revokes old key", gracePeriod: 0, wantOldValid: false},
+		{name: "old key invalid after grace period", gracePeriod: time.Hour, expireGrace: true, wantOldValid: false},
+		{name: "second rotation revokes oldest key", gracePeriod: time.Hour, rotateTwice: true, wantOldValid: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := &Token{UserId: user.Id, Name: tt.name, Status: 1, ExpiredTime: time.Now().Add(time.Hour)}
+			if err := token.Insert(); err != nil {
+				t.Fatal(err)
+			}
+			oldKey := token.Key
+			if err := token.RotateKey(tt.gracePeriod); err != nil {
+				t.Fatal(err)
+			}
+			if tt.rotateTwice {
+				if err := token.RotateKey(tt.gracePeriod); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.expireGrace {
+				DB.Model(&Token{}).Where("id = ?", token.Id).Update("previous_key_expired_time", time.Now().Add(-time.Second))
+			}
+
+			found, err := GetTokenByKey(token.Key)
+			if err != nil || found.Id != token.Id || found.UsedPreviousKey {
+				t.Fatalf("new key: token %+v, err %v", found, err)
+			}
+			found, err = GetTokenByKey(oldKey)
+			if valid := err == nil && found.Id == token.Id; valid != tt.wantOldValid {
+				t.Fatalf("old key valid = %v, want %v (err %v)", valid, tt.wantOldValid, err)
+			}
+			if tt.wantOldValid && !found.UsedPreviousKey {
+				t.Error("old key is not marked as previous key")
+			}
+		})
+	}
+}
+
+func TestRotateKeyConflict(t *testing.T) {
+	user := createTestUser(t, "rotation-conflict")
+	token := &Token{UserId: user.Id, Name: "conflict", Status: 1, ExpiredTime: time.Now().Add(time.Hour)}
+	if err := token.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	stale := *token
+	if err := token.RotateKey(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := stale.RotateKey(time.Hour); err == nil {
+		t.Fatal("rotating a stale copy should fail")
+	}
+}
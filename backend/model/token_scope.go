@@ -0,0 +1,51 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const maxTokenScopes = 32
+
+// 範圍格式為「服務:操作」，例如 user:read、billing:charge
+var tokenScopePattern = regexp.MustCompile(`^[a-z][a-z0-9_.-]{0,31}:[a-z][a-z0-9_.-]{0,31}$`)
+
+// NormalizeTokenScopes 檢查範圍格式，去除重複並排序
+func NormalizeTokenScopes(scopes []string) ([]string, error) {
+	if len(scopes) > maxTokenScopes {
+		return nil, fmt.Errorf("權限範圍不能超過 %d 個", maxTokenScopes)
+	}
+	seen := make(map[string]bool)
+	result := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		if scope == "" || seen[scope] {
+			continue
+		}
+		if !tokenScopePattern.MatchString(scope) {
+			return nil, errors.New("無效的權限範圍：" + scope)
+		}
+		seen[scope] = true
+		result = append(result, scope)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// MissingTokenScopes 返回 required 中 granted 沒有包含的範圍
+func MissingTokenScopes(granted []string, required []string) []string {
+	allowed := make(map[string]bool, len(granted))
+	for _, scope := range granted {
+		allowed[scope] = true
+	}
+	var missing []string
+	for _, scope := range required {
+		if !allowed[scope] {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,100 @@
+package model
+
+import (
+	"account-system/common"
+	"context"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+)
+
+const tokenExpiryNoticeBatchSize = 500
+
+// SweepTokens 批量將已過期和額度用盡的啟用令牌標記為對應狀態，規則與 ValidateUserToken 一致
+func SweepTokens(ctx context.Context) error {
+	now := time.Now()
+	result := DB.Model(&Token{}).
+		Where("status = ? AND never_expire = ? AND expired_time < ?", common.TokenStatusEnabled, false, now).
+		Update("status", common.TokenStatusExpired)
+	if result.Error != nil {
+		return result.Error
+	}
+	expired := result.RowsAffected
+	result = DB.Model(&Token{}).
+		Where("status = ? AND unlimited_quota = ? AND use_account_quota = ? AND organization_id = 0 AND remain_quota <= 0",
+			common.TokenStatusEnabled, false, false).
+		Update("status", common.TokenStatusExhausted)
+	if result.Error != nil {
+		return result.Error
+	}
+	if expired > 0 || result.RowsAffected > 0 {
+		common.SysLog(fmt.Sprintf("token sweep: %d expired, %d exhausted", expired, result.RowsAffected))
+	}
+	return nil
+}
+
+// NotifyExpiringTokens 向令牌所有者發送即將過期提醒，每個令牌的每個過期時間只提醒一次；
+// 發送前先認領令牌，多實例同時執行時不會重複發送
+func NotifyExpiringTokens(ctx context.Context) error {
+	now := time.Now()
+	var tokens []*Token
+	err := DB.Select("id", "user_id", "name", "key_prefix", "expired_time").
+		Where("status = ? AND never_expire = ? AND expiry_notice_time IS NULL AND expired_time > ? AND expired_time <= ?",
+			common.TokenStatusEnabled, false, now, now.AddDate(0, 0, common.TokenExpiryNoticeDays)).
+		Order("user_id").Limit(tokenExpiryNoticeBatchSize).Find(&tokens).Error
+	if err != nil {
+		return err
+	}
+	byUser := make(map[int][]*Token)
+	var userIds []int
+	for _, token := range tokens {
+		result := DB.Model(&Token{}).Where("id = ? AND expiry_notice_time IS NULL", token.Id).Update("expiry_notice_time", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		if _, ok := byUser[token.UserId]; !ok {
+			userIds = append(userIds, token.UserId)
+		}
+		byUser[token.UserId] = append(byUser[token.UserId], token)
+	}
+	for _, userId := range userIds {
+		if ctx.Err() != nil {
+			// 未發送的令牌解除認領，下次繼續發送
+			releaseTokenExpiryNotices(byUser[userId])
+			continue
+		}
+		var user User
+		if err = DB.Select("id", "username", "email").First(&user, userId).Error; err != nil || user.Email == "" {
+			continue
+		}
+		if err = sendTokenExpiryNotice(&user, byUser[userId]); err != nil {
+			common.SysError(fmt.Sprintf("failed to send token expiry notice to user %d: %s", userId, err.Error()))
+			releaseTokenExpiryNotices(byUser[userId])
+		}
+	}
+	return nil
+}
+
+func releaseTokenExpiryNotices(tokens []*Token) {
+	ids := make([]int, len(tokens))
+	for i, token := range tokens {
+		ids[i] = token.Id
+	}
+	DB.Model(&Token{}).Where("id IN ?", ids).Update("expiry_notice_time", nil)
+}
+
+func sendTokenExpiryNotice(user *User, tokens []*Token) error {
+	var items strings.Builder
+	for _, token := range tokens {
+		items.WriteString(fmt.Sprintf("<li>%s（%s…）將於 %s 過期</li>",
+			html.EscapeString(token.Name), token.KeyPrefix, token.ExpiredTime.Format("2006-01-02 15:04")))
+	}
+	subject := fmt.Sprintf("%s 令牌即將過期", common.SystemName)
+	content := fmt.Sprintf("<p>%s，您好：</p><p>您的以下令牌將在 %d 天內過期，請及時更換：</p><ul>%s</ul>",
+		html.EscapeString(user.Username), common.TokenExpiryNoticeDays, items.String())
+	return common.SendEmail(subject, user.Email, content)
+}
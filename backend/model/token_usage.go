@@ -0,0 +1,179 @@
+package model
+
+import (
+	"account-system/common"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// TokenUsage 通過 TokenAuth 的每次請求記錄
+type TokenUsage struct {
+	Id             int       `json:"id"`
+	TokenId        int       `json:"token_id" gorm:"index"`
+	UserId         int       `json:"user_id" gorm:"index"`                   // 個人令牌的所有者，組織令牌的創建者
+	OrganizationId int       `json:"organization_id" gorm:"index;default:0"` // 組織令牌所屬的組織，為 0 表示個人令牌
+	Method         string    `json:"method" gorm:"type:varchar(16)"`
+	Route          string    `json:"route" gorm:"type:varchar(255);index"`
+	StatusCode     int       `json:"status_code"`
+	Latency        int64     `json:"latency"` // 毫秒
+	ClientIP       string    `json:"client_ip" gorm:"type:varchar(64)"`
+	QuotaConsumed  int       `json:"quota_consumed"`
+	CreatedTime    time.Time `json:"created_time" gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP;index"`
+}
+
+// TokenUsageFilter 使用記錄查詢條件，零值表示不過濾
+type TokenUsageFilter struct {
+	TokenId        int
+	UserId         int
+	OrganizationId int
+	PersonalOnly   bool // 只查詢個人令牌的記錄
+	Route          string
+	StatusCode     int
+	StartTime      time.Time
+	EndTime        time.Time
+}
+
+const tokenUsageBatchSize = 100
+
+var (
+	tokenUsageQueue = make(chan *TokenUsage, 4096)
+	tokenUsageMutex sync.Mutex
+	tokenUsageStop  chan struct{} // 寫入協程運行時不為 nil，關閉後協程寫完隊列中的記錄再退出
+	tokenUsageDone  chan struct{}
+)
+
+// RecordTokenUsage 異步記錄令牌使用情況，隊列已滿時丟棄並記錄錯誤，不阻塞請求
+func RecordTokenUsage(usage *TokenUsage) {
+	startTokenUsageWriter()
+	select {
+	case tokenUsageQueue <- usage:
+	default:
+		common.SysError(fmt.Sprintf("token usage queue is full, dropping usage of token %d", usage.TokenId))
+	}
+}
+
+// startTokenUsageWriter 在寫入協程未運行時啟動
+func startTokenUsageWriter() {
+	tokenUsageMutex.Lock()
+	defer tokenUsageMutex.Unlock()
+	if tokenUsageStop != nil {
+		return
+	}
+	tokenUsageStop = make(chan struct{})
+	tokenUsageDone = make(chan struct{})
+	go writeTokenUsages(tokenUsageStop, tokenUsageDone)
+}
+
+// flushTokenUsages 停止寫入協程並等待其寫完隊列中的記錄，由 StopJobs 調用
+func flushTokenUsages(ctx context.Context) error {
+	tokenUsageMutex.Lock()
+	stop, done := tokenUsageStop, tokenUsageDone
+	tokenUsageStop, tokenUsageDone = nil, nil
+	tokenUsageMutex.Unlock()
+	if stop == nil {
+		return nil
+	}
+	close(stop)
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// writeTokenUsages 批量寫入隊列中的使用記錄，stop 關閉後寫完剩餘的記錄並關閉 done
+func writeTokenUsages(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	for {
+		select {
+		case usage := <-tokenUsageQueue:
+			writeTokenUsageBatch(usage)
+		case <-stop:
+			for {
+				select {
+				case usage := <-tokenUsageQueue:
+					writeTokenUsageBatch(usage)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// writeTokenUsageBatch 將 first 和隊列中已有的記錄合併為一批寫入
+func writeTokenUsageBatch(first *TokenUsage) {
+	batch := []*TokenUsage{first}
+drain:
+	for len(batch) < tokenUsageBatchSize {
+		select {
+		case usage := <-tokenUsageQueue:
+			batch = append(batch, usage)
+		default:
+			break drain
+		}
+	}
+	if err := DB.Create(&batch).Error; err != nil {
+		common.SysError("failed to record token usage: " + err.Error())
+	}
+}
+
+// QueryTokenUsages 分頁查詢令牌使用記錄
+func QueryTokenUsages(filter TokenUsageFilter, page, pageSize int) (usages []*TokenUsage, total int64, err error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 10
+	}
+	query := DB.Model(&TokenUsage{})
+	if filter.TokenId != 0 {
+		query = query.Where("token_id = ?", filter.TokenId)
+	}
+	if filter.UserId != 0 {
+		query = query.Where("user_id = ?", filter.UserId)
+	}
+	if filter.OrganizationId != 0 {
+		query = query.Where("organization_id = ?", filter.OrganizationId)
+	} else if filter.PersonalOnly {
+		query = query.Where("organization_id = 0")
+	}
+	if filter.Route != "" {
+		query = query.Where("route = ?", filter.Route)
+	}
+	if filter.StatusCode != 0 {
+		query = query.Where("status_code = ?", filter.StatusCode)
+	}
+	if !filter.StartTime.IsZero() {
+		query = query.Where("created_time >= ?", filter.StartTime)
+	}
+	if !filter.EndTime.IsZero() {
+		query = query.Where("created_time < ?", filter.EndTime)
+	}
+	if err = query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = query.Order("id desc").Limit(pageSize).Offset((page - 1) * pageSize).Find(&usages).Error
+	return usages, total, err
+}
+
+// DeleteExpiredTokenUsages 刪除超過保留天數的使用記錄
+func DeleteExpiredTokenUsages() error {
+	if common.TokenUsageRetentionDays <= 0 {
+		return nil
+	}
+	before := time.Now().AddDate(0, 0, -common.TokenUsageRetentionDays)
+	return DB.Where("created_time < ?", before).Delete(&TokenUsage{}).Error
+}
+
+// initTokenUsageOrganization 為添加 organization_id 之前記錄的組織令牌使用記錄補充組織 ID
+func initTokenUsageOrganization() error {
+	organizationTokens := DB.Unscoped().Model(&Token{}).Select("id").Where("organization_id <> 0")
+	organizationId := DB.Unscoped().Model(&Token{}).Select("organization_id").Where("tokens.id = token_usages.token_id")
+	return DB.Model(&TokenUsage{}).
+		Where("organization_id = 0 AND token_id IN (?)", organizationTokens).
+		Update("organization_id", organizationId).Error
+}
@@ -0,0 +1,41 @@
+package model
+
+import "testing"
+
+func TestInitTokenUsageOrganization(t *testing.T) {
+	user := createTestUser(t, "usage_backfill")
+	org := &Organization{Name: "usage backfill", CreatedBy: user.Id}
+	if err := org.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	newToken := func(organizationId int) *Token {
+		token := &Token{UserId: user.Id, OrganizationId: organizationId, Name: "backfill", Status: 1, NeverExpire: true}
+		if err := token.Insert(); err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	tests := []struct {
+		name  string
+		token *Token
+		want  int
+	}{
+		{name: "personal token", token: newToken(0), want: 0},
+		{name: "organization token", token: newToken(org.Id), want: org.Id},
+	}
+	for _, tt := range tests {
+		DB.Create(&TokenUsage{TokenId: tt.token.Id, UserId: user.Id, Method: "GET", Route: "/api/v1/token", StatusCode: 200})
+	}
+	if err := initTokenUsageOrganization(); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var usage TokenUsage
+			DB.First(&usage, "token_id = ?", tt.token.Id)
+			if usage.OrganizationId != tt.want {
+				t.Fatalf("organization_id = %d, want %d", usage.OrganizationId, tt.want)
+			}
+		})
+	}
+}
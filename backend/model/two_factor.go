@@ -0,0 +1,145 @@
+package model
+
+import (
+	"account-system/common"
+	"errors"
+	"strings"
+	"time"
+)
+
+// SetTwoFactorSecret 保存待確認的 TOTP 密鑰，確認前兩步驗證不生效
+func (user *User) SetTwoFactorSecret(secret string) error {
+	if user.Id == 0 {
+		return errors.New("id 為空！")
+	}
+	if user.TwoFactorEnabled {
+		return errors.New("兩步驗證已啟用，請先停用")
+	}
+	user.TwoFactorSecret = secret
+	return DB.Model(user).Updates(map[string]interface{}{
+		"two_factor_secret":    secret,
+		"two_factor_last_step": 0,
+	}).Error
+}
+
+// EnableTwoFactor 使用驗證碼確認密鑰並啟用兩步驗證，返回明文恢復碼
+func (user *User) EnableTwoFactor(code string) ([]string, error) {
+	if user.TwoFactorEnabled {
+		return nil, errors.New("兩步驗證已啟用")
+	}
+	if user.TwoFactorSecret == "" {
+		return nil, errors.New("請先生成兩步驗證密鑰")
+	}
+	step, ok := common.ValidateTOTPCode(user.TwoFactorSecret, code, time.Now())
+	if !ok {
+		return nil, errors.New("驗證碼錯誤")
+	}
+	codes := common.GenerateRecoveryCodes(common.TwoFactorRecoveryCodeCount)
+	err := DB.Model(user).Updates(map[string]interface{}{
+		"two_factor_enabled":        true,
+		"two_factor_last_step":      step,
+		"two_factor_recovery_codes": hashRecoveryCodes(codes),
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableTwoFactor 停用兩步驗證並清除密鑰和恢復碼
+func (user *User) DisableTwoFactor() error {
+	if user.Id == 0 {
+		return errors.New("id 為空！")
+	}
+	return DB.Model(user).Updates(map[string]interface{}{
+		"two_factor_enabled":        false,
+		"two_factor_secret":         "",
+		"two_factor_last_step":      0,
+		"two_factor_recovery_codes": "",
+	}).Error
+}
+
+// RegenerateRecoveryCodes 重新生成恢復碼，舊的恢復碼全部失效
+func (user *User) RegenerateRecoveryCodes() ([]string, error) {
+	if !user.TwoFactorEnabled {
+		return nil, errors.New("兩步驗證未啟用")
+	}
+	codes := common.GenerateRecoveryCodes(common.TwoFactorRecoveryCodeCount)
+	err := DB.Model(user).Update("two_factor_recovery_codes", hashRecoveryCodes(codes)).Error
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// ValidateTwoFactorCode 驗證 TOTP 驗證碼或恢復碼，恢復碼使用後即作廢
+func (user *User) ValidateTwoFactorCode(code string) error {
+	if !user.TwoFactorEnabled {
+		return errors.New("兩步驗證未啟用")
+	}
+	code = strings.TrimSpace(code)
+	if step, ok := common.ValidateTOTPCode(user.TwoFactorSecret, code, time.Now()); ok {
+		// 僅接受比上次更新的時間步，同一驗證碼不能重複使用
+		result := DB.Model(&User{}).
+			Where("id = ? AND two_factor_last_step < ?", user.Id, step).
+			Update("two_factor_last_step", step)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("驗證碼已被使用，請等待下一個驗證碼")
+		}
+		user.TwoFactorLastStep = step
+		return nil
+	}
+	return user.useRecoveryCode(code)
+}
+
+// useRecoveryCode 消耗一個恢復碼
+func (user *User) useRecoveryCode(code string) error {
+	if code == "" || user.TwoFactorRecoveryCodes == "" {
+		return errors.New("驗證碼錯誤")
+	}
+	hashed := common.HashRecoveryCode(code)
+	hashes := strings.Split(user.TwoFactorRecoveryCodes, ",")
+	remaining := make([]string, 0, len(hashes))
+	found := false
+	for _, h := range hashes {
+		if !found && h == hashed {
+			found = true
+			continue
+		}
+		remaining = append(remaining, h)
+	}
+	if !found {
+		return errors.New("驗證碼錯誤")
+	}
+	// 以舊值作為條件更新，避免並發請求重複使用同一恢復碼
+	result := DB.Model(&User{}).
+		Where("id = ? AND two_factor_recovery_codes = ?", user.Id, user.TwoFactorRecoveryCodes).
+		Update("two_factor_recovery_codes", strings.Join(remaining, ","))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("驗證碼錯誤")
+	}
+	user.TwoFactorRecoveryCodes = strings.Join(remaining, ",")
+	return nil
+}
+
+// RemainingRecoveryCodes 返回剩餘可用的恢復碼數量
+func (user *User) RemainingRecoveryCodes() int {
+	if user.TwoFactorRecoveryCodes == "" {
+		return 0
+	}
+	return len(strings.Split(user.TwoFactorRecoveryCodes, ","))
+}
+
+func hashRecoveryCodes(codes []string) string {
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = common.HashRecoveryCode(code)
+	}
+	return strings.Join(hashes, ",")
+}
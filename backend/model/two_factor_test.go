@@ -0,0 +1,139 @@
+package model
+
+import (
+	"account-system/common"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// totpCode 按 RFC 6238 計算指定時間步的驗證碼，模擬驗證器應用
+func totpCode(t *testing.T, secret string, step int64) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", value%1000000)
+}
+
+// enableTwoFactor 為用戶啟用兩步驗證，以 step 的驗證碼確認，返回密鑰和恢復碼
+func enableTwoFactor(t *testing.T, user *User, step int64) (string, []string) {
+	t.Helper()
+	secret, err := common.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = user.SetTwoFactorSecret(secret); err != nil {
+		t.Fatal(err)
+	}
+	codes, err := user.EnableTwoFactor(totpCode(t, secret, step))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return secret, codes
+}
+
+// TestTwoFactorReplay 同一時間步的驗證碼和同一恢復碼只能使用一次，早於最近一次使用的時間步同樣被拒絕
+func TestTwoFactorReplay(t *testing.T) {
+	user := createTestUser(t, "totp_replay")
+	current := time.Now().Unix() / common.TOTPPeriod
+	// 以上一個時間步的驗證碼啟用
+	secret, recoveryCodes := enableTwoFactor(t, user, current-1)
+	tests := []struct {
+		name   string
+		code   string
+		wantOk bool
+	}{
+		{name: "enabling code reused", code: totpCode(t, secret, current-1), wantOk: false},
+		{name: "current code", code: totpCode(t, secret, current), wantOk: true},
+		{name: "current code replayed", code: totpCode(t, secret, current), wantOk: false},
+		{name: "older code", code: totpCode(t, secret, current-1), wantOk: false},
+		{name: "next code", code: totpCode(t, secret, current+1), wantOk: true},
+		{name: "code outside skew", code: totpCode(t, secret, current+3), wantOk: false},
+		{name: "recovery code", code: recoveryCodes[0], wantOk: true},
+		{name: "recovery code replayed", code: recoveryCodes[0], wantOk: false},
+		{name: "another recovery code", code: recoveryCodes[1], wantOk: true},
+		{name: "wrong code", code: "000000", wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored, err := GetUserById(user.Id, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = stored.ValidateTwoFactorCode(tt.code); (err == nil) != tt.wantOk {
+				t.Fatalf("err = %v, want ok %v", err, tt.wantOk)
+			}
+		})
+	}
+}
+
+// TestTwoFactorConcurrentReplay 並發提交同一驗證碼或恢復碼時只有一個請求成功
+func TestTwoFactorConcurrentReplay(t *testing.T) {
+	current := time.Now().Unix() / common.TOTPPeriod
+	tests := []struct {
+		name string
+		code func(secret string, recoveryCodes []string) string
+	}{
+		{name: "totp code", code: func(secret string, _ []string) string { return totpCode(t, secret, current) }},
+		{name: "recovery code", code: func(_ string, recoveryCodes []string) string { return recoveryCodes[0] }},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := createTestUser(t, fmt.Sprintf("totp_concurrent_%d", i))
+			secret, recoveryCodes := enableTwoFactor(t, user, current-1)
+			code := tt.code(secret, recoveryCodes)
+			var succeeded int32
+			var wg sync.WaitGroup
+			for j := 0; j < 10; j++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					stored, err := GetUserById(user.Id, true)
+					if err == nil && stored.ValidateTwoFactorCode(code) == nil {
+						atomic.AddInt32(&succeeded, 1)
+					}
+				}()
+			}
+			wg.Wait()
+			if succeeded != 1 {
+				t.Fatalf("%d requests succeeded, want 1", succeeded)
+			}
+		})
+	}
+}
+
+// TestRecoveryCodeCount 啟用和重新生成時按 TwoFactorRecoveryCodeCount 生成恢復碼
+func TestRecoveryCodeCount(t *testing.T) {
+	defaultCount := common.TwoFactorRecoveryCodeCount
+	t.Cleanup(func() { common.TwoFactorRecoveryCodeCount = defaultCount })
+	current := time.Now().Unix() / common.TOTPPeriod
+	for i, count := range []int{1, 4, 16} {
+		t.Run(fmt.Sprint(count), func(t *testing.T) {
+			common.TwoFactorRecoveryCodeCount = count
+			user := createTestUser(t, fmt.Sprintf("recovery_count_%d", i))
+			_, codes := enableTwoFactor(t, user, current)
+			if len(codes) != count {
+				t.Fatalf("enable returned %d codes, want %d", len(codes), count)
+			}
+			stored, _ := GetUserById(user.Id, true)
+			if codes, _ = stored.RegenerateRecoveryCodes(); len(codes) != count {
+				t.Fatalf("regenerate returned %d codes, want %d", len(codes), count)
+			}
+		})
+	}
+}
@@ -1,24 +1,40 @@
 package model
 
 import (
+	"account-system/common"
 	"errors"
 	"gorm.io/gorm"
 	"strings"
-	"account-system/common"
+	"time"
 )
 
 // User 用戶模型
 type User struct {
-	Id               int            `json:"id"`
-	Username         string         `json:"username" gorm:"unique;index" validate:"max=12"`
-	Password         string         `json:"password" gorm:"not null;" validate:"min=8,max=20"`
-	DisplayName      string         `json:"display_name" gorm:"index" validate:"max=20"`
-	Role             int            `json:"role" gorm:"type:int;default:1"`   // admin, common
-	Status           int            `json:"status" gorm:"type:int;default:1"` // enabled, disabled
-	Email            string         `json:"email" gorm:"index" validate:"max=50"`
-	AccessToken      *string        `json:"access_token" gorm:"type:char(32);column:access_token;uniqueIndex"` // 系統管理令牌
-	DeletedAt        gorm.DeletedAt `gorm:"index"`
-	Setting          string         `json:"setting" gorm:"type:text;column:setting"`
+	Id                int            `json:"id"`
+	Username          string         `json:"username" gorm:"unique;index" validate:"max=12"`
+	Password          string         `json:"password" gorm:"not null;"` // 密碼規則見 ValidateNewPassword
+	DisplayName       string         `json:"display_name" gorm:"index" validate:"max=20"`
+	Role              int            `json:"role" gorm:"type:int;default:1"`   // 用戶等級，與所分配角色的等級一致
+	RoleId            int            `json:"role_id" gorm:"default:0;index"`   // 所分配的角色，權限由角色決定
+	Status            int            `json:"status" gorm:"type:int;default:1"` // enabled, disabled
+	Email             string         `json:"email" gorm:"index" validate:"max=50"`
+	EmailVerified     bool           `json:"email_verified" gorm:"default:false"`
+	AccessTokenHash   *string        `json:"-" gorm:"type:char(64);index"`                // 系統管理令牌哈希
+	AccessTokenPrefix string         `json:"access_token_prefix" gorm:"type:varchar(16)"` // 系統管理令牌可見前綴
+	Quota             int            `json:"quota" gorm:"type:int;default:0"`             // 帳戶額度，變化記錄在額度流水中
+	Group             string         `json:"group" gorm:"type:varchar(32);default:'default';index"`
+	DeletedAt         gorm.DeletedAt `gorm:"index"`
+	Setting           string         `json:"setting" gorm:"type:text;column:setting"`
+	// 兩步驗證
+	TwoFactorEnabled       bool   `json:"two_factor_enabled" gorm:"default:false"`
+	TwoFactorSecret        string `json:"-" gorm:"type:varchar(64)"`
+	TwoFactorLastStep      int64  `json:"-" gorm:"default:0"` // 最近一次使用的 TOTP 時間步，防止重放
+	TwoFactorRecoveryCodes string `json:"-" gorm:"type:text"` // 恢復碼哈希，以逗號分隔
+	// 登入失敗鎖定
+	FailedLoginCount    int        `json:"failed_login_count" gorm:"default:0"`
+	LastFailedLoginTime *time.Time `json:"last_failed_login_time" gorm:"type:timestamp"`
+	LockedUntil         *time.Time `json:"locked_until" gorm:"type:timestamp"`
+	Permissions         []string   `json:"permissions,omitempty" gorm:"-"` // 角色授予的權限，只在獲取自己的信息時返回
 }
 
 // UserBase 用戶基本信息，用於緩存
@@ -37,23 +53,33 @@ func (user *User) ToBaseUser() *UserBase {
 		Id:       user.Id,
 		Username: user.Username,
 		Status:   user.Status,
+		Group:    user.Group,
+		Quota:    user.Quota,
 		Email:    user.Email,
 	}
 	return cache
 }
 
-func (user *User) GetAccessToken() string {
-	if user.AccessToken == nil {
-		return ""
+// GenerateAccessToken 生成新的系統管理令牌並返回明文，數據庫只保存哈希，舊令牌隨即失效
+func (user *User) GenerateAccessToken() (string, error) {
+	if user.Id == 0 {
+		return "", errors.New("id 為空！")
+	}
+	token := common.GenerateTokenKey(common.TokenKeyTypeAccess)
+	hash := common.HashTokenKey(token)
+	err := DB.Model(user).Updates(map[string]interface{}{
+		"access_token_hash":   hash,
+		"access_token_prefix": common.TokenKeyPrefix(token),
+	}).Error
+	if err != nil {
+		return "", err
 	}
-	return *user.AccessToken
-}
-
-func (user *User) SetAccessToken(token string) {
-	user.AccessToken = &token
+	user.AccessTokenHash = &hash
+	user.AccessTokenPrefix = common.TokenKeyPrefix(token)
+	return token, nil
 }
 
-// Insert 插入新用戶
+// Insert 插入新用戶，並發放所在分組的默認額度
 func (user *User) Insert() error {
 	var err error
 	if user.Password != "" {
@@ -62,11 +88,22 @@ func (user *User) Insert() error {
 			return err
 		}
 	}
-	user.SetAccessToken(common.GetUUID())
-	result := DB.Create(user)
-	if result.Error != nil {
-		return result.Error
+	if user.Group == "" {
+		user.Group = common.DefaultUserGroup
+	}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		if err := user.joinBuiltinRole(tx); err != nil {
+			return err
+		}
+		return user.joinGroup(tx)
+	})
+	if err != nil {
+		return err
 	}
+	recordPasswordHistory(user.Id, user.Password)
 	return nil
 }
 
@@ -91,22 +128,51 @@ func (user *User) Update(updatePassword bool) error {
 	}
 
 	DB.First(&user, user.Id)
+	if user.Email != newUser.Email {
+		// 更換郵箱後需要重新驗證
+		updates["email_verified"] = false
+	}
 	if err = DB.Model(user).Updates(updates).Error; err != nil {
 		return err
 	}
+	if updatePassword {
+		recordPasswordHistory(user.Id, newUser.Password)
+	}
 
 	return nil
 }
 
-// Delete 刪除用戶
+// Delete 刪除用戶；用戶是組織唯一的所有者時拒絕刪除，需要先轉讓所有權或刪除組織
 func (user *User) Delete() error {
 	if user.Id == 0 {
 		return errors.New("id 為空！")
 	}
-	if err := DB.Delete(user).Error; err != nil {
-		return err
-	}
-	return nil
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var organizationIds []int
+		err := tx.Model(&OrganizationMember{}).
+			Where("user_id = ? AND role = ?", user.Id, common.OrganizationRoleOwner).
+			Pluck("organization_id", &organizationIds).Error
+		if err != nil {
+			return err
+		}
+		for _, organizationId := range organizationIds {
+			if err = ensureAnotherOwner(tx, organizationId, user.Id); err != nil {
+				return errors.New("用戶是組織唯一的所有者，請先轉讓所有權或刪除組織")
+			}
+		}
+		if err = tx.Delete(user).Error; err != nil {
+			return err
+		}
+		// 解除第三方身份和通行密鑰並撤銷會話、個人令牌和組織成員身份，避免已註銷用戶的憑證被繼續使用；
+		// 組織令牌屬於組織，不隨創建者刪除
+		for _, record := range []interface{}{&UserIdentity{}, &Passkey{}, &Session{}, &OAuth2Consent{}, &OAuth2RefreshToken{},
+			&PasswordHistory{}, &OrganizationMember{}, &OrganizationInvitation{}} {
+			if err = tx.Where("user_id = ?", user.Id).Delete(record).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Where("user_id = ? AND organization_id = 0", user.Id).Delete(&Token{}).Error
+	})
 }
 
 // ValidateAndFill 驗證用戶密碼並填充用戶信息
@@ -117,10 +183,24 @@ func (user *User) ValidateAndFill() (err error) {
 		return errors.New("用戶名或密碼為空")
 	}
 	// 通過用戶名或郵箱查找用戶
-	DB.Where("username = ? OR email = ?", username, username).First(user)
-	okay := common.ValidatePasswordAndHash(password, user.Password)
-	if !okay || user.Status != common.UserStatusEnabled {
-		return errors.New("用戶名或密碼錯誤，或用戶已被封禁")
+	err = DB.Where("username = ? OR email = ?", username, username).First(user).Error
+	if err != nil {
+		return errLoginFailed
+	}
+	now := time.Now()
+	if err = user.checkLoginLockout(now); err != nil {
+		return err
+	}
+	if err = user.reserveLoginAttempt(now); err != nil {
+		return err
+	}
+	if !common.ValidatePasswordAndHash(password, user.Password) {
+		user.recordLoginFailure(now)
+		return errLoginFailed
+	}
+	user.resetLoginFailures()
+	if user.Status != common.UserStatusEnabled {
+		return errLoginFailed
 	}
 	return nil
 }
@@ -149,6 +229,49 @@ func GetUserById(id int, selectAll bool) (*User, error) {
 	return &user, err
 }
 
+// GetUserByUsername 通過用戶名獲取用戶
+func GetUserByUsername(username string) (*User, error) {
+	if username == "" {
+		return nil, errors.New("用戶名為空！")
+	}
+	var user User
+	err := DB.Omit("password").First(&user, "username = ?", username).Error
+	return &user, err
+}
+
+// GetUserByEmail 通過郵箱獲取用戶
+func GetUserByEmail(email string) (*User, error) {
+	if email == "" {
+		return nil, errors.New("郵箱為空！")
+	}
+	var user User
+	err := DB.Omit("password").First(&user, "email = ?", email).Error
+	return &user, err
+}
+
+// ResetPassword 重置密碼，同時撤銷訪問令牌和所有會話
+func (user *User) ResetPassword(password string) error {
+	if user.Id == 0 {
+		return errors.New("id 為空！")
+	}
+	hashedPassword, err := common.Password2Hash(password)
+	if err != nil {
+		return err
+	}
+	err = DB.Model(user).Updates(map[string]interface{}{
+		"password":            hashedPassword,
+		"access_token_hash":   nil,
+		"access_token_prefix": "",
+	}).Error
+	if err != nil {
+		return err
+	}
+	user.AccessTokenHash = nil
+	user.AccessTokenPrefix = ""
+	recordPasswordHistory(user.Id, hashedPassword)
+	return RevokeUserSessions(user.Id, "")
+}
+
 // DeleteUserById 通過 ID 刪除用戶
 func DeleteUserById(id int) (err error) {
 	if id == 0 {
@@ -275,8 +398,11 @@ func ValidateAccessToken(token string) (user *User) {
 		return nil
 	}
 	token = strings.Replace(token, "Bearer ", "", 1)
+	if !common.IsTokenKeyWellFormed(token, common.TokenKeyTypeAccess) {
+		return nil
+	}
 	user = &User{}
-	if DB.Where("access_token = ?", token).First(user).RowsAffected == 1 {
+	if DB.Where("access_token_hash = ?", common.HashTokenKey(token)).First(user).RowsAffected == 1 {
 		return user
 	}
 	return nil
@@ -292,6 +418,20 @@ func IsUserEnabled(id int) (bool, error) {
 	return user.Status == common.UserStatusEnabled, nil
 }
 
+// GetTokenOwner 獲取令牌認證時需要的所有者狀態、分組和帳戶額度
+func GetTokenOwner(id int) (*User, error) {
+	var user User
+	err := DB.Where("id = ?", id).Select("id", "status", "group", "quota").First(&user).Error
+	return &user, err
+}
+
+// GetUserRoleAndStatus 獲取用戶當前的角色和狀態
+func GetUserRoleAndStatus(id int) (role int, status int, err error) {
+	var user User
+	err = DB.Where("id = ?", id).Select("role", "status").First(&user).Error
+	return user.Role, user.Status, err
+}
+
 // IsAdmin 檢查用戶是否為管理員
 func IsAdmin(id int) bool {
 	var user User
@@ -312,6 +452,59 @@ func IsRoot(id int) bool {
 	return user.Role >= common.RoleRootUser
 }
 
+// SetUserRole 將用戶的等級修改為 role，並分配該等級對應的內置角色
+func SetUserRole(id int, role int) error {
+	if !common.IsValidateRole(role) {
+		return errors.New("無效的角色")
+	}
+	roleId, err := builtinRoleId(DB, role)
+	if err != nil {
+		return err
+	}
+	return AssignUserRole(id, roleId)
+}
+
+// EnableUser 啟用用戶，禁用時被撤銷的令牌和會話不會恢復
+func EnableUser(id int) error {
+	result := DB.Model(&User{}).Where("id = ?", id).Update("status", common.UserStatusEnabled)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("用戶不存在")
+	}
+	return nil
+}
+
+// DisableUser 禁用用戶，並撤銷其所有會話、個人 API 令牌、系統管理令牌和 OAuth2 刷新令牌
+func DisableUser(id int) error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&User{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"status":              common.UserStatusDisabled,
+			"access_token_hash":   nil,
+			"access_token_prefix": "",
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("用戶不存在")
+		}
+		// 額度用盡的令牌在退還額度後會自動恢復，同樣需要禁用
+		err := tx.Model(&Token{}).
+			Where("user_id = ? AND organization_id = 0 AND status IN ?", id, []int{common.TokenStatusEnabled, common.TokenStatusExhausted}).
+			Update("status", common.TokenStatusDisabled).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", id).Delete(&OAuth2RefreshToken{}).Error
+	})
+	if err != nil {
+		return err
+	}
+	return RevokeUserSessions(id, "")
+}
+
 // GetMaxUserId 獲取最大用戶 ID
 func GetMaxUserId() int {
 	var user User
@@ -337,7 +530,7 @@ func createRootAccountIfNeed() error {
 			Role:        common.RoleRootUser,
 			Status:      common.UserStatusEnabled,
 			DisplayName: "Root User",
-			AccessToken: nil,
+			Group:       common.DefaultUserGroup,
 		}
 		DB.Create(&rootUser)
 	}
@@ -0,0 +1,113 @@
+package model
+
+import (
+	"account-system/common"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// VerificationCode 郵件驗證碼，按用途和目標（郵箱）保存，只保存哈希
+type VerificationCode struct {
+	Id          int       `json:"id"`
+	Purpose     string    `json:"purpose" gorm:"type:varchar(32);index:idx_purpose_target"`
+	Target      string    `json:"target" gorm:"type:varchar(255);index:idx_purpose_target"`
+	CodeHash    string    `json:"-" gorm:"type:char(64)"`
+	Attempts    int       `json:"attempts" gorm:"default:0"`
+	CreatedTime time.Time `json:"created_time" gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP"`
+	ExpiredTime time.Time `json:"expired_time" gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP;index"`
+}
+
+var ErrInvalidVerificationCode = errors.New("驗證碼錯誤或已過期")
+
+// normalizeVerificationTarget 郵箱不區分大小寫
+func normalizeVerificationTarget(target string) string {
+	return strings.ToLower(strings.TrimSpace(target))
+}
+
+// hashVerificationCode 哈希時綁定用途和目標，同一驗證碼不能用於其他用途
+func hashVerificationCode(purpose, target, code string) string {
+	sum := sha256.Sum256([]byte(purpose + ":" + target + ":" + strings.TrimSpace(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateVerificationCode 生成 6 位數字驗證碼，同一用途和目標之前的驗證碼隨即作廢；
+// 距上次發送不足冷卻時間時返回錯誤
+func CreateVerificationCode(purpose, target string) (string, error) {
+	target = normalizeVerificationTarget(target)
+	if purpose == "" || target == "" {
+		return "", errors.New("用途或目標為空")
+	}
+	var last VerificationCode
+	err := DB.Where("purpose = ? AND target = ?", purpose, target).Order("id desc").First(&last).Error
+	if err == nil {
+		wait := common.VerificationCodeResendCooldown - int64(time.Since(last.CreatedTime).Seconds())
+		if wait > 0 {
+			return "", fmt.Errorf("發送過於頻繁，請 %d 秒後再試", wait)
+		}
+	}
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+	now := time.Now()
+	record := &VerificationCode{
+		Purpose:     purpose,
+		Target:      target,
+		CodeHash:    hashVerificationCode(purpose, target, code),
+		CreatedTime: now,
+		ExpiredTime: now.Add(time.Duration(common.VerificationCodeLifetime) * time.Second),
+	}
+	// 順便清理已過期的驗證碼
+	DB.Where("expired_time <= ?", now).Delete(&VerificationCode{})
+	if err = DB.Where("purpose = ? AND target = ?", purpose, target).Delete(&VerificationCode{}).Error; err != nil {
+		return "", err
+	}
+	if err = DB.Create(record).Error; err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// ConsumeVerificationCode 校驗並消耗驗證碼，驗證碼只能使用一次，錯誤次數過多時作廢；
+// 比較前先原子地佔用一次嘗試次數，並發請求也不能超過最大嘗試次數
+func ConsumeVerificationCode(purpose, target, code string) error {
+	target = normalizeVerificationTarget(target)
+	var record VerificationCode
+	err := DB.Where("purpose = ? AND target = ? AND expired_time > ?", purpose, target, time.Now()).
+		Order("id desc").First(&record).Error
+	if err != nil {
+		return ErrInvalidVerificationCode
+	}
+	result := DB.Model(&VerificationCode{}).
+		Where("id = ? AND attempts < ?", record.Id, common.VerificationCodeMaxAttempts).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected != 1 {
+		DB.Delete(&record)
+		return ErrInvalidVerificationCode
+	}
+	expected := hashVerificationCode(purpose, target, code)
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(record.CodeHash)) != 1 {
+		return ErrInvalidVerificationCode
+	}
+	// 以刪除是否成功判斷驗證碼是否已被並發使用
+	result = DB.Delete(&record)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidVerificationCode
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package model
+
+import (
+	"account-system/common"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestConsumeVerificationCode(t *testing.T) {
+	purpose := common.EmailVerificationPurpose
+	tests := []struct {
+		name          string
+		wrongAttempts int
+		wantOK        bool
+	}{
+		{"first attempt", 0, true},
+		{"after wrong attempts", common.VerificationCodeMaxAttempts - 1, true},
+		{"attempts exhausted", common.VerificationCodeMaxAttempts, false},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := fmt.Sprintf("consume%d@example.com", i)
+			code, err := CreateVerificationCode(purpose, target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for j := 0; j < tt.wrongAttempts; j++ {
+				if ConsumeVerificationCode(purpose, target, "wrong") == nil {
+					t.Fatal("wrong code accepted")
+				}
+			}
+			if err = ConsumeVerificationCode(purpose, target, code); (err == nil) != tt.wantOK {
+				t.Fatalf("consume error = %v, want ok %v", err, tt.wantOK)
+			}
+			if ConsumeVerificationCode(purpose, target, code) == nil {
+				t.Fatal("code consumed twice")
+			}
+		})
+	}
+
+	t.Run("other purpose", func(t *testing.T) {
+		target := "purpose@example.com"
+		code, err := CreateVerificationCode(purpose, target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ConsumeVerificationCode(common.PasswordResetPurpose, target, code) == nil {
+			t.Fatal("code accepted for other purpose")
+		}
+	})
+}
+
+// TestConsumeVerificationCodeConcurrentAttempts 並發的錯誤嘗試不能超過最大嘗試次數
+func TestConsumeVerificationCodeConcurrentAttempts(t *testing.T) {
+	purpose := common.EmailVerificationPurpose
+	target := "concurrent@example.com"
+	code, err := CreateVerificationCode(purpose, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record VerificationCode
+	if err = DB.Where("purpose = ? AND target = ?", purpose, target).First(&record).Error; err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < common.VerificationCodeMaxAttempts*4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = ConsumeVerificationCode(purpose, target, "wrong")
+		}()
+	}
+	wg.Wait()
+	var attempts int
+	DB.Model(&VerificationCode{}).Select("attempts").Where("id = ?", record.Id).Scan(&attempts)
+	if attempts > common.VerificationCodeMaxAttempts {
+		t.Fatalf("attempts = %d, want at most %d", attempts, common.VerificationCodeMaxAttempts)
+	}
+	if ConsumeVerificationCode(purpose, target, code) == nil {
+		t.Fatal("code accepted after attempts were exhausted")
+	}
+}
@@ -1,6 +1,7 @@
 package router
 
 import (
+	"account-system/common"
 	"account-system/controller"
 	"account-system/middleware"
 	"github.com/gin-contrib/gzip"
@@ -18,7 +19,13 @@ func SetApiRouter(router *gin.Engine) {
 		{
 			// 公共路由
 			userRoute.POST("/register", middleware.CriticalRateLimit(), controller.Register)
+			userRoute.POST("/verification", middleware.CriticalRateLimit(), controller.SendEmailVerification)
 			userRoute.POST("/login", middleware.CriticalRateLimit(), controller.Login)
+			userRoute.POST("/login/2fa", middleware.CriticalRateLimit(), controller.LoginTwoFactor)
+			userRoute.POST("/passkey/login/begin", middleware.CriticalRateLimit(), controller.BeginPasskeyLogin)
+			userRoute.POST("/passkey/login/finish", middleware.CriticalRateLimit(), controller.FinishPasskeyLogin)
+			userRoute.POST("/reset_password/request", middleware.CriticalRateLimit(), controller.RequestPasswordReset)
+			userRoute.POST("/reset_password/confirm", middleware.CriticalRateLimit(), controller.ConfirmPasswordReset)
 			userRoute.GET("/logout", controller.Logout)
 
 			// 需要用戶認證的路由
@@ -29,18 +36,73 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.PUT("/self", controller.UpdateSelf)
 				selfRoute.DELETE("/self", controller.DeleteSelf)
 				selfRoute.GET("/token", controller.GenerateAccessToken)
+				selfRoute.POST("/redeem", middleware.CriticalRateLimit(), controller.Redeem)
+				selfRoute.GET("/quota/ledger", controller.GetSelfQuotaLedger)
+				selfRoute.GET("/2fa", controller.GetTwoFactorStatus)
+				selfRoute.POST("/2fa/setup", controller.SetupTwoFactor)
+				selfRoute.POST("/2fa/enable", middleware.CriticalRateLimit(), controller.EnableTwoFactor)
+				selfRoute.POST("/2fa/disable", middleware.CriticalRateLimit(), controller.DisableTwoFactor)
+				selfRoute.POST("/2fa/recovery_codes", middleware.CriticalRateLimit(), controller.RegenerateRecoveryCodes)
+				selfRoute.GET("/passkey", controller.GetPasskeys)
+				selfRoute.POST("/passkey/register/begin", controller.BeginPasskeyRegistration)
+				selfRoute.POST("/passkey/register/finish", controller.FinishPasskeyRegistration)
+				selfRoute.PUT("/passkey", controller.UpdatePasskey)
+				selfRoute.DELETE("/passkey/:id", controller.DeletePasskey)
+				selfRoute.GET("/identity", controller.GetSelfIdentities)
+				selfRoute.DELETE("/identity/:id", controller.DeleteSelfIdentity)
+				selfRoute.GET("/sessions", controller.GetSelfSessions)
+				selfRoute.DELETE("/sessions", controller.DeleteSelfSessions)
+				selfRoute.DELETE("/sessions/:id", controller.DeleteSelfSession)
 			}
 
-			// 需要管理員認證的路由
+			// 用戶管理路由，每個路由聲明所需的權限
 			adminRoute := userRoute.Group("/")
-			adminRoute.Use(middleware.AdminAuth())
 			{
-				adminRoute.GET("/", controller.GetAllUsers)
-				adminRoute.GET("/search", controller.SearchUsers)
-				adminRoute.GET("/:id", controller.GetUser)
-				adminRoute.POST("/", controller.CreateUser)
-				adminRoute.PUT("/", controller.UpdateUser)
-				adminRoute.DELETE("/:id", controller.DeleteUser)
+				adminRoute.GET("/", middleware.RequirePermission(common.PermissionUserRead), controller.GetAllUsers)
+				adminRoute.GET("/search", middleware.RequirePermission(common.PermissionUserRead), controller.SearchUsers)
+				adminRoute.GET("/:id", middleware.RequirePermission(common.PermissionUserRead), controller.GetUser)
+				adminRoute.POST("/", middleware.RequirePermission(common.PermissionUserCreate), controller.CreateUser)
+				adminRoute.PUT("/", middleware.RequirePermission(common.PermissionUserUpdate), controller.UpdateUser)
+				adminRoute.POST("/manage", middleware.RequirePermission(common.PermissionUserManage), controller.ManageUser)
+				adminRoute.POST("/role", middleware.RequirePermission(common.PermissionUserManage), controller.AssignUserRole)
+				adminRoute.DELETE("/:id", middleware.RequirePermission(common.PermissionUserDelete), controller.DeleteUser)
+				adminRoute.DELETE("/:id/2fa", middleware.RequirePermission(common.PermissionUserUpdate), controller.ResetUserTwoFactor)
+				adminRoute.DELETE("/:id/sessions", middleware.RequirePermission(common.PermissionUserManage), controller.DeleteUserSessions)
+				adminRoute.DELETE("/:id/lockout", middleware.RequirePermission(common.PermissionUserUpdate), controller.UnlockUser)
+			}
+		}
+
+		// 第三方登入相關路由
+		oauthRoute := apiRouter.Group("/oauth")
+		{
+			oauthRoute.GET("/providers", controller.GetOIDCProviders)
+			oauthRoute.GET("/:provider/authorize", middleware.CriticalRateLimit(), controller.OIDCAuthorize)
+			oauthRoute.GET("/:provider/callback", middleware.CriticalRateLimit(), controller.OIDCCallback)
+		}
+
+		// 身份提供方相關路由
+		oauth2Route := apiRouter.Group("/oauth2")
+		{
+			oauth2Route.GET("/jwks", controller.GetOAuth2JWKS)
+			oauth2Route.POST("/token", middleware.CriticalRateLimit(), controller.OAuth2Token)
+			oauth2Route.POST("/revoke", controller.OAuth2Revoke)
+			oauth2Route.POST("/introspect", controller.OAuth2Introspect)
+			oauth2Route.GET("/userinfo", controller.OAuth2UserInfo)
+			oauth2Route.POST("/userinfo", controller.OAuth2UserInfo)
+			oauth2Route.GET("/authorize", middleware.UserAuth(), controller.GetOAuth2Authorize)
+			oauth2Route.POST("/authorize", middleware.UserAuth(), controller.OAuth2Authorize)
+			oauth2Route.POST("/keys/rotate", middleware.RootAuth(), controller.RotateOAuth2SigningKey)
+
+			// 應用管理路由
+			clientRoute := oauth2Route.Group("/client")
+			clientRoute.Use(middleware.RequirePermission(common.PermissionOAuth2Manage))
+			{
+				clientRoute.GET("/", controller.GetAllOAuth2Clients)
+				clientRoute.GET("/:id", controller.GetOAuth2Client)
+				clientRoute.POST("/", controller.CreateOAuth2Client)
+				clientRoute.PUT("/", controller.UpdateOAuth2Client)
+				clientRoute.DELETE("/:id", controller.DeleteOAuth2Client)
+				clientRoute.POST("/:id/secret", controller.ResetOAuth2ClientSecret)
 			}
 		}
 
@@ -50,10 +112,98 @@ func SetApiRouter(router *gin.Engine) {
 		{
 			tokenRoute.GET("/", controller.GetAllTokens)
 			tokenRoute.GET("/search", controller.SearchTokens)
+			tokenRoute.GET("/usage", controller.GetSelfTokenUsages)
 			tokenRoute.GET("/:id", controller.GetToken)
 			tokenRoute.POST("/", controller.AddToken)
 			tokenRoute.PUT("/", controller.UpdateToken)
 			tokenRoute.DELETE("/:id", controller.DeleteToken)
+			tokenRoute.GET("/:id/ledger", controller.GetTokenQuotaLedger)
+			tokenRoute.POST("/:id/rotate", controller.RotateToken)
+		}
+
+		// 額度相關路由，供持有管理員訪問令牌的下游服務調用
+		quotaRoute := apiRouter.Group("/quota")
+		quotaRoute.Use(middleware.RequirePermission(common.PermissionQuotaManage))
+		{
+			quotaRoute.POST("/consume", controller.ConsumeQuota)
+			quotaRoute.POST("/refund", controller.RefundQuota)
+			quotaRoute.POST("/adjust", controller.AdjustQuota)
+			quotaRoute.GET("/audit/:id", controller.AuditTokenQuota)
+			quotaRoute.POST("/rebuild/:id", controller.RebuildTokenQuota)
+		}
+
+		// 兌換碼管理路由
+		redemptionRoute := apiRouter.Group("/redemption")
+		redemptionRoute.Use(middleware.RequirePermission(common.PermissionRedemptionManage))
+		{
+			redemptionRoute.GET("/", controller.GetAllRedemptionCodes)
+			redemptionRoute.POST("/", controller.GenerateRedemptionCodes)
+			redemptionRoute.PUT("/", controller.UpdateRedemptionCodeStatus)
+			redemptionRoute.DELETE("/:id", controller.DeleteRedemptionCode)
+			redemptionRoute.GET("/:id/redemptions", controller.GetRedemptions)
+		}
+
+		// 用戶分組管理路由
+		groupRoute := apiRouter.Group("/group")
+		groupRoute.Use(middleware.RequirePermission(common.PermissionGroupManage))
+		{
+			groupRoute.GET("/", controller.GetAllGroups)
+			groupRoute.POST("/", controller.CreateGroup)
+			groupRoute.PUT("/", controller.UpdateGroup)
+			groupRoute.DELETE("/:id", controller.DeleteGroup)
+			groupRoute.GET("/:id/members", controller.GetGroupMembers)
+			groupRoute.POST("/:id/members", controller.MoveGroupMembers)
+		}
+
+		// 角色管理路由
+		roleRoute := apiRouter.Group("/role")
+		{
+			roleRoute.GET("/", middleware.RequirePermission(common.PermissionRoleRead), controller.GetAllRoles)
+			roleRoute.GET("/permissions", middleware.RequirePermission(common.PermissionRoleRead), controller.GetPermissions)
+			roleRoute.POST("/", middleware.RequirePermission(common.PermissionRoleManage), controller.CreateRole)
+			roleRoute.PUT("/", middleware.RequirePermission(common.PermissionRoleManage), controller.UpdateRole)
+			roleRoute.DELETE("/:id", middleware.RequirePermission(common.PermissionRoleManage), controller.DeleteRole)
+		}
+
+		// 組織相關路由，組織內的權限由組織角色決定
+		orgRoute := apiRouter.Group("/org")
+		orgRoute.Use(middleware.UserAuth())
+		{
+			orgRoute.GET("/", controller.GetSelfOrganizations)
+			orgRoute.POST("/", controller.CreateOrganization)
+			orgRoute.GET("/invitations", controller.GetSelfOrganizationInvitations)
+			orgRoute.POST("/invitations/:id/accept", controller.AcceptOrganizationInvitation)
+			orgRoute.DELETE("/invitations/:id", controller.DeclineOrganizationInvitation)
+			orgRoute.GET("/:id", controller.GetOrganization)
+			orgRoute.PUT("/:id", controller.UpdateOrganization)
+			orgRoute.DELETE("/:id", controller.DeleteOrganization)
+			orgRoute.GET("/:id/members", controller.GetOrganizationMembers)
+			orgRoute.PUT("/:id/members", controller.UpdateOrganizationMember)
+			orgRoute.DELETE("/:id/members/:user_id", controller.RemoveOrganizationMember)
+			orgRoute.GET("/:id/invitations", controller.GetOrganizationInvitations)
+			orgRoute.POST("/:id/invitations", controller.InviteOrganizationMember)
+			orgRoute.DELETE("/:id/invitations/:invitation_id", controller.DeleteOrganizationInvitation)
+			orgRoute.GET("/:id/ledger", controller.GetOrganizationQuotaLedger)
+			orgRoute.GET("/:id/usage", controller.GetOrganizationTokenUsages)
+			orgRoute.POST("/:id/quota", middleware.RequirePermission(common.PermissionQuotaManage), controller.AdjustOrganizationQuota)
+		}
+
+		// 所有令牌的使用記錄
+		apiRouter.GET("/usage", middleware.RequirePermission(common.PermissionUsageRead), controller.GetAllTokenUsages)
+
+		// 通過 API 令牌訪問的路由，每個路由聲明所需的權限範圍
+		v1Route := apiRouter.Group("/v1")
+		v1Route.Use(middleware.TokenAuth())
+		{
+			v1Route.GET("/self", middleware.RequirePersonalToken(), middleware.RequireScopes(common.TokenScopeUserRead), controller.GetSelf)
+			v1Route.GET("/token", middleware.RequireScopes(common.TokenScopeTokenRead), controller.GetAllTokens)
+			v1Route.GET("/token/search", middleware.RequireScopes(common.TokenScopeTokenRead), controller.SearchTokens)
+			v1Route.GET("/token/:id", middleware.RequireScopes(common.TokenScopeTokenRead), controller.GetToken)
+			v1Route.POST("/token", middleware.RequireScopes(common.TokenScopeTokenWrite), controller.AddToken)
+			v1Route.PUT("/token", middleware.RequireScopes(common.TokenScopeTokenWrite), controller.UpdateToken)
+			v1Route.DELETE("/token/:id", middleware.RequireScopes(common.TokenScopeTokenWrite), controller.DeleteToken)
+			v1Route.POST("/token/:id/rotate", middleware.RequireScopes(common.TokenScopeTokenWrite), controller.RotateToken)
+			v1Route.POST("/quota/consume", middleware.RequireScopes(common.TokenScopeQuotaConsume), controller.ConsumeSelfQuota)
 		}
 	}
 }
@@ -1,6 +1,7 @@
 package router
 
 import (
+	"account-system/controller"
 	"embed"
 	"fmt"
 	"github.com/gin-gonic/gin"
@@ -13,6 +14,9 @@ import (
 func SetRouter(router *gin.Engine, buildFS embed.FS, indexPage []byte) {
 	// 設置 API 路由
 	SetApiRouter(router)
+
+	// OpenID Connect 發現文檔
+	router.GET("/.well-known/openid-configuration", controller.GetOpenIDConfiguration)
 	
 	// 設置 Web 路由
 	frontendBaseUrl := os.Getenv("FRONTEND_BASE_URL")
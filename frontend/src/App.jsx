@@ -8,8 +8,15 @@ import LoginForm from './components/LoginForm';
 import RegisterForm from './components/RegisterForm';
 import Profile from './pages/Profile';
 import Tokens from './pages/Tokens';
+import Organizations from './pages/Organizations';
 import AdminUsers from './pages/admin/Users';
+import AdminRedemptions from './pages/admin/Redemptions';
+import AdminGroups from './pages/admin/Groups';
+import AdminRoles from './pages/admin/Roles';
 import NotFound from './pages/NotFound';
+import OAuthCallback from './pages/OAuthCallback';
+import OAuthAuthorize from './pages/OAuthAuthorize';
+import ResetPassword from './pages/ResetPassword';
 
 function App() {
   return (
@@ -21,17 +28,28 @@ function App() {
           <Route path="/" element={<Home />} />
           <Route path="/login" element={<LoginForm />} />
           <Route path="/register" element={<RegisterForm />} />
+          <Route path="/reset" element={<ResetPassword />} />
+          <Route path="/oauth/:provider" element={<OAuthCallback />} />
           
           {/* 需要用戶認證的路由 */}
           <Route element={<ProtectedRoute />}>
             <Route path="/profile" element={<Profile />} />
             <Route path="/tokens" element={<Tokens />} />
+            <Route path="/organizations" element={<Organizations />} />
+            <Route path="/oauth2/authorize" element={<OAuthAuthorize />} />
           </Route>
           
           {/* 需要管理員認證的路由 */}
-          <Route element={<ProtectedRoute requiredRole={10} />}>
+          <Route element={<ProtectedRoute requiredPermission="user.read" />}>
             <Route path="/admin/users" element={<AdminUsers />} />
           </Route>
+          <Route element={<ProtectedRoute requiredPermission="role.read" />}>
+            <Route path="/admin/roles" element={<AdminRoles />} />
+          </Route>
+          <Route element={<ProtectedRoute requiredRole={10} />}>
+            <Route path="/admin/redemptions" element={<AdminRedemptions />} />
+            <Route path="/admin/groups" element={<AdminGroups />} />
+          </Route>
           
           {/* 404 頁面 */}
           <Route path="*" element={<NotFound />} />
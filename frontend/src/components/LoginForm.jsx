@@ -1,5 +1,5 @@
-import React, { useState, useContext } from 'react';
-import { Link, useNavigate } from 'react-router-dom';
+import React, { useState, useContext, useEffect } from 'react';
+import { Link, useLocation, useNavigate } from 'react-router-dom';
 import { AuthContext } from '../context/AuthContext';
 import { API, showError, showSuccess } from '../utils/api';
 
@@ -7,10 +7,42 @@ const LoginForm = () => {
   const [inputs, setInputs] = useState({
     username: '',
     password: '',
+    code: '',
   });
+  const location = useLocation();
+  const [require2fa, setRequire2fa] = useState(!!(location.state && location.state.require2fa));
+  const [providers, setProviders] = useState([]);
   const [loading, setLoading] = useState(false);
   const { login } = useContext(AuthContext);
   const navigate = useNavigate();
+  const from = location.state && location.state.from
+    ? location.state.from.pathname + location.state.from.search
+    : '/';
+
+  useEffect(() => {
+    API.get('/api/oauth/providers')
+      .then((res) => {
+        if (res.data.success) {
+          setProviders(res.data.data || []);
+        }
+      })
+      .catch((error) => console.error(error));
+  }, []);
+
+  const loginWithProvider = async (name) => {
+    try {
+      const res = await API.get(`/api/oauth/${name}/authorize`);
+      const { success, message, data } = res.data;
+      if (success) {
+        window.location.href = data;
+      } else {
+        showError(message);
+      }
+    } catch (error) {
+      showError('無法跳轉到第三方登入，請稍後重試');
+      console.error(error);
+    }
+  };
 
   const handleChange = (name, value) => {
     setInputs((inputs) => ({ ...inputs, [name]: value }));
@@ -18,6 +50,10 @@ const LoginForm = () => {
 
   const handleSubmit = async (e) => {
     e.preventDefault();
+    if (require2fa) {
+      await submitTwoFactor();
+      return;
+    }
     const { username, password } = inputs;
     
     if (!username || !password) {
@@ -33,10 +69,13 @@ const LoginForm = () => {
       });
       
       const { success, message, data } = res.data;
-      if (success) {
+      if (success && data && data.require_2fa) {
+        // 帳號已啟用兩步驗證，需要再輸入驗證碼
+        setRequire2fa(true);
+      } else if (success) {
         login(data);
         showSuccess('登入成功！');
-        navigate('/');
+        navigate(from);
       } else {
         showError(message);
       }
@@ -48,6 +87,36 @@ const LoginForm = () => {
     }
   };
 
+  const submitTwoFactor = async () => {
+    if (!inputs.code) {
+      showError('請輸入驗證碼或恢復碼！');
+      return;
+    }
+    setLoading(true);
+    try {
+      const res = await API.post('/api/user/login/2fa', {
+        code: inputs.code,
+      });
+      const { success, message, data } = res.data;
+      if (success) {
+        login(data);
+        showSuccess('登入成功！');
+        navigate(from);
+      } else {
+        showError(message);
+        if (message.includes('重新登入')) {
+          setRequire2fa(false);
+          handleChange('code', '');
+        }
+      }
+    } catch (error) {
+      showError('驗證失敗，請稍後重試');
+      console.error(error);
+    } finally {
+      setLoading(false);
+    }
+  };
+
   return (
     <div className="min-h-screen flex items-center justify-center bg-gray-50 py-12 px-4 sm:px-6 lg:px-8">
       <div className="max-w-md w-full space-y-8">
@@ -63,6 +132,24 @@ const LoginForm = () => {
           </p>
         </div>
         <form className="mt-8 space-y-6" onSubmit={handleSubmit}>
+          {require2fa ? (
+          <div className="rounded-md shadow-sm">
+            <label htmlFor="code" className="sr-only">
+              驗證碼
+            </label>
+            <input
+              id="code"
+              name="code"
+              type="text"
+              autoComplete="one-time-code"
+              required
+              className="appearance-none rounded-md relative block w-full px-3 py-2 border border-gray-300 placeholder-gray-500 text-gray-900 focus:outline-none focus:ring-blue-500 focus:border-blue-500 focus:z-10 sm:text-sm"
+              placeholder="驗證器應用中的 6 位驗證碼或恢復碼"
+              value={inputs.code}
+              onChange={(e) => handleChange('code', e.target.value)}
+            />
+          </div>
+          ) : (
           <div className="rounded-md shadow-sm -space-y-px">
             <div>
               <label htmlFor="username" className="sr-only">
@@ -95,6 +182,15 @@ const LoginForm = () => {
               />
             </div>
           </div>
+          )}
+
+          {!require2fa && (
+          <div className="text-right text-sm">
+            <Link to="/reset" className="font-medium text-blue-600 hover:text-blue-500">
+              忘記密碼？
+            </Link>
+          </div>
+          )}
 
           <div>
             <button
@@ -102,9 +198,24 @@ const LoginForm = () => {
               disabled={loading}
               className="group relative w-full flex justify-center py-2 px-4 border border-transparent text-sm font-medium rounded-md text-white bg-blue-600 hover:bg-blue-700 focus:outline-none focus:ring-2 focus:ring-offset-2 focus:ring-blue-500"
             >
-              {loading ? '登入中...' : '登入'}
+              {loading ? '登入中...' : require2fa ? '驗證' : '登入'}
             </button>
           </div>
+
+          {!require2fa && providers.length > 0 && (
+          <div className="space-y-2">
+            {providers.map((provider) => (
+              <button
+                key={provider.name}
+                type="button"
+                onClick={() => loginWithProvider(provider.name)}
+                className="w-full flex justify-center py-2 px-4 border border-gray-300 text-sm font-medium rounded-md text-gray-700 bg-white hover:bg-gray-50"
+              >
+                使用 {provider.display_name} 登入
+              </button>
+            ))}
+          </div>
+          )}
         </form>
       </div>
     </div>
@@ -1,6 +1,6 @@
 import React, { useState, useContext } from 'react';
 import { Link, useNavigate } from 'react-router-dom';
-import { AuthContext } from '../context/AuthContext';
+import { AuthContext, hasPermission } from '../context/AuthContext';
 
 const Navbar = () => {
   const { user, isAuthenticated, logout } = useContext(AuthContext);
@@ -43,7 +43,13 @@ const Navbar = () => {
                   >
                     API 令牌
                   </Link>
-                  {user && user.role >= 10 && (
+                  <Link
+                    to="/organizations"
+                    className="border-transparent text-gray-500 hover:border-gray-300 hover:text-gray-700 inline-flex items-center px-1 pt-1 border-b-2 text-sm font-medium"
+                  >
+                    組織
+                  </Link>
+                  {hasPermission(user, 'user.read') && (
                     <Link
                       to="/admin/users"
                       className="border-transparent text-gray-500 hover:border-gray-300 hover:text-gray-700 inline-flex items-center px-1 pt-1 border-b-2 text-sm font-medium"
@@ -51,6 +57,30 @@ const Navbar = () => {
                       用戶管理
                     </Link>
                   )}
+                  {hasPermission(user, 'role.read') && (
+                    <Link
+                      to="/admin/roles"
+                      className="border-transparent text-gray-500 hover:border-gray-300 hover:text-gray-700 inline-flex items-center px-1 pt-1 border-b-2 text-sm font-medium"
+                    >
+                      角色權限
+                    </Link>
+                  )}
+                  {user && user.role >= 10 && (
+                    <>
+                      <Link
+                        to="/admin/redemptions"
+                        className="border-transparent text-gray-500 hover:border-gray-300 hover:text-gray-700 inline-flex items-center px-1 pt-1 border-b-2 text-sm font-medium"
+                      >
+                        兌換碼
+                      </Link>
+                      <Link
+                        to="/admin/groups"
+                        className="border-transparent text-gray-500 hover:border-gray-300 hover:text-gray-700 inline-flex items-center px-1 pt-1 border-b-2 text-sm font-medium"
+                      >
+                        用戶分組
+                      </Link>
+                    </>
+                  )}
                 </>
               )}
             </div>
@@ -154,7 +184,14 @@ const Navbar = () => {
               >
                 API 令牌
               </Link>
-              {user && user.role >= 10 && (
+              <Link
+                to="/organizations"
+                className="block pl-3 pr-4 py-2 border-l-4 border-transparent text-base font-medium text-gray-600 hover:bg-gray-50 hover:border-gray-300 hover:text-gray-800"
+                onClick={() => setMobileMenuOpen(false)}
+              >
+                組織
+              </Link>
+              {hasPermission(user, 'user.read') && (
                 <Link
                   to="/admin/users"
                   className="block pl-3 pr-4 py-2 border-l-4 border-transparent text-base font-medium text-gray-600 hover:bg-gray-50 hover:border-gray-300 hover:text-gray-800"
@@ -163,6 +200,33 @@ const Navbar = () => {
                   用戶管理
                 </Link>
               )}
+              {hasPermission(user, 'role.read') && (
+                <Link
+                  to="/admin/roles"
+                  className="block pl-3 pr-4 py-2 border-l-4 border-transparent text-base font-medium text-gray-600 hover:bg-gray-50 hover:border-gray-300 hover:text-gray-800"
+                  onClick={() => setMobileMenuOpen(false)}
+                >
+                  角色權限
+                </Link>
+              )}
+              {user && user.role >= 10 && (
+                <Link
+                  to="/admin/redemptions"
+                  className="block pl-3 pr-4 py-2 border-l-4 border-transparent text-base font-medium text-gray-600 hover:bg-gray-50 hover:border-gray-300 hover:text-gray-800"
+                  onClick={() => setMobileMenuOpen(false)}
+                >
+                  兌換碼
+                </Link>
+              )}
+              {user && user.role >= 10 && (
+                <Link
+                  to="/admin/groups"
+                  className="block pl-3 pr-4 py-2 border-l-4 border-transparent text-base font-medium text-gray-600 hover:bg-gray-50 hover:border-gray-300 hover:text-gray-800"
+                  onClick={() => setMobileMenuOpen(false)}
+                >
+                  用戶分組
+                </Link>
+              )}
             </>
           )}
         </div>
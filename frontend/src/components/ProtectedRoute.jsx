@@ -1,16 +1,18 @@
 import React, { useContext } from 'react';
-import { Navigate, Outlet } from 'react-router-dom';
-import { AuthContext } from '../context/AuthContext';
+import { Navigate, Outlet, useLocation } from 'react-router-dom';
+import { AuthContext, hasPermission } from '../context/AuthContext';
 
-const ProtectedRoute = ({ requiredRole = 1 }) => {
+const ProtectedRoute = ({ requiredRole = 1, requiredPermission }) => {
   const { user, loading, isAuthenticated } = useContext(AuthContext);
+  const location = useLocation();
 
   if (loading) {
     return <div className="flex justify-center items-center h-screen">載入中...</div>;
   }
 
   if (!isAuthenticated) {
-    return <Navigate to="/login" replace />;
+    // 登入後返回原頁面
+    return <Navigate to="/login" state={{ from: location }} replace />;
   }
 
   // 檢查用戶角色是否滿足要求
@@ -18,6 +20,11 @@ const ProtectedRoute = ({ requiredRole = 1 }) => {
     return <Navigate to="/" replace />;
   }
 
+  // 檢查用戶角色是否授予所需權限
+  if (requiredPermission && !hasPermission(user, requiredPermission)) {
+    return <Navigate to="/" replace />;
+  }
+
   return <Outlet />;
 };
 
@@ -8,6 +8,7 @@ const RegisterForm = () => {
     password: '',
     confirmPassword: '',
     email: '',
+    verificationCode: '',
   });
   const [loading, setLoading] = useState(false);
   const navigate = useNavigate();
@@ -16,20 +17,34 @@ const RegisterForm = () => {
     setInputs((inputs) => ({ ...inputs, [name]: value }));
   };
 
+  const sendVerificationCode = async () => {
+    if (!inputs.email) {
+      showError('請輸入郵箱地址！');
+      return;
+    }
+    try {
+      const res = await API.post('/api/user/verification', { email: inputs.email });
+      const { success, message } = res.data;
+      if (success) {
+        showSuccess(message);
+      } else {
+        showError(message);
+      }
+    } catch (error) {
+      showError('發送失敗，請稍後重試');
+      console.error(error);
+    }
+  };
+
   const handleSubmit = async (e) => {
     e.preventDefault();
-    const { username, password, confirmPassword, email } = inputs;
+    const { username, password, confirmPassword, email, verificationCode } = inputs;
     
     if (!username || !password) {
       showError('請輸入用戶名和密碼！');
       return;
     }
     
-    if (password.length < 8) {
-      showError('密碼長度不得小於 8 位！');
-      return;
-    }
-    
     if (password !== confirmPassword) {
       showError('兩次輸入的密碼不一致！');
       return;
@@ -41,6 +56,7 @@ const RegisterForm = () => {
         username,
         password,
         email,
+        verification_code: verificationCode,
       });
       
       const { success, message } = res.data;
@@ -103,6 +119,30 @@ const RegisterForm = () => {
                 onChange={(e) => handleChange('email', e.target.value)}
               />
             </div>
+            {inputs.email && (
+            <div className="flex">
+              <label htmlFor="verificationCode" className="sr-only">
+                郵箱驗證碼
+              </label>
+              <input
+                id="verificationCode"
+                name="verificationCode"
+                type="text"
+                autoComplete="one-time-code"
+                className="appearance-none rounded-none relative block w-full px-3 py-2 border border-gray-300 placeholder-gray-500 text-gray-900 focus:outline-none focus:ring-blue-500 focus:border-blue-500 focus:z-10 sm:text-sm"
+                placeholder="郵箱驗證碼"
+                value={inputs.verificationCode}
+                onChange={(e) => handleChange('verificationCode', e.target.value)}
+              />
+              <button
+                type="button"
+                onClick={sendVerificationCode}
+                className="px-3 py-2 border border-gray-300 text-sm text-blue-600 bg-white hover:bg-gray-50 whitespace-nowrap"
+              >
+                發送驗證碼
+              </button>
+            </div>
+            )}
             <div>
               <label htmlFor="password" className="sr-only">
                 密碼
@@ -113,7 +153,7 @@ const RegisterForm = () => {
                 type="password"
                 required
                 className="appearance-none rounded-none relative block w-full px-3 py-2 border border-gray-300 placeholder-gray-500 text-gray-900 focus:outline-none focus:ring-blue-500 focus:border-blue-500 focus:z-10 sm:text-sm"
-                placeholder="密碼（至少 8 位）"
+                placeholder="密碼"
                 value={inputs.password}
                 onChange={(e) => handleChange('password', e.target.value)}
               />
@@ -3,6 +3,12 @@ import { API } from '../utils/api';
 
 export const AuthContext = createContext();
 
+// 檢查用戶的角色是否授予指定權限
+export const hasPermission = (user, permission) => {
+  const permissions = (user && user.permissions) || [];
+  return permissions.includes('*') || permissions.includes(permission);
+};
+
 export const AuthProvider = ({ children }) => {
   const [user, setUser] = useState(null);
   const [loading, setLoading] = useState(true);
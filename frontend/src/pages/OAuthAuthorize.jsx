@@ -0,0 +1,115 @@
+import React, { useEffect, useRef, useState } from 'react';
+import { useSearchParams } from 'react-router-dom';
+import { API, showError } from '../utils/api';
+
+const scopeDescriptions = {
+  openid: '確認您的身份',
+  profile: '讀取您的用戶名和顯示名稱',
+  email: '讀取您的郵箱地址',
+  offline_access: '在您離線時保持訪問',
+};
+
+const OAuthAuthorize = () => {
+  const [searchParams] = useSearchParams();
+  const [request, setRequest] = useState(null);
+  const [prompt, setPrompt] = useState('載入中...');
+  const [loading, setLoading] = useState(false);
+  const loaded = useRef(false);
+
+  const params = Object.fromEntries(searchParams.entries());
+
+  const submit = async (approve) => {
+    setLoading(true);
+    try {
+      const res = await API.post('/api/oauth2/authorize', { ...params, approve });
+      const { success, message, data } = res.data;
+      if (data && data.redirect) {
+        window.location.href = data.redirect;
+        return;
+      }
+      if (!success) {
+        showError(message);
+        setPrompt(message);
+      }
+    } catch (error) {
+      showError('授權失敗，請稍後重試');
+      console.error(error);
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  useEffect(() => {
+    if (loaded.current) {
+      return;
+    }
+    loaded.current = true;
+    const load = async () => {
+      try {
+        const res = await API.get(`/api/oauth2/authorize?${searchParams.toString()}`);
+        const { success, message, data } = res.data;
+        if (!success) {
+          if (data && data.redirect) {
+            window.location.href = data.redirect;
+            return;
+          }
+          setPrompt(message);
+          return;
+        }
+        if (data.consented) {
+          // 已授權過相同範圍，直接跳轉
+          await submit(true);
+          return;
+        }
+        setRequest(data);
+      } catch (error) {
+        setPrompt('無法載入授權信息，請稍後重試');
+        console.error(error);
+      }
+    };
+    load();
+  }, []);
+
+  if (!request) {
+    return (
+      <div className="min-h-screen flex items-center justify-center bg-gray-50">
+        <p className="text-gray-600">{prompt}</p>
+      </div>
+    );
+  }
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gray-50 py-12 px-4 sm:px-6 lg:px-8">
+      <div className="max-w-md w-full space-y-6 bg-white shadow rounded-lg p-6">
+        <h2 className="text-center text-2xl font-bold text-gray-900">
+          授權 {request.client_name}
+        </h2>
+        <p className="text-sm text-gray-600">該應用請求以下權限：</p>
+        <ul className="list-disc list-inside text-sm text-gray-700 space-y-1">
+          {request.scopes.map((scope) => (
+            <li key={scope}>{scopeDescriptions[scope] || scope}</li>
+          ))}
+        </ul>
+        <p className="text-xs text-gray-500 break-all">授權後將跳轉到 {request.redirect_uri}</p>
+        <div className="flex space-x-3">
+          <button
+            onClick={() => submit(false)}
+            disabled={loading}
+            className="flex-1 py-2 px-4 border border-gray-300 text-sm font-medium rounded-md text-gray-700 bg-white hover:bg-gray-50"
+          >
+            拒絕
+          </button>
+          <button
+            onClick={() => submit(true)}
+            disabled={loading}
+            className="flex-1 py-2 px-4 border border-transparent text-sm font-medium rounded-md text-white bg-blue-600 hover:bg-blue-700"
+          >
+            授權
+          </button>
+        </div>
+      </div>
+    </div>
+  );
+};
+
+export default OAuthAuthorize;
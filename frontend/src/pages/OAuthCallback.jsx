@@ -0,0 +1,58 @@
+import React, { useContext, useEffect, useRef, useState } from 'react';
+import { useNavigate, useParams, useSearchParams } from 'react-router-dom';
+import { AuthContext } from '../context/AuthContext';
+import { API, showError, showSuccess } from '../utils/api';
+
+const OAuthCallback = () => {
+  const { provider } = useParams();
+  const [searchParams] = useSearchParams();
+  const [prompt, setPrompt] = useState('處理中...');
+  const { login, isAuthenticated } = useContext(AuthContext);
+  const navigate = useNavigate();
+  // 避免開發模式下重複請求，授權碼只能使用一次
+  const handled = useRef(false);
+
+  useEffect(() => {
+    if (handled.current) {
+      return;
+    }
+    handled.current = true;
+    const sendCode = async () => {
+      try {
+        const res = await API.get(`/api/oauth/${provider}/callback?${searchParams.toString()}`);
+        const { success, message, data } = res.data;
+        if (!success) {
+          showError(message);
+          setPrompt(message);
+          navigate(isAuthenticated ? '/profile' : '/login');
+          return;
+        }
+        if (data && data.require_2fa) {
+          navigate('/login', { state: { require2fa: true } });
+        } else if (isAuthenticated) {
+          // 綁定流程
+          showSuccess(message);
+          navigate('/profile');
+        } else {
+          login(data);
+          showSuccess('登入成功！');
+          navigate('/');
+        }
+      } catch (error) {
+        console.error(error);
+        setPrompt('登入失敗，請稍後重試');
+        showError('登入失敗，請稍後重試');
+        navigate('/login');
+      }
+    };
+    sendCode();
+  }, []);
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gray-50">
+      <p className="text-gray-600">{prompt}</p>
+    </div>
+  );
+};
+
+export default OAuthCallback;
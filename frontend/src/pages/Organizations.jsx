@@ -0,0 +1,352 @@
+import React, { useState, useEffect, useContext } from 'react';
+import { AuthContext } from '../context/AuthContext';
+import { API, showError, showSuccess } from '../utils/api';
+
+const roleNames = {
+  owner: '所有者',
+  admin: '管理員',
+  member: '成員',
+};
+
+const roleRank = {
+  owner: 3,
+  admin: 2,
+  member: 1,
+};
+
+const Organizations = () => {
+  const { user } = useContext(AuthContext);
+  const [organizations, setOrganizations] = useState([]);
+  const [invitations, setInvitations] = useState([]);
+  const [loading, setLoading] = useState(true);
+  const [createInput, setCreateInput] = useState({ name: '', description: '' });
+  const [current, setCurrent] = useState(null);
+  const [members, setMembers] = useState([]);
+  const [pending, setPending] = useState([]);
+  const [ledger, setLedger] = useState([]);
+  const [inviteInput, setInviteInput] = useState({ username: '', role: 'member' });
+
+  // 加載所在的組織和收到的邀請
+  const loadOrganizations = async () => {
+    setLoading(true);
+    try {
+      const [orgRes, invitationRes] = await Promise.all([API.get('/api/org'), API.get('/api/org/invitations')]);
+      if (orgRes.data.success) {
+        setOrganizations(orgRes.data.data || []);
+      } else {
+        showError(orgRes.data.message);
+      }
+      if (invitationRes.data.success) {
+        setInvitations(invitationRes.data.data || []);
+      }
+    } catch (error) {
+      showError('加載組織失敗');
+      console.error(error);
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  // 加載組織詳情，管理員以上可以查看尚未處理的邀請
+  const loadOrganization = async (id) => {
+    try {
+      const res = await API.get(`/api/org/${id}`);
+      if (!res.data.success) {
+        showError(res.data.message);
+        return;
+      }
+      const org = res.data.data;
+      setCurrent(org);
+      const [memberRes, ledgerRes] = await Promise.all([API.get(`/api/org/${id}/members`), API.get(`/api/org/${id}/ledger`)]);
+      setMembers(memberRes.data.success ? memberRes.data.data || [] : []);
+      setLedger(ledgerRes.data.success ? ledgerRes.data.data || [] : []);
+      if (roleRank[org.role] >= roleRank.admin) {
+        const pendingRes = await API.get(`/api/org/${id}/invitations`);
+        setPending(pendingRes.data.success ? pendingRes.data.data || [] : []);
+      } else {
+        setPending([]);
+      }
+    } catch (error) {
+      showError('加載組織詳情失敗');
+      console.error(error);
+    }
+  };
+
+  useEffect(() => {
+    loadOrganizations();
+  }, []);
+
+  // 通用請求處理，成功後刷新列表和當前組織
+  const request = async (promise, failMessage) => {
+    try {
+      const res = await promise;
+      if (res.data.success) {
+        showSuccess(res.data.message);
+        loadOrganizations();
+        if (current) {
+          loadOrganization(current.id);
+        }
+        return true;
+      }
+      showError(res.data.message);
+    } catch (error) {
+      showError(failMessage);
+      console.error(error);
+    }
+    return false;
+  };
+
+  const createOrganization = async (e) => {
+    e.preventDefault();
+    if (await request(API.post('/api/org', createInput), '創建失敗')) {
+      setCreateInput({ name: '', description: '' });
+    }
+  };
+
+  const deleteOrganization = async () => {
+    if (!window.confirm('刪除組織會同時刪除組織的所有令牌，確定要刪除嗎？')) {
+      return;
+    }
+    if (await request(API.delete(`/api/org/${current.id}`), '刪除失敗')) {
+      setCurrent(null);
+    }
+  };
+
+  const invite = async (e) => {
+    e.preventDefault();
+    if (await request(API.post(`/api/org/${current.id}/invitations`, inviteInput), '邀請失敗')) {
+      setInviteInput({ username: '', role: 'member' });
+    }
+  };
+
+  const removeMember = async (member, self) => {
+    if (!window.confirm(self ? '確定要退出此組織嗎？' : `確定要移除 ${member.username} 嗎？`)) {
+      return;
+    }
+    if (await request(API.delete(`/api/org/${current.id}/members/${member.user_id}`), '移除失敗') && self) {
+      setCurrent(null);
+    }
+  };
+
+  const canManage = current && roleRank[current.role] >= roleRank.admin;
+
+  return (
+    <div className="max-w-6xl mx-auto py-8 px-4 sm:px-6 lg:px-8">
+      <h1 className="text-2xl font-bold text-gray-900 mb-6">組織</h1>
+
+      {invitations.length > 0 && (
+        <div className="mb-6 p-4 bg-blue-50 border border-blue-200 rounded-md">
+          <h2 className="text-sm font-medium text-blue-800 mb-2">收到的邀請</h2>
+          {invitations.map((invitation) => (
+            <div key={invitation.id} className="flex items-center justify-between text-sm py-1">
+              <span>
+                {invitation.organization_name}（{roleNames[invitation.role]}），
+                {new Date(invitation.expired_time).toLocaleString()} 前有效
+              </span>
+              <span className="space-x-2">
+                <button
+                  onClick={() => request(API.post(`/api/org/invitations/${invitation.id}/accept`), '接受失敗')}
+                  className="text-green-600 hover:text-green-900"
+                >
+                  接受
+                </button>
+                <button
+                  onClick={() => request(API.delete(`/api/org/invitations/${invitation.id}`), '拒絕失敗')}
+                  className="text-red-600 hover:text-red-900"
+                >
+                  拒絕
+                </button>
+              </span>
+            </div>
+          ))}
+        </div>
+      )}
+
+      <form onSubmit={createOrganization} className="mb-6 flex flex-wrap items-center gap-2">
+        <input
+          type="text"
+          value={createInput.name}
+          placeholder="組織名稱"
+          onChange={(e) => setCreateInput((prev) => ({ ...prev, name: e.target.value }))}
+          className="border border-gray-300 rounded-md py-2 px-3 text-sm focus:outline-none focus:ring-blue-500 focus:border-blue-500"
+        />
+        <input
+          type="text"
+          value={createInput.description}
+          placeholder="描述"
+          onChange={(e) => setCreateInput((prev) => ({ ...prev, description: e.target.value }))}
+          className="flex-1 min-w-0 border border-gray-300 rounded-md py-2 px-3 text-sm focus:outline-none focus:ring-blue-500 focus:border-blue-500"
+        />
+        <button type="submit" className="px-4 py-2 bg-blue-600 text-white rounded-md text-sm hover:bg-blue-700">
+          創建組織
+        </button>
+      </form>
+
+      {loading ? (
+        <div className="text-center py-4">載入中...</div>
+      ) : (
+        <div className="overflow-x-auto mb-8">
+          <table className="min-w-full divide-y divide-gray-200">
+            <thead className="bg-gray-50">
+              <tr>
+                {['名稱', '描述', '我的角色', '額度', '操作'].map((title) => (
+                  <th key={title} className="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">
+                    {title}
+                  </th>
+                ))}
+              </tr>
+            </thead>
+            <tbody className="bg-white divide-y divide-gray-200">
+              {organizations.map((org) => (
+                <tr key={org.id}>
+                  <td className="px-6 py-4 whitespace-nowrap text-sm font-medium text-gray-900">{org.name}</td>
+                  <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-500">{org.description || '-'}</td>
+                  <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-500">{roleNames[org.role]}</td>
+                  <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-500">{org.quota}</td>
+                  <td className="px-6 py-4 whitespace-nowrap text-sm font-medium">
+                    <button onClick={() => loadOrganization(org.id)} className="text-blue-600 hover:text-blue-900">
+                      查看
+                    </button>
+                  </td>
+                </tr>
+              ))}
+            </tbody>
+          </table>
+        </div>
+      )}
+
+      {current && (
+        <div>
+          <div className="flex items-center justify-between mb-4">
+            <h2 className="text-lg font-medium text-gray-900">
+              {current.name}（額度：{current.quota}）
+            </h2>
+            {current.role === 'owner' && (
+              <button onClick={deleteOrganization} className="px-3 py-1 bg-red-600 text-white rounded-md text-sm hover:bg-red-700">
+                刪除組織
+              </button>
+            )}
+          </div>
+
+          <table className="min-w-full divide-y divide-gray-200 mb-6">
+            <thead className="bg-gray-50">
+              <tr>
+                {['用戶', '角色', '加入時間', '操作'].map((title) => (
+                  <th key={title} className="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">
+                    {title}
+                  </th>
+                ))}
+              </tr>
+            </thead>
+            <tbody className="bg-white divide-y divide-gray-200">
+              {members.map((member) => {
+                const self = user && member.user_id === user.id;
+                return (
+                  <tr key={member.id}>
+                    <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-900">{member.username}</td>
+                    <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-500">
+                      {canManage ? (
+                        <select
+                          value={member.role}
+                          onChange={(e) =>
+                            request(API.put(`/api/org/${current.id}/members`, { user_id: member.user_id, role: e.target.value }), '修改失敗')
+                          }
+                          className="border border-gray-300 rounded-md py-1 px-2 text-sm"
+                        >
+                          {Object.keys(roleNames).map((role) => (
+                            <option key={role} value={role}>
+                              {roleNames[role]}
+                            </option>
+                          ))}
+                        </select>
+                      ) : (
+                        roleNames[member.role]
+                      )}
+                    </td>
+                    <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-500">{new Date(member.created_time).toLocaleString()}</td>
+                    <td className="px-6 py-4 whitespace-nowrap text-sm font-medium">
+                      {(canManage || self) && (
+                        <button onClick={() => removeMember(member, self)} className="text-red-600 hover:text-red-900">
+                          {self ? '退出' : '移除'}
+                        </button>
+                      )}
+                    </td>
+                  </tr>
+                );
+              })}
+            </tbody>
+          </table>
+
+          {canManage && (
+            <>
+              <h3 className="text-md font-medium text-gray-900 mb-2">邀請成員</h3>
+              <form onSubmit={invite} className="mb-4 flex flex-wrap items-center gap-2">
+                <input
+                  type="text"
+                  value={inviteInput.username}
+                  placeholder="用戶名"
+                  onChange={(e) => setInviteInput((prev) => ({ ...prev, username: e.target.value }))}
+                  className="flex-1 min-w-0 border border-gray-300 rounded-md py-2 px-3 text-sm focus:outline-none focus:ring-blue-500 focus:border-blue-500"
+                />
+                <select
+                  value={inviteInput.role}
+                  onChange={(e) => setInviteInput((prev) => ({ ...prev, role: e.target.value }))}
+                  className="border border-gray-300 rounded-md py-2 px-3 text-sm"
+                >
+                  {Object.keys(roleNames).map((role) => (
+                    <option key={role} value={role}>
+                      {roleNames[role]}
+                    </option>
+                  ))}
+                </select>
+                <button type="submit" className="px-4 py-2 bg-blue-600 text-white rounded-md text-sm hover:bg-blue-700">
+                  邀請
+                </button>
+              </form>
+              {pending.map((invitation) => (
+                <div key={invitation.id} className="flex items-center justify-between text-sm text-gray-600 py-1">
+                  <span>
+                    {invitation.username}（{roleNames[invitation.role]}）等待接受
+                  </span>
+                  <button
+                    onClick={() => request(API.delete(`/api/org/${current.id}/invitations/${invitation.id}`), '撤銷失敗')}
+                    className="text-red-600 hover:text-red-900"
+                  >
+                    撤銷
+                  </button>
+                </div>
+              ))}
+            </>
+          )}
+
+          <h3 className="text-md font-medium text-gray-900 mt-6 mb-2">額度流水</h3>
+          <table className="min-w-full divide-y divide-gray-200">
+            <thead className="bg-gray-50">
+              <tr>
+                {['時間', '類型', '變動', '餘額', '令牌', '原因'].map((title) => (
+                  <th key={title} className="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">
+                    {title}
+                  </th>
+                ))}
+              </tr>
+            </thead>
+            <tbody className="bg-white divide-y divide-gray-200">
+              {ledger.map((entry) => (
+                <tr key={entry.id}>
+                  <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-500">{new Date(entry.created_time).toLocaleString()}</td>
+                  <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-500">{entry.type}</td>
+                  <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-900">{entry.amount}</td>
+                  <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-500">{entry.balance_after}</td>
+                  <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-500">{entry.via_token_id || '-'}</td>
+                  <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-500">{entry.reason || '-'}</td>
+                </tr>
+              ))}
+            </tbody>
+          </table>
+        </div>
+      )}
+    </div>
+  );
+};
+
+export default Organizations;
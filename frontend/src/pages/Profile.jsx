@@ -38,11 +38,6 @@ const Profile = () => {
       return;
     }
     
-    if (password && password.length < 8) {
-      showError('密碼長度不得小於 8 位！');
-      return;
-    }
-    
     setLoading(true);
     try {
       const updateData = {
@@ -95,15 +90,15 @@ const Profile = () => {
       if (success) {
         showSuccess('生成成功！');
         
-        // 更新本地用戶信息
+        // 本地只保存前綴，明文令牌只顯示這一次
         const updatedUser = {
           ...user,
-          access_token: data,
+          access_token_prefix: data.slice(0, 8),
         };
         updateUser(updatedUser);
         
         // 顯示令牌
-        alert(`您的訪問令牌：${data}`);
+        alert(`您的訪問令牌（只顯示一次，請妥善保存）：${data}`);
       } else {
         showError(message);
       }
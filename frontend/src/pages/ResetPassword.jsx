@@ -0,0 +1,146 @@
+import React, { useState } from 'react';
+import { Link, useNavigate } from 'react-router-dom';
+import { API, showError, showSuccess } from '../utils/api';
+
+const inputClass =
+  'appearance-none rounded-md relative block w-full px-3 py-2 border border-gray-300 placeholder-gray-500 text-gray-900 focus:outline-none focus:ring-blue-500 focus:border-blue-500 focus:z-10 sm:text-sm';
+
+const ResetPassword = () => {
+  const [inputs, setInputs] = useState({
+    email: '',
+    code: '',
+    password: '',
+  });
+  const [codeSent, setCodeSent] = useState(false);
+  const [loading, setLoading] = useState(false);
+  const navigate = useNavigate();
+
+  const handleChange = (name, value) => {
+    setInputs((inputs) => ({ ...inputs, [name]: value }));
+  };
+
+  const requestCode = async () => {
+    if (!inputs.email) {
+      showError('請輸入郵箱地址！');
+      return;
+    }
+    setLoading(true);
+    try {
+      const res = await API.post('/api/user/reset_password/request', { email: inputs.email });
+      const { success, message } = res.data;
+      if (success) {
+        showSuccess(message);
+        setCodeSent(true);
+      } else {
+        showError(message);
+      }
+    } catch (error) {
+      showError('發送失敗，請稍後重試');
+      console.error(error);
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  const confirmReset = async () => {
+    if (!inputs.code || !inputs.password) {
+      showError('請輸入驗證碼和新密碼！');
+      return;
+    }
+    setLoading(true);
+    try {
+      const res = await API.post('/api/user/reset_password/confirm', inputs);
+      const { success, message } = res.data;
+      if (success) {
+        showSuccess(message);
+        navigate('/login');
+      } else {
+        showError(message);
+      }
+    } catch (error) {
+      showError('重置失敗，請稍後重試');
+      console.error(error);
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  const handleSubmit = async (e) => {
+    e.preventDefault();
+    if (codeSent) {
+      await confirmReset();
+    } else {
+      await requestCode();
+    }
+  };
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gray-50 py-12 px-4 sm:px-6 lg:px-8">
+      <div className="max-w-md w-full space-y-8">
+        <div>
+          <h2 className="mt-6 text-center text-3xl font-extrabold text-gray-900">
+            重置密碼
+          </h2>
+          <p className="mt-2 text-center text-sm text-gray-600">
+            想起密碼了？{' '}
+            <Link to="/login" className="font-medium text-blue-600 hover:text-blue-500">
+              返回登入
+            </Link>
+          </p>
+        </div>
+        <form className="mt-8 space-y-4" onSubmit={handleSubmit}>
+          <input
+            type="email"
+            required
+            className={inputClass}
+            placeholder="註冊時使用的郵箱"
+            value={inputs.email}
+            disabled={codeSent}
+            onChange={(e) => handleChange('email', e.target.value)}
+          />
+          {codeSent && (
+            <>
+              <input
+                type="text"
+                autoComplete="one-time-code"
+                required
+                className={inputClass}
+                placeholder="郵件中的 6 位驗證碼"
+                value={inputs.code}
+                onChange={(e) => handleChange('code', e.target.value)}
+              />
+              <input
+                type="password"
+                autoComplete="new-password"
+                required
+                className={inputClass}
+                placeholder="新密碼"
+                value={inputs.password}
+                onChange={(e) => handleChange('password', e.target.value)}
+              />
+            </>
+          )}
+          <button
+            type="submit"
+            disabled={loading}
+            className="group relative w-full flex justify-center py-2 px-4 border border-transparent text-sm font-medium rounded-md text-white bg-blue-600 hover:bg-blue-700 focus:outline-none focus:ring-2 focus:ring-offset-2 focus:ring-blue-500"
+          >
+            {codeSent ? '重置密碼' : '發送驗證碼'}
+          </button>
+          {codeSent && (
+            <button
+              type="button"
+              disabled={loading}
+              onClick={requestCode}
+              className="w-full text-sm text-blue-600 hover:text-blue-500"
+            >
+              重新發送驗證碼
+            </button>
+          )}
+        </form>
+      </div>
+    </div>
+  );
+};
+
+export default ResetPassword;
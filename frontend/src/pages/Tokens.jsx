@@ -1,21 +1,41 @@
-import React, { useState, useEffect } from 'react';
+import React, { useState, useEffect, useContext } from 'react';
+import { AuthContext } from '../context/AuthContext';
 import { API, showError, showSuccess } from '../utils/api';
 
+const builtinScopes = ['user:read', 'token:read', 'token:write'];
+
 const Tokens = () => {
+  const { user } = useContext(AuthContext);
+  // 只有管理員可以設置初始額度和無限額度
+  const isAdmin = user && user.role >= 10;
   const [tokens, setTokens] = useState([]);
   const [loading, setLoading] = useState(true);
   const [modalOpen, setModalOpen] = useState(false);
+  const [createdKey, setCreatedKey] = useState('');
+  const [accountQuota, setAccountQuota] = useState(0);
+  const [redeemInput, setRedeemInput] = useState({ code: '', tokenId: 0 });
+  const [organizations, setOrganizations] = useState([]);
+  const [organizationId, setOrganizationId] = useState(0);
   const [tokenInput, setTokenInput] = useState({
     name: '',
     remainQuota: 0,
     unlimitedQuota: false,
+    useAccountQuota: false,
+    scopes: '',
+    allowedIps: '',
+    rateLimitNum: 0,
+    rateLimitDuration: 60,
+    expiredTime: '',
+    neverExpire: false,
   });
 
   // 加載令牌列表
   const loadTokens = async () => {
     setLoading(true);
     try {
-      const res = await API.get('/api/token');
+      const res = await API.get('/api/token', {
+        params: organizationId ? { organization_id: organizationId } : {},
+      });
       if (res.data.success) {
         setTokens(res.data.data);
       } else {
@@ -29,10 +49,61 @@ const Tokens = () => {
     }
   };
 
+  // 加載帳戶額度
+  const loadAccountQuota = async () => {
+    try {
+      const res = await API.get('/api/user/self');
+      if (res.data.success) {
+        setAccountQuota(res.data.data.quota || 0);
+      }
+    } catch (error) {
+      console.error(error);
+    }
+  };
+
+  // 加載當前用戶所在的組織
+  const loadOrganizations = async () => {
+    try {
+      const res = await API.get('/api/org');
+      if (res.data.success) {
+        setOrganizations(res.data.data || []);
+      }
+    } catch (error) {
+      console.error(error);
+    }
+  };
+
   useEffect(() => {
-    loadTokens();
+    loadAccountQuota();
+    loadOrganizations();
   }, []);
 
+  useEffect(() => {
+    loadTokens();
+  }, [organizationId]);
+
+  // 使用兌換碼充值到帳戶或令牌
+  const redeem = async (e) => {
+    e.preventDefault();
+    try {
+      const res = await API.post('/api/user/redeem', {
+        code: redeemInput.code.trim(),
+        token_id: parseInt(redeemInput.tokenId) || 0,
+      });
+      if (res.data.success) {
+        showSuccess(res.data.message);
+        setRedeemInput({ code: '', tokenId: 0 });
+        loadTokens();
+        loadAccountQuota();
+      } else {
+        showError(res.data.message);
+      }
+    } catch (error) {
+      showError('兌換失敗');
+      console.error(error);
+    }
+  };
+
   // 處理輸入變化
   const handleInputChange = (name, value) => {
     setTokenInput((prev) => ({ ...prev, [name]: value }));
@@ -41,14 +112,38 @@ const Tokens = () => {
   // 創建新令牌
   const createToken = async () => {
     try {
-      const res = await API.post('/api/token', tokenInput);
+      const res = await API.post('/api/token', {
+        ...tokenInput,
+        scopes: tokenInput.scopes.split(/[\s,]+/).filter(Boolean),
+        allowed_ips: tokenInput.allowedIps.split(/[\s,]+/).filter(Boolean),
+        rate_limit_num: tokenInput.rateLimitNum || 0,
+        rate_limit_duration: tokenInput.rateLimitDuration || 0,
+        remain_quota: isAdmin ? tokenInput.remainQuota || 0 : 0,
+        unlimited_quota: isAdmin && tokenInput.unlimitedQuota,
+        use_account_quota: !organizationId && tokenInput.useAccountQuota,
+        organization_id: organizationId,
+        // 未選擇過期時間時由服務端按有效期限制設置默認值
+        expired_time:
+          !tokenInput.neverExpire && tokenInput.expiredTime
+            ? new Date(tokenInput.expiredTime).toISOString()
+            : undefined,
+        never_expire: tokenInput.neverExpire,
+      });
       if (res.data.success) {
         showSuccess('創建成功');
+        setCreatedKey(res.data.data.key);
         setModalOpen(false);
         setTokenInput({
           name: '',
           remainQuota: 0,
           unlimitedQuota: false,
+          useAccountQuota: false,
+          scopes: '',
+          allowedIps: '',
+          rateLimitNum: 0,
+          rateLimitDuration: 60,
+          expiredTime: '',
+          neverExpire: false,
         });
         loadTokens();
       } else {
@@ -80,6 +175,27 @@ const Tokens = () => {
     }
   };
 
+  // 輪換令牌密鑰，舊密鑰在默認寬限期內仍然有效
+  const rotateToken = async (id) => {
+    if (!window.confirm('確定要輪換此令牌嗎？舊令牌將在寬限期結束後失效')) {
+      return;
+    }
+
+    try {
+      const res = await API.post(`/api/token/${id}/rotate`);
+      if (res.data.success) {
+        setCreatedKey(res.data.data.key);
+        showSuccess('輪換成功');
+        loadTokens();
+      } else {
+        showError(res.data.message);
+      }
+    } catch (error) {
+      showError('輪換失敗');
+      console.error(error);
+    }
+  };
+
   // 更新令牌狀態
   const updateTokenStatus = async (id, status) => {
     try {
@@ -107,6 +223,18 @@ const Tokens = () => {
     <div className="max-w-6xl mx-auto py-8 px-4 sm:px-6 lg:px-8">
       <div className="flex justify-between items-center mb-6">
         <h1 className="text-2xl font-bold text-gray-900">API 令牌管理</h1>
+        <select
+          value={organizationId}
+          onChange={(e) => setOrganizationId(parseInt(e.target.value) || 0)}
+          className="ml-auto mr-2 border border-gray-300 rounded-md py-2 px-3 text-sm"
+        >
+          <option value={0}>個人令牌</option>
+          {organizations.map((org) => (
+            <option key={org.id} value={org.id}>
+              組織：{org.name}
+            </option>
+          ))}
+        </select>
         <button
           onClick={() => setModalOpen(true)}
           className="px-4 py-2 bg-blue-600 text-white rounded-md hover:bg-blue-700 focus:outline-none focus:ring-2 focus:ring-offset-2 focus:ring-blue-500"
@@ -115,6 +243,61 @@ const Tokens = () => {
         </button>
       </div>
 
+      <form onSubmit={redeem} className="mb-6 flex flex-wrap items-center gap-2">
+        <span className="text-sm text-gray-700">帳戶額度：{accountQuota}</span>
+        <input
+          type="text"
+          value={redeemInput.code}
+          placeholder="輸入兌換碼"
+          onChange={(e) => setRedeemInput((prev) => ({ ...prev, code: e.target.value }))}
+          className="flex-1 min-w-0 border border-gray-300 rounded-md py-2 px-3 text-sm focus:outline-none focus:ring-blue-500 focus:border-blue-500"
+        />
+        <select
+          value={redeemInput.tokenId}
+          onChange={(e) => setRedeemInput((prev) => ({ ...prev, tokenId: e.target.value }))}
+          className="border border-gray-300 rounded-md py-2 px-3 text-sm"
+        >
+          <option value={0}>充值到帳戶</option>
+          {tokens.map((token) => (
+            <option key={token.id} value={token.id}>
+              充值到令牌 {token.name}
+            </option>
+          ))}
+        </select>
+        <button
+          type="submit"
+          className="px-4 py-2 bg-green-600 text-white rounded-md text-sm hover:bg-green-700"
+        >
+          兌換
+        </button>
+      </form>
+
+      {createdKey && (
+        <div className="mb-6 p-4 bg-yellow-50 border border-yellow-200 rounded-md">
+          <p className="text-sm text-yellow-800">
+            請立即複製並保存新令牌，關閉後將無法再次查看：
+          </p>
+          <div className="mt-2 flex items-center">
+            <code className="font-mono text-sm break-all">{createdKey}</code>
+            <button
+              onClick={() => {
+                navigator.clipboard.writeText(createdKey);
+                showSuccess('已複製到剪貼板');
+              }}
+              className="ml-2 text-blue-600 hover:text-blue-800"
+            >
+              複製
+            </button>
+            <button
+              onClick={() => setCreatedKey('')}
+              className="ml-2 text-gray-600 hover:text-gray-800"
+            >
+              關閉
+            </button>
+          </div>
+        </div>
+      )}
+
       {loading ? (
         <div className="text-center py-4">載入中...</div>
       ) : tokens.length === 0 ? (
@@ -130,6 +313,9 @@ const Tokens = () => {
                 <th className="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">
                   令牌
                 </th>
+                <th className="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">
+                  權限範圍
+                </th>
                 <th className="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">
                   狀態
                 </th>
@@ -151,18 +337,24 @@ const Tokens = () => {
                     {token.name}
                   </td>
                   <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-500">
-                    <div className="flex items-center">
-                      <span className="truncate max-w-xs">{token.key}</span>
-                      <button
-                        onClick={() => {
-                          navigator.clipboard.writeText(token.key);
-                          showSuccess('已複製到剪貼板');
-                        }}
-                        className="ml-2 text-blue-600 hover:text-blue-800"
-                      >
-                        複製
-                      </button>
-                    </div>
+                    <span className="font-mono">{token.key_prefix}…</span>
+                    {token.previous_key_prefix && (
+                      <div className="text-xs text-gray-400">
+                        舊令牌 <span className="font-mono">{token.previous_key_prefix}…</span> 有效至{' '}
+                        {new Date(token.previous_key_expired_time).toLocaleString()}
+                      </div>
+                    )}
+                  </td>
+                  <td className="px-6 py-4 text-sm text-gray-500">
+                    {token.scopes && token.scopes.length > 0 ? token.scopes.join(' ') : '無'}
+                    {token.allowed_ips && token.allowed_ips.length > 0 && (
+                      <div className="text-xs text-gray-400">IP：{token.allowed_ips.join(' ')}</div>
+                    )}
+                    {token.rate_limit_num > 0 && (
+                      <div className="text-xs text-gray-400">
+                        限速：{token.rate_limit_num} 次 / {token.rate_limit_duration} 秒
+                      </div>
+                    )}
                   </td>
                   <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-500">
                     <span
@@ -176,10 +368,15 @@ const Tokens = () => {
                     </span>
                   </td>
                   <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-500">
-                    {token.unlimited_quota ? '無限制' : token.remain_quota}
+                    {token.organization_id ? '組織額度' : token.use_account_quota ? '帳戶額度' : token.unlimited_quota ? '無限制' : token.remain_quota}
                   </td>
                   <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-500">
                     {new Date(token.created_time).toLocaleString()}
+                    <div className="text-xs text-gray-400">
+                      {token.never_expire
+                        ? '永不過期'
+                        : `過期：${new Date(token.expired_time).toLocaleString()}`}
+                    </div>
                   </td>
                   <td className="px-6 py-4 whitespace-nowrap text-sm font-medium">
                     <div className="flex space-x-2">
@@ -198,6 +395,12 @@ const Tokens = () => {
                           啟用
                         </button>
                       )}
+                      <button
+                        onClick={() => rotateToken(token.id)}
+                        className="text-blue-600 hover:text-blue-900"
+                      >
+                        輪換
+                      </button>
                       <button
                         onClick={() => deleteToken(token.id)}
                         className="text-red-600 hover:text-red-900"
@@ -238,9 +441,95 @@ const Tokens = () => {
                   type="number"
                   value={tokenInput.remainQuota}
                   onChange={(e) => handleInputChange('remainQuota', parseInt(e.target.value))}
-                  disabled={tokenInput.unlimitedQuota}
+                  disabled={!isAdmin || tokenInput.unlimitedQuota || tokenInput.useAccountQuota || organizationId !== 0}
+                  className="mt-1 block w-full border border-gray-300 rounded-md shadow-sm py-2 px-3 focus:outline-none focus:ring-blue-500 focus:border-blue-500 sm:text-sm"
+                />
+                {!isAdmin && (
+                  <p className="mt-1 text-xs text-gray-500">令牌額度通過兌換碼充值，或勾選使用帳戶額度</p>
+                )}
+              </div>
+              <div className="mt-4">
+                <label className="block text-sm font-medium text-gray-700">
+                  權限範圍
+                </label>
+                <input
+                  type="text"
+                  value={tokenInput.scopes}
+                  placeholder={builtinScopes.join(' ')}
+                  onChange={(e) => handleInputChange('scopes', e.target.value)}
                   className="mt-1 block w-full border border-gray-300 rounded-md shadow-sm py-2 px-3 focus:outline-none focus:ring-blue-500 focus:border-blue-500 sm:text-sm"
                 />
+                <p className="mt-1 text-xs text-gray-500">
+                  以空格分隔，可用內置範圍 {builtinScopes.join('、')}，或自定義的「服務:操作」範圍
+                </p>
+              </div>
+              <div className="mt-4">
+                <label className="block text-sm font-medium text-gray-700">
+                  IP 白名單
+                </label>
+                <input
+                  type="text"
+                  value={tokenInput.allowedIps}
+                  placeholder="203.0.113.7 10.0.0.0/8"
+                  onChange={(e) => handleInputChange('allowedIps', e.target.value)}
+                  className="mt-1 block w-full border border-gray-300 rounded-md shadow-sm py-2 px-3 focus:outline-none focus:ring-blue-500 focus:border-blue-500 sm:text-sm"
+                />
+                <p className="mt-1 text-xs text-gray-500">
+                  以空格分隔的 IP 或 CIDR 網段，留空表示不限制
+                </p>
+              </div>
+              <div className="mt-4">
+                <label className="block text-sm font-medium text-gray-700">
+                  速率限制
+                </label>
+                <div className="mt-1 flex items-center space-x-2">
+                  <input
+                    type="number"
+                    min="0"
+                    value={tokenInput.rateLimitNum}
+                    onChange={(e) => handleInputChange('rateLimitNum', parseInt(e.target.value))}
+                    className="block w-full border border-gray-300 rounded-md shadow-sm py-2 px-3 focus:outline-none focus:ring-blue-500 focus:border-blue-500 sm:text-sm"
+                  />
+                  <span className="text-sm text-gray-500 whitespace-nowrap">次 /</span>
+                  <input
+                    type="number"
+                    min="1"
+                    value={tokenInput.rateLimitDuration}
+                    onChange={(e) => handleInputChange('rateLimitDuration', parseInt(e.target.value))}
+                    className="block w-full border border-gray-300 rounded-md shadow-sm py-2 px-3 focus:outline-none focus:ring-blue-500 focus:border-blue-500 sm:text-sm"
+                  />
+                  <span className="text-sm text-gray-500">秒</span>
+                </div>
+                <p className="mt-1 text-xs text-gray-500">
+                  請求次數為 0 表示不限制
+                </p>
+              </div>
+              <div className="mt-4">
+                <label className="block text-sm font-medium text-gray-700">
+                  過期時間
+                </label>
+                <input
+                  type="datetime-local"
+                  value={tokenInput.expiredTime}
+                  onChange={(e) => handleInputChange('expiredTime', e.target.value)}
+                  disabled={tokenInput.neverExpire}
+                  className="mt-1 block w-full border border-gray-300 rounded-md shadow-sm py-2 px-3 focus:outline-none focus:ring-blue-500 focus:border-blue-500 sm:text-sm"
+                />
+                <div className="mt-2 flex items-center">
+                  <input
+                    type="checkbox"
+                    id="neverExpire"
+                    checked={tokenInput.neverExpire}
+                    onChange={(e) => handleInputChange('neverExpire', e.target.checked)}
+                    className="h-4 w-4 text-blue-600 focus:ring-blue-500 border-gray-300 rounded"
+                  />
+                  <label htmlFor="neverExpire" className="ml-2 block text-sm text-gray-900">
+                    永不過期
+                  </label>
+                </div>
+                <p className="mt-1 text-xs text-gray-500">
+                  留空時使用系統允許的最長有效期
+                </p>
               </div>
               <div className="mt-4 flex items-center">
                 <input
@@ -248,12 +537,26 @@ const Tokens = () => {
                   id="unlimitedQuota"
                   checked={tokenInput.unlimitedQuota}
                   onChange={(e) => handleInputChange('unlimitedQuota', e.target.checked)}
+                  disabled={!isAdmin || organizationId !== 0}
                   className="h-4 w-4 text-blue-600 focus:ring-blue-500 border-gray-300 rounded"
                 />
                 <label htmlFor="unlimitedQuota" className="ml-2 block text-sm text-gray-900">
                   無限制配額
                 </label>
               </div>
+              <div className="mt-4 flex items-center">
+                <input
+                  type="checkbox"
+                  id="useAccountQuota"
+                  checked={tokenInput.useAccountQuota}
+                  onChange={(e) => handleInputChange('useAccountQuota', e.target.checked)}
+                  disabled={tokenInput.unlimitedQuota || organizationId !== 0}
+                  className="h-4 w-4 text-blue-600 focus:ring-blue-500 border-gray-300 rounded"
+                />
+                <label htmlFor="useAccountQuota" className="ml-2 block text-sm text-gray-900">
+                  使用帳戶額度
+                </label>
+              </div>
             </div>
             <div className="px-6 py-4 bg-gray-50 flex justify-end">
               <button
@@ -0,0 +1,242 @@
+import React, { useState, useEffect } from 'react';
+import { API, showError, showSuccess } from '../../utils/api';
+
+const emptyGroup = {
+  id: 0,
+  name: '',
+  description: '',
+  default_quota: 0,
+  rate_limit_num: 0,
+  rate_limit_duration: 60,
+};
+
+const Groups = () => {
+  const [groups, setGroups] = useState([]);
+  const [loading, setLoading] = useState(true);
+  const [input, setInput] = useState(emptyGroup);
+  const [moveInput, setMoveInput] = useState({ groupId: 0, userIds: '', grantQuota: true });
+
+  // 加載分組列表
+  const loadGroups = async () => {
+    setLoading(true);
+    try {
+      const res = await API.get('/api/group');
+      if (res.data.success) {
+        setGroups(res.data.data || []);
+      } else {
+        showError(res.data.message);
+      }
+    } catch (error) {
+      showError('加載分組失敗');
+      console.error(error);
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  useEffect(() => {
+    loadGroups();
+  }, []);
+
+  const handleInputChange = (name, value) => {
+    setInput((prev) => ({ ...prev, [name]: value }));
+  };
+
+  // 創建或更新分組，分組名稱創建後不可修改
+  const saveGroup = async (e) => {
+    e.preventDefault();
+    const payload = {
+      ...input,
+      default_quota: parseInt(input.default_quota) || 0,
+      rate_limit_num: parseInt(input.rate_limit_num) || 0,
+      rate_limit_duration: parseInt(input.rate_limit_duration) || 0,
+    };
+    try {
+      const res = input.id ? await API.put('/api/group', payload) : await API.post('/api/group', payload);
+      if (res.data.success) {
+        showSuccess(res.data.message);
+        setInput(emptyGroup);
+        loadGroups();
+      } else {
+        showError(res.data.message);
+      }
+    } catch (error) {
+      showError('保存失敗');
+      console.error(error);
+    }
+  };
+
+  // 刪除分組
+  const deleteGroup = async (id) => {
+    if (!window.confirm('確定要刪除此分組嗎？')) {
+      return;
+    }
+    try {
+      const res = await API.delete(`/api/group/${id}`);
+      if (res.data.success) {
+        showSuccess('刪除成功');
+        loadGroups();
+      } else {
+        showError(res.data.message);
+      }
+    } catch (error) {
+      showError('刪除失敗');
+      console.error(error);
+    }
+  };
+
+  // 將用戶移到分組
+  const moveUsers = async (e) => {
+    e.preventDefault();
+    const userIds = moveInput.userIds
+      .split(/[\s,]+/)
+      .filter(Boolean)
+      .map((id) => parseInt(id));
+    try {
+      const res = await API.post(`/api/group/${moveInput.groupId}/members`, {
+        user_ids: userIds,
+        grant_quota: moveInput.grantQuota,
+      });
+      if (res.data.success) {
+        showSuccess(res.data.message);
+        setMoveInput((prev) => ({ ...prev, userIds: '' }));
+        loadGroups();
+      } else {
+        showError(res.data.message);
+      }
+    } catch (error) {
+      showError('移動失敗');
+      console.error(error);
+    }
+  };
+
+  const inputClass =
+    'mt-1 block w-full border border-gray-300 rounded-md shadow-sm py-2 px-3 focus:outline-none focus:ring-blue-500 focus:border-blue-500 sm:text-sm';
+
+  return (
+    <div className="max-w-6xl mx-auto py-8 px-4 sm:px-6 lg:px-8">
+      <h1 className="text-2xl font-bold text-gray-900 mb-6">用戶分組</h1>
+
+      <form onSubmit={saveGroup} className="mb-8 grid grid-cols-1 gap-4 sm:grid-cols-6 items-end">
+        <div>
+          <label className="block text-sm font-medium text-gray-700">名稱</label>
+          <input
+            type="text"
+            value={input.name}
+            disabled={input.id !== 0}
+            onChange={(e) => handleInputChange('name', e.target.value)}
+            className={inputClass}
+          />
+        </div>
+        <div className="sm:col-span-2">
+          <label className="block text-sm font-medium text-gray-700">描述</label>
+          <input type="text" value={input.description} onChange={(e) => handleInputChange('description', e.target.value)} className={inputClass} />
+        </div>
+        <div>
+          <label className="block text-sm font-medium text-gray-700">默認額度</label>
+          <input type="number" min="0" value={input.default_quota} onChange={(e) => handleInputChange('default_quota', e.target.value)} className={inputClass} />
+        </div>
+        <div>
+          <label className="block text-sm font-medium text-gray-700">速率限制（次）</label>
+          <input type="number" min="0" value={input.rate_limit_num} onChange={(e) => handleInputChange('rate_limit_num', e.target.value)} className={inputClass} />
+        </div>
+        <div>
+          <label className="block text-sm font-medium text-gray-700">時間窗口（秒）</label>
+          <input type="number" min="1" value={input.rate_limit_duration} onChange={(e) => handleInputChange('rate_limit_duration', e.target.value)} className={inputClass} />
+        </div>
+        <div className="sm:col-span-6">
+          <button
+            type="submit"
+            className="px-4 py-2 bg-blue-600 text-white rounded-md hover:bg-blue-700 focus:outline-none focus:ring-2 focus:ring-offset-2 focus:ring-blue-500"
+          >
+            {input.id ? '保存分組' : '創建分組'}
+          </button>
+          {input.id !== 0 && (
+            <button type="button" onClick={() => setInput(emptyGroup)} className="ml-2 px-4 py-2 bg-gray-200 text-gray-800 rounded-md hover:bg-gray-300">
+              取消
+            </button>
+          )}
+          <span className="ml-3 text-xs text-gray-500">速率限制為 0 表示不限制，只作用於未設置速率限制的令牌</span>
+        </div>
+      </form>
+
+      {loading ? (
+        <div className="text-center py-4">載入中...</div>
+      ) : (
+        <div className="overflow-x-auto mb-8">
+          <table className="min-w-full divide-y divide-gray-200">
+            <thead className="bg-gray-50">
+              <tr>
+                {['名稱', '描述', '成員數', '默認額度', '速率限制', '操作'].map((title) => (
+                  <th key={title} className="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">
+                    {title}
+                  </th>
+                ))}
+              </tr>
+            </thead>
+            <tbody className="bg-white divide-y divide-gray-200">
+              {groups.map((group) => (
+                <tr key={group.id}>
+                  <td className="px-6 py-4 whitespace-nowrap text-sm font-medium text-gray-900">{group.name}</td>
+                  <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-500">{group.description || '-'}</td>
+                  <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-500">{group.member_count}</td>
+                  <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-500">{group.default_quota}</td>
+                  <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-500">
+                    {group.rate_limit_num > 0 ? `${group.rate_limit_num} 次 / ${group.rate_limit_duration} 秒` : '不限制'}
+                  </td>
+                  <td className="px-6 py-4 whitespace-nowrap text-sm font-medium">
+                    <div className="flex space-x-2">
+                      <button onClick={() => setInput({ ...emptyGroup, ...group })} className="text-blue-600 hover:text-blue-900">
+                        編輯
+                      </button>
+                      <button onClick={() => deleteGroup(group.id)} className="text-red-600 hover:text-red-900">
+                        刪除
+                      </button>
+                    </div>
+                  </td>
+                </tr>
+              ))}
+            </tbody>
+          </table>
+        </div>
+      )}
+
+      <h2 className="text-lg font-medium text-gray-900 mb-4">移動用戶</h2>
+      <form onSubmit={moveUsers} className="flex flex-wrap items-center gap-2">
+        <input
+          type="text"
+          value={moveInput.userIds}
+          placeholder="用戶 ID，以逗號分隔"
+          onChange={(e) => setMoveInput((prev) => ({ ...prev, userIds: e.target.value }))}
+          className="flex-1 min-w-0 border border-gray-300 rounded-md py-2 px-3 text-sm focus:outline-none focus:ring-blue-500 focus:border-blue-500"
+        />
+        <select
+          value={moveInput.groupId}
+          onChange={(e) => setMoveInput((prev) => ({ ...prev, groupId: e.target.value }))}
+          className="border border-gray-300 rounded-md py-2 px-3 text-sm"
+        >
+          <option value={0}>選擇分組</option>
+          {groups.map((group) => (
+            <option key={group.id} value={group.id}>
+              {group.name}
+            </option>
+          ))}
+        </select>
+        <label className="flex items-center text-sm text-gray-700">
+          <input
+            type="checkbox"
+            checked={moveInput.grantQuota}
+            onChange={(e) => setMoveInput((prev) => ({ ...prev, grantQuota: e.target.checked }))}
+            className="h-4 w-4 mr-1 text-blue-600 border-gray-300 rounded"
+          />
+          發放默認額度
+        </label>
+        <button type="submit" className="px-4 py-2 bg-blue-600 text-white rounded-md text-sm hover:bg-blue-700">
+          移動
+        </button>
+      </form>
+    </div>
+  );
+};
+
+export default Groups;
@@ -0,0 +1,233 @@
+import React, { useState, useEffect } from 'react';
+import { API, showError, showSuccess } from '../../utils/api';
+
+// 將剛生成的兌換碼導出為 CSV，明文只在生成時返回一次
+const downloadCodes = (codes) => {
+  const rows = [['name', 'code', 'quota', 'max_uses', 'expired_time']];
+  codes.forEach((code) => {
+    rows.push([code.name, code.code, code.quota, code.max_uses, code.expired_time || '']);
+  });
+  const csv = rows.map((row) => row.map((v) => `"${String(v).replace(/"/g, '""')}"`).join(',')).join('\n');
+  const url = URL.createObjectURL(new Blob([csv], { type: 'text/csv;charset=utf-8' }));
+  const link = document.createElement('a');
+  link.href = url;
+  link.download = `redemption-codes-${Date.now()}.csv`;
+  link.click();
+  URL.revokeObjectURL(url);
+};
+
+const Redemptions = () => {
+  const [codes, setCodes] = useState([]);
+  const [loading, setLoading] = useState(true);
+  const [page, setPage] = useState(1);
+  const [totalPages, setTotalPages] = useState(1);
+  const [input, setInput] = useState({
+    name: '',
+    quota: 100,
+    count: 10,
+    maxUses: 1,
+    expiredTime: '',
+  });
+
+  // 加載兌換碼列表
+  const loadCodes = async (pageNum = 1) => {
+    setLoading(true);
+    try {
+      const res = await API.get(`/api/redemption?page=${pageNum}&page_size=10`);
+      if (res.data.success) {
+        setCodes(res.data.data || []);
+        setTotalPages(Math.max(1, Math.ceil(res.data.total / 10)));
+      } else {
+        showError(res.data.message);
+      }
+    } catch (error) {
+      showError('加載兌換碼失敗');
+      console.error(error);
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  useEffect(() => {
+    loadCodes(page);
+  }, [page]);
+
+  const handleInputChange = (name, value) => {
+    setInput((prev) => ({ ...prev, [name]: value }));
+  };
+
+  // 生成兌換碼並立即導出
+  const generateCodes = async (e) => {
+    e.preventDefault();
+    try {
+      const res = await API.post('/api/redemption', {
+        name: input.name,
+        quota: parseInt(input.quota) || 0,
+        count: parseInt(input.count) || 0,
+        max_uses: parseInt(input.maxUses) || 1,
+        expired_time: input.expiredTime ? new Date(input.expiredTime).toISOString() : null,
+      });
+      if (res.data.success) {
+        downloadCodes(res.data.data);
+        showSuccess(res.data.message);
+        loadCodes(1);
+        setPage(1);
+      } else {
+        showError(res.data.message);
+      }
+    } catch (error) {
+      showError('生成失敗');
+      console.error(error);
+    }
+  };
+
+  // 啟用或停用兌換碼
+  const updateStatus = async (id, status) => {
+    try {
+      const res = await API.put('/api/redemption', { id, status });
+      if (res.data.success) {
+        showSuccess('更新成功');
+        loadCodes(page);
+      } else {
+        showError(res.data.message);
+      }
+    } catch (error) {
+      showError('更新失敗');
+      console.error(error);
+    }
+  };
+
+  // 刪除兌換碼
+  const deleteCode = async (id) => {
+    if (!window.confirm('確定要刪除此兌換碼嗎？')) {
+      return;
+    }
+    try {
+      const res = await API.delete(`/api/redemption/${id}`);
+      if (res.data.success) {
+        showSuccess('刪除成功');
+        loadCodes(page);
+      } else {
+        showError(res.data.message);
+      }
+    } catch (error) {
+      showError('刪除失敗');
+      console.error(error);
+    }
+  };
+
+  const inputClass =
+    'mt-1 block w-full border border-gray-300 rounded-md shadow-sm py-2 px-3 focus:outline-none focus:ring-blue-500 focus:border-blue-500 sm:text-sm';
+
+  return (
+    <div className="max-w-6xl mx-auto py-8 px-4 sm:px-6 lg:px-8">
+      <h1 className="text-2xl font-bold text-gray-900 mb-6">兌換碼管理</h1>
+
+      <form onSubmit={generateCodes} className="mb-8 grid grid-cols-1 gap-4 sm:grid-cols-6 items-end">
+        <div className="sm:col-span-2">
+          <label className="block text-sm font-medium text-gray-700">批次名稱</label>
+          <input type="text" value={input.name} onChange={(e) => handleInputChange('name', e.target.value)} className={inputClass} />
+        </div>
+        <div>
+          <label className="block text-sm font-medium text-gray-700">額度</label>
+          <input type="number" min="1" value={input.quota} onChange={(e) => handleInputChange('quota', e.target.value)} className={inputClass} />
+        </div>
+        <div>
+          <label className="block text-sm font-medium text-gray-700">數量</label>
+          <input type="number" min="1" max="1000" value={input.count} onChange={(e) => handleInputChange('count', e.target.value)} className={inputClass} />
+        </div>
+        <div>
+          <label className="block text-sm font-medium text-gray-700">可用次數</label>
+          <input type="number" min="1" value={input.maxUses} onChange={(e) => handleInputChange('maxUses', e.target.value)} className={inputClass} />
+        </div>
+        <div>
+          <label className="block text-sm font-medium text-gray-700">過期時間</label>
+          <input type="datetime-local" value={input.expiredTime} onChange={(e) => handleInputChange('expiredTime', e.target.value)} className={inputClass} />
+        </div>
+        <div className="sm:col-span-6">
+          <button
+            type="submit"
+            className="px-4 py-2 bg-blue-600 text-white rounded-md hover:bg-blue-700 focus:outline-none focus:ring-2 focus:ring-offset-2 focus:ring-blue-500"
+          >
+            生成並導出
+          </button>
+          <span className="ml-3 text-xs text-gray-500">兌換碼只在生成時導出一次，請妥善保存 CSV 文件</span>
+        </div>
+      </form>
+
+      {loading ? (
+        <div className="text-center py-4">載入中...</div>
+      ) : codes.length === 0 ? (
+        <div className="text-center py-4 text-gray-500">暫無兌換碼</div>
+      ) : (
+        <div className="overflow-x-auto">
+          <table className="min-w-full divide-y divide-gray-200">
+            <thead className="bg-gray-50">
+              <tr>
+                {['批次', '兌換碼', '額度', '已用 / 可用', '狀態', '過期時間', '操作'].map((title) => (
+                  <th key={title} className="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">
+                    {title}
+                  </th>
+                ))}
+              </tr>
+            </thead>
+            <tbody className="bg-white divide-y divide-gray-200">
+              {codes.map((code) => (
+                <tr key={code.id}>
+                  <td className="px-6 py-4 whitespace-nowrap text-sm font-medium text-gray-900">{code.name}</td>
+                  <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-500">
+                    <span className="font-mono">{code.code_prefix}…</span>
+                  </td>
+                  <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-500">{code.quota}</td>
+                  <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-500">
+                    {code.used_count} / {code.max_uses}
+                  </td>
+                  <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-500">
+                    {code.status === 1 ? '啟用' : '停用'}
+                  </td>
+                  <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-500">
+                    {code.expired_time ? new Date(code.expired_time).toLocaleString() : '永不過期'}
+                  </td>
+                  <td className="px-6 py-4 whitespace-nowrap text-sm font-medium">
+                    <div className="flex space-x-2">
+                      <button
+                        onClick={() => updateStatus(code.id, code.status === 1 ? 2 : 1)}
+                        className="text-yellow-600 hover:text-yellow-900"
+                      >
+                        {code.status === 1 ? '停用' : '啟用'}
+                      </button>
+                      <button onClick={() => deleteCode(code.id)} className="text-red-600 hover:text-red-900">
+                        刪除
+                      </button>
+                    </div>
+                  </td>
+                </tr>
+              ))}
+            </tbody>
+          </table>
+          <div className="mt-4 flex justify-end space-x-2">
+            <button
+              onClick={() => setPage(page - 1)}
+              disabled={page <= 1}
+              className="px-3 py-1 border border-gray-300 rounded-md text-sm disabled:opacity-50"
+            >
+              上一頁
+            </button>
+            <span className="px-3 py-1 text-sm text-gray-700">
+              {page} / {totalPages}
+            </span>
+            <button
+              onClick={() => setPage(page + 1)}
+              disabled={page >= totalPages}
+              className="px-3 py-1 border border-gray-300 rounded-md text-sm disabled:opacity-50"
+            >
+              下一頁
+            </button>
+          </div>
+        </div>
+      )}
+    </div>
+  );
+};
+
+export default Redemptions;
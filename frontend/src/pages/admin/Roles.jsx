@@ -0,0 +1,236 @@
+import React, { useState, useEffect, useContext } from 'react';
+import { AuthContext, hasPermission } from '../../context/AuthContext';
+import { API, showError, showSuccess } from '../../utils/api';
+
+const levelNames = {
+  0: '訪客',
+  1: '普通用戶',
+  10: '管理員',
+  100: '超級管理員',
+};
+
+const permissionNames = {
+  'user.read': '查看用戶',
+  'user.create': '創建用戶',
+  'user.update': '修改用戶資料',
+  'user.manage': '啟用禁用、升降級和分配角色',
+  'user.delete': '刪除用戶',
+  'role.read': '查看角色',
+  'role.manage': '管理角色',
+};
+
+const emptyRole = {
+  id: 0,
+  name: '',
+  description: '',
+  level: 1,
+  permissions: [],
+};
+
+const Roles = () => {
+  const { user } = useContext(AuthContext);
+  const [roles, setRoles] = useState([]);
+  const [permissions, setPermissions] = useState([]);
+  const [loading, setLoading] = useState(true);
+  const [input, setInput] = useState(emptyRole);
+  const canManage = hasPermission(user, 'role.manage');
+
+  // 加載角色和可授予的權限
+  const loadRoles = async () => {
+    setLoading(true);
+    try {
+      const [roleRes, permissionRes] = await Promise.all([API.get('/api/role'), API.get('/api/role/permissions')]);
+      if (roleRes.data.success) {
+        setRoles(roleRes.data.data || []);
+      } else {
+        showError(roleRes.data.message);
+      }
+      if (permissionRes.data.success) {
+        setPermissions(permissionRes.data.data || []);
+      }
+    } catch (error) {
+      showError('加載角色失敗');
+      console.error(error);
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  useEffect(() => {
+    loadRoles();
+  }, []);
+
+  const togglePermission = (permission) => {
+    setInput((prev) => ({
+      ...prev,
+      permissions: prev.permissions.includes(permission)
+        ? prev.permissions.filter((p) => p !== permission)
+        : [...prev.permissions, permission],
+    }));
+  };
+
+  // 創建或更新角色，角色名稱和等級創建後不可修改
+  const saveRole = async (e) => {
+    e.preventDefault();
+    const payload = { ...input, level: parseInt(input.level) || 0 };
+    try {
+      const res = input.id ? await API.put('/api/role', payload) : await API.post('/api/role', payload);
+      if (res.data.success) {
+        showSuccess(res.data.message);
+        setInput(emptyRole);
+        loadRoles();
+      } else {
+        showError(res.data.message);
+      }
+    } catch (error) {
+      showError('保存失敗');
+      console.error(error);
+    }
+  };
+
+  // 刪除角色
+  const deleteRole = async (id) => {
+    if (!window.confirm('確定要刪除此角色嗎？')) {
+      return;
+    }
+    try {
+      const res = await API.delete(`/api/role/${id}`);
+      if (res.data.success) {
+        showSuccess('刪除成功');
+        loadRoles();
+      } else {
+        showError(res.data.message);
+      }
+    } catch (error) {
+      showError('刪除失敗');
+      console.error(error);
+    }
+  };
+
+  const inputClass =
+    'mt-1 block w-full border border-gray-300 rounded-md shadow-sm py-2 px-3 focus:outline-none focus:ring-blue-500 focus:border-blue-500 sm:text-sm';
+
+  return (
+    <div className="max-w-6xl mx-auto py-8 px-4 sm:px-6 lg:px-8">
+      <h1 className="text-2xl font-bold text-gray-900 mb-6">角色權限</h1>
+
+      {canManage && (
+        <form onSubmit={saveRole} className="mb-8 grid grid-cols-1 gap-4 sm:grid-cols-4 items-end">
+          <div>
+            <label className="block text-sm font-medium text-gray-700">名稱</label>
+            <input
+              type="text"
+              value={input.name}
+              disabled={input.id !== 0}
+              onChange={(e) => setInput((prev) => ({ ...prev, name: e.target.value }))}
+              className={inputClass}
+            />
+          </div>
+          <div className="sm:col-span-2">
+            <label className="block text-sm font-medium text-gray-700">描述</label>
+            <input
+              type="text"
+              value={input.description}
+              onChange={(e) => setInput((prev) => ({ ...prev, description: e.target.value }))}
+              className={inputClass}
+            />
+          </div>
+          <div>
+            <label className="block text-sm font-medium text-gray-700">等級</label>
+            <select
+              value={input.level}
+              disabled={input.id !== 0}
+              onChange={(e) => setInput((prev) => ({ ...prev, level: e.target.value }))}
+              className={inputClass}
+            >
+              {[0, 1, 10].map((level) => (
+                <option key={level} value={level}>
+                  {levelNames[level]}
+                </option>
+              ))}
+            </select>
+          </div>
+          <div className="sm:col-span-4 flex flex-wrap gap-4">
+            {permissions.map((permission) => (
+              <label key={permission} className="flex items-center text-sm text-gray-700">
+                <input
+                  type="checkbox"
+                  checked={input.permissions.includes(permission)}
+                  onChange={() => togglePermission(permission)}
+                  className="h-4 w-4 mr-1 text-blue-600 border-gray-300 rounded"
+                />
+                {permissionNames[permission] || permission}
+              </label>
+            ))}
+          </div>
+          <div className="sm:col-span-4">
+            <button
+              type="submit"
+              className="px-4 py-2 bg-blue-600 text-white rounded-md hover:bg-blue-700 focus:outline-none focus:ring-2 focus:ring-offset-2 focus:ring-blue-500"
+            >
+              {input.id ? '保存角色' : '創建角色'}
+            </button>
+            {input.id !== 0 && (
+              <button type="button" onClick={() => setInput(emptyRole)} className="ml-2 px-4 py-2 bg-gray-200 text-gray-800 rounded-md hover:bg-gray-300">
+                取消
+              </button>
+            )}
+            <span className="ml-3 text-xs text-gray-500">等級決定用戶能操作哪些用戶，只能授予自己擁有的權限</span>
+          </div>
+        </form>
+      )}
+
+      {loading ? (
+        <div className="text-center py-4">載入中...</div>
+      ) : (
+        <div className="overflow-x-auto">
+          <table className="min-w-full divide-y divide-gray-200">
+            <thead className="bg-gray-50">
+              <tr>
+                {['名稱', '描述', '等級', '權限', '用戶數', '操作'].map((title) => (
+                  <th key={title} className="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">
+                    {title}
+                  </th>
+                ))}
+              </tr>
+            </thead>
+            <tbody className="bg-white divide-y divide-gray-200">
+              {roles.map((role) => (
+                <tr key={role.id}>
+                  <td className="px-6 py-4 whitespace-nowrap text-sm font-medium text-gray-900">
+                    {role.name}
+                    {role.built_in && <span className="ml-1 text-xs text-gray-400">內置</span>}
+                  </td>
+                  <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-500">{role.description || '-'}</td>
+                  <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-500">{levelNames[role.level] || role.level}</td>
+                  <td className="px-6 py-4 text-sm text-gray-500">
+                    {role.permissions.includes('*')
+                      ? '所有權限'
+                      : role.permissions.map((p) => permissionNames[p] || p).join('、') || '-'}
+                  </td>
+                  <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-500">{role.member_count}</td>
+                  <td className="px-6 py-4 whitespace-nowrap text-sm font-medium">
+                    {canManage && role.level < user.role && (
+                      <div className="flex space-x-2">
+                        <button onClick={() => setInput({ ...emptyRole, ...role })} className="text-blue-600 hover:text-blue-900">
+                          編輯
+                        </button>
+                        {!role.built_in && (
+                          <button onClick={() => deleteRole(role.id)} className="text-red-600 hover:text-red-900">
+                            刪除
+                          </button>
+                        )}
+                      </div>
+                    )}
+                  </td>
+                </tr>
+              ))}
+            </tbody>
+          </table>
+        </div>
+      )}
+    </div>
+  );
+};
+
+export default Roles;
@@ -3,6 +3,7 @@ import { API, showError, showSuccess } from '../../utils/api';
 
 const Users = () => {
   const [users, setUsers] = useState([]);
+  const [roles, setRoles] = useState([]);
   const [loading, setLoading] = useState(true);
   const [modalOpen, setModalOpen] = useState(false);
   const [editingUser, setEditingUser] = useState(null);
@@ -46,6 +47,33 @@ const Users = () => {
     loadUsers(page, searchKeyword);
   }, [page, searchKeyword]);
 
+  // 加載角色列表，沒有查看角色權限時只顯示用戶等級
+  useEffect(() => {
+    API.get('/api/role')
+      .then((res) => {
+        if (res.data.success) {
+          setRoles(res.data.data || []);
+        }
+      })
+      .catch((error) => console.error(error));
+  }, []);
+
+  // 為用戶分配角色
+  const assignRole = async (id, roleId) => {
+    try {
+      const res = await API.post('/api/user/role', { id, role_id: parseInt(roleId) });
+      if (res.data.success) {
+        showSuccess(res.data.message);
+        loadUsers(page, searchKeyword);
+      } else {
+        showError(res.data.message);
+      }
+    } catch (error) {
+      showError('分配角色失敗');
+      console.error(error);
+    }
+  };
+
   // 處理輸入變化
   const handleInputChange = (name, value) => {
     setUserInput((prev) => ({ ...prev, [name]: value }));
@@ -137,6 +165,43 @@ const Users = () => {
     }
   };
 
+  // 解除登入鎖定
+  const unlockUser = async (id) => {
+    try {
+      const res = await API.delete(`/api/user/${id}/lockout`);
+      if (res.data.success) {
+        showSuccess(res.data.message);
+        loadUsers(page, searchKeyword);
+      } else {
+        showError(res.data.message);
+      }
+    } catch (error) {
+      showError('解除鎖定失敗');
+      console.error(error);
+    }
+  };
+
+  // 啟用、禁用、升級或降級用戶
+  const manageUser = async (id, action) => {
+    if (action === 'disable' && !window.confirm('禁用後將撤銷該用戶的所有會話和令牌，確定要禁用嗎？')) {
+      return;
+    }
+    try {
+      const res = await API.post('/api/user/manage', { id, action });
+      if (res.data.success) {
+        showSuccess(res.data.message);
+        loadUsers(page, searchKeyword);
+      } else {
+        showError(res.data.message);
+      }
+    } catch (error) {
+      showError('操作失敗');
+      console.error(error);
+    }
+  };
+
+  const isLocked = (user) => user.locked_until && new Date(user.locked_until) > new Date();
+
   // 處理搜索
   const handleSearch = (e) => {
     e.preventDefault();
@@ -204,6 +269,9 @@ const Users = () => {
                 <th className="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">
                   角色
                 </th>
+                <th className="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">
+                  分組 / 額度
+                </th>
                 <th className="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">
                   狀態
                 </th>
@@ -228,7 +296,19 @@ const Users = () => {
                     {user.email || '-'}
                   </td>
                   <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-500">
-                    {user.role === 100 ? (
+                    {roles.length > 0 ? (
+                      <select
+                        value={user.role_id}
+                        onChange={(e) => assignRole(user.id, e.target.value)}
+                        className="border border-gray-300 rounded-md py-1 px-2 text-sm"
+                      >
+                        {roles.map((role) => (
+                          <option key={role.id} value={role.id}>
+                            {role.description || role.name}
+                          </option>
+                        ))}
+                      </select>
+                    ) : user.role === 100 ? (
                       <span className="px-2 inline-flex text-xs leading-5 font-semibold rounded-full bg-purple-100 text-purple-800">
                         超級管理員
                       </span>
@@ -242,6 +322,9 @@ const Users = () => {
                       </span>
                     )}
                   </td>
+                  <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-500">
+                    {user.group} / {user.quota}
+                  </td>
                   <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-500">
                     <span
                       className={`px-2 inline-flex text-xs leading-5 font-semibold rounded-full ${
@@ -252,6 +335,14 @@ const Users = () => {
                     >
                       {user.status === 1 ? '啟用' : '禁用'}
                     </span>
+                    {isLocked(user) && (
+                      <span
+                        className="ml-1 px-2 inline-flex text-xs leading-5 font-semibold rounded-full bg-yellow-100 text-yellow-800"
+                        title={`鎖定至 ${new Date(user.locked_until).toLocaleString()}`}
+                      >
+                        已鎖定
+                      </span>
+                    )}
                   </td>
                   <td className="px-6 py-4 whitespace-nowrap text-sm font-medium">
                     <div className="flex space-x-2">
@@ -261,6 +352,32 @@ const Users = () => {
                       >
                         編輯
                       </button>
+                      <button
+                        onClick={() => manageUser(user.id, user.status === 1 ? 'disable' : 'enable')}
+                        className="text-yellow-600 hover:text-yellow-900"
+                      >
+                        {user.status === 1 ? '禁用' : '啟用'}
+                      </button>
+                      <button
+                        onClick={() => manageUser(user.id, 'promote')}
+                        className="text-green-600 hover:text-green-900"
+                      >
+                        升級
+                      </button>
+                      <button
+                        onClick={() => manageUser(user.id, 'demote')}
+                        className="text-gray-600 hover:text-gray-900"
+                      >
+                        降級
+                      </button>
+                      {(isLocked(user) || user.failed_login_count > 0) && (
+                        <button
+                          onClick={() => unlockUser(user.id)}
+                          className="text-yellow-600 hover:text-yellow-900"
+                        >
+                          解鎖
+                        </button>
+                      )}
                       <button
                         onClick={() => deleteUser(user.id)}
                         className="text-red-600 hover:text-red-900"
@@ -372,33 +489,38 @@ const Users = () => {
                     className="mt-1 block w-full border border-gray-300 rounded-md shadow-sm py-2 px-3 focus:outline-none focus:ring-blue-500 focus:border-blue-500 sm:text-sm"
                   />
                 </div>
-                <div>
-                  <label className="block text-sm font-medium text-gray-700">
-                    角色
-                  </label>
-                  <select
-                    value={userInput.role}
-                    onChange={(e) => handleInputChange('role', e.target.value)}
-                    className="mt-1 block w-full border border-gray-300 rounded-md shadow-sm py-2 px-3 focus:outline-none focus:ring-blue-500 focus:border-blue-500 sm:text-sm"
-                  >
-                    <option value={1}>普通用戶</option>
-                    <option value={10}>管理員</option>
-                    <option value={100}>超級管理員</option>
-                  </select>
-                </div>
-                <div>
-                  <label className="block text-sm font-medium text-gray-700">
-                    狀態
-                  </label>
-                  <select
-                    value={userInput.status}
-                    onChange={(e) => handleInputChange('status', e.target.value)}
-                    className="mt-1 block w-full border border-gray-300 rounded-md shadow-sm py-2 px-3 focus:outline-none focus:ring-blue-500 focus:border-blue-500 sm:text-sm"
-                  >
-                    <option value={1}>啟用</option>
-                    <option value={2}>禁用</option>
-                  </select>
-                </div>
+                {/* 角色和狀態只在創建時設置，之後通過列表中的操作修改 */}
+                {!editingUser && (
+                  <>
+                    <div>
+                      <label className="block text-sm font-medium text-gray-700">
+                        角色
+                      </label>
+                      <select
+                        value={userInput.role}
+                        onChange={(e) => handleInputChange('role', e.target.value)}
+                        className="mt-1 block w-full border border-gray-300 rounded-md shadow-sm py-2 px-3 focus:outline-none focus:ring-blue-500 focus:border-blue-500 sm:text-sm"
+                      >
+                        <option value={1}>普通用戶</option>
+                        <option value={10}>管理員</option>
+                        <option value={100}>超級管理員</option>
+                      </select>
+                    </div>
+                    <div>
+                      <label className="block text-sm font-medium text-gray-700">
+                        狀態
+                      </label>
+                      <select
+                        value={userInput.status}
+                        onChange={(e) => handleInputChange('status', e.target.value)}
+                        className="mt-1 block w-full border border-gray-300 rounded-md shadow-sm py-2 px-3 focus:outline-none focus:ring-blue-500 focus:border-blue-500 sm:text-sm"
+                      >
+                        <option value={1}>啟用</option>
+                        <option value={2}>禁用</option>
+                      </select>
+                    </div>
+                  </>
+                )}
               </div>
             </div>
             <div className="px-6 py-4 bg-gray-50 flex justify-end">